@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/arm/resources/resources"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// createNetworkAlert creates a metric alert firing when the VM's outbound traffic exceeds the configured
+// threshold, notifying the configured action group.
+func createNetworkAlert(vmName string, alert networkAlert) {
+	name := vmName + "-network-out"
+	stepf("Create metric alert '%s'\n", name)
+	vm, err := vmClient.Get(groupName, vmName, "")
+	onErrorFail(err, "Get failed")
+
+	windowSize := alert.WindowSize
+	if windowSize == "" {
+		windowSize = "PT5M"
+	}
+	rule := resources.GenericResource{
+		// Metric alerts aren't regional.
+		Location: to.StringPtr("global"),
+		Tags:     resourceTags(),
+		Properties: &map[string]interface{}{
+			"description":         fmt.Sprintf("VM '%s' sent more than %.0f bytes in %s", vmName, alert.ThresholdBytes, windowSize),
+			"severity":            alert.Severity,
+			"enabled":             true,
+			"scopes":              []string{*vm.ID},
+			"evaluationFrequency": "PT1M",
+			"windowSize":          windowSize,
+			"criteria": map[string]interface{}{
+				"odata.type": "Microsoft.Azure.Monitor.SingleResourceMultipleMetricCriteria",
+				"allOf": []interface{}{map[string]interface{}{
+					"name":            "NetworkOut",
+					"criterionType":   "StaticThresholdCriterion",
+					"metricName":      "Network Out Total",
+					"metricNamespace": "Microsoft.Compute/virtualMachines",
+					"operator":        "GreaterThan",
+					"timeAggregation": "Total",
+					"threshold":       alert.ThresholdBytes,
+				}},
+			},
+			"actions": []interface{}{map[string]interface{}{"actionGroupId": alert.ActionGroupID}},
+		},
+	}
+
+	client := genericClient
+	client.APIVersion = genericAPIVersions["microsoft.insights/metricalerts"]
+	id := strings.TrimPrefix(resourceID("Microsoft.Insights/metricAlerts", name), "/")
+	_, err = client.CreateOrUpdateByID(id, rule, nil)
+	onErrorFail(err, "CreateOrUpdateByID failed")
+
+	rule, err = client.GetByID(id)
+	onErrorFail(err, "GetByID failed")
+	recordCreated("alert", client.APIVersion, rule.ID, rule)
+}
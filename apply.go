@@ -0,0 +1,635 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// topologySpec is the desired network topology of a resource group, read by apply -f.
+type topologySpec struct {
+	// ResourceGroup is the resource group the topology lives in, the sample's by default. It must exist.
+	ResourceGroup string `json:"resourceGroup"`
+
+	// Location is the region of the resources, the sample's by default.
+	Location string `json:"location"`
+
+	VNets     []vnetSpec `json:"vnets"`
+	PublicIPs []pipSpec  `json:"publicIps"`
+	NICs      []nicSpec  `json:"nics"`
+}
+
+type vnetSpec struct {
+	Name         string       `json:"name"`
+	AddressSpace []string     `json:"addressSpace"`
+	Subnets      []subnetSpec `json:"subnets"`
+}
+
+type subnetSpec struct {
+	Name          string `json:"name"`
+	AddressPrefix string `json:"addressPrefix"`
+}
+
+type pipSpec struct {
+	Name string `json:"name"`
+
+	// Allocation is Dynamic, the default, or Static.
+	Allocation string `json:"allocation"`
+
+	// Tags must be set on the public IP, which may have others.
+	Tags map[string]string `json:"tags"`
+}
+
+type nicSpec struct {
+	Name string `json:"name"`
+
+	// Subnet is "vnet/subnet", only the subnet's name if the spec has a single VNet, or the resource ID
+	// of a subnet outside the spec.
+	Subnet string `json:"subnet"`
+
+	// PrivateIP is a static private IP, allocated dynamically when empty.
+	PrivateIP string `json:"privateIp"`
+
+	// PublicIP and NSG are the names of a public IP of the spec and of an NSG of the resource group.
+	PublicIP     string `json:"publicIp"`
+	NSG          string `json:"nsg"`
+	IPForwarding bool   `json:"ipForwarding"`
+
+	// Tags must be set on the NIC, which may have others.
+	Tags map[string]string `json:"tags"`
+}
+
+// specAction is a change to bring a resource to its desired state.
+type specAction struct {
+	verb   string
+	kind   string
+	name   string
+	detail string
+	apply  func() error
+}
+
+func (a specAction) String() string {
+	s := fmt.Sprintf("%s %s '%s'", a.verb, a.kind, a.name)
+	if a.detail != "" {
+		s += ": " + a.detail
+	}
+	return s
+}
+
+// applySpec creates, updates and, with -prune, deletes the VNets, subnets, public IPs and NICs of a resource
+// group to match a topology spec, after printing the actions and asking for confirmation.
+func applySpec(args []string) {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	file := fs.String("f", "", "path of the YAML or JSON topology spec")
+	prune := fs.Bool("prune", false, "also delete the VNets, subnets, public IPs and NICs of the resource group missing from the spec")
+	dryRun := fs.Bool("dry-run", false, "only print the actions")
+	fs.Parse(args)
+	if *file == "" || fs.NArg() > 0 {
+		fmt.Println("Usage: apply -f topology.yaml [-prune] [-dry-run]")
+		os.Exit(1)
+	}
+	spec, err := loadSpec(*file)
+	onErrorFail(err, "Reading the spec failed")
+	actions, err := planSpec(spec, *prune)
+	onErrorFail(err, "Planning failed")
+	if len(actions) == 0 {
+		fmt.Println("The resource group matches the spec")
+		return
+	}
+	for _, a := range actions {
+		fmt.Println(a)
+	}
+	if *dryRun || !confirm(fmt.Sprintf("Apply these %d actions?", len(actions))) {
+		return
+	}
+	onErrorFail(applyActions(actions), "Apply failed")
+	fmt.Printf("Applied %d actions\n", len(actions))
+}
+
+// loadSpec reads and checks a topology spec, defaulting its resource group and location to the sample's.
+func loadSpec(path string) (topologySpec, error) {
+	var spec topologySpec
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return spec, err
+	}
+	if err = unmarshalYAML(b, &spec); err != nil {
+		return spec, fmt.Errorf("%s: %s", path, err)
+	}
+	if spec.ResourceGroup == "" {
+		spec.ResourceGroup = groupName
+	}
+	if spec.Location == "" {
+		spec.Location = westUS
+	}
+
+	pips := map[string]bool{}
+	for _, p := range spec.PublicIPs {
+		if p.Name == "" {
+			return spec, fmt.Errorf("%s: a public IP has no name", path)
+		}
+		switch network.IPAllocationMethod(p.Allocation) {
+		case "", network.Dynamic, network.Static:
+		default:
+			return spec, fmt.Errorf("%s: allocation of public IP '%s' must be Dynamic or Static", path, p.Name)
+		}
+		pips[p.Name] = true
+	}
+	for _, v := range spec.VNets {
+		if v.Name == "" || len(v.AddressSpace) == 0 {
+			return spec, fmt.Errorf("%s: every VNet needs a name and an addressSpace", path)
+		}
+		for _, s := range v.Subnets {
+			if s.Name == "" || s.AddressPrefix == "" {
+				return spec, fmt.Errorf("%s: every subnet of VNet '%s' needs a name and an addressPrefix", path, v.Name)
+			}
+		}
+	}
+	for _, n := range spec.NICs {
+		if n.Name == "" {
+			return spec, fmt.Errorf("%s: a NIC has no name", path)
+		}
+		if _, err := spec.subnetID(n); err != nil {
+			return spec, fmt.Errorf("%s: %s", path, err)
+		}
+		if n.PublicIP != "" && !pips[n.PublicIP] {
+			return spec, fmt.Errorf("%s: public IP '%s' of NIC '%s' isn't in the spec", path, n.PublicIP, n.Name)
+		}
+	}
+	return spec, nil
+}
+
+// subnetID returns the resource ID of a NIC's subnet.
+func (spec topologySpec) subnetID(n nicSpec) (string, error) {
+	if strings.HasPrefix(n.Subnet, "/subscriptions/") {
+		return n.Subnet, nil
+	}
+	parts := strings.Split(n.Subnet, "/")
+	if len(parts) == 1 && len(spec.VNets) == 1 {
+		parts = []string{spec.VNets[0].Name, parts[0]}
+	}
+	if len(parts) == 2 {
+		for _, v := range spec.VNets {
+			for _, s := range v.Subnets {
+				if v.Name == parts[0] && s.Name == parts[1] {
+					return spec.specResourceID("Microsoft.Network/virtualNetworks/subnets", v.Name+"/"+s.Name), nil
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("subnet '%s' of NIC '%s' isn't in the spec, use vnet/subnet or a subnet ID", n.Subnet, n.Name)
+}
+
+// specTags returns tags in the form of the SDK's models, or nil if there are none.
+func specTags(tags map[string]string) *map[string]*string {
+	if len(tags) == 0 {
+		return nil
+	}
+	result := map[string]*string{}
+	for k, v := range tags {
+		result[k] = to.StringPtr(v)
+	}
+	return &result
+}
+
+// mergeTags sets tags on top of the existing ones.
+func mergeTags(existing *map[string]*string, tags map[string]string) *map[string]*string {
+	if len(tags) == 0 {
+		return existing
+	}
+	result := map[string]*string{}
+	if existing != nil {
+		for k, v := range *existing {
+			result[k] = v
+		}
+	}
+	for k, v := range tags {
+		result[k] = to.StringPtr(v)
+	}
+	return &result
+}
+
+// specResourceID returns the ID of a resource of the spec's resource group.
+func (spec topologySpec) specResourceID(resourceType, name string) string {
+	return groupID(groupClient.SubscriptionID, spec.ResourceGroup).Child(resourceType, name).String()
+}
+
+// planSpec compares the spec with the live resources and returns the actions to make them match, in an order
+// that respects their dependencies: VNets, subnets, public IPs and NICs are created or updated in that
+// order, then deleted in the reverse one.
+func planSpec(spec topologySpec, prune bool) ([]specAction, error) {
+	group := spec.ResourceGroup
+	actions, deletions := []specAction{}, []specAction{}
+
+	liveVNets, err := listGroupVNets(group)
+	if err != nil {
+		return nil, err
+	}
+	wantedVNets := map[string]bool{}
+	for _, v := range spec.VNets {
+		v := v
+		wantedVNets[strings.ToLower(v.Name)] = true
+		live, err := vNetClient.Get(group, v.Name, "")
+		if isNotFound(live.Response) {
+			actions = append(actions, specAction{"create", "VNet", v.Name, strings.Join(v.AddressSpace, ", "), func() error {
+				subnets := []network.Subnet{}
+				for _, s := range v.Subnets {
+					subnets = append(subnets, network.Subnet{Name: to.StringPtr(s.Name),
+						SubnetPropertiesFormat: &network.SubnetPropertiesFormat{AddressPrefix: to.StringPtr(s.AddressPrefix)}})
+				}
+				prefixes := append([]string{}, v.AddressSpace...)
+				_, err := vNetClient.CreateOrUpdate(group, v.Name, network.VirtualNetwork{
+					Location: to.StringPtr(spec.Location),
+					VirtualNetworkPropertiesFormat: &network.VirtualNetworkPropertiesFormat{
+						AddressSpace: &network.AddressSpace{AddressPrefixes: &prefixes},
+						Subnets:      &subnets,
+					},
+				}, nil)
+				if err != nil {
+					return err
+				}
+				vNet, err := vNetClient.Get(group, v.Name, "")
+				if err == nil {
+					resourceCreated("vnet", vNetClient.APIVersion, vNet.ID, vNet)
+				}
+				return err
+			}})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		current := []string{}
+		if live.VirtualNetworkPropertiesFormat != nil && live.AddressSpace != nil && live.AddressSpace.AddressPrefixes != nil {
+			current = *live.AddressSpace.AddressPrefixes
+		}
+		if !sameStrings(current, v.AddressSpace) {
+			actions = append(actions, specAction{"update", "VNet", v.Name,
+				fmt.Sprintf("address space %s -> %s", strings.Join(current, ", "), strings.Join(v.AddressSpace, ", ")), func() error {
+					// The VNet is written back with its subnets, which a PUT without them would delete.
+					vNet, err := vNetClient.Get(group, v.Name, "")
+					if err != nil {
+						return err
+					}
+					prefixes := append([]string{}, v.AddressSpace...)
+					vNet.AddressSpace = &network.AddressSpace{AddressPrefixes: &prefixes}
+					_, err = vNetClient.CreateOrUpdate(group, v.Name, vNet, nil)
+					return err
+				}})
+		}
+
+		liveSubnets := map[string]network.Subnet{}
+		if live.VirtualNetworkPropertiesFormat != nil && live.Subnets != nil {
+			for _, s := range *live.Subnets {
+				liveSubnets[strings.ToLower(stringValue(s.Name))] = s
+			}
+		}
+		for _, s := range v.Subnets {
+			s := s
+			ls, ok := liveSubnets[strings.ToLower(s.Name)]
+			delete(liveSubnets, strings.ToLower(s.Name))
+			prefix := ""
+			if ok && ls.SubnetPropertiesFormat != nil {
+				prefix = stringValue(ls.AddressPrefix)
+			}
+			switch {
+			case !ok:
+				actions = append(actions, specAction{"create", "subnet", v.Name + "/" + s.Name, s.AddressPrefix, func() error {
+					_, err := subnetClient.CreateOrUpdate(group, v.Name, s.Name, network.Subnet{
+						SubnetPropertiesFormat: &network.SubnetPropertiesFormat{AddressPrefix: to.StringPtr(s.AddressPrefix)},
+					}, nil)
+					return err
+				}})
+			case prefix != s.AddressPrefix:
+				actions = append(actions, specAction{"update", "subnet", v.Name + "/" + s.Name, fmt.Sprintf("address prefix %s -> %s", prefix, s.AddressPrefix), func() error {
+					subnet, err := subnetClient.Get(group, v.Name, s.Name, "")
+					if err != nil {
+						return err
+					}
+					subnet.AddressPrefix = to.StringPtr(s.AddressPrefix)
+					_, err = subnetClient.CreateOrUpdate(group, v.Name, s.Name, subnet, nil)
+					return err
+				}})
+			}
+		}
+		if prune {
+			for _, ls := range liveSubnets {
+				name := stringValue(ls.Name)
+				deletions = append(deletions, specAction{"delete", "subnet", v.Name + "/" + name, "", func() error {
+					if _, err := subnetClient.Delete(group, v.Name, name, nil); err != nil {
+						return err
+					}
+					resourceDeleted(resourceTypes["subnet"], name)
+					return nil
+				}})
+			}
+		}
+	}
+
+	for _, p := range spec.PublicIPs {
+		p := p
+		allocation := network.IPAllocationMethod(p.Allocation)
+		if allocation == "" {
+			allocation = network.Dynamic
+		}
+		live, err := addressClient.Get(group, p.Name, "")
+		switch {
+		case isNotFound(live.Response):
+			actions = append(actions, specAction{"create", "public IP", p.Name, string(allocation), func() error {
+				_, err := addressClient.CreateOrUpdate(group, p.Name, network.PublicIPAddress{
+					Location:                        to.StringPtr(spec.Location),
+					Tags:                            specTags(p.Tags),
+					PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{PublicIPAllocationMethod: allocation},
+				}, nil)
+				if err != nil {
+					return err
+				}
+				pip, err := addressClient.Get(group, p.Name, "")
+				if err == nil {
+					resourceCreated("pip", addressClient.APIVersion, pip.ID, pip)
+				}
+				return err
+			}})
+		case err != nil:
+			return nil, err
+		case live.PublicIPAddressPropertiesFormat != nil && (live.PublicIPAllocationMethod != allocation || !hasTags(live.Tags, p.Tags)):
+			changes := []string{}
+			if live.PublicIPAllocationMethod != allocation {
+				changes = append(changes, fmt.Sprintf("allocation %s -> %s", live.PublicIPAllocationMethod, allocation))
+			}
+			if !hasTags(live.Tags, p.Tags) {
+				changes = append(changes, "tags")
+			}
+			actions = append(actions, specAction{"update", "public IP", p.Name, strings.Join(changes, ", "), func() error {
+				pip, err := addressClient.Get(group, p.Name, "")
+				if err != nil {
+					return err
+				}
+				if pip.PublicIPAllocationMethod == allocation {
+					return updateTags(*pip.ID, mergeTags(pip.Tags, p.Tags))
+				}
+				pip.PublicIPAllocationMethod = allocation
+				pip.Tags = mergeTags(pip.Tags, p.Tags)
+				_, err = addressClient.CreateOrUpdate(group, p.Name, pip, nil)
+				return err
+			}})
+		}
+	}
+
+	for _, n := range spec.NICs {
+		n := n
+		subnetID, _ := spec.subnetID(n)
+		want := desiredNIC{
+			subnetID:     subnetID,
+			privateIP:    n.PrivateIP,
+			ipForwarding: n.IPForwarding,
+			tags:         n.Tags,
+		}
+		if n.PublicIP != "" {
+			want.pipID = spec.specResourceID("Microsoft.Network/publicIPAddresses", n.PublicIP)
+		}
+		if n.NSG != "" {
+			want.nsgID = spec.specResourceID("Microsoft.Network/networkSecurityGroups", n.NSG)
+		}
+		live, err := interfacesClient.Get(group, n.Name, "")
+		switch {
+		case isNotFound(live.Response):
+			actions = append(actions, specAction{"create", "NIC", n.Name, "in subnet " + lastSegment(&subnetID), func() error {
+				nic := network.Interface{
+					Location: to.StringPtr(spec.Location),
+					InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+						IPConfigurations: &[]network.InterfaceIPConfiguration{{
+							Name:                                     to.StringPtr("ipconfig1"),
+							InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{},
+						}},
+					},
+				}
+				want.applyTo(&nic)
+				if _, err := interfacesClient.CreateOrUpdate(group, n.Name, nic, nil); err != nil {
+					return err
+				}
+				nic, err := interfacesClient.Get(group, n.Name, "")
+				if err == nil {
+					resourceCreated("nic", interfacesClient.APIVersion, nic.ID, nic)
+				}
+				return err
+			}})
+		case err != nil:
+			return nil, err
+		default:
+			if changes := want.changes(live); len(changes) > 0 {
+				actions = append(actions, specAction{"update", "NIC", n.Name, strings.Join(changes, ", "), func() error {
+					_, err := patchNIC(group, n.Name, func(nic *network.Interface) error {
+						if changes := want.changes(*nic); len(changes) == 1 && changes[0] == "tags" {
+							if err := updateTags(*nic.ID, mergeTags(nic.Tags, want.tags)); err != nil {
+								return err
+							}
+							return errNICUnchanged
+						}
+						want.applyTo(nic)
+						return nil
+					})
+					return err
+				}})
+			}
+		}
+	}
+
+	if prune {
+		nicDeletions, err := pruneActions(spec, group)
+		if err != nil {
+			return nil, err
+		}
+		// NICs go first, as they hold on to public IPs and subnets, and VNets last.
+		deletions = append(nicDeletions[0], append(nicDeletions[1], deletions...)...)
+		if liveVNets.Value != nil {
+			for _, v := range *liveVNets.Value {
+				name := stringValue(v.Name)
+				if !wantedVNets[strings.ToLower(name)] {
+					deletions = append(deletions, specAction{"delete", "VNet", name, "", func() error {
+						if _, err := vNetClient.Delete(group, name, nil); err != nil {
+							return err
+						}
+						resourceDeleted("Microsoft.Network/virtualNetworks", name)
+						return nil
+					}})
+				}
+			}
+		}
+	}
+	return append(actions, deletions...), nil
+}
+
+// pruneActions returns the deletions of the NICs and of the public IPs of group missing from the spec.
+func pruneActions(spec topologySpec, group string) ([2][]specAction, error) {
+	var deletions [2][]specAction
+	wanted := map[string]bool{}
+	for _, n := range spec.NICs {
+		wanted["nic/"+strings.ToLower(n.Name)] = true
+	}
+	for _, p := range spec.PublicIPs {
+		wanted["pip/"+strings.ToLower(p.Name)] = true
+	}
+
+	nics, err := listGroupNICs(group)
+	if err != nil {
+		return deletions, err
+	}
+	if nics.Value != nil {
+		for _, nic := range *nics.Value {
+			nic, name := nic, stringValue(nic.Name)
+			if !wanted["nic/"+strings.ToLower(name)] {
+				// Azure refuses to delete a NIC attached to a VM, so it is detached first like nic delete does.
+				attached := nic.InterfacePropertiesFormat != nil && nic.VirtualMachine != nil && nic.VirtualMachine.ID != nil
+				detail := ""
+				if attached {
+					detail = fmt.Sprintf("detached from VM '%s' first", lastSegment(nic.VirtualMachine.ID))
+				}
+				deletions[0] = append(deletions[0], specAction{"delete", "NIC", name, detail, func() error {
+					if attached {
+						if err := detachFromVM(nic); err != nil {
+							return err
+						}
+					}
+					if _, err := interfacesClient.Delete(group, name, nil); err != nil {
+						return err
+					}
+					resourceDeleted("Microsoft.Network/networkInterfaces", name)
+					return nil
+				}})
+			}
+		}
+	}
+	pips, err := listGroupPIPs(group)
+	if err != nil {
+		return deletions, err
+	}
+	if pips.Value != nil {
+		for _, pip := range *pips.Value {
+			name := stringValue(pip.Name)
+			if !wanted["pip/"+strings.ToLower(name)] {
+				deletions[1] = append(deletions[1], specAction{"delete", "public IP", name, "", func() error {
+					if _, err := addressClient.Delete(group, name, nil); err != nil {
+						return err
+					}
+					resourceDeleted("Microsoft.Network/publicIPAddresses", name)
+					return nil
+				}})
+			}
+		}
+	}
+	return deletions, nil
+}
+
+// applyActions applies actions in order, stopping at the first failure.
+func applyActions(actions []specAction) error {
+	for _, a := range actions {
+		stepf("%s\n", a)
+		if err := a.apply(); err != nil {
+			return fmt.Errorf("%s: %s", a, err)
+		}
+	}
+	return nil
+}
+
+// desiredNIC is what a spec says about the primary IP configuration and settings of a NIC.
+type desiredNIC struct {
+	subnetID     string
+	privateIP    string
+	pipID        string
+	nsgID        string
+	ipForwarding bool
+	tags         map[string]string
+}
+
+// changes describes how the NIC differs from the desired one.
+func (d desiredNIC) changes(nic network.Interface) []string {
+	changes := []string{}
+	ipConfig := primaryIPConfiguration(nic)
+	if nic.InterfacePropertiesFormat == nil || ipConfig == nil || ipConfig.InterfaceIPConfigurationPropertiesFormat == nil {
+		return []string{"no IP configuration"}
+	}
+	subnetID, pipID, nsgID, privateIP := "", "", "", ""
+	if ipConfig.Subnet != nil {
+		subnetID = stringValue(ipConfig.Subnet.ID)
+	}
+	if ipConfig.PublicIPAddress != nil {
+		pipID = stringValue(ipConfig.PublicIPAddress.ID)
+	}
+	if nic.NetworkSecurityGroup != nil {
+		nsgID = stringValue(nic.NetworkSecurityGroup.ID)
+	}
+	if ipConfig.PrivateIPAllocationMethod == network.Static {
+		privateIP = stringValue(ipConfig.PrivateIPAddress)
+	}
+	forwarding := nic.EnableIPForwarding != nil && *nic.EnableIPForwarding
+	describe := func(id string) string {
+		if id == "" {
+			return "none"
+		}
+		return lastSegment(&id)
+	}
+	if !strings.EqualFold(subnetID, d.subnetID) {
+		changes = append(changes, fmt.Sprintf("subnet %s -> %s", describe(subnetID), describe(d.subnetID)))
+	}
+	if !strings.EqualFold(pipID, d.pipID) {
+		changes = append(changes, fmt.Sprintf("public IP %s -> %s", describe(pipID), describe(d.pipID)))
+	}
+	if !strings.EqualFold(nsgID, d.nsgID) {
+		changes = append(changes, fmt.Sprintf("NSG %s -> %s", describe(nsgID), describe(d.nsgID)))
+	}
+	if privateIP != d.privateIP {
+		changes = append(changes, fmt.Sprintf("static private IP %s -> %s", describe(privateIP), describe(d.privateIP)))
+	}
+	if forwarding != d.ipForwarding {
+		changes = append(changes, fmt.Sprintf("IP forwarding %v -> %v", forwarding, d.ipForwarding))
+	}
+	if !hasTags(nic.Tags, d.tags) {
+		changes = append(changes, "tags")
+	}
+	return changes
+}
+
+// applyTo sets the desired settings on the NIC and its primary IP configuration.
+func (d desiredNIC) applyTo(nic *network.Interface) {
+	nic.EnableIPForwarding = to.BoolPtr(d.ipForwarding)
+	nic.Tags = mergeTags(nic.Tags, d.tags)
+	nic.NetworkSecurityGroup = nil
+	if d.nsgID != "" {
+		nic.NetworkSecurityGroup = &network.SecurityGroup{ID: to.StringPtr(d.nsgID)}
+	}
+	ipConfig := primaryIPConfiguration(*nic)
+	ipConfig.Subnet = &network.Subnet{ID: to.StringPtr(d.subnetID)}
+	ipConfig.PublicIPAddress = nil
+	if d.pipID != "" {
+		ipConfig.PublicIPAddress = &network.PublicIPAddress{ID: to.StringPtr(d.pipID)}
+	}
+	if d.privateIP != "" {
+		ipConfig.PrivateIPAllocationMethod = network.Static
+		ipConfig.PrivateIPAddress = to.StringPtr(d.privateIP)
+	} else {
+		ipConfig.PrivateIPAllocationMethod = network.Dynamic
+	}
+}
+
+// sameStrings reports whether a and b hold the same strings, in any order.
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]string{}, a...), append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
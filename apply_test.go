@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// TestApplyPrune applies a spec without one of the NICs of a VM and one of the subnets of the VNet with
+// -prune, and checks that the NIC is detached from the VM before its deletion and that the deleted subnet is
+// removed from the state.
+func TestApplyPrune(t *testing.T) {
+	f := newTestARM(t)
+	createTestGroup(t)
+	vNet := testVNet()
+	*vNet.Subnets = append(*vNet.Subnets, network.Subnet{
+		Name:                   to.StringPtr("extra"),
+		SubnetPropertiesFormat: &network.SubnetPropertiesFormat{AddressPrefix: to.StringPtr("10.0.1.0/24")},
+	})
+	if _, err := vNetClient.CreateOrUpdate(groupName, "vnet", vNet, nil); err != nil {
+		t.Fatalf("creating the VNet: %v", err)
+	}
+	for _, name := range []string{"nic-1", "nic-2"} {
+		if _, err := interfacesClient.CreateOrUpdate(groupName, name, testNIC(), nil); err != nil {
+			t.Fatalf("creating %s: %v", name, err)
+		}
+	}
+	vmID := seedVM(f, "vm", "nic-1", "nic-2")
+	for _, name := range []string{"nic-1", "nic-2"} {
+		nic := f.resources[strings.ToLower(resourceID("Microsoft.Network/networkInterfaces", name))]
+		nic["properties"].(map[string]interface{})["virtualMachine"] = map[string]interface{}{"id": vmID}
+	}
+	extraID := resourceID("Microsoft.Network/virtualNetworks/subnets", "vnet/extra")
+	runState.Resources = []stateResource{{Type: resourceTypes["subnet"], Name: "extra", ID: extraID}}
+
+	spec := topologySpec{
+		ResourceGroup: groupName,
+		Location:      westUS,
+		VNets: []vnetSpec{{
+			Name: "vnet", AddressSpace: []string{"10.0.0.0/16"},
+			Subnets: []subnetSpec{{Name: "subnet", AddressPrefix: "10.0.0.0/24"}},
+		}},
+		NICs: []nicSpec{{Name: "nic-1", Subnet: "subnet"}},
+	}
+	actions, err := planSpec(spec, true)
+	if err != nil {
+		t.Fatalf("planning: %v", err)
+	}
+	if err := applyActions(actions); err != nil {
+		t.Fatalf("applying: %v", err)
+	}
+
+	_, err = interfacesClient.Get(groupName, "nic-2", "")
+	if de, ok := err.(autorest.DetailedError); !ok || de.StatusCode != http.StatusNotFound {
+		t.Errorf("getting the pruned NIC: err = %v, want a 404", err)
+	}
+	vm, err := vmClient.Get(groupName, "vm", "")
+	if err != nil {
+		t.Fatalf("getting the VM: %v", err)
+	}
+	if refs := *vm.NetworkProfile.NetworkInterfaces; len(refs) != 1 || !strings.HasSuffix(to.String(refs[0].ID), "/nic-1") {
+		t.Errorf("the VM's NICs are %+v, want only nic-1", refs)
+	}
+	if runState.find(extraID) >= 0 {
+		t.Errorf("the pruned subnet is still recorded in the state")
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// auditEntry is a line of the audit log, recording one request that changed a resource.
+type auditEntry struct {
+	Time       string `json:"time"`
+	Method     string `json:"method"`
+	ResourceID string `json:"resourceId"`
+	BodySHA256 string `json:"bodySha256,omitempty"`
+	Status     int    `json:"status,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"durationMs"`
+}
+
+// auditMu serializes appends to the audit log.
+var auditMu sync.Mutex
+
+// auditMutations decorates a sender to append every PUT, PATCH, POST and DELETE sent to ARM to the
+// file given with -audit-log, one JSON object per line.
+func auditMutations(s autorest.Sender) autorest.Sender {
+	return autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+		if *auditPath == "" || r.Method == http.MethodGet || r.Method == http.MethodHead ||
+			strings.Contains(r.URL.Path, "/oauth2/") {
+			return s.Do(r)
+		}
+
+		entry := auditEntry{
+			Time:       time.Now().UTC().Format(time.RFC3339Nano),
+			Method:     r.Method,
+			ResourceID: r.URL.Path,
+		}
+		if r.Body != nil {
+			b, err := ioutil.ReadAll(r.Body)
+			r.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(b))
+			sum := sha256.Sum256(b)
+			entry.BodySHA256 = hex.EncodeToString(sum[:])
+		}
+
+		start := time.Now()
+		resp, err := s.Do(r)
+		entry.DurationMS = int64(time.Since(start) / time.Millisecond)
+		if err != nil {
+			entry.Error = err.Error()
+		} else {
+			entry.Status = resp.StatusCode
+		}
+		appendAudit(entry)
+		return resp, err
+	})
+}
+
+// appendAudit appends an entry to the audit log. Failing to write the log makes the sample stop,
+// since it would otherwise change resources without a trace.
+func appendAudit(entry auditEntry) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	b, err := json.Marshal(entry)
+	onErrorFail(err, "Marshal failed")
+	f, err := os.OpenFile(*auditPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	onErrorFail(err, "Opening the audit log failed")
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	onErrorFail(err, "Writing the audit log failed")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+// auxiliaryTokenHeader carries the tokens of the auxiliary tenants on requests that
+// touch resources in more than one tenant.
+const auxiliaryTokenHeader = "x-ms-authorization-auxiliary"
+
+// newServicePrincipalToken gets a token for the Resource Manager endpoint from tenantID, sending
+// the token requests through sender.
+func newServicePrincipalToken(tenantID, clientID, clientSecret string, sender autorest.Sender) *azure.ServicePrincipalToken {
+	oauthConfig, err := azure.PublicCloud.OAuthConfigForTenant(tenantID)
+	onErrorFail(err, "Getting authentication token: OAuthConfigForTenant failed")
+
+	spToken, err := azure.NewServicePrincipalToken(*oauthConfig, clientID, clientSecret, azure.PublicCloud.ResourceManagerEndpoint)
+	onErrorFail(err, "Getting authentication token: NewServicePrincipalToken failed")
+	spToken.SetSender(sender)
+	return spToken
+}
+
+// auxiliaryAuthorizer authorizes requests with a primary token and passes the tokens of
+// auxiliary tenants along, for service principals that are guests in the subscription's tenant.
+type auxiliaryAuthorizer struct {
+	primary   *azure.ServicePrincipalToken
+	auxiliary []*azure.ServicePrincipalToken
+}
+
+// WithAuthorization implements autorest.Authorizer.
+func (a auxiliaryAuthorizer) WithAuthorization() autorest.PrepareDecorator {
+	return func(p autorest.Preparer) autorest.Preparer {
+		return autorest.PreparerFunc(func(r *http.Request) (*http.Request, error) {
+			tokens := []string{}
+			for _, aux := range a.auxiliary {
+				if err := aux.EnsureFresh(); err != nil {
+					return r, autorest.NewErrorWithError(err, "main.auxiliaryAuthorizer", "WithAuthorization", nil,
+						"Failed to refresh auxiliary token for request to %s", r.URL)
+				}
+				tokens = append(tokens, fmt.Sprintf("Bearer %s", aux.AccessToken))
+			}
+			p = autorest.WithHeader(auxiliaryTokenHeader, strings.Join(tokens, ", "))(p)
+			return a.primary.WithAuthorization()(p).Prepare(r)
+		})
+	}
+}
+
+// splitList splits a comma-separated flag value, ignoring empty items.
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/azure-sdk-for-go/arm/resources/resources"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// bastionSubnetName is the name Azure requires for the subnet of a Bastion host.
+const bastionSubnetName = "AzureBastionSubnet"
+
+// deployBastion creates a Bastion host in its own subnet of the VNet, through which the portal opens SSH
+// sessions to the VM over TLS, without the VM needing a public IP.
+func deployBastion(location string) {
+	stepf("Deploy Azure Bastion\n")
+	createSubnet(vNetName, subnetLayout{Name: bastionSubnetName, AddressPrefix: *bastionPrefix}, nil)
+
+	pipName := resourceName("pip", "bastion-pip", location, namingVars{"seq": "3"})
+	stepf("Create public IP address: '%s'\n", pipName)
+	createStandardPIP(pipName, "Regional", &network.PublicIPAddressPropertiesFormat{PublicIPAllocationMethod: network.Static})
+	pip, err := addressClient.Get(groupName, pipName, "")
+	onErrorFail(err, "Get failed")
+	recordCreated("pip", addressClient.APIVersion, pip.ID, pip)
+
+	name := resourceName("bastion", "bastion", location, nil)
+	stepf("Create Bastion host '%s', which takes several minutes\n", name)
+	client := genericClient
+	client.APIVersion = genericAPIVersions["microsoft.network/bastionhosts"]
+	id := strings.TrimPrefix(resourceID("Microsoft.Network/bastionHosts", name), "/")
+	subnetID := fmt.Sprintf("%s/subnets/%s", resourceID("Microsoft.Network/virtualNetworks", vNetName), bastionSubnetName)
+	_, err = client.CreateOrUpdateByID(id, resources.GenericResource{
+		Location: to.StringPtr(location),
+		Tags:     resourceTags(),
+		Properties: &map[string]interface{}{
+			"ipConfigurations": []interface{}{
+				map[string]interface{}{
+					"name": "IPconfig1",
+					"properties": map[string]interface{}{
+						"subnet":          map[string]interface{}{"id": subnetID},
+						"publicIPAddress": map[string]interface{}{"id": *pip.ID},
+					},
+				},
+			},
+		},
+	}, nil)
+	onErrorFail(err, "CreateOrUpdateByID failed")
+
+	host, err := client.GetByID(id)
+	onErrorFail(err, "GetByID failed")
+	recordCreated("bastion", client.APIVersion, host.ID, host)
+	fmt.Printf("Connect to VM '%s' through Bastion: %s/bastionHost\n", vmName,
+		portalLink(resourceID("Microsoft.Compute/virtualMachines", vmName)))
+}
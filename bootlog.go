@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/arm/compute"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// bootDiagnosticsAPIVersion is the first compute API version able to hand out SAS URIs of the boot diagnostics.
+const bootDiagnosticsAPIVersion = "2020-06-01"
+
+// bootDiagnostics returns the profile writing the VM's serial log and console screenshots to the blob
+// storage of account.
+func bootDiagnostics(account string) *compute.DiagnosticsProfile {
+	return &compute.DiagnosticsProfile{
+		BootDiagnostics: &compute.BootDiagnostics{
+			Enabled:    to.BoolPtr(true),
+			StorageURI: to.StringPtr(fmt.Sprintf("https://%s.blob.%s/", account, azure.PublicCloud.StorageEndpointSuffix)),
+		},
+	}
+}
+
+// vmSerialLog prints the serial log of a VM and the URI of its latest console screenshot, both valid for a
+// limited time.
+func vmSerialLog(args []string) {
+	fs := flag.NewFlagSet("vm serial-log", flag.ExitOnError)
+	tail := fs.Int("tail", 0, "print only the last lines of the log")
+	fs.Parse(args)
+	name := vmName
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		name = fs.Arg(0)
+	default:
+		fmt.Println("Usage: vm serial-log [-tail n] [name]")
+		os.Exit(1)
+	}
+
+	var uris struct {
+		ConsoleScreenshotBlobURI string `json:"consoleScreenshotBlobUri"`
+		SerialConsoleLogBlobURI  string `json:"serialConsoleLogBlobUri"`
+	}
+	err := armRequest("POST", resourceID("Microsoft.Compute/virtualMachines", name)+"/retrieveBootDiagnosticsData",
+		bootDiagnosticsAPIVersion, map[string]interface{}{"sasUriExpirationTimeInMinutes": 60}, nil, &uris)
+	onErrorFail(err, "Retrieving the boot diagnostics failed")
+	if uris.SerialConsoleLogBlobURI == "" {
+		fmt.Printf("VM '%s' has no serial log yet, is boot diagnostics enabled?\n", name)
+		os.Exit(1)
+	}
+
+	client := &http.Client{Transport: newTransport(), Timeout: 60 * time.Second}
+	resp, err := client.Get(uris.SerialConsoleLogBlobURI)
+	onErrorFail(err, "Downloading the serial log failed")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		onErrorFail(fmt.Errorf("blob storage responded %s", resp.Status), "Downloading the serial log failed")
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	onErrorFail(err, "Downloading the serial log failed")
+
+	lines := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	if *tail > 0 && len(lines) > *tail {
+		lines = lines[len(lines)-*tail:]
+	}
+	fmt.Println(strings.Join(lines, "\n"))
+	if uris.ConsoleScreenshotBlobURI != "" {
+		fmt.Printf("\nConsole screenshot, valid for an hour: %s\n", uris.ConsoleScreenshotBlobURI)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// nicBrowse is an interactive terminal UI for inspecting and changing the NICs of the resource group.
+// Failed operations are reported and leave the browser running.
+func nicBrowse(args []string) {
+	for {
+		fmt.Println()
+		listNICs()
+		line, ok := prompt("NIC name to open, r to refresh, q to quit")
+		switch {
+		case !ok || line == "q":
+			return
+		case line == "" || line == "r":
+			continue
+		}
+		browseNIC(line)
+	}
+}
+
+// browseNIC shows the IP configurations of a NIC and applies the actions entered for it until the user goes back.
+func browseNIC(name string) {
+	for {
+		nic, err := interfacesClient.Get(groupName, name, "")
+		if err != nil {
+			fmt.Printf("Get failed: %s\n", err)
+			return
+		}
+		fmt.Println()
+		printIPConfigurations(nic)
+
+		line, ok := prompt("f toggle IP forwarding, a <pip name or ID> attach public IP, d detach public IP, x delete, b back")
+		if !ok {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "b":
+			return
+		case "f":
+			enabled := nic.EnableIPForwarding != nil && *nic.EnableIPForwarding
+			fmt.Printf("Set IP forwarding of NIC '%s' to %v\n", name, !enabled)
+			nic.EnableIPForwarding = to.BoolPtr(!enabled)
+			updateNIC(nic)
+		case "a":
+			if len(fields) != 2 {
+				fmt.Println("Usage: a <public IP name or resource ID>")
+				continue
+			}
+			// A resource ID attaches a public IP of another resource group.
+			var pip network.PublicIPAddress
+			var err error
+			if strings.HasPrefix(fields[1], "/") {
+				pip, err = getPublicIP(fields[1])
+			} else {
+				pip, err = addressClient.Get(groupName, fields[1], "")
+			}
+			if err != nil {
+				fmt.Printf("Get failed: %s\n", err)
+				continue
+			}
+			fmt.Printf("Attach public IP '%s' to NIC '%s'\n", fields[1], name)
+			primaryIPConfiguration(nic).PublicIPAddress = &network.PublicIPAddress{ID: pip.ID}
+			updateNIC(nic)
+		case "d":
+			fmt.Printf("Detach the public IP of NIC '%s'\n", name)
+			primaryIPConfiguration(nic).PublicIPAddress = nil
+			updateNIC(nic)
+		case "x":
+			if !confirm(fmt.Sprintf("Delete NIC '%s'?", name)) {
+				continue
+			}
+			fmt.Printf("Delete NIC '%s'\n", name)
+			if _, err := interfacesClient.Delete(groupName, name, nil); err != nil {
+				fmt.Printf("Delete failed: %s\n", err)
+				continue
+			}
+			forgetResource("Microsoft.Network/networkInterfaces", name)
+			return
+		default:
+			fmt.Printf("Unknown action '%s'\n", fields[0])
+		}
+	}
+}
+
+// updateNIC writes a changed NIC back to ARM unless someone else changed it since it was shown, reporting
+// rather than failing on errors.
+func updateNIC(nic network.Interface) {
+	resp, err := putNICIfMatch(groupName, nic)
+	switch {
+	case isPreconditionFailed(resp):
+		fmt.Printf("NIC '%s' was changed by someone else meanwhile, nothing was updated; check it again\n", *nic.Name)
+	case err != nil:
+		fmt.Printf("CreateOrUpdate failed: %s\n", err)
+	}
+}
+
+// printIPConfigurations prints a NIC's settings and a table of its IP configurations.
+func printIPConfigurations(nic network.Interface) {
+	forwarding, vm := false, "-"
+	if nic.EnableIPForwarding != nil {
+		forwarding = *nic.EnableIPForwarding
+	}
+	if nic.VirtualMachine != nil {
+		vm = lastSegment(nic.VirtualMachine.ID)
+	}
+	fmt.Printf("NIC '%s'  MAC %s  IP forwarding %v  VM %s\n", stringValue(nic.Name), stringValue(nic.MacAddress), forwarding, vm)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "IPCONFIG\tPRIMARY\tPRIVATE IP\tALLOCATION\tSUBNET\tPUBLIC IP")
+	if nic.IPConfigurations != nil {
+		for _, ipConfig := range *nic.IPConfigurations {
+			p := ipConfig.InterfaceIPConfigurationPropertiesFormat
+			if p == nil {
+				continue
+			}
+			subnet, pip := "-", "-"
+			if p.Subnet != nil {
+				subnet = lastSegment(p.Subnet.ID)
+			}
+			if p.PublicIPAddress != nil {
+				pip = lastSegment(p.PublicIPAddress.ID)
+			}
+			fmt.Fprintf(w, "%s\t%v\t%s\t%s\t%s\t%s\n", stringValue(ipConfig.Name), p.Primary != nil && *p.Primary,
+				stringValue(p.PrivateIPAddress), p.PrivateIPAllocationMethod, subnet, pip)
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+)
+
+// existingSubnets are the subnets of -vnet-id or -subnet-ids the NICs go into, in the layout's order,
+// set by resolveExistingNetwork.
+var existingSubnets []network.Subnet
+
+// useExistingNetwork reports whether the NICs go into an existing VNet instead of one the sample creates.
+func useExistingNetwork() bool {
+	return *existingVNetID != "" || *existingSubnetIDs != ""
+}
+
+// resolveExistingNetwork looks up the subnets of -vnet-id or -subnet-ids and replaces the layout with them,
+// exiting unless they exist, share a VNet in the sample's region and go along with the other flags.
+// With -vnet-id the layout's subnets are looked up by name; -subnet-ids gives one subnet per NIC instead.
+func resolveExistingNetwork() {
+	if *existingVNetID != "" && *existingSubnetIDs != "" {
+		fmt.Println("Use either -vnet-id or -subnet-ids")
+		os.Exit(1)
+	}
+	switch {
+	case *bastion:
+		fmt.Println("-bastion creates the AzureBastionSubnet in the sample's VNet, it can't be used with -vnet-id or -subnet-ids")
+		os.Exit(1)
+	case *multiRegion:
+		fmt.Println("-multi-region peers the sample's VNet, it can't be used with -vnet-id or -subnet-ids")
+		os.Exit(1)
+	case *nsgLevel == nsgLevelSubnet || *nsgLevel == nsgLevelBoth:
+		fmt.Println("-nsg subnet would change the NSGs of existing subnets, use -nsg nic with -vnet-id or -subnet-ids")
+		os.Exit(1)
+	}
+
+	ids := []string{}
+	if *existingSubnetIDs != "" {
+		for _, id := range strings.Split(*existingSubnetIDs, ",") {
+			ids = append(ids, strings.TrimSpace(id))
+		}
+	} else {
+		vNetID := strings.TrimSuffix(*existingVNetID, "/")
+		for _, s := range layout {
+			ids = append(ids, vNetID+"/subnets/"+s.Name)
+		}
+	}
+
+	vNetOf := func(subnetID string) string {
+		return strings.ToLower(subnetID[:strings.LastIndex(subnetID, "/subnets/")])
+	}
+	subnets := []network.Subnet{}
+	for i, id := range ids {
+		if !strings.Contains(id, "/subnets/") {
+			fmt.Printf("'%s' is not the resource ID of a subnet\n", id)
+			os.Exit(1)
+		}
+		if vNetOf(id) != vNetOf(ids[0]) {
+			fmt.Println("All the NICs of a VM must be in the same VNet, but the subnets of -subnet-ids are in several")
+			os.Exit(1)
+		}
+		subnet, err := getSubnet(id)
+		onErrorFail(err, fmt.Sprintf("Get subnet '%s' failed", id))
+		subnets = append(subnets, subnet)
+
+		if i >= len(layout) {
+			layout = append(layout, subnetLayout{NIC: resourceName("nic", fmt.Sprintf("nic%d", i+1), westUS, namingVars{"seq": fmt.Sprint(i + 1)})})
+		}
+		layout[i].Name = stringValue(subnet.Name)
+		layout[i].AddressPrefix = ""
+		if subnet.SubnetPropertiesFormat != nil {
+			layout[i].AddressPrefix = stringValue(subnet.AddressPrefix)
+		}
+		layout[i].Delegations = nil
+		if layout[i].Tier == "" {
+			layout[i].Tier = strings.ToLower(layout[i].Name)
+		}
+	}
+	layout = layout[:len(subnets)]
+
+	var vNet network.VirtualNetwork
+	err := armRequest("GET", ids[0][:strings.LastIndex(ids[0], "/subnets/")], vNetClient.APIVersion, nil, nil, &vNet)
+	onErrorFail(err, "Get VNet failed")
+	if !sameLocation(stringValue(vNet.Location), westUS) {
+		fmt.Printf("VNet '%s' is in %s, but the sample deploys its VM into %s\n", stringValue(vNet.Name), stringValue(vNet.Location), westUS)
+		os.Exit(1)
+	}
+	stepf("Use the existing VNet '%s' of resource group '%s'\n", stringValue(vNet.Name), resourceGroupOf(vNet.ID))
+	existingSubnets = subnets
+}
+
+// getSubnet reads a subnet by resource ID, which may be in another resource group or subscription than the sample's.
+func getSubnet(id string) (network.Subnet, error) {
+	var subnet network.Subnet
+	err := armRequest("GET", id, subnetClient.APIVersion, nil, nil, &subnet)
+	return subnet, err
+}
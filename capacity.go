@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"text/tabwriter"
+)
+
+// subnetCapacity prints how many addresses each subnet of a VNet has, how many are reserved by Azure or
+// allocated to IP configurations, and how many remain.
+func subnetCapacity(args []string) {
+	fs := flag.NewFlagSet("subnet capacity", flag.ExitOnError)
+	name := fs.String("vnet", vNetName, "name of the VNet in the resource group")
+	fs.Parse(args)
+
+	list, err := listSubnets(groupName, *name)
+	onErrorFail(err, "List failed")
+	if list.Value == nil || len(*list.Value) == 0 {
+		fmt.Printf("VNet '%s' has no subnets\n", *name)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SUBNET\tPREFIX\tTOTAL\tRESERVED\tALLOCATED\tFREE\tUSED")
+	for _, subnet := range *list.Value {
+		prefix := ""
+		allocated := 0
+		if subnet.SubnetPropertiesFormat != nil {
+			prefix = stringValue(subnet.AddressPrefix)
+			if subnet.IPConfigurations != nil {
+				allocated = len(*subnet.IPConfigurations)
+			}
+		}
+		_, n, err := net.ParseCIDR(prefix)
+		if err != nil || n.IP.To4() == nil {
+			fmt.Fprintf(w, "%s\t%s\t-\t-\t%d\t-\t-\n", stringValue(subnet.Name), prefix, allocated)
+			continue
+		}
+		ones, bits := n.Mask.Size()
+		total := 1 << uint(bits-ones)
+		// Azure reserves the first four addresses and the broadcast address of every subnet.
+		reserved := azureReservedAddresses + 1
+		free := total - reserved - allocated
+		if free < 0 {
+			free = 0
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d%%\n", stringValue(subnet.Name), prefix, total, reserved, allocated, free,
+			100*(reserved+allocated)/total)
+	}
+	w.Flush()
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// retailPricesURL is the Azure Retail Prices API, which needs no authentication.
+const retailPricesURL = "https://prices.azure.com/api/retail/prices"
+
+// hoursPerMonth is the number of hours Azure bills a full month of a running VM for.
+const hoursPerMonth = 730
+
+// resourceKinds are the names under which the chat message counts each type of resource.
+var resourceKinds = map[string]string{
+	"microsoft.network/virtualnetworks":                        "VNet",
+	"microsoft.network/virtualnetworks/subnets":                "subnet",
+	"microsoft.network/virtualnetworks/virtualnetworkpeerings": "peering",
+	"microsoft.network/networkinterfaces":                      "NIC",
+	"microsoft.network/publicipaddresses":                      "public IP",
+	"microsoft.storage/storageaccounts":                        "storage account",
+	"microsoft.compute/virtualmachines":                        "VM",
+}
+
+// postChatMessage posts a summary of the deployment to a Slack or Microsoft Teams incoming webhook.
+// Both accept a JSON object with the message as its text, they only differ in how bold text is marked.
+func postChatMessage(webhook string, outcome deploymentOutcome) error {
+	bold := "**"
+	if u, err := url.Parse(webhook); err == nil && strings.HasSuffix(u.Host, "slack.com") {
+		bold = "*"
+	}
+
+	lines := []string{}
+	if outcome.Succeeded {
+		lines = append(lines, fmt.Sprintf("%s%s deployed %d resources into %s in %s%s",
+			bold, sampleUserAgent, len(outcome.Resources), outcome.ResourceGroup, outcome.Duration, bold))
+	} else {
+		lines = append(lines, fmt.Sprintf("%s%s failed to deploy into %s after %s%s",
+			bold, sampleUserAgent, outcome.ResourceGroup, outcome.Duration, bold))
+	}
+
+	counts := map[string]int{}
+	for _, r := range runState.Resources {
+		if kind, ok := resourceKinds[strings.ToLower(r.Type)]; ok {
+			counts[kind]++
+		}
+	}
+	kinds := []string{}
+	for kind, n := range counts {
+		kinds = append(kinds, fmt.Sprintf("%d %s", n, kind))
+	}
+	sort.Strings(kinds)
+	if len(kinds) > 0 {
+		lines = append(lines, "Topology: "+strings.Join(kinds, ", "))
+	}
+
+	for _, r := range runState.Resources {
+		if strings.EqualFold(r.Type, "Microsoft.Network/publicIPAddresses") {
+			address := r.Outputs["ipAddress"]
+			if address == "" {
+				address = "(unallocated)"
+			}
+			if fqdn := r.Outputs["fqdn"]; fqdn != "" {
+				address += " (" + fqdn + ")"
+			}
+			lines = append(lines, fmt.Sprintf("Public IP %s: %s", r.Name, address))
+		}
+	}
+
+	if hourly, currency, err := estimateHourlyCost(); err != nil {
+		lines = append(lines, fmt.Sprintf("Estimated cost: unavailable (%s)", err))
+	} else if hourly > 0 {
+		lines = append(lines, fmt.Sprintf("Estimated cost: %.2f %s/hour, %.0f %s/month for the VMs at list price",
+			hourly, currency, hourly*hoursPerMonth, currency))
+	}
+
+	if outcome.Error != "" {
+		lines = append(lines, fmt.Sprintf("%sError:%s %s", bold, bold, outcome.Error))
+	}
+
+	body, err := json.Marshal(map[string]string{"text": strings.Join(lines, "\n\n")})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return postNotification(req)
+}
+
+// estimateHourlyCost adds up the Linux pay-as-you-go list prices of the VMs created by the run.
+// Disks, public IPs and traffic aren't included.
+func estimateHourlyCost() (float64, string, error) {
+	total, currency := 0.0, "USD"
+	for _, r := range runState.Resources {
+		size := r.Outputs["vmSize"]
+		location, _ := r.Body["location"].(string)
+		if !strings.EqualFold(r.Type, "Microsoft.Compute/virtualMachines") || size == "" || location == "" {
+			continue
+		}
+		price, c, err := vmListPrice(size, location)
+		if err != nil {
+			return 0, "", err
+		}
+		total += price
+		currency = c
+	}
+	return total, currency, nil
+}
+
+// retailPrice is an item returned by the Retail Prices API.
+type retailPrice struct {
+	RetailPrice   float64 `json:"retailPrice"`
+	CurrencyCode  string  `json:"currencyCode"`
+	UnitOfMeasure string  `json:"unitOfMeasure"`
+	ProductName   string  `json:"productName"`
+	SkuName       string  `json:"skuName"`
+}
+
+// vmListPrice returns the hourly Linux pay-as-you-go price of a VM size in a region.
+func vmListPrice(size, location string) (float64, string, error) {
+	filter := fmt.Sprintf("serviceName eq 'Virtual Machines' and priceType eq 'Consumption' and armRegionName eq '%s' and armSkuName eq '%s'",
+		strings.ToLower(location), size)
+	client := &http.Client{Transport: newTransport(), Timeout: 30 * time.Second}
+	resp, err := client.Get(retailPricesURL + "?$filter=" + url.QueryEscape(filter))
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, "", fmt.Errorf("%s responded %s", resp.Request.URL.Host, resp.Status)
+	}
+
+	var prices struct {
+		Items []retailPrice `json:"Items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&prices); err != nil {
+		return 0, "", err
+	}
+	for _, p := range prices.Items {
+		if p.UnitOfMeasure == "1 Hour" && !strings.Contains(p.ProductName, "Windows") &&
+			!strings.Contains(p.SkuName, "Spot") && !strings.Contains(p.SkuName, "Low Priority") {
+			return p.RetailPrice, p.CurrencyCode, nil
+		}
+	}
+	return 0, "", fmt.Errorf("no list price for %s in %s", size, location)
+}
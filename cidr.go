@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// defaultSubnetSize is the prefix length the planner gives subnets of the layout without an address prefix or size.
+const defaultSubnetSize = 24
+
+// Prefix lengths Azure accepts for IPv4 subnets.
+const (
+	minSubnetSize = 2
+	maxSubnetSize = 29
+)
+
+// defaultAddressSpace is the address space of the sample's VNet unless -address-space or the configuration file gives one.
+const defaultAddressSpace = "172.16.0.0/16"
+
+// addressSpace are the address prefixes of the sample's VNet, set by validateAddressSpace.
+var addressSpace []string
+
+// validateAddressSpace resolves the VNet's address prefixes, plans the subnets of the layout without an
+// address prefix, and exits unless each prefix is a valid network address and every subnet falls inside one
+// of them without overlapping another subnet.
+func validateAddressSpace() {
+	prefixes := config.AddressSpace
+	if *addressSpaceFlag != "" {
+		prefixes = strings.Split(*addressSpaceFlag, ",")
+	}
+	if len(prefixes) == 0 {
+		prefixes = []string{defaultAddressSpace}
+	}
+
+	networks := []*net.IPNet{}
+	for i, p := range prefixes {
+		prefixes[i] = strings.TrimSpace(p)
+		n := parseNetwork("VNet address prefix", prefixes[i])
+		networks = append(networks, n)
+	}
+	planLayout(networks)
+	subnets := []*net.IPNet{}
+	for _, s := range layout {
+		subnet := parseNetwork(fmt.Sprintf("Address prefix of subnet '%s'", s.Name), s.AddressPrefix)
+		subnets = append(subnets, subnet)
+		if !anyContains(networks, subnet) {
+			fmt.Printf("Subnet '%s' (%s) is outside the VNet's address space %s\n", s.Name, s.AddressPrefix, strings.Join(prefixes, ", "))
+			os.Exit(1)
+		}
+		if s.PrivateIP != "" {
+			if ip := net.ParseIP(s.PrivateIP); ip == nil || !subnet.Contains(ip) {
+				fmt.Printf("Private IP '%s' of NIC '%s' is not an address of subnet '%s' (%s)\n", s.PrivateIP, s.NIC, s.Name, s.AddressPrefix)
+				os.Exit(1)
+			}
+		}
+	}
+	if i, j := firstOverlap(subnets); i >= 0 {
+		fmt.Printf("Subnet '%s' (%s) overlaps with subnet '%s' (%s)\n", layout[j].Name, layout[j].AddressPrefix, layout[i].Name, layout[i].AddressPrefix)
+		os.Exit(1)
+	}
+	if *bastion {
+		n := parseNetwork("Address prefix of the AzureBastionSubnet", *bastionPrefix)
+		if ones, _ := n.Mask.Size(); ones > 26 {
+			fmt.Printf("The AzureBastionSubnet needs a /26 or larger, %s is too small\n", *bastionPrefix)
+			os.Exit(1)
+		}
+		if !anyContains(networks, n) {
+			fmt.Printf("The AzureBastionSubnet (%s) is outside the VNet's address space %s\n", *bastionPrefix, strings.Join(prefixes, ", "))
+			os.Exit(1)
+		}
+		if _, j := firstOverlap(append([]*net.IPNet{n}, subnets...)); j > 0 {
+			fmt.Printf("Subnet '%s' (%s) overlaps with the AzureBastionSubnet (%s)\n", layout[j-1].Name, layout[j-1].AddressPrefix, *bastionPrefix)
+			os.Exit(1)
+		}
+	}
+	if *multiRegion {
+		peer := parseNetwork("Address space of the second region", peerAddressPrefix)
+		for i, n := range networks {
+			if n.Contains(peer.IP) || peer.Contains(n.IP) {
+				fmt.Printf("VNet address prefix %s overlaps with the second region's %s, which prevents peering\n", prefixes[i], peerAddressPrefix)
+				os.Exit(1)
+			}
+		}
+	}
+	addressSpace = prefixes
+}
+
+// parseNetwork parses a CIDR prefix, exiting if it is invalid or has host bits set, e.g. 172.16.1.1/24.
+func parseNetwork(what, prefix string) *net.IPNet {
+	_, n, err := net.ParseCIDR(prefix)
+	if err != nil {
+		fmt.Printf("%s '%s' is not a valid CIDR prefix\n", what, prefix)
+		os.Exit(1)
+	}
+	if n.String() != prefix {
+		fmt.Printf("%s '%s' is not a network address, did you mean %s?\n", what, prefix, n)
+		os.Exit(1)
+	}
+	return n
+}
+
+// cidrContains reports whether inner lies entirely within outer.
+func cidrContains(outer, inner *net.IPNet) bool {
+	outerOnes, outerBits := outer.Mask.Size()
+	innerOnes, innerBits := inner.Mask.Size()
+	return outerBits == innerBits && innerOnes >= outerOnes && outer.Contains(inner.IP)
+}
+
+// anyContains reports whether one of networks contains n.
+func anyContains(networks []*net.IPNet, n *net.IPNet) bool {
+	for _, outer := range networks {
+		if cidrContains(outer, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// planLayout gives each subnet of the layout without an address prefix one of its size, exiting if the
+// address space has no room left. The prefixes of the other subnets, and of the AzureBastionSubnet with
+// -bastion, are kept out of the plan.
+func planLayout(networks []*net.IPNet) {
+	taken := []*net.IPNet{}
+	sizes := []int{}
+	for _, s := range layout {
+		if s.AddressPrefix != "" {
+			taken = append(taken, parseNetwork(fmt.Sprintf("Address prefix of subnet '%s'", s.Name), s.AddressPrefix))
+			continue
+		}
+		size := s.Size
+		if size == 0 {
+			size = defaultSubnetSize
+		}
+		sizes = append(sizes, size)
+	}
+	if len(sizes) == 0 {
+		return
+	}
+	if *bastion {
+		taken = append(taken, parseNetwork("Address prefix of the AzureBastionSubnet", *bastionPrefix))
+	}
+
+	planned, err := planSubnets(networks, taken, sizes)
+	if err != nil {
+		fmt.Printf("Planning the subnets failed: %s\n", err)
+		os.Exit(1)
+	}
+	for i := range layout {
+		if layout[i].AddressPrefix == "" {
+			layout[i].AddressPrefix = planned[0].String()
+			planned = planned[1:]
+			stepf("Plan subnet '%s' as %s\n", layout[i].Name, layout[i].AddressPrefix)
+		}
+	}
+}
+
+// planSubnets returns non-overlapping IPv4 subnets of the given prefix lengths, in the same order, packed
+// into the first of networks with room for them and clear of the taken prefixes. The largest subnets are
+// placed first, which keeps smaller ones from fragmenting the address space.
+func planSubnets(networks, taken []*net.IPNet, sizes []int) ([]*net.IPNet, error) {
+	order := make(bySize, len(sizes))
+	for i, size := range sizes {
+		if size < minSubnetSize || size > maxSubnetSize {
+			return nil, fmt.Errorf("/%d is not a valid subnet size, use /%d to /%d", size, minSubnetSize, maxSubnetSize)
+		}
+		order[i] = plannedSubnet{index: i, size: size}
+	}
+	sort.Stable(order)
+
+	used := append([]*net.IPNet{}, taken...)
+	planned := make([]*net.IPNet, len(sizes))
+	for _, p := range order {
+		n := firstFree(networks, used, p.size)
+		if n == nil {
+			return nil, fmt.Errorf("no room left in the address space for a /%d subnet", p.size)
+		}
+		planned[p.index] = n
+		used = append(used, n)
+	}
+	return planned, nil
+}
+
+// firstFree returns the first IPv4 prefix of the given length inside one of networks that overlaps none of used, or nil.
+func firstFree(networks, used []*net.IPNet, size int) *net.IPNet {
+	mask := net.CIDRMask(size, 8*net.IPv4len)
+	step := uint64(1) << uint(8*net.IPv4len-size)
+	for _, outer := range networks {
+		ones, bits := outer.Mask.Size()
+		if outer.IP.To4() == nil || bits != 8*net.IPv4len || ones > size {
+			continue
+		}
+		start := uint64(binary.BigEndian.Uint32(outer.IP.To4()))
+		end := start + uint64(1)<<uint(bits-ones)
+		for a := start; a < end; a += step {
+			ip := make(net.IP, net.IPv4len)
+			binary.BigEndian.PutUint32(ip, uint32(a))
+			candidate := &net.IPNet{IP: ip, Mask: mask}
+			if !anyOverlaps(used, candidate) {
+				return candidate
+			}
+		}
+	}
+	return nil
+}
+
+// anyOverlaps reports whether n shares addresses with one of networks.
+func anyOverlaps(networks []*net.IPNet, n *net.IPNet) bool {
+	for _, other := range networks {
+		if other.Contains(n.IP) || n.Contains(other.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstOverlap returns the indexes i < j of the first two of networks sharing addresses, or -1, -1 if
+// none do.
+func firstOverlap(networks []*net.IPNet) (int, int) {
+	for j := range networks {
+		for i := 0; i < j; i++ {
+			if anyOverlaps(networks[i:i+1], networks[j]) {
+				return i, j
+			}
+		}
+	}
+	return -1, -1
+}
+
+// plannedSubnet is a subnet to plan: its position among the requested sizes, and its prefix length.
+type plannedSubnet struct {
+	index int
+	size  int
+}
+
+// bySize sorts subnets to plan from the largest to the smallest.
+type bySize []plannedSubnet
+
+func (s bySize) Len() int           { return len(s) }
+func (s bySize) Less(i, j int) bool { return s[i].size < s[j].size }
+func (s bySize) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// vnetPlan prints the subnet prefixes the planner would give subnets of the given sizes in an address space.
+func vnetPlan(args []string) {
+	fs := flag.NewFlagSet("vnet plan", flag.ExitOnError)
+	space := fs.String("address-space", defaultAddressSpace, "comma-separated address prefixes of the VNet")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fmt.Println("Usage: vnet plan [-address-space prefix,...] <size>...   e.g. vnet plan 24 26 26")
+		os.Exit(1)
+	}
+
+	networks := []*net.IPNet{}
+	for _, p := range strings.Split(*space, ",") {
+		networks = append(networks, parseNetwork("VNet address prefix", strings.TrimSpace(p)))
+	}
+	sizes := []int{}
+	for _, a := range fs.Args() {
+		size := 0
+		if _, err := fmt.Sscanf(strings.TrimPrefix(a, "/"), "%d", &size); err != nil {
+			fmt.Printf("Subnet size '%s' is not a prefix length such as 24\n", a)
+			os.Exit(1)
+		}
+		sizes = append(sizes, size)
+	}
+	planned, err := planSubnets(networks, nil, sizes)
+	onErrorFail(err, "Planning the subnets failed")
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SUBNET\tPREFIX\tUSABLE")
+	for i, n := range planned {
+		fmt.Fprintf(w, "%d\t%s\t%d\n", i+1, n, 1<<uint(8*net.IPv4len-sizes[i])-(azureReservedAddresses+1))
+	}
+	w.Flush()
+}
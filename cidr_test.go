@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+// networks parses CIDR prefixes for the tests.
+func networks(t *testing.T, prefixes ...string) []*net.IPNet {
+	t.Helper()
+	ns := []*net.IPNet{}
+	for _, p := range prefixes {
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			t.Fatalf("bad test prefix %s: %v", p, err)
+		}
+		ns = append(ns, n)
+	}
+	return ns
+}
+
+func TestFirstOverlap(t *testing.T) {
+	tests := []struct {
+		prefixes []string
+		i, j     int
+	}{
+		{nil, -1, -1},
+		{[]string{"172.16.0.0/24"}, -1, -1},
+		{[]string{"172.16.0.0/24", "172.16.1.0/24", "172.16.2.0/23"}, -1, -1},
+		{[]string{"172.16.0.0/24", "172.16.0.0/24"}, 0, 1},
+		{[]string{"172.16.0.0/24", "172.16.1.0/24", "172.16.0.128/25"}, 0, 2},
+		{[]string{"172.16.2.0/24", "172.16.0.0/22"}, 0, 1},
+		{[]string{"10.0.0.0/24", "172.16.0.0/24", "172.16.0.0/16"}, 1, 2},
+	}
+	for _, tt := range tests {
+		if i, j := firstOverlap(networks(t, tt.prefixes...)); i != tt.i || j != tt.j {
+			t.Errorf("firstOverlap(%v) = %d, %d, want %d, %d", tt.prefixes, i, j, tt.i, tt.j)
+		}
+	}
+}
+
+func TestPlanSubnets(t *testing.T) {
+	space := networks(t, "172.16.0.0/16")
+	taken := networks(t, "172.16.0.0/24", "172.16.2.0/24")
+	planned, err := planSubnets(space, taken, []int{24, 23, 26})
+	if err != nil {
+		t.Fatalf("planSubnets: %v", err)
+	}
+	got := []string{}
+	for _, n := range planned {
+		got = append(got, n.String())
+	}
+	// The /23 is placed first, past the taken prefixes, then the /24 and the /26 in the gaps left.
+	want := []string{"172.16.1.0/24", "172.16.4.0/23", "172.16.3.0/26"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("planSubnets = %v, want %v", got, want)
+		}
+	}
+	if i, _ := firstOverlap(append(taken, planned...)); i >= 0 {
+		t.Errorf("planned subnets overlap: %v", got)
+	}
+
+	if _, err := planSubnets(networks(t, "172.16.0.0/24"), nil, []int{25, 25, 25}); err == nil {
+		t.Errorf("planning three /25 in a /24 succeeded, want an error")
+	}
+}
+
+// TestPlanLayout checks that the default subnets keep their prefixes and that a subnet added without one is
+// planned around them.
+func TestPlanLayout(t *testing.T) {
+	saved := layout
+	t.Cleanup(func() { layout = saved })
+	layout = append(append([]subnetLayout{}, defaultLayout...), subnetLayout{Name: "Extra", Size: 26})
+
+	planLayout(networks(t, defaultAddressSpace))
+	want := []string{"172.16.1.0/24", "172.16.2.0/24", "172.16.3.0/24", "172.16.0.0/26"}
+	for i, s := range layout {
+		if s.AddressPrefix != want[i] {
+			t.Errorf("subnet '%s' = %s, want %s", s.Name, s.AddressPrefix, want[i])
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// circuitCooldown is how long an open circuit fails requests before letting one through to see whether
+// ARM has recovered, which matters for the daemons running for hours.
+const circuitCooldown = time.Minute
+
+// Classes of failures the circuit breaker counts. Other failures, e.g. a missing resource or a
+// conflict, are answers about a single request and don't open the circuit.
+const (
+	failureAuth    = "authentication or authorization"
+	failureQuota   = "quota or throttling"
+	failureService = "service availability"
+)
+
+// circuitBreaker fails requests to ARM without sending them once -circuit-breaker consecutive requests
+// have failed with the same class of failure.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	class    string
+	failures []string
+	openedAt time.Time
+}
+
+// circuit is the breaker shared by all clients.
+var circuit = &circuitBreaker{}
+
+// circuitOpenError is the error of the requests an open circuit fails, summing up the failures that
+// opened it.
+type circuitOpenError struct {
+	class    string
+	failures []string
+}
+
+func (e circuitOpenError) Error() string {
+	return fmt.Sprintf("stopping early, the last %d requests to ARM failed with %s errors:\n\t%s",
+		len(e.failures), e.class, strings.Join(e.failures, "\n\t"))
+}
+
+// validateCircuitBreaker exits unless -circuit-breaker is valid.
+func validateCircuitBreaker() {
+	if *circuitThreshold < 0 {
+		fmt.Println("-circuit-breaker can't be negative, use 0 to turn it off")
+		os.Exit(1)
+	}
+}
+
+// isOpen reports whether the circuit fails requests.
+func (c *circuitBreaker) isOpen() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return *circuitThreshold > 0 && len(c.failures) >= *circuitThreshold
+}
+
+// allow returns the error to fail a request with while the circuit is open. Once circuitCooldown has
+// passed, it lets a request through and restarts the cooldown.
+func (c *circuitBreaker) allow() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if *circuitThreshold == 0 || len(c.failures) < *circuitThreshold {
+		return nil
+	}
+	if time.Since(c.openedAt) >= circuitCooldown {
+		c.openedAt = time.Now()
+		return nil
+	}
+	return circuitOpenError{c.class, append([]string{}, c.failures...)}
+}
+
+// record counts the outcome of a request: a failure of the same class as the previous ones adds to
+// them, any other outcome starts over.
+func (c *circuitBreaker) record(class, failure string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if class != c.class {
+		c.class, c.failures = class, nil
+	}
+	if class == "" {
+		return
+	}
+	c.failures = append(c.failures, failure)
+	if len(c.failures) > *circuitThreshold {
+		c.failures = c.failures[1:]
+	}
+	if len(c.failures) == *circuitThreshold {
+		c.openedAt = time.Now()
+	}
+}
+
+// withCircuitBreaker decorates a sender to fail requests without sending them while the circuit is open,
+// so that a run facing expired credentials, an exhausted quota or a regional outage stops with a single
+// error listing the failures, rather than going through every remaining step and waiting for each to
+// time out. Failures are counted after retries.
+func withCircuitBreaker(s autorest.Sender) autorest.Sender {
+	return autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+		if err := circuit.allow(); err != nil {
+			return nil, err
+		}
+		resp, err := s.Do(r)
+		class, failure := classifyFailure(r, resp, err)
+		circuit.record(class, failure)
+		return resp, err
+	})
+}
+
+// classifyFailure returns the class of failure of a request and a line describing it, or an empty class
+// if the request didn't fail in a way the circuit breaker counts. The body of an error response is read
+// and put back.
+func classifyFailure(r *http.Request, resp *http.Response, err error) (string, string) {
+	if err != nil {
+		return failureService, fmt.Sprintf("%s %s: %s", r.Method, r.URL.Path, err)
+	}
+	if resp.StatusCode < 400 {
+		return "", ""
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	code, message := armErrorOf(body)
+	failure := fmt.Sprintf("%s %s: %s %s: %s", r.Method, r.URL.Path, resp.Status, code, message)
+
+	lower := strings.ToLower(code)
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || strings.Contains(lower, "authorization") ||
+		strings.Contains(lower, "authentication") || strings.Contains(lower, "invalid_client") ||
+		strings.Contains(lower, "unauthorized_client"):
+		return failureAuth, failure
+	case resp.StatusCode == http.StatusTooManyRequests || strings.Contains(lower, "quota") ||
+		strings.Contains(lower, "throttl") || strings.Contains(lower, "skunotavailable"):
+		return failureQuota, failure
+	case resp.StatusCode >= 500:
+		return failureService, failure
+	}
+	return "", ""
+}
+
+// armErrorOf returns the code and message of an error response of ARM or of the token endpoint.
+func armErrorOf(body []byte) (string, string) {
+	var armError struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &armError) == nil && armError.Error.Code != "" {
+		return armError.Error.Code, armError.Error.Message
+	}
+	var oauthError struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if json.Unmarshal(body, &oauthError) == nil && oauthError.Error != "" {
+		return oauthError.Error, strings.SplitN(oauthError.Description, "\r\n", 2)[0]
+	}
+	return "", strings.TrimSpace(string(body))
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// command is a subcommand of the sample, e.g. `state diff`. Running the binary
+// without a command runs the sample end to end. Local commands run without authenticating.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string)
+	local   bool
+}
+
+// runningCommand is set while a command runs, as opposed to the sample's own run.
+var runningCommand bool
+
+var commands = []command{
+	{"apply", "create, update and, with -prune, delete VNets, subnets, public IPs and NICs to match a YAML topology spec", applySpec, false},
+	{"controller run", "keep reconciling the resources toward a topology spec, undoing drift, until interrupted", controllerRun, false},
+	{"operator run", "reconcile NICs and public IPs toward the AzureNIC and AzurePublicIP resources of a Kubernetes cluster", operatorRun, false},
+	{"operator crds", "print the CustomResourceDefinitions of AzureNIC and AzurePublicIP", operatorCRDs, true},
+	{"serve", "serve the NICs of the resource group over an HTTP JSON API authenticated with a bearer token", serve, false},
+	{"inventory daemon", "keep the inventory of resource groups in the -inventory file, for nic list and graph to read instead of ARM", inventoryDaemon, false},
+	{"plan", "print what a run would create or change, with What-If for -engine template or by comparing with the live resources", plan, false},
+	{"move", "move NICs with their public IPs and VMs to another resource group, after validating the move", moveResources, false},
+	{"history", "print who changed the resources of the last run and when, from the Activity Log", history, false},
+	{"resume", "wait for the long-running operations a killed run or -no-wait left in flight in the state file", resume, false},
+	{"state diff", "compare the state recorded by the last run with the live resources", stateDiff, false},
+	{"nic list", "list the NICs of the resource group as a table or CSV", nicList, false},
+	{"nic show", "print a NIC by name, or by resource ID in any subscription and resource group", nicShow, false},
+	{"nic create", "create a NIC whose subnet and public IP may be in other resource groups, checking location and join permissions", nicCreate, false},
+	{"nic browse", "browse the NICs interactively, toggling IP forwarding, attaching public IPs and deleting", nicBrowse, false},
+	{"nic effective-nsg", "print the security rules applying to a NIC from its subnet's and its own NSG", nicEffectiveNSG, false},
+	{"nic delete", "delete a NIC, or the NICs matching -prefix or -tag, detaching them from their VM, load balancers and application gateways first", nicDelete, false},
+	{"nic rename", "recreate a NIC under a new name with the same configuration, in its VM and with its static IPs", nicRename, false},
+	{"nic clone", "create a NIC with the configuration of another, with new dynamic IPs, in any subnet or resource group", nicClone, false},
+	{"nic diff", "print the configuration properties that differ between two NICs, or a NIC and a JSON snapshot", nicDiff, false},
+	{"nic export", "print the ARM JSON of a NIC, to back it up before a risky change", nicExport, false},
+	{"nic import", "create or restore a NIC from the JSON printed by nic export", nicImport, false},
+	{"nic tag", "set or remove tags of a NIC without rewriting the rest of its configuration", nicTag, false},
+	{"nic add-ip", "add secondary private IPs, dynamic or static, to a NIC", nicAddIP, false},
+	{"nic remove-ip", "remove secondary private IPs from a NIC", nicRemoveIP, false},
+	{"nic metrics", "print the traffic of a NIC from Azure Monitor as a table or sparklines", nicMetrics, false},
+	{"orphans", "list the NICs, public IPs and NSGs attached to nothing, with a Resource Graph query", orphans, false},
+	{"pip delete", "delete a public IP, detaching it from its NIC first with -force", pipDelete, false},
+	{"vnet check-ip", "report whether private IPs of a VNet are free, suggesting free ones otherwise", vnetCheckIP, false},
+	{"vnet plan", "print the subnet prefixes planned for subnets of the given sizes in an address space", vnetPlan, true},
+	{"vnet dns", "print or replace the DNS servers of a VNet", vnetDNS, false},
+	{"subnet capacity", "print the total, reserved, allocated and free addresses of each subnet of a VNet", subnetCapacity, false},
+	{"vm serial-log", "print the serial log of the VM and the URI of its console screenshot", vmSerialLog, false},
+	{"vm netinfo", "print the NICs of the VM as ARM sees them next to the addresses, routes and DNS inside the guest", vmNetinfo, false},
+	{"verify", "check with Network Watcher that each tier reaches the next one's private IP as expected", verifyCommand, false},
+	{"graph", "write a DOT or Mermaid diagram of the deployed topology", graph, false},
+}
+
+// runCommand runs the command named by the leading words of args, passing it the remaining arguments.
+func runCommand(args []string) {
+	for _, c := range commands {
+		words := strings.Fields(c.name)
+		if len(args) >= len(words) && strings.Join(args[:len(words)], " ") == c.name {
+			if !c.local {
+				authenticate()
+			}
+			runningCommand = true
+			c.run(args[len(words):])
+			return
+		}
+	}
+	fmt.Printf("Unknown command '%s'\n", strings.Join(args, " "))
+	usage()
+	os.Exit(1)
+}
+
+// usage prints the global flags and the available commands.
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [flags] [command]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		if strings.HasPrefix(c.name, "__") {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "  %-20s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nFlags:")
+	flag.PrintDefaults()
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// completionScripts are the scripts printed by `completion`. They hand the words typed so far to the
+// hidden __complete command, whose candidates they offer. The first verb is the name of the shell
+// function, the second the name of the binary.
+var completionScripts = map[string]string{
+	"bash": `_%[1]s() {
+    local IFS=$'\n'
+    local out
+    out=$(%[2]s __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null) || return
+    COMPREPLY=($out)
+}
+complete -o default -F _%[1]s %[2]s
+`,
+	"zsh": `#compdef %[2]s
+_%[1]s() {
+    local out
+    out=$(%[2]s __complete "${(@)words[2,CURRENT]}" 2>/dev/null) || return
+    [[ -n $out ]] && compadd -- "${(@f)out}"
+}
+compdef _%[1]s %[2]s
+`,
+	"fish": `function __%[1]s_complete
+    set -l tokens (commandline -opc) (commandline -ct)
+    %[2]s __complete $tokens[2..-1] 2>/dev/null
+end
+complete -c %[2]s -f -a '(__%[1]s_complete)'
+`,
+	"powershell": `Register-ArgumentCompleter -Native -CommandName '%[2]s' -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $words = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { $_.ToString() })
+    if ($wordToComplete -eq '') { $words += '""' }
+    & '%[2]s' __complete @words 2>$null | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`,
+}
+
+var shellIdentifier = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// The completion commands are registered here because complete itself looks through the commands.
+func init() {
+	commands = append(commands,
+		command{"completion", "print the bash, zsh, fish or powershell completion script", completion, true},
+		command{"__complete", "print the completion candidates for the given words", complete, true},
+	)
+}
+
+// completion prints the completion script for a shell.
+func completion(args []string) {
+	if len(args) != 1 || completionScripts[args[0]] == "" {
+		fmt.Println("Usage: completion bash|zsh|fish|powershell")
+		os.Exit(1)
+	}
+	binary := filepath.Base(os.Args[0])
+	fmt.Printf(completionScripts[args[0]], shellIdentifier.ReplaceAllString(binary, "_"), binary)
+}
+
+// complete prints the candidates for the last of args, given the words before it: flags,
+// command names, profile names after -profile, and the names of the NICs in the resource group
+// after a nic command.
+func complete(args []string) {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	current, typed := args[len(args)-1], args[:len(args)-1]
+
+	candidates := []string{}
+	words, pending := positionalWords(typed)
+	switch {
+	case pending == "profile":
+		for name := range config.Profiles {
+			candidates = append(candidates, name)
+		}
+	case pending != "":
+		// Let the shell complete file names and other values.
+	case strings.HasPrefix(current, "-"):
+		flag.VisitAll(func(f *flag.Flag) {
+			candidates = append(candidates, "-"+f.Name)
+		})
+	default:
+		for _, c := range commands {
+			cw := strings.Fields(c.name)
+			if strings.HasPrefix(c.name, "__") || len(words) >= len(cw) || strings.Join(cw[:len(words)], " ") != strings.Join(words, " ") {
+				continue
+			}
+			candidates = append(candidates, cw[len(words)])
+		}
+		if len(words) >= 2 && words[0] == "nic" {
+			candidates = append(candidates, nicNames(typed)...)
+		}
+	}
+
+	sort.Strings(candidates)
+	last := ""
+	for _, c := range candidates {
+		if c != last && strings.HasPrefix(c, current) {
+			fmt.Println(c)
+		}
+		last = c
+	}
+}
+
+// positionalWords returns the words of args that aren't flags or flag values, and the name of the
+// flag still waiting for its value if the last word is one.
+func positionalWords(args []string) ([]string, string) {
+	words, pending := []string{}, ""
+	for _, a := range args {
+		switch {
+		case pending != "":
+			pending = ""
+		case strings.HasPrefix(a, "-"):
+			name := strings.TrimLeft(a, "-")
+			if strings.Contains(name, "=") {
+				continue
+			}
+			if f := flag.Lookup(name); f != nil {
+				if b, ok := f.Value.(interface {
+					IsBoolFlag() bool
+				}); !ok || !b.IsBoolFlag() {
+					pending = name
+				}
+			}
+		default:
+			words = append(words, a)
+		}
+	}
+	return words, pending
+}
+
+// nicNames returns the names of the NICs in the resource group, authenticating with the global flags
+// among args. The completion scripts ignore the output if this fails.
+func nicNames(args []string) []string {
+	flag.CommandLine.Parse(args)
+	*quiet = true
+	loadConfig()
+	applyNaming()
+	authenticate()
+	names := []string{}
+	list, err := listGroupNICs(groupName)
+	onErrorFail(err, "List failed")
+	if list.Value != nil {
+		for _, nic := range *list.Value {
+			names = append(names, stringValue(nic.Name))
+		}
+	}
+	return names
+}
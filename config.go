@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+const defaultConfigPath = "config.json"
+
+// sampleConfig is the optional JSON configuration file of the sample.
+type sampleConfig struct {
+	// Profiles are named deployment targets, e.g. "dev" and "prod", selected with -profile.
+	Profiles map[string]profile `json:"profiles"`
+
+	// APIVersions overrides the ARM API versions used by the clients. Keys are either a service
+	// ("resources", "network", "compute", "storage", "dns") or a single client of the sample, e.g.
+	// "networkInterfaces", which takes precedence over its service.
+	APIVersions map[string]string `json:"apiVersions"`
+
+	// EventGrid is the custom topic to publish an event to when a deployment succeeds or fails.
+	EventGrid *eventGridTopic `json:"eventGrid"`
+
+	// RequiredTags are the tag keys every resource must carry. The sample refuses to deploy unless Tags
+	// or -tag provide a value for each of them.
+	RequiredTags []string `json:"requiredTags"`
+
+	// Tags are stamped on every resource the sample creates. -tag adds to and overrides them.
+	Tags map[string]string `json:"tags"`
+
+	// AddressSpace are the address prefixes of the VNet, 172.16.0.0/16 by default. -address-space overrides them.
+	AddressSpace []string `json:"addressSpace"`
+
+	// DNSServers are the DNS servers the VNets hand to their VMs instead of Azure-provided DNS.
+	DNSServers []string `json:"dnsServers"`
+
+	// Subnets replaces the sample's front-end, mid-tier and back-end subnets, each of which holds a NIC.
+	Subnets []subnetLayout `json:"subnets"`
+
+	// SubnetDelegations lists, per subnet name, the services the subnet is delegated to,
+	// e.g. "Microsoft.Web/serverFarms". No NICs are placed into delegated subnets.
+	SubnetDelegations map[string][]string `json:"subnetDelegations"`
+
+	// Naming overrides the names of the resources with templates.
+	Naming namingConfig `json:"naming"`
+
+	// Alert is the metric alert to create on the VM's outbound network traffic.
+	Alert *networkAlert `json:"alert"`
+
+	// Polling sets how often long-running operations are polled, as ARM asks when empty.
+	Polling *pollingConfig `json:"polling"`
+}
+
+// networkAlert configures a metric alert firing when a VM sends more than ThresholdBytes over WindowSize.
+type networkAlert struct {
+	ActionGroupID  string  `json:"actionGroupId"`
+	ThresholdBytes float64 `json:"thresholdBytes"`
+	// WindowSize is an ISO 8601 duration, PT5M when empty.
+	WindowSize string `json:"windowSize"`
+	// Severity ranges from 0 (critical) to 4 (verbose).
+	Severity int `json:"severity"`
+}
+
+// eventGridTopic is an Event Grid custom topic and one of its access keys.
+type eventGridTopic struct {
+	Endpoint string `json:"topicEndpoint"`
+	Key      string `json:"key"`
+}
+
+// profile holds the tenant, subscription and service principal of one deployment target.
+// Empty fields fall back to the corresponding AZURE_* environment variable.
+type profile struct {
+	TenantID       string `json:"tenantId"`
+	SubscriptionID string `json:"subscriptionId"`
+	ClientID       string `json:"clientId"`
+	ClientSecret   string `json:"clientSecret"`
+
+	// AuxiliaryTenants are the tenants of resources the service principal is a guest of.
+	// Their tokens are sent along with the primary tenant's.
+	AuxiliaryTenants []string `json:"auxiliaryTenants"`
+}
+
+var config sampleConfig
+
+// loadConfig reads the configuration file. A missing file is only an error when -config was given explicitly.
+func loadConfig() {
+	b, err := ioutil.ReadFile(*configPath)
+	if os.IsNotExist(err) && *configPath == defaultConfigPath {
+		return
+	}
+	onErrorFail(err, "ReadFile failed")
+	err = json.Unmarshal(b, &config)
+	onErrorFail(err, fmt.Sprintf("Parsing %s failed", *configPath))
+}
+
+// apiVersion returns the API version configured for a client, or else for its service, or else defaultVersion.
+func apiVersion(service, client, defaultVersion string) string {
+	if v := config.APIVersions[client]; v != "" {
+		return v
+	}
+	if v := config.APIVersions[service]; v != "" {
+		return v
+	}
+	return defaultVersion
+}
+
+// selectedProfile returns the profile chosen with -profile, or an empty profile when none was chosen.
+func selectedProfile() profile {
+	if *profileName == "" {
+		return profile{}
+	}
+	p, ok := config.Profiles[*profileName]
+	if !ok {
+		fmt.Printf("Profile '%s' is not defined in %s\n", *profileName, *configPath)
+		os.Exit(1)
+	}
+	return p
+}
+
+// profileOrEnvVar returns value if it is set, or else the value of the environment variable.
+func profileOrEnvVar(value, varName string) string {
+	if value != "" {
+		return value
+	}
+	return getEnvVarOrExit(varName)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// specWatchInterval is how often the controller checks whether the spec file changed.
+const specWatchInterval = 5 * time.Second
+
+// controllerRun reconciles the resources toward a topology spec until interrupted: on start, whenever the
+// spec file changes, and every -interval in between, which undoes drift such as a public IP detached or IP
+// forwarding toggled by hand. Failed passes are reported and retried at the next resync.
+func controllerRun(args []string) {
+	fs := flag.NewFlagSet("controller run", flag.ExitOnError)
+	file := fs.String("f", "", "path of the YAML or JSON topology spec")
+	interval := fs.Duration("interval", 5*time.Minute, "resync interval")
+	prune := fs.Bool("prune", false, "also delete the VNets, subnets, public IPs and NICs of the resource group missing from the spec")
+	fs.Parse(args)
+	if *file == "" || fs.NArg() > 0 || *interval <= 0 {
+		fmt.Println("Usage: controller run -f topology.yaml [-interval 5m] [-prune]")
+		os.Exit(1)
+	}
+	// The spec must be valid to start; later edits that break it are reported and the last good spec is kept.
+	spec, err := loadSpec(*file)
+	onErrorFail(err, "Reading the spec failed")
+	modified := specModTime(*file)
+	fmt.Printf("Reconciling resource group '%s' toward %s every %s\n", spec.ResourceGroup, *file, *interval)
+
+	next := time.Now()
+	for {
+		if t := specModTime(*file); !t.Equal(modified) {
+			modified = t
+			if changed, err := loadSpec(*file); err != nil {
+				fmt.Printf("%s Ignoring the changed spec: %s\n", timestamp(), err)
+			} else {
+				fmt.Printf("%s The spec changed\n", timestamp())
+				spec, next = changed, time.Now()
+			}
+		}
+		if !time.Now().Before(next) {
+			reconcile(spec, *prune)
+			next = time.Now().Add(*interval)
+		}
+		time.Sleep(specWatchInterval)
+	}
+}
+
+// reconcile applies the actions bringing the resources to the spec, printing them as they are applied.
+func reconcile(spec topologySpec, prune bool) {
+	actions, err := planSpec(spec, prune)
+	if err != nil {
+		fmt.Printf("%s Planning failed: %s\n", timestamp(), err)
+		return
+	}
+	if len(actions) == 0 {
+		stepf("%s In sync\n", timestamp())
+		return
+	}
+	for _, a := range actions {
+		fmt.Printf("%s %s\n", timestamp(), a)
+		if err := a.apply(); err != nil {
+			fmt.Printf("%s Failed: %s\n", timestamp(), err)
+			return
+		}
+	}
+	fmt.Printf("%s Reconciled %d actions\n", timestamp(), len(actions))
+}
+
+// specModTime returns the modification time of the spec file, or the zero time if it can't be read.
+func specModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// timestamp prefixes the controller's messages.
+func timestamp() string {
+	return time.Now().Format("15:04:05")
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/arm/resources/resources"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+const (
+	workspaceName = "sample-logs"
+
+	// The SDK has no client for diagnostic settings, so they are managed as generic resources.
+	diagnosticSettingAPIVersion = "2021-05-01-preview"
+
+	diagnosticSettingName = "send-to-log-analytics"
+)
+
+// configureDiagnostics sends the logs and metrics of the public IPs and NSGs in the resource group
+// to a Log Analytics workspace. An empty workspaceID creates a new workspace in the group.
+func configureDiagnostics(workspaceID string) {
+	if workspaceID == "" {
+		workspaceID = createWorkspace(westUS, resourceName("workspace", workspaceName, westUS, nil))
+	}
+
+	pips, err := listGroupPIPs(groupName)
+	onErrorFail(err, "List failed")
+	if pips.Value != nil {
+		for _, pip := range *pips.Value {
+			// Public IPs have DDoS protection logs and metrics.
+			createDiagnosticSetting(*pip.ID, *pip.Name, workspaceID, true)
+		}
+	}
+
+	nsgs, err := listGroupNSGs(groupName)
+	onErrorFail(err, "List failed")
+	if nsgs.Value != nil {
+		for _, nsg := range *nsgs.Value {
+			// NSGs have event and rule counter logs, but no metrics.
+			createDiagnosticSetting(*nsg.ID, *nsg.Name, workspaceID, false)
+		}
+	}
+}
+
+// createWorkspace creates a pay-as-you-go Log Analytics workspace and returns its resource ID.
+func createWorkspace(location, name string) string {
+	stepf("Create Log Analytics workspace '%s' in %s\n", name, location)
+	client := genericClient
+	client.APIVersion = genericAPIVersions["microsoft.operationalinsights/workspaces"]
+	id := strings.TrimPrefix(resourceID("Microsoft.OperationalInsights/workspaces", name), "/")
+
+	workspace := resources.GenericResource{
+		Location: to.StringPtr(location),
+		Tags:     resourceTags(),
+		Properties: &map[string]interface{}{
+			"sku":             map[string]interface{}{"name": "PerGB2018"},
+			"retentionInDays": 30,
+		},
+	}
+	_, err := client.CreateOrUpdateByID(id, workspace, nil)
+	onErrorFail(err, "CreateOrUpdateByID failed")
+
+	workspace, err = client.GetByID(id)
+	onErrorFail(err, "GetByID failed")
+	recordCreated("workspace", client.APIVersion, workspace.ID, workspace)
+	return *workspace.ID
+}
+
+// createDiagnosticSetting sends all the logs, and optionally all the metrics, of a resource to a workspace.
+func createDiagnosticSetting(resourceID, resourceName, workspaceID string, metrics bool) {
+	stepf("\tSend diagnostics of '%s' to the workspace\n", resourceName)
+	client := genericClient
+	client.APIVersion = diagnosticSettingAPIVersion
+
+	properties := map[string]interface{}{
+		"workspaceId": workspaceID,
+		"logs":        []interface{}{map[string]interface{}{"categoryGroup": "allLogs", "enabled": true}},
+	}
+	if metrics {
+		properties["metrics"] = []interface{}{map[string]interface{}{"category": "AllMetrics", "enabled": true}}
+	}
+	id := strings.TrimPrefix(resourceID, "/") + "/providers/Microsoft.Insights/diagnosticSettings/" + diagnosticSettingName
+	_, err := client.CreateOrUpdateByID(id, resources.GenericResource{Properties: &properties}, nil)
+	onErrorFail(err, "CreateOrUpdateByID failed")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+)
+
+// validateDNSServers exits unless every DNS server of the configuration file is an IP address.
+func validateDNSServers() {
+	if err := checkDNSServers(config.DNSServers); err != nil {
+		fmt.Printf("dnsServers in %s: %s\n", *configPath, err)
+		os.Exit(1)
+	}
+}
+
+// checkDNSServers returns an error unless every server is an IP address.
+func checkDNSServers(servers []string) error {
+	for _, s := range servers {
+		if net.ParseIP(s) == nil {
+			return fmt.Errorf("DNS server '%s' is not an IP address", s)
+		}
+	}
+	return nil
+}
+
+// dhcpOptions returns the DHCP options handing servers to the VMs of a VNet, or nil for Azure-provided DNS.
+func dhcpOptions(servers []string) *network.DhcpOptions {
+	if len(servers) == 0 {
+		return nil
+	}
+	s := append([]string{}, servers...)
+	return &network.DhcpOptions{DNSServers: &s}
+}
+
+// vnetDNS prints or replaces the DNS servers of an existing VNet.
+func vnetDNS(args []string) {
+	fs := flag.NewFlagSet("vnet dns", flag.ExitOnError)
+	name := fs.String("vnet", vNetName, "name of the VNet in the resource group")
+	clear := fs.Bool("clear", false, "switch the VNet back to Azure-provided DNS")
+	fs.Parse(args)
+	servers := fs.Args()
+
+	vNet, err := vNetClient.Get(groupName, *name, "")
+	onErrorFail(err, "Get failed")
+	if len(servers) == 0 && !*clear {
+		if vNet.DhcpOptions == nil || vNet.DhcpOptions.DNSServers == nil || len(*vNet.DhcpOptions.DNSServers) == 0 {
+			fmt.Printf("VNet '%s' uses Azure-provided DNS\n", *name)
+		} else {
+			fmt.Printf("VNet '%s' uses DNS servers %s\n", *name, strings.Join(*vNet.DhcpOptions.DNSServers, ", "))
+		}
+		return
+	}
+	if len(servers) > 0 && *clear {
+		fmt.Println("Usage: vnet dns [-vnet name] [-clear | server...]")
+		os.Exit(1)
+	}
+	onErrorFail(checkDNSServers(servers), "Invalid DNS servers")
+
+	// An empty list of servers switches back to Azure-provided DNS.
+	vNet.DhcpOptions = &network.DhcpOptions{DNSServers: &servers}
+	_, err = vNetClient.CreateOrUpdate(groupName, *name, vNet, nil)
+	onErrorFail(err, "CreateOrUpdate failed")
+	if *clear {
+		fmt.Printf("VNet '%s' now uses Azure-provided DNS\n", *name)
+	} else {
+		fmt.Printf("VNet '%s' now uses DNS servers %s\n", *name, strings.Join(servers, ", "))
+	}
+	fmt.Println("Running VMs pick up the change when their DHCP lease is renewed, or when they restart.")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/arm/dns"
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// dnsRecordTTL is the TTL in seconds of the A record registered for the public IP.
+const dnsRecordTTL = 300
+
+// registerDNSRecord points an A record of the -dns-zone zone at the public IP pipID and prints its
+// hostname. A zone missing from the sample's resource group is created; one in -dns-zone-group must exist.
+func registerDNSRecord(zoneName, pipID string) {
+	zoneGroup := *dnsZoneGroup
+	if zoneGroup == "" {
+		zoneGroup = groupName
+	}
+	zone, err := zoneClient.Get(zoneGroup, zoneName)
+	switch {
+	case err == nil:
+		stepf("Use DNS zone '%s' of resource group '%s'\n", zoneName, zoneGroup)
+	case isNotFound(zone.Response) && zoneGroup == groupName:
+		stepf("Create DNS zone '%s'\n", zoneName)
+		zone, err = zoneClient.CreateOrUpdate(groupName, zoneName, dns.Zone{
+			Location: to.StringPtr("global"),
+			Tags:     resourceTags(),
+		}, "", "")
+		onErrorFail(err, "CreateOrUpdate failed")
+		recordCreated("dnszone", zoneClient.APIVersion, zone.ID, zone)
+		if zone.NameServers != nil {
+			fmt.Printf("Delegate '%s' to the name servers %s at your registrar for the zone to resolve publicly\n",
+				zoneName, strings.Join(*zone.NameServers, ", "))
+		}
+	default:
+		onErrorFail(err, "Get failed")
+	}
+
+	pip, err := getPublicIP(pipID)
+	onErrorFail(err, "Get failed")
+	if pip.IPAddress == nil {
+		onErrorFail(fmt.Errorf("public IP '%s' has no address allocated yet", to.String(pip.Name)), "Register DNS record failed")
+	}
+
+	recordName := *dnsRecordName
+	if recordName == "" {
+		recordName = vmName
+	}
+	stepf("Point A record '%s' of zone '%s' at %s\n", recordName, zoneName, *pip.IPAddress)
+	record, err := recordSetClient.CreateOrUpdate(zoneGroup, zoneName, recordName, dns.A, dns.RecordSet{
+		RecordSetProperties: &dns.RecordSetProperties{
+			TTL:      to.Int64Ptr(dnsRecordTTL),
+			ARecords: &[]dns.ARecord{{Ipv4Address: pip.IPAddress}},
+		},
+	}, "", "")
+	onErrorFail(err, "CreateOrUpdate failed")
+	recordCreated("dnsrecord", recordSetClient.APIVersion, record.ID, record)
+	fmt.Printf("Hostname: %s.%s\n", recordName, zoneName)
+}
+
+// setReverseFQDN makes reverse DNS lookups of the public IP pipID answer fqdn. ARM only accepts an fqdn
+// that resolves to the IP or to the IP's own FQDN, so the forward record is checked first for a clear error.
+func setReverseFQDN(pipID, fqdn string) {
+	if !strings.HasSuffix(fqdn, ".") {
+		fqdn += "."
+	}
+	pip, err := getPublicIP(pipID)
+	onErrorFail(err, "Get failed")
+	onErrorFail(checkForwardRecord(fqdn, pip), "Set reverse FQDN failed")
+
+	stepf("Set the reverse FQDN of public IP '%s' to '%s'\n", to.String(pip.Name), fqdn)
+	if pip.DNSSettings == nil {
+		pip.DNSSettings = &network.PublicIPAddressDNSSettings{}
+	}
+	pip.DNSSettings.ReverseFqdn = to.StringPtr(fqdn)
+	_, err = addressClient.CreateOrUpdate(resourceGroupOf(pip.ID), *pip.Name, pip, nil)
+	onErrorFail(err, "CreateOrUpdate failed")
+	fmt.Printf("Reverse DNS of %s: %s\n", to.String(pip.IPAddress), fqdn)
+}
+
+// checkForwardRecord returns an error unless fqdn resolves to the address of pip, directly or through a
+// CNAME to the FQDN of pip's DNS label.
+func checkForwardRecord(fqdn string, pip network.PublicIPAddress) error {
+	host := strings.TrimSuffix(fqdn, ".")
+	if pip.IPAddress == nil {
+		return fmt.Errorf("public IP '%s' has no address allocated yet", to.String(pip.Name))
+	}
+	if pip.DNSSettings != nil && pip.DNSSettings.Fqdn != nil {
+		if cname, err := net.LookupCNAME(host); err == nil && strings.EqualFold(strings.TrimSuffix(cname, "."), *pip.DNSSettings.Fqdn) {
+			return nil
+		}
+	}
+	addrs, err := net.LookupHost(host)
+	if err != nil {
+		return fmt.Errorf("create a forward record for %s first, it doesn't resolve: %s", host, err)
+	}
+	for _, a := range addrs {
+		if a == *pip.IPAddress {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s resolves to %s rather than to %s", host, strings.Join(addrs, ", "), *pip.IPAddress)
+}
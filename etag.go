@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// etagRetries is how many times a conditional update is attempted from a fresh read when others keep
+// changing the resource in between.
+const etagRetries = 3
+
+// putNICIfMatch writes a NIC back only if it hasn't changed since it was read: the NIC's ETag is sent as
+// If-Match, and ARM answers 412 Precondition Failed if someone else updated it meanwhile. A NIC without an
+// ETag, e.g. one not read from ARM, is written unconditionally.
+func putNICIfMatch(group string, nic network.Interface) (autorest.Response, error) {
+	req, err := interfacesClient.CreateOrUpdatePreparer(group, *nic.Name, nic, nil)
+	if err != nil {
+		return autorest.Response{}, autorest.NewErrorWithError(err, "network.InterfacesClient", "CreateOrUpdate", nil, "Failure preparing request")
+	}
+	if nic.Etag != nil {
+		req.Header.Set("If-Match", *nic.Etag)
+	}
+	resp, err := interfacesClient.CreateOrUpdateSender(req)
+	if err != nil {
+		return autorest.Response{Response: resp}, autorest.NewErrorWithError(err, "network.InterfacesClient", "CreateOrUpdate", resp, "Failure sending request")
+	}
+	result, err := interfacesClient.CreateOrUpdateResponder(resp)
+	if err != nil {
+		err = autorest.NewErrorWithError(err, "network.InterfacesClient", "CreateOrUpdate", resp, "Failure responding to request")
+	}
+	return result, err
+}
+
+// isPreconditionFailed reports whether a conditional request failed because the resource changed.
+func isPreconditionFailed(resp autorest.Response) bool {
+	return resp.Response != nil && resp.StatusCode == http.StatusPreconditionFailed
+}
+
+// errNICUnchanged tells patchNIC that the NIC needs no update.
+var errNICUnchanged = errors.New("NIC unchanged")
+
+// patchNIC changes a NIC in place: it reads the live NIC, applies mutate to it and writes the result back
+// with If-Match, starting over from a fresh read if someone else changed the NIC in between. mutate sees the
+// current configuration on every attempt and should only touch what it means to change. It may return
+// errNICUnchanged to skip the update, and any other error aborts it. patchNIC returns the NIC as written.
+func patchNIC(group, name string, mutate func(*network.Interface) error) (network.Interface, error) {
+	for attempt := 1; ; attempt++ {
+		nic, err := interfacesClient.Get(group, name, "")
+		if err != nil {
+			return nic, err
+		}
+		if err = mutate(&nic); err == errNICUnchanged {
+			return nic, nil
+		} else if err != nil {
+			return nic, err
+		}
+		resp, err := putNICIfMatch(group, nic)
+		if isPreconditionFailed(resp) && attempt < etagRetries {
+			stepf("\tNIC '%s' changed meanwhile, retry with its current configuration\n", name)
+			continue
+		}
+		return nic, err
+	}
+}
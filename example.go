@@ -1,35 +1,49 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"net/http"
 	"os"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/Azure/azure-sdk-for-go/arm/compute"
+	"github.com/Azure/azure-sdk-for-go/arm/dns"
 	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/azure-sdk-for-go/arm/resources/locks"
 	"github.com/Azure/azure-sdk-for-go/arm/resources/resources"
 	"github.com/Azure/azure-sdk-for-go/arm/storage"
+	"github.com/Azure/go-autorest/autorest"
 	"github.com/Azure/go-autorest/autorest/azure"
 	"github.com/Azure/go-autorest/autorest/to"
 )
 
 const (
-	westUS          = "westus"
-	groupName       = "your-azure-sample-group"
-	vNetName        = "vNet"
-	nicNameFrontEnd = "nic1"
-	nicNameMidTier  = "nic2"
-	nicNameBackEnd  = "nic3"
-	accountName     = "golangrocksonazure"
-	vmName          = "vm"
-	vhdURItemplate  = "https://%s.blob.%s/golangcontainer/%s.vhd"
+	westUS         = "westus"
+	vhdURItemplate = "https://%s.blob.%s/golangcontainer/%s.vhd"
 )
 
-// This example requires that the following environment vars are set:
+// Names of the sample's resources, unless naming templates in the configuration file override them.
+var (
+	groupName   = "your-azure-sample-group"
+	vNetName    = "vNet"
+	accountName = "golangrocksonazure"
+	vmName      = "vm"
+
+	// nicNameFrontEnd is the VM's primary NIC, in the first subnet of the layout, and nicNameMidTier the NIC
+	// of the second subnet, which the sample deletes again. Both are set by applyNaming.
+	nicNameFrontEnd string
+	nicNameMidTier  string
+)
+
+// This example requires that the following environment vars are set, unless the
+// values are provided by a profile of the configuration file (see -profile):
 //
 // AZURE_TENANT_ID: contains your Azure Active Directory tenant ID or domain
 // AZURE_CLIENT_ID: contains your Azure Active Directory Application Client ID
 // AZURE_CLIENT_SECRET: contains your Azure Active Directory Application Secret
-// AZURE_SUBSCRIPTION_ID: contains your Azure Subscription ID
+// AZURE_SUBSCRIPTION_ID: contains your Azure Subscription ID, unless -subscription is given
 //
 
 var (
@@ -40,119 +54,331 @@ var (
 	interfacesClient network.InterfacesClient
 	accountClient    storage.AccountsClient
 	vmClient         compute.VirtualMachinesClient
+	peeringClient    network.VirtualNetworkPeeringsClient
+	nsgClient        network.SecurityGroupsClient
+	lockClient       locks.ManagementLocksClient
+	zoneClient       dns.ZonesClient
+	recordSetClient  dns.RecordSetsClient
+
+	// deploymentsClient submits the template of -engine template.
+	deploymentsClient resources.DeploymentsClient
+
+	// genericClient manages resources the SDK has no client for. Its APIVersion is set per resource type.
+	genericClient resources.Client
 )
 
-func init() {
-	subscriptionID := getEnvVarOrExit("AZURE_SUBSCRIPTION_ID")
-	tenantID := getEnvVarOrExit("AZURE_TENANT_ID")
+// authenticate gets a service principal token for the selected profile and creates the clients, or with
+// -offline creates clients of the fake ARM backend without authenticating.
+func authenticate() {
+	if *offline {
+		createClients(offlineSubscriptionID, autorest.NullAuthorizer{}, newSender())
+		return
+	}
+	p := selectedProfile()
+	subscriptionID := *subscription
+	if subscriptionID == "" {
+		subscriptionID = profileOrEnvVar(p.SubscriptionID, "AZURE_SUBSCRIPTION_ID")
+	}
+	tenantID := *tenant
+	if tenantID == "" {
+		tenantID = profileOrEnvVar(p.TenantID, "AZURE_TENANT_ID")
+	}
 
-	oauthConfig, err := azure.PublicCloud.OAuthConfigForTenant(tenantID)
-	onErrorFail(err, "Getting authentication token: OAuthConfigForTenant failed")
+	clientID := profileOrEnvVar(p.ClientID, "AZURE_CLIENT_ID")
+	clientSecret := profileOrEnvVar(p.ClientSecret, "AZURE_CLIENT_SECRET")
+	sender := newSender()
+	spToken := newServicePrincipalToken(tenantID, clientID, clientSecret, sender)
 
-	clientID := getEnvVarOrExit("AZURE_CLIENT_ID")
-	clientSecret := getEnvVarOrExit("AZURE_CLIENT_SECRET")
-	spToken, err := azure.NewServicePrincipalToken(*oauthConfig, clientID, clientSecret, azure.PublicCloud.ResourceManagerEndpoint)
-	onErrorFail(err, "Getting authentication token: NewServicePrincipalToken failed")
+	auxiliaryTenantIDs := p.AuxiliaryTenants
+	if *auxiliaryTenants != "" {
+		auxiliaryTenantIDs = splitList(*auxiliaryTenants)
+	}
+	if len(auxiliaryTenantIDs) == 0 {
+		createClients(subscriptionID, spToken, sender)
+		return
+	}
 
-	createClients(subscriptionID, spToken)
+	authorizer := auxiliaryAuthorizer{primary: spToken}
+	for _, t := range auxiliaryTenantIDs {
+		stepf("Get auxiliary token from tenant '%s'\n", t)
+		authorizer.auxiliary = append(authorizer.auxiliary, newServicePrincipalToken(t, clientID, clientSecret, sender))
+	}
+	createClients(subscriptionID, authorizer, sender)
 }
 
 func main() {
-	createResourceGroup()
-	createVirtualNetwork()
-	subnets := createSubnets()
-	pip1 := createPIP("pip1")
-	nics := createNICs(subnets, pip1)
-	createStorageAccount()
-	nirs := buildNIRs(nics)
-	createVM(nirs)
-	pip2 := createPIP("pip2")
-	updateNICwithPIP(nicNameFrontEnd, nics, pip2)
+	flag.Usage = usage
+	flag.Parse()
+	validateProgress()
+	loadConfig()
+	applyNaming()
+	if flag.NArg() > 0 {
+		runCommand(flag.Args())
+		emitProgress(progressEvent{Event: eventRunSucceeded})
+		return
+	}
+	authenticate()
+
+	validateTags()
+	resolveTopology()
+	pip1Name, pip2Name := samplePIPNames()
+	if *existingPIPID != "" {
+		checkDNSLabels(westUS, pip1Name)
+	} else {
+		checkDNSLabels(westUS, pip1Name, pip2Name)
+	}
+	switch {
+	case useExistingNetwork():
+	case *multiRegion:
+		checkAddressSpaceOverlap(append(append([]string{}, addressSpace...), peerAddressPrefix))
+	default:
+		checkAddressSpaceOverlap(addressSpace)
+	}
+	if *policyCheck {
+		checkPolicies()
+	}
+	resumeOperations()
+	deploying = true
+	if *existingGroup != "" {
+		useExistingGroup()
+	} else {
+		createResourceGroup()
+	}
+	var nics []network.Interface
+	var pip2 network.PublicIPAddress
+	if *engine == engineTemplate {
+		nics, pip2 = deployTemplate(westUS, pip1Name, pip2Name)
+		if config.Alert != nil {
+			createNetworkAlert(vmName, *config.Alert)
+		}
+	} else {
+		subnets := existingSubnets
+		if !useExistingNetwork() {
+			createVirtualNetwork(westUS, vNetName, addressSpace)
+			subnets = createSubnets()
+		}
+		pip1 := createPIP(pip1Name)
+		nics = createNICs(subnets, pip1)
+		createStorageAccount(westUS, accountName)
+		nirs := buildNIRs(nics)
+		createVM(westUS, vmName, accountName, nirs)
+		if *bastion {
+			deployBastion(westUS)
+		}
+		if *jit {
+			configureJIT(westUS)
+		}
+		if config.Alert != nil {
+			createNetworkAlert(vmName, *config.Alert)
+		}
+		if *multiRegion {
+			deploySecondRegion(*secondRegion)
+		}
+		pip2 = existingPIP
+		if *existingPIPID == "" {
+			pip2 = createPIP(pip2Name)
+		}
+		updateNICwithPIP(nicNameFrontEnd, pip2)
+	}
+	if *dnsZone != "" {
+		registerDNSRecord(*dnsZone, *pip2.ID)
+	}
+	if *reverseFQDN != "" {
+		setReverseFQDN(*pip2.ID, *reverseFQDN)
+	}
+	if *waitSSH > 0 && !*offline {
+		waitForSSH(*pip2.ID, *waitSSH)
+	}
+	printSSHCommand(*pip2.ID)
+	if *diagnostics || *workspaceID != "" {
+		configureDiagnostics(*workspaceID)
+	}
+	if *lockScope != "" {
+		createLocks(*lockScope)
+	}
 	listNICs()
+	if *nsgLevel != "" {
+		stepf("Effective security rules of NIC '%s'\n", nicNameFrontEnd)
+		nicEffectiveNSG([]string{nicNameFrontEnd})
+	}
+	if *verify && !verifyTiers(nil) {
+		onErrorFail(fmt.Errorf("connectivity between the tiers isn't as expected"), "Verify failed")
+	}
+	saveState()
+	if *outputsPath != "" {
+		writeOutputs(*outputsPath)
+	}
+	notifyDeployment(nil)
 
-	fmt.Printf("Press enter to delete NIC '%s'...\n", nicNameMidTier)
-	var input string
-	fmt.Scanln(&input)
+	if *bicepPath != "" {
+		exportBicep(*bicepPath)
+	}
+	if *terraformPath != "" {
+		exportTerraform(*terraformPath)
+	}
+	if *reportPath != "" {
+		writeReport(*reportPath)
+	}
 
-	deleteNIC(nicNameMidTier)
-	fmt.Println("Remaining NICs are...")
-	listNICs()
+	question := fmt.Sprintf("Detach NIC '%s' from VM '%s' and delete it?", nicNameMidTier, vmName)
+	if *deleteVM {
+		question = fmt.Sprintf("Delete VM '%s' and NIC '%s'?", vmName, nicNameMidTier)
+	}
+	if hasNIC(nics, nicNameMidTier) && confirm(question) {
+		deleteNIC(nicNameMidTier, *deleteVM)
+		stepf("Remaining NICs are...\n")
+		listNICs()
+	}
 
-	fmt.Print("Press enter to delete all the resources created in this sample...")
-	fmt.Scanln(&input)
+	switch {
+	case (*keepGroup || *existingGroup != "") && confirm("Delete all the resources created in this sample?"):
+		deleteSampleResources()
+	case !*keepGroup && *existingGroup == "" && confirm(fmt.Sprintf("Delete resource group '%s' and everything in it?", groupName)):
+		deleteResourceGroup()
+	default:
+		fmt.Printf("Leaving the resources in place, they are recorded in '%s'\n", *statePath)
+	}
+	emitProgress(progressEvent{Event: eventRunSucceeded})
+}
 
-	deleteResourceGroup()
+// resolveTopology validates the flags and configuration shaping the topology and resolves what it needs
+// from them: the VNet's address space and subnets, or the existing ones, and the existing public IP.
+func resolveTopology() {
+	validateNSGLevel()
+	if useExistingNetwork() {
+		resolveExistingNetwork()
+	} else {
+		validateAddressSpace()
+	}
+	validateDNSServers()
+	validatePIPFlags()
+	validateJIT()
+	validateEngine()
+	if *existingPIPID != "" {
+		resolveExistingPIP(*existingPIPID)
+	}
 }
 
 func createResourceGroup() {
-	fmt.Println("Create resource group")
+	stepf("Create resource group\n")
+	existence, err := groupClient.CheckExistence(groupName)
+	if !isNotFound(existence) {
+		onErrorFail(err, "CheckExistence failed")
+	}
+
 	resourceGroup := resources.ResourceGroup{
 		Location: to.StringPtr(westUS),
+		Tags:     resourceTags(),
 	}
-	_, err := groupClient.CreateOrUpdate(groupName, resourceGroup)
+	group, err := groupClient.CreateOrUpdate(groupName, resourceGroup)
 	onErrorFail(err, "CreateOrUpdate failed")
+	if isNotFound(existence) {
+		recordCreated("group", groupClient.APIVersion, group.ID, group)
+	} else {
+		stepf("\tResource group '%s' already exists, only the resources created in it will be rolled back on failure\n", groupName)
+	}
+}
+
+// useExistingGroup checks that the group given with -use-existing-group exists. It is never created,
+// recorded or deleted by the sample, so only the resources created in it are rolled back on failure.
+func useExistingGroup() {
+	stepf("Use existing resource group '%s'\n", groupName)
+	group, err := groupClient.Get(groupName)
+	if isNotFound(group.Response) {
+		fmt.Printf("Resource group '%s' doesn't exist, create it first or drop -use-existing-group\n", groupName)
+		os.Exit(1)
+	}
+	onErrorFail(err, "Get failed")
+	if !strings.EqualFold(stringValue(group.Location), westUS) {
+		stepf("\tResource group '%s' is in %s, the sample's resources are created in %s\n", groupName, *group.Location, westUS)
+	}
 }
 
-func createVirtualNetwork() {
-	fmt.Println("Create virtual network")
+func createVirtualNetwork(location, name string, addressPrefixes []string) network.VirtualNetwork {
+	stepf("Create virtual network '%s' in %s\n", name, location)
 	vNet := network.VirtualNetwork{
-		Location: to.StringPtr(westUS),
+		Location: to.StringPtr(location),
+		Tags:     resourceTags(),
 		VirtualNetworkPropertiesFormat: &network.VirtualNetworkPropertiesFormat{
 			AddressSpace: &network.AddressSpace{
-				AddressPrefixes: &[]string{"172.16.0.0/16"},
+				AddressPrefixes: &addressPrefixes,
 			},
+			DhcpOptions: dhcpOptions(config.DNSServers),
 		},
 	}
-	_, err := vNetClient.CreateOrUpdate(groupName, vNetName, vNet, nil)
+	_, err := vNetClient.CreateOrUpdate(groupName, name, vNet, nil)
 	onErrorFail(err, "CreateOrUpdate failed")
+
+	vNet, err = vNetClient.Get(groupName, name, "")
+	onErrorFail(err, "Get failed")
+	recordCreated("vnet", vNetClient.APIVersion, vNet.ID, vNet)
+	return vNet
 }
 
+// createSubnets creates the subnets of the layout, in order.
 func createSubnets() []network.Subnet {
-	fmt.Println("Create subnets")
-	subnet := network.Subnet{
-		SubnetPropertiesFormat: &network.SubnetPropertiesFormat{},
-	}
-	subnetNames := []string{"Front-end", "Mid-tier", "Back-end"}
+	stepf("Create subnets\n")
 	subnets := []network.Subnet{}
-	for i, n := range subnetNames {
-		fmt.Printf("\tCreate subnet: '%s'\n", n)
-		subnet.AddressPrefix = to.StringPtr(fmt.Sprintf("172.16.%v.0/24", i+1))
-		_, err := subnetClient.CreateOrUpdate(groupName, vNetName, n, subnet, nil)
-		onErrorFail(err, "\tCreateOrUpdate failed")
-
-		subnetInfo, err := subnetClient.Get(groupName, vNetName, n, "")
-		onErrorFail(err, "\tGet failed")
-
-		subnets = append(subnets, subnetInfo)
+	for _, s := range layout {
+		subnets = append(subnets, createSubnet(vNetName, s, subnetNSG(westUS, s)))
 	}
 	return subnets
 }
 
+// createSubnet creates a subnet in an existing virtual network, associated with nsg unless it is nil.
+func createSubnet(vNetName string, s subnetLayout, nsg *network.SecurityGroup) network.Subnet {
+	stepf("\tCreate subnet: '%s'\n", s.Name)
+	if len(s.Delegations) > 0 || len(s.ServiceEndpoints) > 0 {
+		createGenericSubnet(vNetName, s, nsg)
+	} else {
+		subnet := network.Subnet{
+			SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+				AddressPrefix:        to.StringPtr(s.AddressPrefix),
+				NetworkSecurityGroup: nsg,
+			},
+		}
+		_, err := subnetClient.CreateOrUpdate(groupName, vNetName, s.Name, subnet, nil)
+		onErrorFail(err, "\tCreateOrUpdate failed")
+	}
+
+	subnetInfo, err := subnetClient.Get(groupName, vNetName, s.Name, "")
+	onErrorFail(err, "\tGet failed")
+	recordCreated("subnet", subnetClient.APIVersion, subnetInfo.ID, subnetInfo)
+	return subnetInfo
+}
+
 // createPIP creates a public IP address
 func createPIP(pipName string) network.PublicIPAddress {
-	fmt.Printf("Create public IP address: '%s'\n", pipName)
-	pip := network.PublicIPAddress{
-		Location: to.StringPtr(westUS),
-		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
-			DNSSettings: &network.PublicIPAddressDNSSettings{
-				DomainNameLabel: to.StringPtr(fmt.Sprintf("azuresample-%s", pipName)),
-			},
-		},
+	stepf("Create public IP address: '%s'\n", pipName)
+	properties := newPIPProperties(pipName)
+	if *pipTier != "" {
+		createStandardPIP(pipName, *pipTier, properties)
+	} else {
+		pip := network.PublicIPAddress{
+			Location:                        to.StringPtr(westUS),
+			Tags:                            resourceTags(),
+			PublicIPAddressPropertiesFormat: properties,
+		}
+		_, err := addressClient.CreateOrUpdate(groupName, pipName, pip, nil)
+		onErrorFail(err, "CreateOrUpdate failed")
 	}
-	_, err := addressClient.CreateOrUpdate(groupName, pipName, pip, nil)
-	onErrorFail(err, "CreateOrUpdate failed")
 
-	fmt.Println("Get public IP address")
-	pip, err = addressClient.Get(groupName, pipName, "")
+	stepf("Get public IP address\n")
+	pip, err := addressClient.Get(groupName, pipName, "")
 	onErrorFail(err, "Get failed")
+	recordCreated("pip", addressClient.APIVersion, pip.ID, pip)
+	if pip.DNSSettings != nil && pip.DNSSettings.Fqdn != nil {
+		fmt.Printf("Public IP '%s': %s\n", pipName, *pip.DNSSettings.Fqdn)
+	}
 
 	return pip
 }
 
 func createNICs(subnets []network.Subnet, pip network.PublicIPAddress) []network.Interface {
-	fmt.Println("Create network interfaces (NICs)")
+	stepf("Create network interfaces (NICs)\n")
 	nic := network.Interface{
 		Location: to.StringPtr(westUS),
+		Tags:     resourceTags(),
 		InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
 			IPConfigurations: &[]network.InterfaceIPConfiguration{
 				{
@@ -163,25 +389,43 @@ func createNICs(subnets []network.Subnet, pip network.PublicIPAddress) []network
 			},
 		},
 	}
-	nicNames := []string{
-		nicNameFrontEnd,
-		nicNameMidTier,
-		nicNameBackEnd,
-	}
 	nics := []network.Interface{}
-	for i, n := range nicNames {
-		fmt.Printf("\tCreate NIC '%s' using subnet '%s'\n", n, *subnets[i].Name)
+	for i, s := range layout {
+		n := s.NIC
+		if len(s.Delegations) > 0 {
+			if n == nicNameFrontEnd {
+				onErrorFail(fmt.Errorf("subnet '%s' is delegated to %s, but holds the VM's primary NIC", s.Name, strings.Join(s.Delegations, ", ")),
+					"\tCreate NIC failed")
+			}
+			stepf("\tSkip NIC '%s', subnet '%s' is delegated to %s\n", n, s.Name, strings.Join(s.Delegations, ", "))
+			continue
+		}
+		stepf("\tCreate NIC '%s' using subnet '%s'\n", n, *subnets[i].Name)
 		(*nic.IPConfigurations)[0].Name = to.StringPtr(fmt.Sprintf("IPconfig%v", i+1))
 		(*nic.IPConfigurations)[0].Subnet = &subnets[i]
+		if s.PrivateIP != "" {
+			// Checking first turns ARM's generic failure into one naming the address's current holder.
+			subnet, err := getSubnet(*subnets[i].ID)
+			onErrorFail(err, "\tGet failed")
+			onErrorFail(checkStaticIP(subnet, s.PrivateIP), "\tCreate NIC failed")
+			stepf("\t\tAssign static private IP %s\n", s.PrivateIP)
+			(*nic.IPConfigurations)[0].PrivateIPAllocationMethod = network.Static
+			(*nic.IPConfigurations)[0].PrivateIPAddress = to.StringPtr(s.PrivateIP)
+		} else {
+			(*nic.IPConfigurations)[0].PrivateIPAllocationMethod = network.Dynamic
+			(*nic.IPConfigurations)[0].PrivateIPAddress = nil
+		}
 
 		if n == nicNameFrontEnd {
 			nic.EnableIPForwarding = to.BoolPtr(true)
 			(*nic.IPConfigurations)[0].Primary = to.BoolPtr(true)
 			(*nic.IPConfigurations)[0].PublicIPAddress = &pip
+			nic.NetworkSecurityGroup = nicNSG(westUS, n)
 		} else {
 			nic.EnableIPForwarding = nil
 			(*nic.IPConfigurations)[0].Primary = nil
 			(*nic.IPConfigurations)[0].PublicIPAddress = nil
+			nic.NetworkSecurityGroup = nil
 		}
 
 		_, err := interfacesClient.CreateOrUpdate(groupName, n, nic, nil)
@@ -189,34 +433,40 @@ func createNICs(subnets []network.Subnet, pip network.PublicIPAddress) []network
 
 		nicInfo, err := interfacesClient.Get(groupName, n, "")
 		onErrorFail(err, "Get failed")
+		recordCreated("nic", interfacesClient.APIVersion, nicInfo.ID, nicInfo)
 
 		nics = append(nics, nicInfo)
 	}
 	return nics
 }
 
-func createStorageAccount() {
-	fmt.Println("Create storage account")
+func createStorageAccount(location, name string) {
+	stepf("Create storage account '%s' in %s\n", name, location)
 	account := storage.AccountCreateParameters{
 		Sku: &storage.Sku{
 			Name: storage.StandardLRS},
-		Location: to.StringPtr(westUS),
+		Location:                          to.StringPtr(location),
+		Tags:                              resourceTags(),
 		AccountPropertiesCreateParameters: &storage.AccountPropertiesCreateParameters{},
 	}
-	_, err := accountClient.Create(groupName, accountName, account, nil)
+	_, err := accountClient.Create(groupName, name, account, nil)
 	onErrorFail(err, "Create failed")
+
+	accountInfo, err := accountClient.GetProperties(groupName, name)
+	onErrorFail(err, "GetProperties failed")
+	recordCreated("storage", accountClient.APIVersion, accountInfo.ID, accountInfo)
 }
 
 func buildNIRs(nics []network.Interface) []compute.NetworkInterfaceReference {
-	fmt.Println("Assign NIC to Network Interface References (NIRs) ")
+	stepf("Assign NIC to Network Interface References (NIRs) \n")
 	nirs := []compute.NetworkInterfaceReference{}
 	for i, nic := range nics {
-		fmt.Printf("\tAssign NIC '%s' to NIR %v\n", *nic.Name, i)
+		stepf("\tAssign NIC '%s' to NIR %v\n", *nic.Name, i)
 		nir := compute.NetworkInterfaceReference{
 			ID: nic.ID,
 		}
 		if nic.Name != nil && *nic.Name == nicNameFrontEnd {
-			fmt.Printf("\t%v is assigned to the primary NIR\n", nicNameFrontEnd)
+			stepf("\t%v is assigned to the primary NIR\n", nicNameFrontEnd)
 			nir.NetworkInterfaceReferenceProperties = &compute.NetworkInterfaceReferenceProperties{
 				Primary: to.BoolPtr(true),
 			}
@@ -230,10 +480,22 @@ func buildNIRs(nics []network.Interface) []compute.NetworkInterfaceReference {
 	return nirs
 }
 
-func createVM(nirs []compute.NetworkInterfaceReference) {
-	fmt.Println("Create VM with the assigned NIRs")
+func createVM(location, name, account string, nirs []compute.NetworkInterfaceReference) {
+	stepf("Create VM '%s' in %s with the assigned NIRs\n", name, location)
+	vm := vmModel(location, name, account, nirs)
+	_, err := vmClient.CreateOrUpdate(groupName, name, vm, nil)
+	onErrorFail(err, "CreateOrUpdate failed")
+
+	vm, err = vmClient.Get(groupName, name, "")
+	onErrorFail(err, "Get failed")
+	recordCreated("vm", vmClient.APIVersion, vm.ID, vm)
+}
+
+// vmModel returns the VM the sample creates, with its OS disk in the storage account and the NICs of nirs.
+func vmModel(location, name, account string, nirs []compute.NetworkInterfaceReference) compute.VirtualMachine {
 	vm := compute.VirtualMachine{
-		Location: to.StringPtr(westUS),
+		Location: to.StringPtr(location),
+		Tags:     resourceTags(),
 		VirtualMachineProperties: &compute.VirtualMachineProperties{
 			HardwareProfile: &compute.HardwareProfile{
 				VMSize: compute.StandardD3V2,
@@ -248,70 +510,71 @@ func createVM(nirs []compute.NetworkInterfaceReference) {
 				OsDisk: &compute.OSDisk{
 					Name: to.StringPtr("osDisk"),
 					Vhd: &compute.VirtualHardDisk{
-						URI: to.StringPtr(fmt.Sprintf(vhdURItemplate, accountName, azure.PublicCloud.StorageEndpointSuffix, vmName)),
+						URI: to.StringPtr(fmt.Sprintf(vhdURItemplate, account, azure.PublicCloud.StorageEndpointSuffix, name)),
 					},
 					CreateOption: compute.FromImage,
 				},
 			},
 			OsProfile: &compute.OSProfile{
-				ComputerName:  to.StringPtr(vmName),
-				AdminUsername: to.StringPtr("notadmin"),
+				ComputerName:  to.StringPtr(name),
+				AdminUsername: to.StringPtr(adminUsername),
 				AdminPassword: to.StringPtr("Pa$$w0rd1975"),
 			},
 			NetworkProfile: &compute.NetworkProfile{
 				NetworkInterfaces: &[]compute.NetworkInterfaceReference{},
 			},
+			DiagnosticsProfile: bootDiagnostics(account),
 		},
 	}
 
 	vm.VirtualMachineProperties.NetworkProfile.NetworkInterfaces = &nirs
-
-	_, err := vmClient.CreateOrUpdate(groupName, vmName, vm, nil)
-	onErrorFail(err, "CreateOrUpdate failed")
-
+	if linux := linuxConfiguration(); linux != nil {
+		vm.OsProfile.AdminPassword = nil
+		vm.OsProfile.LinuxConfiguration = linux
+	}
+	return vm
 }
 
-func updateNICwithPIP(nicName string, nics []network.Interface, pip network.PublicIPAddress) {
-	var index int
-	for i, nic := range nics {
-		if *nic.Name == nicName {
-			index = i
-		}
-	}
-	fmt.Printf("Update NIC '%s' with PIP '%s'\n", nicName, *pip.Name)
-	(*nics[index].IPConfigurations)[0].PublicIPAddress = &pip
-	(*nics[index].IPConfigurations)[0].Primary = to.BoolPtr(true)
-	_, err := interfacesClient.CreateOrUpdate(groupName, nicName, nics[index], nil)
+// updateNICwithPIP attaches the public IP to the live NIC's first IP configuration.
+func updateNICwithPIP(nicName string, pip network.PublicIPAddress) {
+	stepf("Update NIC '%s' with PIP '%s'\n", nicName, *pip.Name)
+	_, err := patchNIC(groupName, nicName, func(nic *network.Interface) error {
+		(*nic.IPConfigurations)[0].PublicIPAddress = &pip
+		(*nic.IPConfigurations)[0].Primary = to.BoolPtr(true)
+		return nil
+	})
 	onErrorFail(err, "CreateOrUpdate failed")
 }
 
 func listNICs() {
-	fmt.Println("Listing NICs")
-	list, err := interfacesClient.List(groupName)
+	stepf("Listing NICs\n")
+	list, err := listGroupNICs(groupName)
 	onErrorFail(err, "List failed")
 	if list.Value == nil || len(*list.Value) == 0 {
 		fmt.Printf("There are no NICs in %s resource group\n", groupName)
 	} else {
-		for _, nic := range *list.Value {
-			printNIC(nic)
-		}
+		pips, err := listGroupPIPs(groupName)
+		onErrorFail(err, "List failed")
+		printNICs(*list.Value, publicIPAddresses(pips))
 	}
 }
 
-func deleteNIC(nicName string) {
-	fmt.Println("Delete NIC")
-	fmt.Println("\tFirst, delete the VM")
-	_, err := vmClient.Delete(groupName, vmName, nil)
-	onErrorFail(err, "Delete failed")
-	fmt.Println("\tSecond, delete the NIC")
-	_, err = interfacesClient.Delete(groupName, nicName, nil)
-	onErrorFail(err, "Delete failed")
-}
-
 func deleteResourceGroup() {
-	fmt.Println("Deleting resource group")
-	_, err := groupClient.Delete(groupName, nil)
+	deleteResources(outsideGroup(runState.Resources))
+	stepf("Deleting resource group\n")
+	unlockFor(resourceID("", ""))
+	url, err := withoutWaiting(func(cancel <-chan struct{}) error {
+		_, err := groupClient.Delete(groupName, cancel)
+		return err
+	})
 	onErrorFail(err, "Delete failed")
+	if url != "" {
+		printAccepted("Deletion", resourceID("", ""), url)
+		fmt.Printf("The resources stay recorded in '%s' until ARM has deleted them\n", *statePath)
+		return
+	}
+	runState.Resources = nil
+	writeState()
 }
 
 // getEnvVarOrExit returns the value of specified environment variable or terminates if it's not defined.
@@ -325,46 +588,273 @@ func getEnvVarOrExit(varName string) string {
 	return value
 }
 
-// onErrorFail prints a failure message and exits the program if err is not nil.
+// failureHooks are run by onErrorFail, the last registered first, before it rolls back and exits: deferred
+// functions don't run on os.Exit.
+var failureHooks []func()
+
+// onFailure registers hook to be run if the program fails before the returned function is called.
+func onFailure(hook func()) (done func()) {
+	failureHooks = append(failureHooks, hook)
+	i := len(failureHooks) - 1
+	return func() {
+		if i < len(failureHooks) {
+			failureHooks[i] = nil
+		}
+	}
+}
+
+// onErrorFail prints a failure message, runs the failure hooks, rolls back the resources created so far and exits the program if err is not nil,
+// with the exit code of the kind of failure. While serving, it fails the request being served instead.
 func onErrorFail(err error, message string) {
 	if err != nil {
+		if serving {
+			panic(requestFailure{message: message, err: err})
+		}
 		fmt.Printf("%s: %s\n", message, err)
-		groupClient.Delete(groupName, nil)
-		os.Exit(1)
+		emitProgress(progressEvent{Event: eventRunFailed, Message: message, Error: err.Error()})
+		notifyDeployment(fmt.Errorf("%s: %s", message, err))
+		hooks := failureHooks
+		failureHooks = nil
+		for i := len(hooks) - 1; i >= 0; i-- {
+			if hooks[i] != nil {
+				hooks[i]()
+			}
+		}
+		rollback()
+		os.Exit(exitCode(err))
+	}
+}
+
+// isNotFound reports whether resp is ARM's answer for a resource that doesn't exist.
+func isNotFound(resp autorest.Response) bool {
+	return resp.Response != nil && resp.StatusCode == http.StatusNotFound
+}
+
+// printNICs prints an aligned table of Network Interfaces, with extra columns when -wide is set.
+// addresses maps the lower-cased IDs of public IPs to their address.
+func printNICs(nics []network.Interface, addresses map[string]string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := "NAME\tPRIVATE IP\tPUBLIC IP\tMAC\tSUBNET\tVM\tSTATE"
+	if *wide {
+		header += "\tLOCATION\tIP FORWARDING\tALLOCATION\tIPCONFIGS\tID"
+	}
+	fmt.Fprintln(w, header)
+
+	for _, nic := range nics {
+		if nic.InterfacePropertiesFormat == nil {
+			nic.InterfacePropertiesFormat = &network.InterfacePropertiesFormat{}
+		}
+		ipConfig := primaryIPConfiguration(nic)
+		privateIP, publicIP, subnet, allocation := "", "", "", ""
+		if ipConfig != nil && ipConfig.InterfaceIPConfigurationPropertiesFormat != nil {
+			privateIP = stringValue(ipConfig.PrivateIPAddress)
+			allocation = string(ipConfig.PrivateIPAllocationMethod)
+			if ipConfig.PublicIPAddress != nil && ipConfig.PublicIPAddress.ID != nil {
+				publicIP = addresses[strings.ToLower(*ipConfig.PublicIPAddress.ID)]
+				if publicIP == "" {
+					publicIP = "(unallocated)"
+				}
+			}
+			if ipConfig.Subnet != nil {
+				subnet = lastSegment(ipConfig.Subnet.ID)
+			}
+		}
+		vm := ""
+		if nic.VirtualMachine != nil {
+			vm = lastSegment(nic.VirtualMachine.ID)
+		}
+
+		row := []string{stringValue(nic.Name), privateIP, publicIP, stringValue(nic.MacAddress), subnet, vm, stringValue(nic.ProvisioningState)}
+		if *wide {
+			forwarding := "false"
+			if nic.EnableIPForwarding != nil {
+				forwarding = fmt.Sprint(*nic.EnableIPForwarding)
+			}
+			ipConfigs := 0
+			if nic.IPConfigurations != nil {
+				ipConfigs = len(*nic.IPConfigurations)
+			}
+			row = append(row, stringValue(nic.Location), forwarding, allocation, fmt.Sprint(ipConfigs), stringValue(nic.ID))
+		}
+		for i := range row {
+			if row[i] == "" {
+				row[i] = "-"
+			}
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+}
+
+// primaryIPConfiguration returns the primary IP configuration of a NIC, or its first one if none is marked primary.
+func primaryIPConfiguration(nic network.Interface) *network.InterfaceIPConfiguration {
+	if nic.InterfacePropertiesFormat == nil || nic.IPConfigurations == nil || len(*nic.IPConfigurations) == 0 {
+		return nil
+	}
+	for i, ipConfig := range *nic.IPConfigurations {
+		if ipConfig.InterfaceIPConfigurationPropertiesFormat != nil && ipConfig.Primary != nil && *ipConfig.Primary {
+			return &(*nic.IPConfigurations)[i]
+		}
 	}
+	return &(*nic.IPConfigurations)[0]
 }
 
-// printNIC prints basic info about a Network Interface.
-func printNIC(nic network.Interface) {
-	fmt.Printf("Network interface '%s'\n", *nic.Name)
-	fmt.Printf("\tLocation:                    %s\n", *nic.Location)
-	fmt.Printf("\tIP forwarding enabled:       %t\n", *nic.EnableIPForwarding)
-	fmt.Printf("\tMAC address:                 %s\n", *nic.MacAddress)
-	fmt.Printf("\tPrivate IP:                  %s\n", *(*nic.IPConfigurations)[0].PrivateIPAddress)
-	fmt.Printf("\tPrivate allocation method:   %s\n", (*nic.IPConfigurations)[0].PrivateIPAllocationMethod)
-	fmt.Printf("\tPrimary virtual network ID:  %s\n", *(*nic.IPConfigurations)[0].Subnet.ID)
-	fmt.Println()
+// publicIPAddresses maps the lower-cased IDs of the listed public IPs to their allocated address.
+func publicIPAddresses(list network.PublicIPAddressListResult) map[string]string {
+	addresses := map[string]string{}
+	if list.Value != nil {
+		for _, pip := range *list.Value {
+			if pip.ID != nil && pip.PublicIPAddressPropertiesFormat != nil {
+				addresses[strings.ToLower(*pip.ID)] = stringValue(pip.IPAddress)
+			}
+		}
+	}
+	return addresses
+}
+
+// stringValue dereferences s, returning "" for nil.
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// lastSegment returns the last segment of a resource ID, i.e. the resource's name.
+func lastSegment(id *string) string {
+	if id == nil {
+		return ""
+	}
+	parts := strings.Split(*id, "/")
+	return parts[len(parts)-1]
 }
 
-func createClients(subscriptionID string, spToken *azure.ServicePrincipalToken) {
+// createClients creates the clients of the subscription, which send their requests with sender. The sender
+// retries failed requests, so the clients' own retries are turned off. The clients apply the decorators
+// registered with registerPrepareDecorator and registerRespondDecorator.
+func createClients(subscriptionID string, authorizer autorest.Authorizer, sender autorest.Sender) {
 	groupClient = resources.NewGroupsClient(subscriptionID)
-	groupClient.Authorizer = spToken
+	groupClient.Authorizer = authorizer
+	groupClient.Sender = sender
+	groupClient.RetryAttempts = 0
+	groupClient.RequestInspector = inspectRequest
+	groupClient.ResponseInspector = inspectResponse
+	groupClient.UserAgent = userAgent(groupClient.UserAgent)
+	groupClient.APIVersion = apiVersion("resources", "resourceGroups", groupClient.APIVersion)
 
 	vNetClient = network.NewVirtualNetworksClient(subscriptionID)
-	vNetClient.Authorizer = spToken
+	vNetClient.Authorizer = authorizer
+	vNetClient.Sender = sender
+	vNetClient.RetryAttempts = 0
+	vNetClient.RequestInspector = inspectRequest
+	vNetClient.ResponseInspector = inspectResponse
+	vNetClient.UserAgent = userAgent(vNetClient.UserAgent)
+	vNetClient.APIVersion = apiVersion("network", "virtualNetworks", vNetClient.APIVersion)
 
 	subnetClient = network.NewSubnetsClient(subscriptionID)
-	subnetClient.Authorizer = spToken
+	subnetClient.Authorizer = authorizer
+	subnetClient.Sender = sender
+	subnetClient.RetryAttempts = 0
+	subnetClient.RequestInspector = inspectRequest
+	subnetClient.ResponseInspector = inspectResponse
+	subnetClient.UserAgent = userAgent(subnetClient.UserAgent)
+	subnetClient.APIVersion = apiVersion("network", "subnets", subnetClient.APIVersion)
 
 	addressClient = network.NewPublicIPAddressesClient(subscriptionID)
-	addressClient.Authorizer = spToken
+	addressClient.Authorizer = authorizer
+	addressClient.Sender = sender
+	addressClient.RetryAttempts = 0
+	addressClient.RequestInspector = inspectRequest
+	addressClient.ResponseInspector = inspectResponse
+	addressClient.UserAgent = userAgent(addressClient.UserAgent)
+	addressClient.APIVersion = apiVersion("network", "publicIPAddresses", addressClient.APIVersion)
 
 	interfacesClient = network.NewInterfacesClient(subscriptionID)
-	interfacesClient.Authorizer = spToken
+	interfacesClient.Authorizer = authorizer
+	interfacesClient.Sender = sender
+	interfacesClient.RetryAttempts = 0
+	interfacesClient.RequestInspector = inspectRequest
+	interfacesClient.ResponseInspector = inspectResponse
+	interfacesClient.UserAgent = userAgent(interfacesClient.UserAgent)
+	interfacesClient.APIVersion = apiVersion("network", "networkInterfaces", interfacesClient.APIVersion)
 
 	accountClient = storage.NewAccountsClient(subscriptionID)
-	accountClient.Authorizer = spToken
+	accountClient.Authorizer = authorizer
+	accountClient.Sender = sender
+	accountClient.RetryAttempts = 0
+	accountClient.RequestInspector = inspectRequest
+	accountClient.ResponseInspector = inspectResponse
+	accountClient.UserAgent = userAgent(accountClient.UserAgent)
+	accountClient.APIVersion = apiVersion("storage", "storageAccounts", accountClient.APIVersion)
 
 	vmClient = compute.NewVirtualMachinesClient(subscriptionID)
-	vmClient.Authorizer = spToken
+	vmClient.Authorizer = authorizer
+	vmClient.Sender = sender
+	vmClient.RetryAttempts = 0
+	vmClient.RequestInspector = inspectRequest
+	vmClient.ResponseInspector = inspectResponse
+	vmClient.UserAgent = userAgent(vmClient.UserAgent)
+	vmClient.APIVersion = apiVersion("compute", "virtualMachines", vmClient.APIVersion)
+
+	peeringClient = network.NewVirtualNetworkPeeringsClient(subscriptionID)
+	peeringClient.Authorizer = authorizer
+	peeringClient.Sender = sender
+	peeringClient.RetryAttempts = 0
+	peeringClient.RequestInspector = inspectRequest
+	peeringClient.ResponseInspector = inspectResponse
+	peeringClient.UserAgent = userAgent(peeringClient.UserAgent)
+	peeringClient.APIVersion = apiVersion("network", "virtualNetworkPeerings", peeringClient.APIVersion)
+
+	nsgClient = network.NewSecurityGroupsClient(subscriptionID)
+	nsgClient.Authorizer = authorizer
+	nsgClient.Sender = sender
+	nsgClient.RetryAttempts = 0
+	nsgClient.RequestInspector = inspectRequest
+	nsgClient.ResponseInspector = inspectResponse
+	nsgClient.UserAgent = userAgent(nsgClient.UserAgent)
+	nsgClient.APIVersion = apiVersion("network", "networkSecurityGroups", nsgClient.APIVersion)
+
+	lockClient = locks.NewManagementLocksClient(subscriptionID)
+	lockClient.Authorizer = authorizer
+	lockClient.Sender = sender
+	lockClient.RetryAttempts = 0
+	lockClient.RequestInspector = inspectRequest
+	lockClient.ResponseInspector = inspectResponse
+	lockClient.UserAgent = userAgent(lockClient.UserAgent)
+	lockClient.APIVersion = apiVersion("resources", "locks", lockClient.APIVersion)
+
+	zoneClient = dns.NewZonesClient(subscriptionID)
+	zoneClient.Authorizer = authorizer
+	zoneClient.Sender = sender
+	zoneClient.RetryAttempts = 0
+	zoneClient.RequestInspector = inspectRequest
+	zoneClient.ResponseInspector = inspectResponse
+	zoneClient.UserAgent = userAgent(zoneClient.UserAgent)
+	zoneClient.APIVersion = apiVersion("dns", "dnsZones", zoneClient.APIVersion)
+
+	recordSetClient = dns.NewRecordSetsClient(subscriptionID)
+	recordSetClient.Authorizer = authorizer
+	recordSetClient.Sender = sender
+	recordSetClient.RetryAttempts = 0
+	recordSetClient.RequestInspector = inspectRequest
+	recordSetClient.ResponseInspector = inspectResponse
+	recordSetClient.UserAgent = userAgent(recordSetClient.UserAgent)
+	recordSetClient.APIVersion = apiVersion("dns", "recordSets", recordSetClient.APIVersion)
+
+	genericClient = resources.NewClient(subscriptionID)
+	genericClient.Authorizer = authorizer
+	genericClient.Sender = sender
+	genericClient.RetryAttempts = 0
+	genericClient.RequestInspector = inspectRequest
+	genericClient.ResponseInspector = inspectResponse
+	genericClient.UserAgent = userAgent(genericClient.UserAgent)
+
+	deploymentsClient = resources.NewDeploymentsClient(subscriptionID)
+	deploymentsClient.Authorizer = authorizer
+	deploymentsClient.Sender = sender
+	deploymentsClient.RetryAttempts = 0
+	deploymentsClient.RequestInspector = inspectRequest
+	deploymentsClient.ResponseInspector = inspectResponse
+	deploymentsClient.UserAgent = userAgent(deploymentsClient.UserAgent)
+	deploymentsClient.APIVersion = apiVersion("resources", "deployments", deploymentsClient.APIVersion)
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// Exit codes of the sample, documented in the README so that scripts wrapping it can tell failures apart.
+// 2 is left to the flag package, which exits with it on invalid flags.
+const (
+	exitFailure   = 1 // any other failure
+	exitAuth      = 3 // the credentials were rejected or lack a permission
+	exitQuota     = 4 // a quota or the capacity of a size in the region is used up
+	exitConflict  = 5 // a name is already taken or a resource is in use
+	exitThrottled = 6 // ARM kept throttling the requests after the retries
+	exitTimeout   = 7 // a request or a long-running operation timed out
+	exitCancelled = 8 // the user declined to go ahead
+)
+
+// exitCode returns the exit code for a run failing with err, from the status ARM answered with and the
+// error codes in the error's message.
+func exitCode(err error) int {
+	if e, ok := err.(circuitOpenError); ok {
+		switch {
+		case e.class == failureAuth:
+			return exitAuth
+		case e.class == failureQuota && strings.Contains(strings.Join(e.failures, "\n"), "429"):
+			return exitThrottled
+		case e.class == failureQuota:
+			return exitQuota
+		}
+		return exitFailure
+	}
+
+	status := 0
+	if de, ok := err.(autorest.DetailedError); ok {
+		status, _ = de.StatusCode.(int)
+	}
+	message := strings.ToLower(err.Error())
+	containsAny := func(words ...string) bool {
+		for _, w := range words {
+			if strings.Contains(message, w) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden ||
+		containsAny("authorizationfailed", "authenticationfailed", "invalidauthenticationtoken", "invalid_client",
+			"unauthorized_client", "invalid_grant", "aadsts"):
+		return exitAuth
+	case status == http.StatusTooManyRequests || containsAny("toomanyrequests", "throttl"):
+		return exitThrottled
+	case containsAny("quota", "skunotavailable", "allocationfailed"):
+		return exitQuota
+	case status == http.StatusConflict || containsAny("conflict", "alreadyexists", "alreadytaken", "inuse"):
+		return exitConflict
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout ||
+		containsAny("timeout", "timed out", "deadline exceeded"):
+		return exitTimeout
+	}
+	return exitFailure
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+)
+
+// deployedResource is a live resource created by the sample, in its ARM JSON form.
+type deployedResource struct {
+	Symbol     string
+	Parent     string
+	Type       string
+	APIVersion string
+	Name       string
+	ID         string
+	Body       map[string]interface{}
+	Model      interface{}
+}
+
+// bicepExpr is a Bicep expression that is written verbatim instead of as a string literal.
+type bicepExpr string
+
+// resourceTypes are the ARM types of the kinds of resource whose models don't carry their type.
+var resourceTypes = map[string]string{
+	"group":   "Microsoft.Resources/resourceGroups",
+	"subnet":  "Microsoft.Network/virtualNetworks/subnets",
+	"peering": "Microsoft.Network/virtualNetworks/virtualNetworkPeerings",
+}
+
+var (
+	bicepIdentifier    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	bicepInvalidSymbol = regexp.MustCompile(`[^A-Za-z0-9_]`)
+)
+
+// collectDeployedResources gets the current ARM representation of every resource in the sample's resource group.
+func collectDeployedResources() []deployedResource {
+	deployed := []deployedResource{}
+
+	accounts, err := listGroupAccounts(groupName)
+	onErrorFail(err, "ListByResourceGroup failed")
+	if accounts.Value != nil {
+		for _, account := range *accounts.Value {
+			deployed = append(deployed, newDeployedResource("storage", accountClient.APIVersion, account.ID, account))
+		}
+	}
+
+	vNets, err := listGroupVNets(groupName)
+	onErrorFail(err, "List failed")
+	if vNets.Value != nil {
+		for _, vNet := range *vNets.Value {
+			deployed = append(deployed, newDeployedResource("vnet", vNetClient.APIVersion, vNet.ID, vNet))
+		}
+	}
+
+	nsgs, err := listGroupNSGs(groupName)
+	onErrorFail(err, "List failed")
+	if nsgs.Value != nil {
+		for _, nsg := range *nsgs.Value {
+			deployed = append(deployed, newDeployedResource("nsg", nsgClient.APIVersion, nsg.ID, nsg))
+		}
+	}
+
+	pips, err := listGroupPIPs(groupName)
+	onErrorFail(err, "List failed")
+	if pips.Value != nil {
+		for _, pip := range *pips.Value {
+			deployed = append(deployed, newDeployedResource("pip", addressClient.APIVersion, pip.ID, pip))
+		}
+	}
+
+	nics, err := listGroupNICs(groupName)
+	onErrorFail(err, "List failed")
+	if nics.Value != nil {
+		for _, nic := range *nics.Value {
+			deployed = append(deployed, newDeployedResource("nic", interfacesClient.APIVersion, nic.ID, nic))
+		}
+	}
+
+	vms, err := listGroupVMs(groupName)
+	onErrorFail(err, "List failed")
+	if vms.Value != nil {
+		for _, vm := range *vms.Value {
+			deployed = append(deployed, newDeployedResource("vm", vmClient.APIVersion, vm.ID, vm))
+		}
+	}
+
+	return deployed
+}
+
+// recordedResources gets the current ARM representation of the resources of the sample's resource group that
+// state records, leaving out those created by others.
+func recordedResources(state sampleState) []deployedResource {
+	recorded := []deployedResource{}
+	for _, r := range collectDeployedResources() {
+		if state.find(r.ID) >= 0 {
+			recorded = append(recorded, r)
+		}
+	}
+	return recorded
+}
+
+// newDeployedResource converts an SDK model into a deployedResource, keeping only the writable parts of its body.
+func newDeployedResource(kind, apiVersion string, id *string, model interface{}) deployedResource {
+	b, err := json.Marshal(model)
+	onErrorFail(err, "Marshal failed")
+	raw := map[string]interface{}{}
+	err = json.Unmarshal(b, &raw)
+	onErrorFail(err, "Unmarshal failed")
+
+	r := deployedResource{
+		APIVersion: apiVersion,
+		Body:       map[string]interface{}{},
+		Model:      model,
+	}
+	if id != nil {
+		r.ID = *id
+	}
+	r.Name, _ = raw["name"].(string)
+	r.Type, _ = raw["type"].(string)
+	if r.Type == "" {
+		r.Type = resourceTypes[kind]
+	}
+	r.Symbol = fmt.Sprintf("%s_%s", kind, bicepInvalidSymbol.ReplaceAllString(r.Name, "_"))
+
+	for _, k := range []string{"location", "tags", "sku", "kind", "properties"} {
+		if v, ok := raw[k]; ok {
+			r.Body[k] = pruneReadOnly(v)
+		}
+	}
+	switch kind {
+	case "storage":
+		// The account properties returned by ARM are all endpoints and status.
+		r.Body["properties"] = map[string]interface{}{}
+	case "vnet":
+		subnetBackReferences(r)
+	}
+	return r
+}
+
+// pruneReadOnly removes the properties ARM computes on its own from a resource body.
+func pruneReadOnly(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		_, named := t["name"]
+		_, hasProperties := t["properties"]
+		for k, child := range t {
+			switch k {
+			case "provisioningState", "resourceGuid", "etag", "macAddress", "virtualMachine",
+				"ipConfiguration", "ipAddress", "fqdn", "appliedDnsServers", "internalFqdn",
+				"internalDomainNameSuffix", "vmId", "instanceView", "peeringState":
+				delete(t, k)
+			case "id":
+				// Child resources (subnets, ipconfigs) carry their own ID; references don't have a name.
+				if named && hasProperties {
+					delete(t, k)
+				}
+			default:
+				t[k] = pruneReadOnly(child)
+			}
+		}
+		if method, _ := t["privateIPAllocationMethod"].(string); method == string(network.Dynamic) {
+			delete(t, "privateIPAddress")
+		}
+		return t
+	case []interface{}:
+		for i := range t {
+			t[i] = pruneReadOnly(t[i])
+		}
+		return t
+	}
+	return v
+}
+
+// subnetBackReferences strips the read-only list of ipconfigs attached to each subnet of a VNet.
+func subnetBackReferences(r deployedResource) {
+	props, _ := r.Body["properties"].(map[string]interface{})
+	subnets, _ := props["subnets"].([]interface{})
+	for _, s := range subnets {
+		if sp, ok := s.(map[string]interface{})["properties"].(map[string]interface{}); ok {
+			delete(sp, "ipConfigurations")
+		}
+	}
+}
+
+// splitPeerings moves the peerings of a VNet out of its body into resources of their own,
+// because two VNets peered with each other would otherwise reference each other.
+func splitPeerings(vNet deployedResource) []deployedResource {
+	props, _ := vNet.Body["properties"].(map[string]interface{})
+	peerings, _ := props["virtualNetworkPeerings"].([]interface{})
+	delete(props, "virtualNetworkPeerings")
+
+	split := []deployedResource{}
+	for _, p := range peerings {
+		peering, _ := p.(map[string]interface{})
+		name, _ := peering["name"].(string)
+		split = append(split, deployedResource{
+			Symbol:     vNet.Symbol + "_" + bicepInvalidSymbol.ReplaceAllString(name, "_"),
+			Parent:     vNet.Symbol,
+			Type:       resourceTypes["peering"],
+			APIVersion: vNet.APIVersion,
+			Name:       name,
+			ID:         fmt.Sprintf("%s/virtualNetworkPeerings/%s", vNet.ID, name),
+			Body:       map[string]interface{}{"properties": peering["properties"]},
+		})
+	}
+	return split
+}
+
+// exportBicep writes a Bicep file declaring the deployed sample topology.
+func exportBicep(path string) {
+	stepf("Export Bicep template to '%s'\n", path)
+	deployed := recordedResources(runState)
+
+	// Replace references between the resources with symbolic references so Bicep infers the dependencies.
+	references := map[string]bicepExpr{}
+	for i := 0; i < len(deployed); i++ {
+		r := deployed[i]
+		references[strings.ToLower(r.ID)] = bicepExpr(r.Symbol + ".id")
+		if r.Type == "Microsoft.Network/virtualNetworks" {
+			deployed = append(deployed, splitPeerings(r)...)
+			props, _ := r.Body["properties"].(map[string]interface{})
+			subnets, _ := props["subnets"].([]interface{})
+			for _, s := range subnets {
+				name, _ := s.(map[string]interface{})["name"].(string)
+				subnetID := fmt.Sprintf("%s/subnets/%s", r.ID, name)
+				references[strings.ToLower(subnetID)] = bicepExpr(fmt.Sprintf("'${%s.id}/subnets/%s'", r.Symbol, bicepEscape(name)))
+			}
+		}
+		if r.Type == "Microsoft.Compute/virtualMachines" {
+			props, _ := r.Body["properties"].(map[string]interface{})
+			if osProfile, ok := props["osProfile"].(map[string]interface{}); ok {
+				osProfile["adminPassword"] = bicepExpr("adminPassword")
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("// Generated from the resources created by network-go-manage-network-interface.\n\n")
+	buf.WriteString("@secure()\nparam adminPassword string\n")
+	for _, r := range deployed {
+		fmt.Fprintf(&buf, "\nresource %s '%s@%s' = {\n", r.Symbol, r.Type, r.APIVersion)
+		if r.Parent != "" {
+			fmt.Fprintf(&buf, "  parent: %s\n", r.Parent)
+		}
+		fmt.Fprintf(&buf, "  name: %s\n", bicepString(r.Name))
+		writeBicepProperties(&buf, r.Body, references, 1)
+		buf.WriteString("}\n")
+	}
+
+	err := ioutil.WriteFile(path, buf.Bytes(), 0644)
+	onErrorFail(err, "WriteFile failed")
+}
+
+// writeBicepProperties writes the members of a Bicep object, one per line, sorted by key.
+func writeBicepProperties(buf *bytes.Buffer, obj map[string]interface{}, references map[string]bicepExpr, depth int) {
+	keys := []string{}
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	indent := strings.Repeat("  ", depth)
+	for _, k := range keys {
+		key := k
+		if !bicepIdentifier.MatchString(k) {
+			key = bicepString(k)
+		}
+		fmt.Fprintf(buf, "%s%s: ", indent, key)
+		writeBicepValue(buf, obj[k], references, depth)
+		buf.WriteString("\n")
+	}
+}
+
+// writeBicepValue writes a single JSON value as Bicep, without a trailing newline.
+func writeBicepValue(buf *bytes.Buffer, v interface{}, references map[string]bicepExpr, depth int) {
+	indent := strings.Repeat("  ", depth)
+	switch t := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bicepExpr:
+		buf.WriteString(string(t))
+	case string:
+		if ref, ok := references[strings.ToLower(t)]; ok {
+			buf.WriteString(string(ref))
+		} else {
+			buf.WriteString(bicepString(t))
+		}
+	case bool:
+		buf.WriteString(strconv.FormatBool(t))
+	case float64:
+		buf.WriteString(strconv.FormatFloat(t, 'f', -1, 64))
+	case map[string]interface{}:
+		buf.WriteString("{\n")
+		writeBicepProperties(buf, t, references, depth+1)
+		buf.WriteString(indent + "}")
+	case []interface{}:
+		buf.WriteString("[\n")
+		for _, item := range t {
+			buf.WriteString(indent + "  ")
+			writeBicepValue(buf, item, references, depth+1)
+			buf.WriteString("\n")
+		}
+		buf.WriteString(indent + "]")
+	}
+}
+
+// bicepString quotes s as a Bicep string literal.
+func bicepString(s string) string {
+	return "'" + bicepEscape(s) + "'"
+}
+
+// bicepEscape escapes s for use inside a Bicep string literal.
+func bicepEscape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "${", `\${`)
+	return r.Replace(s)
+}
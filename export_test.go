@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// TestExportBicepRecordedResources exports a group with a VNet and a NIC the sample created, the subnet's name
+// needing escaping, and a VNet it didn't create, which is left out.
+func TestExportBicepRecordedResources(t *testing.T) {
+	newTestARM(t)
+	createTestGroup(t)
+	vNet := testVNet()
+	(*vNet.Subnets)[0].Name = to.StringPtr("it's")
+	if _, err := vNetClient.CreateOrUpdate(groupName, "vnet", vNet, nil); err != nil {
+		t.Fatalf("creating the VNet: %v", err)
+	}
+	nic := testNIC()
+	subnetID := resourceID("Microsoft.Network/virtualNetworks", "vnet") + "/subnets/it's"
+	(*nic.IPConfigurations)[0].Subnet.ID = to.StringPtr(subnetID)
+	if _, err := interfacesClient.CreateOrUpdate(groupName, "nic", nic, nil); err != nil {
+		t.Fatalf("creating the NIC: %v", err)
+	}
+	if _, err := vNetClient.CreateOrUpdate(groupName, "other-vnet", network.VirtualNetwork{
+		Location: to.StringPtr(westUS),
+		VirtualNetworkPropertiesFormat: &network.VirtualNetworkPropertiesFormat{
+			AddressSpace: &network.AddressSpace{AddressPrefixes: &[]string{"10.1.0.0/16"}},
+		},
+	}, nil); err != nil {
+		t.Fatalf("creating the other VNet: %v", err)
+	}
+	runState.Resources = []stateResource{
+		{Type: "Microsoft.Network/virtualNetworks", Name: "vnet", ID: resourceID("Microsoft.Network/virtualNetworks", "vnet")},
+		{Type: "Microsoft.Network/networkInterfaces", Name: "nic", ID: resourceID("Microsoft.Network/networkInterfaces", "nic")},
+	}
+
+	path := filepath.Join(t.TempDir(), "deployment.bicep")
+	exportBicep(path)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bicep := string(b)
+	if !strings.Contains(bicep, "resource vnet_vnet ") {
+		t.Errorf("the recorded VNet isn't exported:\n%s", bicep)
+	}
+	if strings.Contains(bicep, "other-vnet") {
+		t.Errorf("the VNet the sample didn't create is exported:\n%s", bicep)
+	}
+	if !strings.Contains(bicep, `'${vnet_vnet.id}/subnets/it\'s'`) {
+		t.Errorf("the NIC's subnet isn't an escaped reference to the VNet:\n%s", bicep)
+	}
+}
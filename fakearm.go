@@ -0,0 +1,522 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// offlineSubscriptionID is the subscription the clients use with -offline.
+const offlineSubscriptionID = "00000000-0000-0000-0000-000000000000"
+
+// fakeARM is an in-memory stand-in for Azure Resource Manager, serving the requests of the clients with
+// -offline. It keeps resources as the JSON bodies PUT to their IDs, fills in what ARM would (IDs, private
+// and public IPs, MACs, the VM of a NIC, the subnets of a VNet), and answers PUTs and DELETEs as
+// long-running operations that complete on their polls-th poll, as ARM does for the resource types whose
+// SDK calls poll. Lists are paged with nextLink when pageSize is set, and every throttleEvery-th request
+// other than polls is answered with 429, which the tests use to exercise the paging and the retries.
+type fakeARM struct {
+	mu sync.Mutex
+
+	polls         int
+	pageSize      int
+	throttleEvery int
+	requests      int
+
+	// acceptPuts answers the PUTs of long-running types with 202 rather than 201 or 200, as some ARM
+	// providers do while the resource is provisioned.
+	acceptPuts bool
+
+	// resources are the resources by lower-cased ID, and operations the polls left before the operation
+	// with the given number completes.
+	resources  map[string]map[string]interface{}
+	operations map[int]int
+	nextOp     int
+
+	// version numbers the ETags of the resources.
+	version int
+
+	// path is the file the resources are kept in between runs, or empty to keep them in memory only.
+	path string
+}
+
+// newFakeARM returns a fake ARM backend holding the resources kept in path by an earlier run, if any.
+func newFakeARM(path string) *fakeARM {
+	f := &fakeARM{resources: map[string]map[string]interface{}{}, operations: map[int]int{}, path: path, polls: 2}
+	if path == "" {
+		return f
+	}
+	if b, err := ioutil.ReadFile(path); err == nil {
+		onErrorFail(json.Unmarshal(b, &f.resources), fmt.Sprintf("Reading the offline resources in '%s' failed", path))
+	} else if !os.IsNotExist(err) {
+		onErrorFail(err, "ReadFile failed")
+	}
+	return f
+}
+
+// RoundTrip implements http.RoundTripper, serving the request in-process.
+func (f *fakeARM) RoundTrip(r *http.Request) (*http.Response, error) {
+	w := httptest.NewRecorder()
+	f.ServeHTTP(w, r)
+	resp := w.Result()
+	resp.Request = r
+	return resp, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (f *fakeARM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	lower := strings.ToLower(path)
+	polling := strings.Contains(lower, "/providers/fake/")
+	if !polling && f.throttleEvery > 0 {
+		if f.requests++; f.requests%f.throttleEvery == 0 {
+			w.Header().Set("Retry-After", "1")
+			fakeError(w, http.StatusTooManyRequests, "TooManyRequests", "The request is throttled, retry after 1 second")
+			return
+		}
+	}
+	switch {
+	case strings.Contains(lower, "/providers/fake/operations/"):
+		f.serveOperation(w, r, path, true)
+	case strings.Contains(lower, "/providers/fake/operationresults/"):
+		f.serveOperation(w, r, path, false)
+	case r.Method == http.MethodHead:
+		if f.resources[lower] == nil {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case r.Method == http.MethodGet && strings.HasPrefix(strings.ToLower(lastSegment(&path)), "check"):
+		// CheckDnsNameAvailability and CheckIPAddressAvailability: every name and address is free.
+		writeJSON(w, http.StatusOK, map[string]interface{}{"available": true})
+	case r.Method == http.MethodGet && !isResourcePath(path):
+		writeJSON(w, http.StatusOK, f.page(r, f.list(path)))
+	case r.Method == http.MethodGet:
+		res := f.resources[lower]
+		if res == nil {
+			fakeError(w, http.StatusNotFound, "ResourceNotFound", fmt.Sprintf("The resource '%s' was not found.", path))
+			return
+		}
+		writeJSON(w, http.StatusOK, f.withChildren(res))
+	case r.Method == http.MethodPut || r.Method == http.MethodPatch:
+		f.put(w, r, path)
+	case r.Method == http.MethodDelete:
+		f.delete(w, r, path)
+	case r.Method == http.MethodPost:
+		// Actions such as starting a VM or validating a deployment succeed right away.
+		writeJSON(w, http.StatusOK, map[string]interface{}{})
+	default:
+		fakeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method+" isn't supported offline")
+	}
+}
+
+// put creates or updates the resource at path from the request's body.
+func (f *fakeARM) put(w http.ResponseWriter, r *http.Request, path string) {
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		fakeError(w, http.StatusBadRequest, "InvalidRequestContent", err.Error())
+		return
+	}
+	id := canonicalID(path)
+	key := strings.ToLower(id)
+	existing := f.resources[key]
+	if m := r.Header.Get("If-Match"); m != "" && m != "*" && (existing == nil || existing["etag"] != m) {
+		fakeError(w, http.StatusPreconditionFailed, "PreconditionFailed", "The ETag doesn't match the resource's")
+		return
+	}
+	if existing != nil && r.Method == http.MethodPatch {
+		for k, v := range body {
+			existing[k] = v
+		}
+		body = existing
+	}
+	typ := resourceTypeOf(id)
+	body["id"], body["name"], body["type"] = id, lastSegment(&id), typ
+	f.version++
+	body["etag"] = fmt.Sprintf("W/\"%d\"", f.version)
+	props := fakeObject(body, "properties")
+	props["provisioningState"] = "Succeeded"
+	f.fill(typ, id, body, existing)
+	f.resources[key] = body
+	f.save()
+
+	status := http.StatusCreated
+	if existing != nil {
+		status = http.StatusOK
+	}
+	answer := f.withChildren(body)
+	if fakeLongRunning(r.Method, typ) {
+		// As with ARM, the resource is still being provisioned until the operation completes.
+		w.Header().Set("Azure-AsyncOperation", f.startOperation(r, "operations"))
+		w.Header().Set("Retry-After", "1")
+		answer = fakeCopy(answer)
+		answer["properties"].(map[string]interface{})["provisioningState"] = "Updating"
+		if f.acceptPuts {
+			status = http.StatusAccepted
+		}
+	}
+	writeJSON(w, status, answer)
+}
+
+// delete deletes the resource at path and those nested in it, which for a resource group are all of its resources.
+func (f *fakeARM) delete(w http.ResponseWriter, r *http.Request, path string) {
+	key := strings.ToLower(canonicalID(path))
+	if f.resources[key] == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	for k, res := range f.resources {
+		if k == key || strings.HasPrefix(k, key+"/") {
+			f.detach(res)
+			delete(f.resources, k)
+		}
+	}
+	f.save()
+	if !fakeLongRunning(r.Method, resourceTypeOf(path)) {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.Header().Set("Location", f.startOperation(r, "operationresults"))
+	w.Header().Set("Retry-After", "1")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// startOperation starts a long-running operation on the resource the request is about and returns the URL
+// to poll its status at, in the resource's subscription.
+func (f *fakeARM) startOperation(r *http.Request, kind string) string {
+	f.nextOp++
+	f.operations[f.nextOp] = f.polls - 1
+	subscription := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/subscriptions/"), "/", 2)[0]
+	return fmt.Sprintf("%s/subscriptions/%s/providers/fake/%s/%d", fakeBaseURL(r), subscription, kind, f.nextOp)
+}
+
+// serveOperation answers a poll of an operation, which is running until its polls left are used up.
+// async tells an Azure-AsyncOperation poll from a Location one.
+func (f *fakeARM) serveOperation(w http.ResponseWriter, r *http.Request, path string, async bool) {
+	var n int
+	fmt.Sscanf(lastSegment(&path), "%d", &n)
+	left, ok := f.operations[n]
+	if !ok {
+		if async {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"status": "Succeeded"})
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+		return
+	}
+	if left > 0 {
+		f.operations[n] = left - 1
+	} else {
+		delete(f.operations, n)
+	}
+	switch {
+	case async && left > 0:
+		w.Header().Set("Retry-After", "1")
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "InProgress"})
+	case async:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "Succeeded"})
+	case left > 0:
+		w.Header().Set("Location", fakeBaseURL(r)+r.URL.Path)
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// list returns the resources of the collection at path: the children of a resource, all the resources of
+// a type in a subscription, or all the resources of a resource group.
+func (f *fakeARM) list(path string) []interface{} {
+	segments := strings.Split(strings.Trim(strings.ToLower(path), "/"), "/")
+	keys := []string{}
+	for k := range f.resources {
+		switch {
+		case len(segments) == 5 && segments[2] == "providers":
+			typ := segments[3] + "/" + segments[4]
+			if strings.HasPrefix(k, "/subscriptions/"+segments[1]+"/") && strings.EqualFold(resourceTypeOf(k), typ) {
+				keys = append(keys, k)
+			}
+		case segments[len(segments)-1] == "resources" && len(segments) == 5:
+			if prefix := strings.ToLower(strings.TrimSuffix(path, "/resources")) + "/"; strings.HasPrefix(k, prefix) &&
+				strings.Contains(k[len(prefix):], "/") {
+				keys = append(keys, k)
+			}
+		case k[:strings.LastIndex(k, "/")] == strings.ToLower(path):
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	value := []interface{}{}
+	for _, k := range keys {
+		value = append(value, f.withChildren(f.resources[k]))
+	}
+	return value
+}
+
+// page returns the page of a list the request asks for with $skiptoken, with the nextLink of the next page
+// if there is one.
+func (f *fakeARM) page(r *http.Request, value []interface{}) map[string]interface{} {
+	skip, _ := strconv.Atoi(r.URL.Query().Get("$skiptoken"))
+	if skip > len(value) {
+		skip = len(value)
+	}
+	if f.pageSize == 0 || len(value)-skip <= f.pageSize {
+		return map[string]interface{}{"value": value[skip:]}
+	}
+	query := url.Values{}
+	query.Set("api-version", r.URL.Query().Get("api-version"))
+	query.Set("$skiptoken", strconv.Itoa(skip+f.pageSize))
+	return map[string]interface{}{
+		"value":    value[skip : skip+f.pageSize],
+		"nextLink": fakeBaseURL(r) + r.URL.Path + "?" + query.Encode(),
+	}
+}
+
+// fill sets the properties ARM fills in on a resource of type typ created or updated at id. existing is
+// the resource before the update, or nil.
+func (f *fakeARM) fill(typ, id string, body, existing map[string]interface{}) {
+	props := fakeObject(body, "properties")
+	switch strings.ToLower(typ) {
+	case "microsoft.network/virtualnetworks":
+		// Subnets given inline become resources of their own.
+		if subnets, ok := props["subnets"].([]interface{}); ok {
+			for _, s := range subnets {
+				if subnet, ok := s.(map[string]interface{}); ok && subnet["name"] != nil {
+					subnetID := fmt.Sprintf("%s/subnets/%s", id, subnet["name"])
+					subnet["id"], subnet["type"] = subnetID, "Microsoft.Network/virtualNetworks/subnets"
+					fakeObject(subnet, "properties")["provisioningState"] = "Succeeded"
+					f.resources[strings.ToLower(subnetID)] = subnet
+				}
+			}
+			delete(props, "subnets")
+		}
+	case "microsoft.network/networkinterfaces":
+		if existing != nil {
+			if vm := fakeObject(existing, "properties")["virtualMachine"]; vm != nil {
+				props["virtualMachine"] = vm
+			}
+			props["macAddress"] = fakeObject(existing, "properties")["macAddress"]
+		}
+		if props["macAddress"] == nil {
+			props["macAddress"] = fmt.Sprintf("00-0D-3A-%02X-%02X-%02X", len(f.resources)>>16&0xff, len(f.resources)>>8&0xff, len(f.resources)&0xff)
+		}
+		ipConfigs, _ := props["ipConfigurations"].([]interface{})
+		for i, c := range ipConfigs {
+			ipConfig, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			ipConfig["id"] = fmt.Sprintf("%s/ipConfigurations/%v", id, ipConfig["name"])
+			ipProps := fakeObject(ipConfig, "properties")
+			ipProps["provisioningState"] = "Succeeded"
+			if _, ok := ipProps["primary"]; !ok {
+				ipProps["primary"] = i == 0
+			}
+			if ip, _ := ipProps["privateIPAddress"].(string); ip == "" {
+				ipProps["privateIPAddress"] = f.freeAddress(fakeObject(ipProps, "subnet")["id"])
+			}
+		}
+	case "microsoft.network/publicipaddresses":
+		if existing != nil {
+			props["ipAddress"] = fakeObject(existing, "properties")["ipAddress"]
+		}
+		if props["ipAddress"] == nil {
+			props["ipAddress"] = fmt.Sprintf("203.0.113.%d", len(f.resources)%250+1)
+		}
+		if dns, ok := props["dnsSettings"].(map[string]interface{}); ok && dns["domainNameLabel"] != nil {
+			dns["fqdn"] = fmt.Sprintf("%s.%s.cloudapp.azure.com", dns["domainNameLabel"], body["location"])
+		}
+	case "microsoft.compute/virtualmachines":
+		if props["vmId"] = newCorrelationID(); existing != nil {
+			props["vmId"] = fakeObject(existing, "properties")["vmId"]
+		}
+		profile := fakeObject(props, "networkProfile")
+		nics, _ := profile["networkInterfaces"].([]interface{})
+		for _, n := range nics {
+			if ref, ok := n.(map[string]interface{}); ok {
+				if nic := f.resources[strings.ToLower(fmt.Sprint(ref["id"]))]; nic != nil {
+					fakeObject(nic, "properties")["virtualMachine"] = map[string]interface{}{"id": id}
+				}
+			}
+		}
+	case "microsoft.storage/storageaccounts":
+		props["primaryEndpoints"] = map[string]interface{}{"blob": fmt.Sprintf("https://%s.blob.core.windows.net/", body["name"])}
+	}
+}
+
+// detach removes the references to a deleted resource that ARM would remove, i.e. the VM of its NICs.
+func (f *fakeARM) detach(res map[string]interface{}) {
+	if !strings.EqualFold(fmt.Sprint(res["type"]), "Microsoft.Compute/virtualMachines") {
+		return
+	}
+	for _, other := range f.resources {
+		props := fakeObject(other, "properties")
+		if vm, ok := props["virtualMachine"].(map[string]interface{}); ok && strings.EqualFold(fmt.Sprint(vm["id"]), fmt.Sprint(res["id"])) {
+			delete(props, "virtualMachine")
+		}
+	}
+}
+
+// freeAddress returns the first address of the subnet with the given ID that no NIC holds, skipping the
+// four Azure reserves at the start of the subnet.
+func (f *fakeARM) freeAddress(subnetID interface{}) string {
+	subnet := f.resources[strings.ToLower(fmt.Sprint(subnetID))]
+	if subnet == nil {
+		return ""
+	}
+	prefix, _ := fakeObject(subnet, "properties")["addressPrefix"].(string)
+	ip, network, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return ""
+	}
+	used := map[string]bool{}
+	for _, res := range f.resources {
+		ipConfigs, _ := fakeObject(res, "properties")["ipConfigurations"].([]interface{})
+		for _, c := range ipConfigs {
+			if ipConfig, ok := c.(map[string]interface{}); ok {
+				if address, ok := fakeObject(ipConfig, "properties")["privateIPAddress"].(string); ok {
+					used[address] = true
+				}
+			}
+		}
+	}
+	ip = ip.Mask(network.Mask).To4()
+	first := uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+	for i := uint32(4); ; i++ {
+		a := first + i
+		candidate := net.IPv4(byte(a>>24), byte(a>>16), byte(a>>8), byte(a))
+		if !network.Contains(candidate) {
+			return ""
+		}
+		if !used[candidate.String()] {
+			return candidate.String()
+		}
+	}
+}
+
+// withChildren returns a resource as ARM answers it, with the subnets of a VNet inlined.
+func (f *fakeARM) withChildren(res map[string]interface{}) map[string]interface{} {
+	if !strings.EqualFold(fmt.Sprint(res["type"]), "Microsoft.Network/virtualNetworks") {
+		return res
+	}
+	copied := fakeCopy(res)
+	copied["properties"].(map[string]interface{})["subnets"] = f.list(fmt.Sprint(res["id"]) + "/subnets")
+	return copied
+}
+
+// fakeCopy returns a copy of a resource whose properties can be changed without changing the resource's.
+func fakeCopy(res map[string]interface{}) map[string]interface{} {
+	copied := map[string]interface{}{}
+	for k, v := range res {
+		copied[k] = v
+	}
+	props := map[string]interface{}{}
+	for k, v := range fakeObject(res, "properties") {
+		props[k] = v
+	}
+	copied["properties"] = props
+	return copied
+}
+
+// save writes the resources to the file kept between runs, if there is one.
+func (f *fakeARM) save() {
+	if f.path == "" {
+		return
+	}
+	b, err := json.MarshalIndent(f.resources, "", "  ")
+	onErrorFail(err, "MarshalIndent failed")
+	onErrorFail(ioutil.WriteFile(f.path, b, 0644), "WriteFile failed")
+}
+
+// fakeLongRunning reports whether ARM answers the method on resources of type typ as a long-running
+// operation, which the SDK then polls, rather than right away.
+func fakeLongRunning(method, typ string) bool {
+	typ = strings.ToLower(typ)
+	switch {
+	case strings.HasPrefix(typ, "microsoft.network/dnszones/"), typ == "microsoft.authorization/locks":
+		return false
+	case typ == "microsoft.network/dnszones", typ == "microsoft.resources/resourcegroups":
+		return method == http.MethodDelete
+	case typ == "microsoft.storage/storageaccounts":
+		return method == http.MethodPut
+	}
+	return strings.HasPrefix(typ, "microsoft.network/") || strings.HasPrefix(typ, "microsoft.compute/")
+}
+
+// isResourcePath reports whether path is that of a resource rather than of a collection: once the
+// providers segments are left out, resource paths have an even number of segments.
+func isResourcePath(path string) bool {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	n := len(segments)
+	for i, s := range segments {
+		if strings.EqualFold(s, "providers") && i+1 < len(segments) {
+			n -= 2
+		}
+	}
+	return n%2 == 0
+}
+
+// canonicalID returns a resource ID with the casing ARM answers with for the segments the SDK sends in lower case.
+func canonicalID(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if strings.EqualFold(s, "resourcegroups") {
+			segments[i] = "resourceGroups"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// resourceTypeOf returns the type of the resource with the given ID, e.g. Microsoft.Network/virtualNetworks/subnets.
+func resourceTypeOf(id string) string {
+	segments := strings.Split(strings.Trim(id, "/"), "/")
+	p := -1
+	for i, s := range segments {
+		if strings.EqualFold(s, "providers") {
+			p = i
+		}
+	}
+	if p < 0 || p+1 >= len(segments) {
+		return "Microsoft.Resources/resourceGroups"
+	}
+	parts := []string{segments[p+1]}
+	for i := p + 2; i < len(segments); i += 2 {
+		parts = append(parts, segments[i])
+	}
+	return strings.Join(parts, "/")
+}
+
+// fakeObject returns the JSON object under key in m, adding an empty one if there is none.
+func fakeObject(m map[string]interface{}, key string) map[string]interface{} {
+	o, ok := m[key].(map[string]interface{})
+	if !ok {
+		o = map[string]interface{}{}
+		m[key] = o
+	}
+	return o
+}
+
+// fakeBaseURL returns the scheme and host the request was sent to.
+func fakeBaseURL(r *http.Request) string {
+	if r.URL.Host != "" {
+		return r.URL.Scheme + "://" + r.URL.Host
+	}
+	return "http://" + r.Host
+}
+
+// fakeError responds with an ARM error.
+func fakeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]interface{}{"error": map[string]string{"code": code, "message": message}})
+}
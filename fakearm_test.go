@@ -0,0 +1,246 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/azure-sdk-for-go/arm/resources/resources"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// newTestARM points the clients at an in-memory fake ARM for the duration of the test, with the state
+// kept in a temporary directory and a short delay before retries.
+func newTestARM(t *testing.T) *fakeARM {
+	t.Helper()
+	savedState, savedRetry, savedQuiet := *statePath, *retryMinDelay, *quiet
+	savedGroup, savedRunState, savedCommand := groupName, runState, runningCommand
+	t.Cleanup(func() {
+		*statePath, *retryMinDelay, *quiet = savedState, savedRetry, savedQuiet
+		groupName, runState, runningCommand = savedGroup, savedRunState, savedCommand
+	})
+	*statePath = filepath.Join(t.TempDir(), "sample-state.json")
+	*retryMinDelay = 10 * time.Millisecond
+	*quiet = true
+	groupName = "test-group"
+	runState = sampleState{}
+	runningCommand = false
+
+	f := newFakeARM("")
+	f.polls = 1
+	createClients(offlineSubscriptionID, autorest.NullAuthorizer{}, newSenderWithTransport(f))
+	return f
+}
+
+// createTestGroup creates the test's resource group.
+func createTestGroup(t *testing.T) {
+	t.Helper()
+	if _, err := groupClient.CreateOrUpdate(groupName, resources.ResourceGroup{Location: to.StringPtr(westUS)}); err != nil {
+		t.Fatalf("creating the group: %v", err)
+	}
+}
+
+// testVNet returns a VNet with a subnet.
+func testVNet() network.VirtualNetwork {
+	return network.VirtualNetwork{
+		Location: to.StringPtr(westUS),
+		VirtualNetworkPropertiesFormat: &network.VirtualNetworkPropertiesFormat{
+			AddressSpace: &network.AddressSpace{AddressPrefixes: &[]string{"10.0.0.0/16"}},
+			Subnets: &[]network.Subnet{{
+				Name:                   to.StringPtr("subnet"),
+				SubnetPropertiesFormat: &network.SubnetPropertiesFormat{AddressPrefix: to.StringPtr("10.0.0.0/24")},
+			}},
+		},
+	}
+}
+
+func TestFakeARMCreateGetDelete(t *testing.T) {
+	newTestARM(t)
+	createTestGroup(t)
+
+	if _, err := vNetClient.CreateOrUpdate(groupName, "vnet", testVNet(), nil); err != nil {
+		t.Fatalf("creating the VNet: %v", err)
+	}
+	vnet, err := vNetClient.Get(groupName, "vnet", "")
+	if err != nil {
+		t.Fatalf("getting the VNet: %v", err)
+	}
+	if got := to.String(vnet.ProvisioningState); got != "Succeeded" {
+		t.Errorf("provisioning state = %q, want Succeeded", got)
+	}
+	if vnet.Subnets == nil || len(*vnet.Subnets) != 1 || to.String((*vnet.Subnets)[0].Name) != "subnet" {
+		t.Errorf("subnets = %+v, want the subnet created with the VNet", vnet.Subnets)
+	}
+	wantID := "/subscriptions/" + offlineSubscriptionID + "/resourceGroups/" + groupName +
+		"/providers/Microsoft.Network/virtualNetworks/vnet"
+	if got := to.String(vnet.ID); got != wantID {
+		t.Errorf("ID = %q, want %q", got, wantID)
+	}
+
+	if _, err := vNetClient.Delete(groupName, "vnet", nil); err != nil {
+		t.Fatalf("deleting the VNet: %v", err)
+	}
+	_, err = vNetClient.Get(groupName, "vnet", "")
+	if de, ok := err.(autorest.DetailedError); !ok || de.StatusCode != http.StatusNotFound {
+		t.Errorf("getting the deleted VNet: err = %v, want a 404", err)
+	}
+}
+
+func TestFakeARMPagedList(t *testing.T) {
+	f := newTestARM(t)
+	createTestGroup(t)
+	if _, err := vNetClient.CreateOrUpdate(groupName, "vnet", testVNet(), nil); err != nil {
+		t.Fatalf("creating the VNet: %v", err)
+	}
+	names := []string{"nic-1", "nic-2", "nic-3", "nic-4", "nic-5"}
+	for _, name := range names {
+		if _, err := interfacesClient.CreateOrUpdate(groupName, name, testNIC(), nil); err != nil {
+			t.Fatalf("creating %s: %v", name, err)
+		}
+	}
+
+	f.pageSize = 2
+	first, err := interfacesClient.List(groupName)
+	if err != nil {
+		t.Fatalf("listing the first page: %v", err)
+	}
+	if first.Value == nil || len(*first.Value) != 2 || to.String(first.NextLink) == "" {
+		t.Fatalf("first page = %d NICs, nextLink %q, want 2 NICs and a nextLink", len(*first.Value), to.String(first.NextLink))
+	}
+
+	all, err := listGroupNICs(groupName)
+	if err != nil {
+		t.Fatalf("listing all the pages: %v", err)
+	}
+	if all.Value == nil || len(*all.Value) != len(names) {
+		t.Fatalf("listed %d NICs, want %d", len(*all.Value), len(names))
+	}
+	for i, nic := range *all.Value {
+		if got := to.String(nic.Name); got != names[i] {
+			t.Errorf("NIC %d = %q, want %q", i, got, names[i])
+		}
+	}
+}
+
+func TestFakeARMThrottling(t *testing.T) {
+	f := newTestARM(t)
+	createTestGroup(t)
+	f.throttleEvery = 2
+
+	// Every second request is answered with 429 and how long to wait.
+	url := "https://management.azure.com/subscriptions/" + offlineSubscriptionID + "/resourcegroups/" + groupName +
+		"?api-version=2016-09-01"
+	if resp, _ := f.RoundTrip(httptest.NewRequest(http.MethodGet, url, nil)); resp.StatusCode != http.StatusOK {
+		t.Fatalf("first request: status %d, want 200", resp.StatusCode)
+	}
+	resp, _ := f.RoundTrip(httptest.NewRequest(http.MethodGet, url, nil))
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "1" {
+		t.Fatalf("throttled request: status %d, Retry-After %q, want 429 and 1", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	// The clients wait for the Retry-After and retry, so the next throttled request still succeeds.
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if _, err := groupClient.Get(groupName); err != nil {
+			t.Fatalf("getting the group with throttling: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("the throttled request was retried after %v, want the Retry-After of 1s", elapsed)
+	}
+}
+
+// testNIC returns a NIC in the subnet of testVNet.
+func testNIC() network.Interface {
+	subnetID := "/subscriptions/" + offlineSubscriptionID + "/resourceGroups/" + groupName +
+		"/providers/Microsoft.Network/virtualNetworks/vnet/subnets/subnet"
+	return network.Interface{
+		Location: to.StringPtr(westUS),
+		InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+			IPConfigurations: &[]network.InterfaceIPConfiguration{{
+				Name: to.StringPtr("ipconfig"),
+				InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+					PrivateIPAllocationMethod: network.Dynamic,
+					Subnet:                    &network.Subnet{ID: to.StringPtr(subnetID)},
+				},
+			}},
+		},
+	}
+}
+
+// pointClientsAt sends the requests of the clients to the server at url rather than to ARM.
+func pointClientsAt(url string) {
+	groupClient.BaseURI = url
+	vNetClient.BaseURI = url
+	subnetClient.BaseURI = url
+	addressClient.BaseURI = url
+	interfacesClient.BaseURI = url
+	accountClient.BaseURI = url
+	vmClient.BaseURI = url
+	peeringClient.BaseURI = url
+	nsgClient.BaseURI = url
+	lockClient.BaseURI = url
+	zoneClient.BaseURI = url
+	recordSetClient.BaseURI = url
+	genericClient.BaseURI = url
+	deploymentsClient.BaseURI = url
+}
+
+// TestFakeARMOverHTTP serves the fake from an HTTP server and checks that a VNet whose creation is
+// accepted with 202 is polled at its Azure-AsyncOperation URL until it is provisioned.
+func TestFakeARMOverHTTP(t *testing.T) {
+	f := newTestARM(t)
+	f.polls = 2
+	f.acceptPuts = true
+
+	var mu sync.Mutex
+	var putStatus, polls int
+	var asyncOperation string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		f.ServeHTTP(rec, r)
+		mu.Lock()
+		switch {
+		case r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/virtualNetworks/"):
+			putStatus, asyncOperation = rec.Code, rec.Header().Get("Azure-AsyncOperation")
+		case strings.Contains(r.URL.Path, "/providers/fake/operations/"):
+			polls++
+		}
+		mu.Unlock()
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	}))
+	defer srv.Close()
+	createClients(offlineSubscriptionID, autorest.NullAuthorizer{}, newSenderWithTransport(http.DefaultTransport))
+	pointClientsAt(srv.URL)
+	createTestGroup(t)
+
+	if _, err := vNetClient.CreateOrUpdate(groupName, "vnet", testVNet(), nil); err != nil {
+		t.Fatalf("creating the VNet: %v", err)
+	}
+	if putStatus != http.StatusAccepted {
+		t.Errorf("the VNet's PUT was answered with %d, want 202", putStatus)
+	}
+	if !strings.HasPrefix(asyncOperation, srv.URL+"/") {
+		t.Errorf("Azure-AsyncOperation = %q, want a URL of the server %s", asyncOperation, srv.URL)
+	}
+	if polls != 2 {
+		t.Errorf("the operation was polled %d times, want 2", polls)
+	}
+	vnet, err := vNetClient.Get(groupName, "vnet", "")
+	if err != nil {
+		t.Fatalf("getting the VNet: %v", err)
+	}
+	if got := to.String(vnet.ProvisioningState); got != "Succeeded" {
+		t.Errorf("provisioning state = %q, want Succeeded", got)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// Flags shared by the sample run and its commands.
+var (
+	bicepPath         = flag.String("bicep", "", "write a Bicep file declaring the created resources to this path")
+	terraformPath     = flag.String("terraform", "", "write Terraform import blocks for the created resources to this path")
+	statePath         = flag.String("state", "sample-state.json", "path of the file recording the configuration of the created resources")
+	keepGroup         = flag.Bool("keep-group", false, "delete the sample's resources individually at the end and keep the resource group")
+	configPath        = flag.String("config", defaultConfigPath, "path of the JSON configuration file")
+	profileName       = flag.String("profile", "", "name of the configuration profile providing the tenant, subscription and credentials")
+	subscription      = flag.String("subscription", "", "ID of the subscription to deploy into, overriding the profile and AZURE_SUBSCRIPTION_ID")
+	multiRegion       = flag.Bool("multi-region", false, "also deploy a VNet and VM into -second-region, globally peered with the first VNet")
+	secondRegion      = flag.String("second-region", "eastus", "region of the second VNet in -multi-region mode")
+	tenant            = flag.String("tenant", "", "tenant to get the token from, overriding the profile and AZURE_TENANT_ID")
+	auxiliaryTenants  = flag.String("auxiliary-tenants", "", "comma-separated tenants to also get tokens from, for service principals that are guests in the subscription's tenant")
+	proxyURL          = flag.String("proxy", "", "URL of the HTTP(S) proxy to send all requests through, overriding HTTP_PROXY and HTTPS_PROXY")
+	userAgentSuffix   = flag.String("user-agent-suffix", "", "text appended to the User-Agent of every request, e.g. to attribute ARM traffic to a pipeline")
+	noTelemetry       = flag.Bool("no-telemetry", false, "send neither the sample's User-Agent identification nor the run's correlation ID with the requests")
+	wide              = flag.Bool("wide", false, "show extra columns when listing NICs")
+	quiet             = flag.Bool("quiet", false, "only print errors and final outputs such as the NIC table")
+	verbose           = flag.Bool("v", false, "also print every ARM request")
+	veryVerbose       = flag.Bool("vv", false, "also print the polling of long-running operations, implies -v")
+	auditPath         = flag.String("audit-log", "", "file to append every create, update and delete sent to ARM to, if any")
+	notifyURL         = flag.String("notify-url", "", "URL to POST a JSON summary of the deployment to when it succeeds or fails")
+	chatWebhook       = flag.String("chat-webhook", "", "Slack or Microsoft Teams incoming webhook URL to post a summary of the deployment to")
+	diagnostics       = flag.Bool("diagnostics", false, "create a Log Analytics workspace and send the logs and metrics of the NSGs and public IPs to it")
+	workspaceID       = flag.String("workspace-id", "", "resource ID of an existing Log Analytics workspace to send diagnostics to, implies -diagnostics")
+	lockScope         = flag.String("lock", "", "place CanNotDelete locks on the resource group (group) or on each NIC (nics) once deployed")
+	existingGroup     = flag.String("use-existing-group", "", "deploy into this existing resource group instead of creating one, and never delete it")
+	addressSpaceFlag  = flag.String("address-space", "", "comma-separated address prefixes of the VNet, overriding the configuration file")
+	existingVNetID    = flag.String("vnet-id", "", "resource ID of an existing VNet to place the NICs into, in its subnets named as in the layout, instead of creating a VNet")
+	existingSubnetIDs = flag.String("subnet-ids", "", "comma-separated resource IDs of existing subnets of one VNet, one per NIC, instead of creating a VNet")
+	nsgLevel          = flag.String("nsg", "", "associate network security groups with the subnets (subnet), the front-end NIC (nic) or both (both)")
+	dnsZone           = flag.String("dns-zone", "", "register an A record for the front-end NIC's public IP in this Azure DNS zone, created if missing")
+	dnsZoneGroup      = flag.String("dns-zone-group", "", "resource group of an existing -dns-zone, the sample's resource group by default")
+	dnsRecordName     = flag.String("dns-record", "", "name of the A record in -dns-zone, the VM's name by default")
+	reverseFQDN       = flag.String("reverse-fqdn", "", "answer reverse DNS lookups of the front-end NIC's public IP with this FQDN, which must resolve to the IP")
+	pipAllocation     = flag.String("pip-allocation", "", "allocation method of the public IPs: Dynamic (the default) or Static")
+	pipIdleTimeout    = flag.Int("pip-idle-timeout", 0, "TCP idle timeout of the public IPs in minutes, 4 to 30")
+	pipTier           = flag.String("pip-tier", "", "create Standard SKU public IPs of this tier: Regional or Global")
+	existingPIPID     = flag.String("public-ip-id", "", "resource ID of an existing public IP, possibly in another resource group, to attach to the front-end NIC instead of creating one")
+	bastion           = flag.Bool("bastion", false, "deploy an Azure Bastion host to reach the VM without a public IP")
+	bastionPrefix     = flag.String("bastion-prefix", "172.16.255.0/26", "address prefix of the AzureBastionSubnet, at least a /26 inside the VNet's address space")
+	jit               = flag.Bool("jit", false, "keep SSH closed behind a just-in-time access policy and request access for the caller's IP, needs -nsg")
+	jitSource         = flag.String("jit-source", "", "IP address or CIDR to request JIT access from instead of the caller's public IP")
+	sshKeyPath        = flag.String("ssh-key", "", "path of an SSH public key to authorize on the VMs instead of the password")
+	copySSH           = flag.Bool("copy-ssh", false, "copy the SSH command printed for the VM to the clipboard")
+	waitSSH           = flag.Duration("wait-ssh", 5*time.Minute, "how long to wait for the VM to answer on SSH once deployed, 0 to skip the check")
+	verify            = flag.Bool("verify", false, "check with Network Watcher that each tier reaches the next one once deployed, see the verify command")
+	outputsPath       = flag.String("outputs", "", "path of the JSON file receiving the MACs and IPs of the NICs once deployed, if any")
+	inventoryPath     = flag.String("inventory", "inventory.json", "path of the inventory kept by the inventory daemon, read by nic list and graph while it is fresh, empty to always ask ARM")
+	engine            = flag.String("engine", engineSDK, "create the topology with one SDK call per resource (sdk) or as a single ARM template deployment (template)")
+	whatIf            = flag.Bool("what-if", false, "with -engine template, show the changes of the deployment with What-If and ask before deploying")
+	policyCheck       = flag.Bool("policy-check", false, "check the resources against the assigned Azure policies before creating any, and stop if a policy would deny one")
+	deleteVM          = flag.Bool("delete-vm", false, "delete the VM along with the mid-tier NIC at the end of the run, instead of only detaching the NIC from it")
+	yes               = flag.Bool("yes", false, "delete resources without asking for confirmation")
+	retryAttempts     = flag.Int("retry-attempts", autorest.DefaultRetryAttempts, "how many times to retry a request ARM answers with 408, 429 or a 5xx status, 0 to never retry")
+	retryMinDelay     = flag.Duration("retry-min-delay", 30*time.Second, "delay before the first retry of a request, doubling with each further retry")
+	retryMaxDelay     = flag.Duration("retry-max-delay", 2*time.Minute, "longest delay between retries of a request, also capping the Retry-After ARM asks for")
+	readsPerSecond    = flag.Float64("reads-per-second", 20, "most GET requests to send to ARM per second, 0 for no limit")
+	writesPerSecond   = flag.Float64("writes-per-second", 5, "most PUT, PATCH, POST and DELETE requests to send to ARM per second, 0 for no limit")
+	circuitThreshold  = flag.Int("circuit-breaker", 5, "stop after this many consecutive requests failed with authorization, quota or service errors, 0 to never stop early")
+	noWait            = flag.Bool("no-wait", false, "return from deleting the resource group or a NIC and from nic create and nic clone once ARM accepts them, printing the operation to poll")
+	progressFormat    = flag.String("progress", "", "write a JSON event per line to stdout for each step and long-running operation instead of the step messages, printing the rest to stderr (jsonl)")
+	offline           = flag.Bool("offline", false, "demonstrate the sample without a subscription, sending its requests to an in-memory fake of ARM")
+	offlineStore      = flag.String("offline-store", "sample-offline.json", "file keeping the resources of the -offline fake of ARM between runs, empty to keep them in memory only")
+	reportPath        = flag.String("report", "", "write a Markdown report of the created resources to this path, or an HTML one if it ends in .html")
+)
+
+// tagFlags are the tags given with -tag.
+var tagFlags = tagList{}
+
+func init() {
+	flag.Var(tagFlags, "tag", "key=value tag to stamp on every resource, overriding the tags of the configuration file; repeatable")
+}
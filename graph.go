@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/arm/compute"
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+)
+
+// graphNode is a resource in the topology diagram.
+type graphNode struct {
+	ID    string
+	Kind  string
+	Lines []string
+}
+
+// graphEdge connects two graph nodes by their lower-cased resource IDs. Dashed edges are peerings.
+type graphEdge struct {
+	From, To string
+	Dashed   bool
+}
+
+// graphShapes are the DOT shapes of each kind of node.
+var graphShapes = map[string]string{
+	"vnet":   "box3d",
+	"subnet": "box",
+	"nic":    "component",
+	"pip":    "ellipse",
+	"vm":     "box",
+}
+
+// graph writes a DOT or Mermaid diagram of the VNets, subnets, NICs, public IPs and VMs in the resource group.
+func graph(args []string) {
+	fs := flag.NewFlagSet("graph", flag.ExitOnError)
+	format := fs.String("format", "dot", "diagram format: dot or mermaid")
+	file := fs.String("file", "", "write the diagram to this file instead of stdout")
+	fs.Parse(args)
+
+	nodes, edges := topology(inventoryResources())
+
+	var buf bytes.Buffer
+	switch *format {
+	case "dot":
+		writeDOT(&buf, nodes, edges)
+	case "mermaid":
+		writeMermaid(&buf, nodes, edges)
+	default:
+		fmt.Printf("Unknown diagram format '%s'\n", *format)
+		os.Exit(1)
+	}
+
+	if *file == "" {
+		os.Stdout.Write(buf.Bytes())
+		return
+	}
+	err := ioutil.WriteFile(*file, buf.Bytes(), 0644)
+	onErrorFail(err, "WriteFile failed")
+}
+
+// topology turns the deployed resources into the nodes and edges of the diagram,
+// in the order VNet -> subnets -> NICs -> public IPs and VMs.
+func topology(deployed []deployedResource) ([]graphNode, []graphEdge) {
+	nodes, edges := []graphNode{}, []graphEdge{}
+	known := map[string]bool{}
+	add := func(id *string, kind string, lines ...string) {
+		if id == nil || known[strings.ToLower(*id)] {
+			return
+		}
+		known[strings.ToLower(*id)] = true
+		nodes = append(nodes, graphNode{ID: strings.ToLower(*id), Kind: kind, Lines: lines})
+	}
+	connect := func(from, to *string, dashed bool) {
+		if from != nil && to != nil {
+			edges = append(edges, graphEdge{From: strings.ToLower(*from), To: strings.ToLower(*to), Dashed: dashed})
+		}
+	}
+
+	for _, r := range deployed {
+		switch m := r.Model.(type) {
+		case network.VirtualNetwork:
+			prefixes := ""
+			if m.AddressSpace != nil && m.AddressSpace.AddressPrefixes != nil {
+				prefixes = strings.Join(*m.AddressSpace.AddressPrefixes, ", ")
+			}
+			add(m.ID, "vnet", "vnet: "+stringValue(m.Name), prefixes)
+			if m.Subnets != nil {
+				for _, s := range *m.Subnets {
+					prefix := ""
+					if s.SubnetPropertiesFormat != nil {
+						prefix = stringValue(s.AddressPrefix)
+					}
+					add(s.ID, "subnet", "subnet: "+stringValue(s.Name), prefix)
+					connect(m.ID, s.ID, false)
+				}
+			}
+			if m.VirtualNetworkPeerings != nil {
+				for _, p := range *m.VirtualNetworkPeerings {
+					if p.VirtualNetworkPeeringPropertiesFormat != nil && p.RemoteVirtualNetwork != nil {
+						connect(m.ID, p.RemoteVirtualNetwork.ID, true)
+					}
+				}
+			}
+		case network.PublicIPAddress:
+			ip := "(unallocated)"
+			if m.PublicIPAddressPropertiesFormat != nil && m.IPAddress != nil {
+				ip = *m.IPAddress
+			}
+			add(m.ID, "pip", "pip: "+stringValue(m.Name), ip)
+		case compute.VirtualMachine:
+			size := ""
+			if m.VirtualMachineProperties != nil && m.HardwareProfile != nil {
+				size = string(m.HardwareProfile.VMSize)
+			}
+			add(m.ID, "vm", "vm: "+stringValue(m.Name), size)
+		}
+	}
+
+	// NICs come last, so that the subnets, public IPs and VMs they connect are already known.
+	for _, r := range deployed {
+		nic, ok := r.Model.(network.Interface)
+		if !ok || nic.InterfacePropertiesFormat == nil {
+			continue
+		}
+		private := ""
+		if ipConfig := primaryIPConfiguration(nic); ipConfig != nil {
+			private = stringValue(ipConfig.PrivateIPAddress)
+		}
+		add(nic.ID, "nic", "nic: "+stringValue(nic.Name), private)
+		if nic.IPConfigurations != nil {
+			for _, ipConfig := range *nic.IPConfigurations {
+				if ipConfig.InterfaceIPConfigurationPropertiesFormat == nil {
+					continue
+				}
+				if ipConfig.Subnet != nil {
+					connect(ipConfig.Subnet.ID, nic.ID, false)
+				}
+				if ipConfig.PublicIPAddress != nil {
+					connect(nic.ID, ipConfig.PublicIPAddress.ID, false)
+				}
+			}
+		}
+		if nic.VirtualMachine != nil {
+			connect(nic.ID, nic.VirtualMachine.ID, false)
+		}
+	}
+
+	// Drop edges to resources outside the resource group, such as the remote end of a cross-group peering.
+	inGroup := []graphEdge{}
+	for _, e := range edges {
+		if known[e.From] && known[e.To] {
+			inGroup = append(inGroup, e)
+		}
+	}
+	return nodes, inGroup
+}
+
+// nodeNames gives every node a short identifier that is valid in both DOT and Mermaid.
+func nodeNames(nodes []graphNode) map[string]string {
+	names := map[string]string{}
+	for i, n := range nodes {
+		names[n.ID] = fmt.Sprintf("%s%d", n.Kind, i)
+	}
+	return names
+}
+
+// writeDOT writes the diagram in Graphviz DOT, e.g. for `dot -Tsvg`.
+func writeDOT(buf *bytes.Buffer, nodes []graphNode, edges []graphEdge) {
+	names := nodeNames(nodes)
+	buf.WriteString("digraph topology {\n  rankdir=LR;\n  node [fontname=\"Helvetica\"];\n")
+	for _, n := range nodes {
+		label := strings.Replace(strings.Join(n.Lines, "\n"), `"`, `\"`, -1)
+		label = strings.Replace(label, "\n", `\n`, -1)
+		fmt.Fprintf(buf, "  %s [shape=%s, label=\"%s\"];\n", names[n.ID], graphShapes[n.Kind], label)
+	}
+	for _, e := range edges {
+		style := ""
+		if e.Dashed {
+			style = " [style=dashed, label=\"peering\"]"
+		}
+		fmt.Fprintf(buf, "  %s -> %s%s;\n", names[e.From], names[e.To], style)
+	}
+	buf.WriteString("}\n")
+}
+
+// writeMermaid writes the diagram as a Mermaid flowchart, which renders in GitHub Markdown.
+func writeMermaid(buf *bytes.Buffer, nodes []graphNode, edges []graphEdge) {
+	names := nodeNames(nodes)
+	buf.WriteString("graph LR\n")
+	for _, n := range nodes {
+		label := strings.Replace(strings.Join(n.Lines, "<br/>"), `"`, "#quot;", -1)
+		fmt.Fprintf(buf, "  %s[\"%s\"]\n", names[n.ID], label)
+	}
+	for _, e := range edges {
+		arrow := "-->"
+		if e.Dashed {
+			arrow = "-. peering .->"
+		}
+		fmt.Fprintf(buf, "  %s %s %s\n", names[e.From], arrow, names[e.To])
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// activityLogAPIVersion is the API version of the Activity Log's management events.
+const activityLogAPIVersion = "2015-04-01"
+
+// activityLogRetention is how far back the Activity Log keeps events.
+const activityLogRetention = 90 * 24 * time.Hour
+
+// activityEvent is an Activity Log event of an operation on a resource.
+type activityEvent struct {
+	EventTimestamp string        `json:"eventTimestamp"`
+	Caller         string        `json:"caller"`
+	CorrelationID  string        `json:"correlationId"`
+	ResourceID     string        `json:"resourceId"`
+	OperationName  localizedName `json:"operationName"`
+	Status         localizedName `json:"status"`
+}
+
+// localizedName is a value of the Activity Log with its display text.
+type localizedName struct {
+	Value          string `json:"value"`
+	LocalizedValue string `json:"localizedValue"`
+}
+
+// history prints who changed the resources of the last run and when, from the Activity Log. By default it
+// covers every operation on the resources of the state file, including later ones by other callers; with
+// -run only those of the run itself, which sent its requests with the correlation ID of the state file.
+func history(args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	run := fs.Bool("run", false, "only show the operations of the run that wrote the state file")
+	correlation := fs.String("correlation-id", "", "only show the operations of this correlation ID")
+	since := fs.Duration("since", 0, "how far back to look, from the run's start by default, at most 90 days")
+	all := fs.Bool("all", false, "also show the events of operations being started or accepted")
+	fs.Parse(args)
+
+	state := loadState()
+	if *run {
+		if state.CorrelationID == "" {
+			fmt.Printf("The state file '%s' has no correlation ID, it was written with -no-telemetry or before runs recorded theirs\n", *statePath)
+			os.Exit(1)
+		}
+		*correlation = state.CorrelationID
+	}
+	from := time.Now().Add(-activityLogRetention + time.Hour)
+	if started, err := time.Parse(time.RFC3339, state.Started); err == nil && started.After(from) {
+		from = started.Add(-time.Minute)
+	}
+	if *since > 0 {
+		from = time.Now().Add(-*since)
+	}
+
+	filter := fmt.Sprintf("eventTimestamp ge '%s' and eventTimestamp le '%s'",
+		from.UTC().Format(time.RFC3339), time.Now().UTC().Format(time.RFC3339))
+	if *correlation != "" {
+		filter += fmt.Sprintf(" and correlationId eq '%s'", *correlation)
+	} else {
+		filter += fmt.Sprintf(" and resourceGroupName eq '%s'", groupName)
+	}
+	events, err := listActivityEvents(filter)
+	onErrorFail(err, "Querying the Activity Log failed")
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tCALLER\tOPERATION\tSTATUS\tRESOURCE")
+	shown := 0
+	// The Activity Log returns the newest events first.
+	for i := len(events) - 1; i >= 0; i-- {
+		e := events[i]
+		if !*all && (e.Status.Value == "Started" || e.Status.Value == "Accepted") {
+			continue
+		}
+		if *correlation == "" && !stateCovers(state, e.ResourceID) {
+			continue
+		}
+		r, _ := parseID(e.ResourceID)
+		name := strings.Join(r.Names, "/")
+		if name == "" {
+			name = r.Name()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.EventTimestamp, e.Caller, e.OperationName.LocalizedValue, e.Status.Value, name)
+		shown++
+	}
+	if shown == 0 {
+		fmt.Printf("No operations on the run's resources since %s\n", from.Format(time.RFC3339))
+		return
+	}
+	w.Flush()
+}
+
+// stateCovers reports whether the resource id, or the resource it is nested in, is recorded in the state.
+func stateCovers(state sampleState, id string) bool {
+	for _, r := range state.Resources {
+		if strings.EqualFold(r.ID, id) || strings.HasPrefix(strings.ToLower(id), strings.ToLower(r.ID)+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// listActivityEvents returns the management events of the subscription's Activity Log matching filter,
+// following the nextLinks.
+func listActivityEvents(filter string) ([]activityEvent, error) {
+	path := "/subscriptions/" + groupClient.SubscriptionID + "/providers/Microsoft.Insights/eventtypes/management/values"
+	query := map[string]interface{}{"$filter": filter}
+	events := []activityEvent{}
+	for {
+		var page struct {
+			Value    []activityEvent `json:"value"`
+			NextLink string          `json:"nextLink"`
+		}
+		if err := armRequest("GET", path, activityLogAPIVersion, query, nil, &page); err != nil {
+			return nil, err
+		}
+		events = append(events, page.Value...)
+		if page.NextLink == "" {
+			return events, nil
+		}
+		next, err := url.Parse(page.NextLink)
+		if err != nil {
+			return nil, err
+		}
+		path, query = next.Path, map[string]interface{}{}
+		for k, v := range next.Query() {
+			if k != "api-version" {
+				query[k] = v[0]
+			}
+		}
+	}
+}
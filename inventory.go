@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/arm/compute"
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+)
+
+// inventory is the content of the -inventory file the inventory daemon keeps up to date.
+type inventory struct {
+	Refreshed time.Time `json:"refreshed"`
+
+	// Expires is when the inventory is too old to be used in place of ARM, should the daemon have stopped.
+	Expires time.Time                 `json:"expires"`
+	Groups  map[string]groupInventory `json:"groups"`
+}
+
+// groupInventory holds the resources of a resource group listed by nic list and graph.
+type groupInventory struct {
+	Refreshed time.Time                 `json:"refreshed"`
+	VNets     []network.VirtualNetwork  `json:"vnets"`
+	PublicIPs []network.PublicIPAddress `json:"publicIps"`
+	NICs      []network.Interface       `json:"nics"`
+	VMs       []compute.VirtualMachine  `json:"vms"`
+}
+
+// inventoryDaemon lists the VNets, public IPs, NICs and VMs of resource groups every -interval and writes them
+// to the -inventory file, which nic list and graph then read instead of ARM. A group that fails to refresh
+// keeps its previous inventory.
+func inventoryDaemon(args []string) {
+	fs := flag.NewFlagSet("inventory daemon", flag.ExitOnError)
+	groups := fs.String("groups", groupName, "comma-separated resource groups to keep the inventory of")
+	interval := fs.Duration("interval", time.Minute, "refresh interval")
+	fs.Parse(args)
+	if fs.NArg() > 0 || *interval <= 0 || *inventoryPath == "" {
+		fmt.Println("Usage: inventory daemon [-groups name,...] [-interval 1m], with -inventory set")
+		os.Exit(1)
+	}
+
+	inv := inventory{Groups: map[string]groupInventory{}}
+	fmt.Printf("Refreshing the inventory of %s into %s every %s\n", *groups, *inventoryPath, *interval)
+	for {
+		for _, group := range strings.Split(*groups, ",") {
+			group = strings.TrimSpace(group)
+			g, err := listGroupInventory(group)
+			if err != nil {
+				fmt.Printf("%s Refreshing resource group '%s' failed: %s\n", timestamp(), group, err)
+				continue
+			}
+			inv.Groups[strings.ToLower(group)] = g
+			stepf("%s Resource group '%s': %d NICs, %d public IPs\n", timestamp(), group, len(g.NICs), len(g.PublicIPs))
+		}
+		inv.Refreshed = time.Now().UTC()
+		inv.Expires = inv.Refreshed.Add(2 * *interval)
+		if err := writeInventory(inv); err != nil {
+			fmt.Printf("%s Writing the inventory failed: %s\n", timestamp(), err)
+		}
+		time.Sleep(*interval)
+	}
+}
+
+// listGroupInventory lists the resources of a group from ARM.
+func listGroupInventory(group string) (groupInventory, error) {
+	g := groupInventory{Refreshed: time.Now().UTC()}
+	vNets, err := listGroupVNets(group)
+	if err != nil {
+		return g, err
+	}
+	pips, err := listGroupPIPs(group)
+	if err != nil {
+		return g, err
+	}
+	nics, err := listGroupNICs(group)
+	if err != nil {
+		return g, err
+	}
+	vms, err := listGroupVMs(group)
+	if err != nil {
+		return g, err
+	}
+	if vNets.Value != nil {
+		g.VNets = *vNets.Value
+	}
+	if pips.Value != nil {
+		g.PublicIPs = *pips.Value
+	}
+	if nics.Value != nil {
+		g.NICs = *nics.Value
+	}
+	if vms.Value != nil {
+		g.VMs = *vms.Value
+	}
+	return g, nil
+}
+
+// writeInventory replaces the -inventory file, through a rename so that readers never see half of it.
+func writeInventory(inv inventory) error {
+	b, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	tmp := *inventoryPath + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, *inventoryPath)
+}
+
+// cachedInventory returns the inventory of a group if the daemon keeps an unexpired one.
+func cachedInventory(group string) (groupInventory, bool) {
+	if *inventoryPath == "" {
+		return groupInventory{}, false
+	}
+	b, err := ioutil.ReadFile(*inventoryPath)
+	if err != nil {
+		return groupInventory{}, false
+	}
+	var inv inventory
+	if err := json.Unmarshal(b, &inv); err != nil || time.Now().After(inv.Expires) {
+		return groupInventory{}, false
+	}
+	g, ok := inv.Groups[strings.ToLower(group)]
+	if ok {
+		stepf("Using the inventory of %s from %s\n", g.Refreshed.Local().Format("15:04:05"), *inventoryPath)
+	}
+	return g, ok
+}
+
+// inventoryNICs returns the NICs and public IPs of the sample's resource group, from the inventory if the
+// daemon keeps it, or else from ARM.
+func inventoryNICs() ([]network.Interface, network.PublicIPAddressListResult) {
+	if g, ok := cachedInventory(groupName); ok {
+		return g.NICs, network.PublicIPAddressListResult{Value: &g.PublicIPs}
+	}
+	list, err := listGroupNICs(groupName)
+	onErrorFail(err, "List failed")
+	pips, err := listGroupPIPs(groupName)
+	onErrorFail(err, "List failed")
+	nics := []network.Interface{}
+	if list.Value != nil {
+		nics = *list.Value
+	}
+	return nics, pips
+}
+
+// inventoryResources returns the VNets, public IPs, VMs and NICs of the sample's resource group, from the
+// inventory if the daemon keeps it, or else every resource of the group from ARM.
+func inventoryResources() []deployedResource {
+	g, ok := cachedInventory(groupName)
+	if !ok {
+		return collectDeployedResources()
+	}
+	deployed := []deployedResource{}
+	for _, vNet := range g.VNets {
+		deployed = append(deployed, newDeployedResource("vnet", vNetClient.APIVersion, vNet.ID, vNet))
+	}
+	for _, pip := range g.PublicIPs {
+		deployed = append(deployed, newDeployedResource("pip", addressClient.APIVersion, pip.ID, pip))
+	}
+	for _, nic := range g.NICs {
+		deployed = append(deployed, newDeployedResource("nic", interfacesClient.APIVersion, nic.ID, nic))
+	}
+	for _, vm := range g.VMs {
+		deployed = append(deployed, newDeployedResource("vm", vmClient.APIVersion, vm.ID, vm))
+	}
+	return deployed
+}
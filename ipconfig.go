@@ -0,0 +1,154 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// nicAddIP appends secondary IP configurations to a NIC, in the subnet of its primary one as Azure requires.
+// Addresses given with -static are assigned as is; -count adds further dynamically allocated ones.
+func nicAddIP(args []string) {
+	fs := flag.NewFlagSet("nic add-ip", flag.ExitOnError)
+	count := fs.Int("count", 0, "number of dynamically allocated private IPs to add, 1 unless -static is set")
+	static := fs.String("static", "", "comma-separated static private IPs to add")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *count < 0 {
+		fmt.Println("Usage: nic add-ip [-count n] [-static ip,...] <name>")
+		os.Exit(1)
+	}
+	addresses := []string{}
+	if *static != "" {
+		for _, a := range strings.Split(*static, ",") {
+			addresses = append(addresses, strings.TrimSpace(a))
+		}
+	}
+	if len(addresses) == 0 && *count == 0 {
+		*count = 1
+	}
+
+	name := fs.Arg(0)
+	nic, err := interfacesClient.Get(groupName, name, "")
+	onErrorFail(err, "Get failed")
+	primary := primaryIPConfiguration(nic)
+	if primary == nil || primary.InterfaceIPConfigurationPropertiesFormat == nil {
+		onErrorFail(fmt.Errorf("NIC '%s' has no IP configuration", name), "Add IP failed")
+	}
+
+	if len(addresses) > 0 {
+		subnet, err := getSubnet(*primary.Subnet.ID)
+		onErrorFail(err, "Get failed")
+		requested := map[string]bool{}
+		for _, a := range addresses {
+			if requested[a] {
+				onErrorFail(fmt.Errorf("address %s is given more than once", a), "Add IP failed")
+			}
+			requested[a] = true
+			onErrorFail(checkStaticIP(subnet, a), "Add IP failed")
+		}
+	}
+
+	fmt.Printf("Add %d IP configurations to NIC '%s' in subnet '%s'\n", len(addresses)+*count, name, lastSegment(primary.Subnet.ID))
+	subnetID := primary.Subnet.ID
+	_, err = patchNIC(groupName, name, func(nic *network.Interface) error {
+		primary := primaryIPConfiguration(*nic)
+		if primary == nil || primary.InterfaceIPConfigurationPropertiesFormat == nil {
+			return fmt.Errorf("NIC '%s' has no IP configuration", name)
+		}
+		// A NIC with several IP configurations needs one marked primary, which single-IP NICs usually aren't.
+		primary.Primary = to.BoolPtr(true)
+		ipConfigs := *nic.IPConfigurations
+		add := func(allocation network.IPAllocationMethod, address *string) {
+			ipConfigs = append(ipConfigs, network.InterfaceIPConfiguration{
+				Name: to.StringPtr(nextIPConfigName(ipConfigs)),
+				InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+					PrivateIPAllocationMethod: allocation,
+					PrivateIPAddress:          address,
+					Subnet:                    &network.Subnet{ID: subnetID},
+					Primary:                   to.BoolPtr(false),
+				},
+			})
+		}
+		for _, a := range addresses {
+			add(network.Static, to.StringPtr(a))
+		}
+		for i := 0; i < *count; i++ {
+			add(network.Dynamic, nil)
+		}
+		nic.IPConfigurations = &ipConfigs
+		return nil
+	})
+	onErrorFail(err, "CreateOrUpdate failed")
+
+	nic, err = interfacesClient.Get(groupName, name, "")
+	onErrorFail(err, "Get failed")
+	printIPConfigurations(nic)
+	fmt.Println("\nThe guest OS only answers on the new addresses once they are configured inside it, e.g. with")
+	fmt.Println("`ip addr add` on Linux; DHCP hands out the primary address only.")
+}
+
+// nicRemoveIP removes secondary IP configurations, given by name or private IP, from a NIC.
+func nicRemoveIP(args []string) {
+	if len(args) < 2 {
+		fmt.Println("Usage: nic remove-ip <name> <ipconfig or private IP>...")
+		os.Exit(1)
+	}
+	name := args[0]
+	removed := []string{}
+	_, err := patchNIC(groupName, name, func(nic *network.Interface) error {
+		if nic.InterfacePropertiesFormat == nil || nic.IPConfigurations == nil {
+			return fmt.Errorf("NIC '%s' has no IP configuration", name)
+		}
+		remove := map[string]bool{}
+		for _, a := range args[1:] {
+			remove[a] = true
+		}
+		kept := []network.InterfaceIPConfiguration{}
+		removed = []string{}
+		for _, c := range *nic.IPConfigurations {
+			address := ""
+			if c.InterfaceIPConfigurationPropertiesFormat != nil {
+				address = stringValue(c.PrivateIPAddress)
+			}
+			ipConfigName := stringValue(c.Name)
+			if !remove[ipConfigName] && !remove[address] {
+				kept = append(kept, c)
+				continue
+			}
+			if c.InterfaceIPConfigurationPropertiesFormat != nil && c.Primary != nil && *c.Primary {
+				return fmt.Errorf("'%s' is the primary IP configuration of NIC '%s'", ipConfigName, name)
+			}
+			delete(remove, ipConfigName)
+			delete(remove, address)
+			removed = append(removed, fmt.Sprintf("'%s' (%s)", ipConfigName, address))
+		}
+		for a := range remove {
+			return fmt.Errorf("NIC '%s' has no IP configuration or private IP '%s'", name, a)
+		}
+		nic.IPConfigurations = &kept
+		return nil
+	})
+	onErrorFail(err, "Remove IP failed")
+	fmt.Printf("Removed IP configurations %s from NIC '%s'\n", strings.Join(removed, ", "), name)
+	nic, err := interfacesClient.Get(groupName, name, "")
+	onErrorFail(err, "Get failed")
+	printIPConfigurations(nic)
+}
+
+// nextIPConfigName returns the first name of the form secondary<n> not used by ipConfigs.
+func nextIPConfigName(ipConfigs []network.InterfaceIPConfiguration) string {
+	used := map[string]bool{}
+	for _, c := range ipConfigs {
+		used[strings.ToLower(stringValue(c.Name))] = true
+	}
+	for n := 1; ; n++ {
+		name := fmt.Sprintf("secondary%d", n)
+		if !used[name] {
+			return name
+		}
+	}
+}
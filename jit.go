@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// jitAPIVersion is the version of the Microsoft Defender for Cloud API of JIT network access policies.
+const jitAPIVersion = "2020-01-01"
+
+// jitPolicyName is the name of the sample's JIT network access policy.
+const jitPolicyName = "default"
+
+// jitDuration is how long access may be requested for at a time.
+const jitDuration = 3 * time.Hour
+
+// callerIPURL answers the public IP address of the caller as plain text.
+const callerIPURL = "https://api.ipify.org"
+
+// validateJIT exits if -jit is given without -nsg, as JIT opens and closes ports through NSG rules.
+func validateJIT() {
+	if *jit && *nsgLevel == "" {
+		fmt.Println("-jit needs -nsg, just-in-time access opens SSH through NSG rules")
+		os.Exit(1)
+	}
+}
+
+// configureJIT creates a JIT network access policy for SSH on the VM, then requests access from the caller's
+// IP address, or from -jit-source, for jitDuration. Microsoft Defender for Servers must be enabled on the
+// subscription.
+func configureJIT(location string) {
+	vmID := resourceID("Microsoft.Compute/virtualMachines", vmName)
+	path := fmt.Sprintf("%s/providers/Microsoft.Security/locations/%s/jitNetworkAccessPolicies/%s",
+		resourceID("", ""), location, jitPolicyName)
+
+	stepf("Create JIT network access policy for SSH on VM '%s'\n", vmName)
+	policy := map[string]interface{}{}
+	err := armRequest("PUT", path, jitAPIVersion, nil, map[string]interface{}{
+		"kind": "Basic",
+		"properties": map[string]interface{}{
+			"virtualMachines": []interface{}{
+				map[string]interface{}{
+					"id": vmID,
+					"ports": []interface{}{
+						map[string]interface{}{
+							"number":                     22,
+							"protocol":                   "TCP",
+							"allowedSourceAddressPrefix": "*",
+							"maxRequestAccessDuration":   isoDuration(jitDuration),
+						},
+					},
+				},
+			},
+		},
+	}, &policy)
+	onErrorFail(err, "Creating the JIT policy failed")
+	id, _ := policy["id"].(string)
+	recordCreated("jit", jitAPIVersion, &id, policy)
+
+	source := *jitSource
+	if source == "" {
+		source, err = callerIP()
+		onErrorFail(err, "Getting the caller's IP address failed")
+	}
+	stepf("Request SSH access to VM '%s' from %s\n", vmName, source)
+	err = armRequest("POST", path+"/initiate", jitAPIVersion, nil, map[string]interface{}{
+		"virtualMachines": []interface{}{
+			map[string]interface{}{
+				"id": vmID,
+				"ports": []interface{}{
+					map[string]interface{}{
+						"number":                     22,
+						"duration":                   isoDuration(jitDuration),
+						"allowedSourceAddressPrefix": source,
+					},
+				},
+			},
+		},
+		"justification": "network-go-manage-network-interface sample",
+	}, nil)
+	onErrorFail(err, "Requesting JIT access failed")
+	fmt.Printf("SSH to VM '%s' is open to %s until %s\n", vmName, source,
+		time.Now().Add(jitDuration).Format(time.RFC3339))
+}
+
+// callerIP returns the public IP address this machine reaches the Internet from.
+func callerIP() (string, error) {
+	client := &http.Client{Transport: newTransport(), Timeout: 30 * time.Second}
+	resp, err := client.Get(callerIPURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	ip := strings.TrimSpace(string(b))
+	if resp.StatusCode != http.StatusOK || net.ParseIP(ip) == nil {
+		return "", fmt.Errorf("%s responded %s", callerIPURL, resp.Status)
+	}
+	return ip, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/arm/resources/locks"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+const (
+	lockType = "Microsoft.Authorization/locks"
+
+	// lockScopeSeparator separates the ID of a lock's scope from the lock's name.
+	lockScopeSeparator = "/providers/Microsoft.Authorization/locks/"
+)
+
+// createLocks places a CanNotDelete lock on the resource group, or on each NIC in it, and records the locks
+// so that teardown can remove them before deleting what they protect.
+func createLocks(scope string) {
+	lock := locks.ManagementLockObject{
+		ManagementLockProperties: &locks.ManagementLockProperties{
+			Level: locks.CanNotDelete,
+			Notes: to.StringPtr("Placed by " + sampleUserAgent + ", removed by its teardown"),
+		},
+	}
+
+	switch scope {
+	case "group":
+		name := "cannot-delete-" + groupName
+		stepf("Lock resource group '%s'\n", groupName)
+		created, err := lockClient.CreateOrUpdateAtResourceGroupLevel(groupName, name, lock)
+		onErrorFail(err, "CreateOrUpdateAtResourceGroupLevel failed")
+		recordCreated("lock", lockClient.APIVersion, created.ID, created)
+	case "nics":
+		nics, err := listGroupNICs(groupName)
+		onErrorFail(err, "List failed")
+		if nics.Value == nil {
+			return
+		}
+		for _, nic := range *nics.Value {
+			name := "cannot-delete-" + *nic.Name
+			stepf("Lock NIC '%s'\n", *nic.Name)
+			created, err := lockClient.CreateOrUpdateAtResourceLevel(groupName, "Microsoft.Network", "", "networkInterfaces", *nic.Name, name, lock)
+			onErrorFail(err, "CreateOrUpdateAtResourceLevel failed")
+			recordCreated("lock", lockClient.APIVersion, created.ID, created)
+		}
+	default:
+		fmt.Printf("Unknown lock scope '%s', use group or nics\n", scope)
+		os.Exit(1)
+	}
+}
+
+// unlockMu serializes unlockFor, so that resources deleted concurrently, such as NICs, don't both try to
+// remove the lock on their resource group.
+var unlockMu sync.Mutex
+
+// unlockFor removes the recorded locks that would prevent deleting the resource with the given ID:
+// those on the resource itself, on what contains it, such as its resource group, and on what it contains.
+func unlockFor(id string) {
+	unlockMu.Lock()
+	defer unlockMu.Unlock()
+	stateMu.Lock()
+	recorded := append([]stateResource{}, runState.Resources...)
+	stateMu.Unlock()
+
+	id = strings.ToLower(id)
+	for _, r := range recorded {
+		if !strings.EqualFold(r.Type, lockType) {
+			continue
+		}
+		scope := strings.ToLower(r.ID)
+		if i := strings.Index(scope, strings.ToLower(lockScopeSeparator)); i >= 0 {
+			scope = scope[:i]
+		}
+		if id != scope && !strings.HasPrefix(id, scope+"/") && !strings.HasPrefix(scope, id+"/") {
+			continue
+		}
+		stepf("\tRemove lock '%s'\n", r.Name)
+		if err := deleteResource(r); err != nil {
+			fmt.Printf("\tRemoving the lock failed: %s\n", err)
+			continue
+		}
+		stateMu.Lock()
+		recordDeleted(r.Type, r.Name)
+		stateMu.Unlock()
+	}
+}
+
+// resourceID returns the ID of a resource of the given type in the sample's resource group, or of the group
+// itself when resourceType is empty.
+func resourceID(resourceType, name string) string {
+	id := groupID(groupClient.SubscriptionID, groupName)
+	if resourceType == "" {
+		return id.String()
+	}
+	return id.Child(resourceType, name).String()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// countLockDeletes is a transport counting the deletions of locks it passes on to the fake.
+type countLockDeletes struct {
+	f       *fakeARM
+	mu      sync.Mutex
+	deletes int
+}
+
+func (t *countLockDeletes) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Method == http.MethodDelete && strings.Contains(r.URL.Path, "/locks/") {
+		t.mu.Lock()
+		t.deletes++
+		t.mu.Unlock()
+	}
+	return t.f.RoundTrip(r)
+}
+
+// TestUnlockForConcurrently removes the lock on the resource group for NICs deleted concurrently, as
+// nic delete does, and checks that the lock is removed once. Run with -race to check the state updates.
+func TestUnlockForConcurrently(t *testing.T) {
+	f := newTestARM(t)
+	transport := &countLockDeletes{f: f}
+	createClients(offlineSubscriptionID, autorest.NullAuthorizer{}, newSenderWithTransport(transport))
+
+	lockID := resourceID("", "") + lockScopeSeparator + "cannot-delete-group"
+	runState = sampleState{ResourceGroup: groupName, Resources: []stateResource{
+		{Type: resourceTypes["group"], Name: groupName, ID: resourceID("", "")},
+		{Type: lockType, Name: "cannot-delete-group", ID: lockID},
+	}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			unlockFor(resourceID("Microsoft.Network/networkInterfaces", fmt.Sprintf("nic-%d", i)))
+		}(i)
+	}
+	wg.Wait()
+
+	if transport.deletes != 1 {
+		t.Errorf("the lock was deleted %d times, want once", transport.deletes)
+	}
+	if runState.find(lockID) >= 0 {
+		t.Errorf("the removed lock is still recorded in the state")
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// metricsAPIVersion is the version of the Azure Monitor metrics API, which the SDK has no client for.
+const metricsAPIVersion = "2018-01-01"
+
+// nicMetricNames are the traffic metrics of a NIC, in bytes per second.
+var nicMetricNames = []string{"BytesSentRate", "BytesReceivedRate"}
+
+// sparkBlocks are the bars of a sparkline, from lowest to highest.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// metricsResponse is the part of an Azure Monitor metrics response the sample reads.
+type metricsResponse struct {
+	Value []struct {
+		Name struct {
+			Value string `json:"value"`
+		} `json:"name"`
+		Timeseries []struct {
+			Data []struct {
+				TimeStamp string   `json:"timeStamp"`
+				Average   *float64 `json:"average"`
+			} `json:"data"`
+		} `json:"timeseries"`
+	} `json:"value"`
+}
+
+// nicMetrics prints the traffic of a NIC over a time range as a table, or as sparklines with -spark.
+func nicMetrics(args []string) {
+	fs := flag.NewFlagSet("nic metrics", flag.ExitOnError)
+	since := fs.Duration("since", time.Hour, "length of the time range ending now")
+	interval := fs.Duration("interval", 5*time.Minute, "granularity of the data points: 1m, 5m, 15m, 30m, 1h, 6h, 12h or 24h")
+	spark := fs.Bool("spark", false, "print a sparkline per metric instead of a table")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Println("Usage: nic metrics [-since 1h] [-interval 5m] [-spark] <name>")
+		os.Exit(1)
+	}
+
+	nic, err := interfacesClient.Get(groupName, fs.Arg(0), "")
+	onErrorFail(err, "Get failed")
+
+	end := time.Now().UTC()
+	var metrics metricsResponse
+	err = armRequest("GET", *nic.ID+"/providers/Microsoft.Insights/metrics", metricsAPIVersion, map[string]interface{}{
+		"metricnames": strings.Join(nicMetricNames, ","),
+		"timespan":    end.Add(-*since).Format(time.RFC3339) + "/" + end.Format(time.RFC3339),
+		"interval":    isoDuration(*interval),
+		"aggregation": "Average",
+	}, nil, &metrics)
+	onErrorFail(err, "Getting the metrics failed")
+
+	// Collect the series per metric, aligned on the timestamps of the first one.
+	timestamps := []string{}
+	series := map[string][]float64{}
+	for _, m := range metrics.Value {
+		for _, ts := range m.Timeseries {
+			for _, d := range ts.Data {
+				if m.Name.Value == nicMetricNames[0] {
+					timestamps = append(timestamps, d.TimeStamp)
+				}
+				v := 0.0
+				if d.Average != nil {
+					v = *d.Average
+				}
+				series[m.Name.Value] = append(series[m.Name.Value], v)
+			}
+		}
+	}
+
+	if *spark {
+		for _, name := range nicMetricNames {
+			values := series[name]
+			fmt.Printf("%-18s %s  max %s/s\n", name, sparkline(values), byteRate(maxValue(values)))
+		}
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tSENT\tRECEIVED")
+	for i, t := range timestamps {
+		row := []string{t}
+		for _, name := range nicMetricNames {
+			if i < len(series[name]) {
+				row = append(row, byteRate(series[name][i])+"/s")
+			} else {
+				row = append(row, "-")
+			}
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+}
+
+// isoDuration formats a duration of whole minutes in ISO 8601, as Azure Monitor expects intervals.
+func isoDuration(d time.Duration) string {
+	if d >= time.Hour && d%time.Hour == 0 {
+		return fmt.Sprintf("PT%dH", d/time.Hour)
+	}
+	return fmt.Sprintf("PT%dM", d/time.Minute)
+}
+
+// sparkline renders values as bars scaled to their maximum.
+func sparkline(values []float64) string {
+	top := maxValue(values)
+	bars := make([]rune, len(values))
+	for i, v := range values {
+		level := 0
+		if top > 0 {
+			level = int(v / top * float64(len(sparkBlocks)-1))
+		}
+		bars[i] = sparkBlocks[level]
+	}
+	return string(bars)
+}
+
+// maxValue returns the largest of values, or 0.
+func maxValue(values []float64) float64 {
+	top := 0.0
+	for _, v := range values {
+		if v > top {
+			top = v
+		}
+	}
+	return top
+}
+
+// byteRate formats a number of bytes with a binary unit prefix.
+func byteRate(b float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB"}
+	i := 0
+	for b >= 1024 && i < len(units)-1 {
+		b /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", b, units[i])
+}
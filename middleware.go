@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// prepareDecorators and respondDecorators are the hooks every client applies to its requests and
+// responses, registered with registerPrepareDecorator and registerRespondDecorator.
+var (
+	prepareDecorators []autorest.PrepareDecorator
+	respondDecorators []autorest.RespondDecorator
+)
+
+// registerPrepareDecorator adds decorators applied to every request of every client, after the
+// request is built and before it is authorized and sent, e.g. to add headers or rewrite the URL.
+// Decorators apply in the order they are registered, also to clients created before.
+func registerPrepareDecorator(d ...autorest.PrepareDecorator) {
+	prepareDecorators = append(prepareDecorators, d...)
+}
+
+// registerRespondDecorator adds decorators applied to every response of every client, polling included,
+// e.g. to capture responses. autorest inspects a response once when it is received and once more when the
+// client reads its result, so decorators should expect to see it twice, and restore the body if they read it.
+func registerRespondDecorator(d ...autorest.RespondDecorator) {
+	respondDecorators = append(respondDecorators, d...)
+}
+
+// inspectRequest is the RequestInspector of the clients, applying the registered prepare decorators.
+func inspectRequest(p autorest.Preparer) autorest.Preparer {
+	return autorest.PreparerFunc(func(r *http.Request) (*http.Request, error) {
+		return autorest.DecoratePreparer(p, prepareDecorators...).Prepare(r)
+	})
+}
+
+// inspectResponse is the ResponseInspector of the clients, applying the registered respond decorators.
+func inspectResponse(r autorest.Responder) autorest.Responder {
+	return autorest.ResponderFunc(func(resp *http.Response) error {
+		return autorest.DecorateResponder(r, respondDecorators...).Respond(resp)
+	})
+}
+
+// headerList collects repeated name=value flags of HTTP headers.
+type headerList map[string]string
+
+func (h headerList) String() string {
+	pairs := []string{}
+	for k, v := range h {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (h headerList) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("header '%s' isn't of the form name=value", value)
+	}
+	h[http.CanonicalHeaderKey(kv[0])] = kv[1]
+	return nil
+}
+
+// headerFlags are the headers given with -header.
+var headerFlags = headerList{}
+
+func init() {
+	flag.Var(headerFlags, "header", "name=value HTTP header to add to every request sent to ARM; repeatable")
+	registerPrepareDecorator(func(p autorest.Preparer) autorest.Preparer {
+		return autorest.PreparerFunc(func(r *http.Request) (*http.Request, error) {
+			r, err := p.Prepare(r)
+			if err == nil && len(headerFlags) > 0 {
+				if r.Header == nil {
+					r.Header = http.Header{}
+				}
+				for k, v := range headerFlags {
+					r.Header.Set(k, v)
+				}
+			}
+			return r, err
+		})
+	})
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/arm/compute"
+	"github.com/Azure/azure-sdk-for-go/arm/resources/resources"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// moveAPIVersion is the first resources API version with validateMoveResources, which the SDK's
+// 2016-09-01 client doesn't have.
+const moveAPIVersion = "2017-05-10"
+
+// ARM may answer for a moved resource from its old location for a while, so its new ID is read up to
+// moveVerifyAttempts times, moveVerifyInterval apart.
+const (
+	moveVerifyAttempts = 12
+	moveVerifyInterval = 10 * time.Second
+)
+
+// moveResources moves NICs of the resource group, with their public IPs and the VMs they are attached to,
+// to another resource group, of the same or, with -to-subscription, another subscription of the tenant.
+// ARM moves a VM only together with all its NICs, so those of the VM come along too. The move is validated
+// first with validateMoveResources, which also checks the target's permissions, policies and registered
+// resource providers, so nothing is moved unless all of it can be. Once moved, each resource is read back
+// under its new ID.
+func moveResources(args []string) {
+	fs := flag.NewFlagSet("move", flag.ExitOnError)
+	toGroup := fs.String("to-group", "", "resource group to move the resources to, created in the sample's region if missing")
+	toSubscription := fs.String("to-subscription", "", "subscription of -to-group, the sample's when empty")
+	timeout := fs.Duration("timeout", 4*time.Hour, "how long to wait for the move, which ARM completes regardless")
+	dryRun := fs.Bool("dry-run", false, "only validate the move")
+	fs.Parse(args)
+	if *toGroup == "" {
+		fmt.Println("Usage: move -to-group name [-to-subscription id] [-timeout 4h] [-dry-run] [nic...]")
+		os.Exit(1)
+	}
+	target := groupID(groupClient.SubscriptionID, *toGroup)
+	if *toSubscription != "" {
+		target.Subscription = *toSubscription
+	}
+	if strings.EqualFold(target.String(), resourceID("", "")) {
+		fmt.Printf("The resources are in resource group '%s' already\n", groupName)
+		os.Exit(1)
+	}
+	nics := []string{}
+	for _, name := range fs.Args() {
+		nics = append(nics, resourceID("Microsoft.Network/networkInterfaces", name))
+	}
+	if len(nics) == 0 {
+		// Without NICs the sample's VM moves with everything attached to it.
+		vm, err := vmClient.Get(groupName, vmName, "")
+		onErrorFail(err, "Get VM failed")
+		nics = vmNICs(vm)
+	}
+	ids, err := movedResources(nics)
+	onErrorFail(err, "Collecting the resources to move failed")
+	fmt.Printf("Resources to move to %s:\n", target)
+	for _, id := range ids {
+		fmt.Printf("\t%s\n", id)
+	}
+
+	if !ensureGroup(target, *dryRun) {
+		fmt.Printf("Resource group '%s' doesn't exist, the move would create it but can't be validated without it\n", *toGroup)
+		return
+	}
+	info := resources.MoveInfo{Resources: &ids, TargetResourceGroup: to.StringPtr(target.String())}
+
+	// Validation is a long-running operation as well, which takes a few minutes across subscriptions.
+	stepf("Validate moving %d resources to resource group '%s'\n", len(ids), *toGroup)
+	err = armRequest("POST", resourceID("", "")+"/validateMoveResources", moveAPIVersion, nil, info, nil)
+	onErrorFail(err, "Validating the move failed")
+	if *dryRun {
+		fmt.Println("The resources can be moved")
+		return
+	}
+
+	stepf("Move %d resources to resource group '%s', which locks both groups until it completes\n", len(ids), *toGroup)
+	cancel := make(chan struct{})
+	timer := time.AfterFunc(*timeout, func() { close(cancel) })
+	_, err = genericClient.MoveResources(groupName, info, cancel)
+	if !timer.Stop() {
+		fmt.Printf("The move didn't complete within %s, ARM goes on with it; check the resources with nic show -id later\n", *timeout)
+		os.Exit(exitTimeout)
+	}
+	onErrorFail(err, "MoveResources failed")
+
+	stepf("Verify the moved resources\n")
+	for _, id := range ids {
+		r, _ := parseID(id)
+		r.Subscription, r.ResourceGroup = target.Subscription, target.ResourceGroup
+		onErrorFail(verifyMoved(r), fmt.Sprintf("Verifying %s failed", r))
+		resourceMoved(id, r.String())
+		fmt.Printf("\t%s\n", r)
+	}
+	fmt.Printf("Moved %d resources to resource group '%s'\n", len(ids), *toGroup)
+}
+
+// verifyMoved reads a moved NIC, public IP or VM under its new ID until ARM has it there.
+func verifyMoved(id armID) error {
+	apiVersion := interfacesClient.APIVersion
+	if strings.EqualFold(id.Namespace, "Microsoft.Compute") {
+		apiVersion = vmClient.APIVersion
+	}
+	var err error
+	for attempt := 1; attempt <= moveVerifyAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(moveVerifyInterval)
+		}
+		var resource struct {
+			ID string `json:"id"`
+		}
+		err = armRequest("GET", id.String(), apiVersion, nil, nil, &resource)
+		if err == nil && strings.EqualFold(resource.ID, id.String()) {
+			return nil
+		}
+		if err == nil {
+			err = fmt.Errorf("ARM still has it as %s", resource.ID)
+		}
+	}
+	return err
+}
+
+// movedResources returns the IDs of NICs of the resource group, given by ID, with the public IPs of their
+// IP configurations, the VMs they are attached to and the other NICs of those VMs.
+func movedResources(nics []string) ([]string, error) {
+	ids := []string{}
+	seen := map[string]bool{}
+	add := func(id *string) {
+		if id != nil && !seen[strings.ToLower(*id)] {
+			seen[strings.ToLower(*id)] = true
+			ids = append(ids, *id)
+		}
+	}
+	vms := []string{}
+	for i := 0; i < len(nics); i++ {
+		if seen[strings.ToLower(nics[i])] {
+			continue
+		}
+		if !strings.EqualFold(resourceGroupOf(&nics[i]), groupName) {
+			return nil, fmt.Errorf("NIC '%s' is in resource group '%s', move it from there", lastSegment(&nics[i]), resourceGroupOf(&nics[i]))
+		}
+		nic, err := getNICByID(nics[i])
+		if err != nil {
+			return nil, err
+		}
+		add(nic.ID)
+		if nic.IPConfigurations != nil {
+			for _, c := range *nic.IPConfigurations {
+				if c.InterfaceIPConfigurationPropertiesFormat != nil && c.PublicIPAddress != nil {
+					add(c.PublicIPAddress.ID)
+				}
+			}
+		}
+		if nic.VirtualMachine == nil || seen[strings.ToLower(stringValue(nic.VirtualMachine.ID))] {
+			continue
+		}
+		vmID := nic.VirtualMachine.ID
+		if !strings.EqualFold(resourceGroupOf(vmID), groupName) {
+			return nil, fmt.Errorf("NIC '%s' is attached to VM '%s' of resource group '%s', move it from there",
+				lastSegment(&nics[i]), lastSegment(vmID), resourceGroupOf(vmID))
+		}
+		add(vmID)
+		vm, err := vmClient.Get(groupName, lastSegment(vmID), "")
+		if err != nil {
+			return nil, err
+		}
+		vms = append(vms, stringValue(vm.Name))
+		nics = append(nics, vmNICs(vm)...)
+	}
+	if len(vms) > 0 {
+		fmt.Printf("VMs move with all their NICs, so the move includes VM %s\n", strings.Join(vms, ", "))
+	}
+	return ids, nil
+}
+
+// vmNICs returns the IDs of the NICs of a VM.
+func vmNICs(vm compute.VirtualMachine) []string {
+	ids := []string{}
+	if vm.VirtualMachineProperties != nil && vm.NetworkProfile != nil && vm.NetworkProfile.NetworkInterfaces != nil {
+		for _, ref := range *vm.NetworkProfile.NetworkInterfaces {
+			if ref.ID != nil {
+				ids = append(ids, *ref.ID)
+			}
+		}
+	}
+	return ids
+}
+
+// ensureGroup creates a resource group in the sample's region unless it exists, and reports whether it
+// exists afterwards. With dryRun, a missing group isn't created.
+func ensureGroup(group armID, dryRun bool) bool {
+	client := groupClient
+	client.SubscriptionID = group.Subscription
+	name := group.ResourceGroup
+	existence, err := client.CheckExistence(name)
+	if !isNotFound(existence) {
+		onErrorFail(err, "CheckExistence failed")
+		return true
+	}
+	if dryRun {
+		return false
+	}
+	stepf("Create resource group '%s'\n", name)
+	_, err = client.CreateOrUpdate(name, resources.ResourceGroup{Location: to.StringPtr(westUS), Tags: resourceTags()})
+	onErrorFail(err, "CreateOrUpdate failed")
+	return true
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/arm/compute"
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// Address space and names of the topology deployed into the second region in -multi-region mode.
+// The address space must not overlap with the first VNet's for the peering to be allowed.
+const (
+	peerAddressPrefix = "172.17.0.0/16"
+	peerSubnetPrefix  = "172.17.1.0/24"
+	peerSubnetName    = "Front-end"
+)
+
+// deploySecondRegion deploys a VNet, NIC and VM into location and peers the VNet with the first
+// region's VNet in both directions, so the two VMs can reach each other over private IPs.
+func deploySecondRegion(location string) {
+	stepf("Deploy the second region topology into %s\n", location)
+	frontEnd := layout[0]
+	frontEndVars := namingVars{"tier": frontEnd.Tier, "seq": "1"}
+	peerVNetName := resourceName("vnet", vNetName+"-"+location, location, nil)
+	peerVMName := resourceName("vm", vmName+"-"+location, location, nil)
+	peerAccountName := resourceName("storage", accountName+"peer", location, nil)
+
+	peerVNet := createVirtualNetwork(location, peerVNetName, []string{peerAddressPrefix})
+	peerSubnet := subnetLayout{
+		Name:          resourceName("subnet", peerSubnetName, location, frontEndVars),
+		AddressPrefix: peerSubnetPrefix,
+		Tier:          frontEnd.Tier,
+		NSG:           frontEnd.NSG,
+		AllowInbound:  frontEnd.AllowInbound,
+	}
+	subnet := createSubnet(peerVNetName, peerSubnet, subnetNSG(location, peerSubnet))
+	nic := createNIC(location, resourceName("nic", nicNameFrontEnd+"-"+location, location, frontEndVars), subnet)
+	createStorageAccount(location, peerAccountName)
+	createVM(location, peerVMName, peerAccountName, []compute.NetworkInterfaceReference{
+		{
+			ID: nic.ID,
+			NetworkInterfaceReferenceProperties: &compute.NetworkInterfaceReferenceProperties{
+				Primary: to.BoolPtr(true),
+			},
+		},
+	})
+
+	vNet, err := vNetClient.Get(groupName, vNetName, "")
+	onErrorFail(err, "Get failed")
+	peerVirtualNetworks(vNet, peerVNet)
+	peerVirtualNetworks(peerVNet, vNet)
+
+	frontEndNIC, err := interfacesClient.Get(groupName, nicNameFrontEnd, "")
+	onErrorFail(err, "Get failed")
+	fmt.Printf("VM '%s' (%s) and VM '%s' (%s) can now reach each other over their private IPs\n",
+		vmName, *(*frontEndNIC.IPConfigurations)[0].PrivateIPAddress,
+		peerVMName, *(*nic.IPConfigurations)[0].PrivateIPAddress)
+}
+
+// createNIC creates a NIC with a single dynamically addressed IP configuration in subnet.
+func createNIC(location, name string, subnet network.Subnet) network.Interface {
+	stepf("Create NIC '%s' using subnet '%s'\n", name, *subnet.Name)
+	nic := network.Interface{
+		Location: to.StringPtr(location),
+		Tags:     resourceTags(),
+		InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+			IPConfigurations: &[]network.InterfaceIPConfiguration{
+				{
+					Name: to.StringPtr("IPconfig1"),
+					InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+						PrivateIPAllocationMethod: network.Dynamic,
+						Subnet:                    &subnet,
+					},
+				},
+			},
+		},
+	}
+	_, err := interfacesClient.CreateOrUpdate(groupName, name, nic, nil)
+	onErrorFail(err, "CreateOrUpdate failed")
+
+	nic, err = interfacesClient.Get(groupName, name, "")
+	onErrorFail(err, "Get failed")
+	recordCreated("nic", interfacesClient.APIVersion, nic.ID, nic)
+	return nic
+}
+
+// peerVirtualNetworks creates the peering from one VNet to another. Peerings are directional,
+// so traffic only flows once both VNets have been peered with each other.
+func peerVirtualNetworks(local, remote network.VirtualNetwork) {
+	name := fmt.Sprintf("%s-to-%s", *local.Name, *remote.Name)
+	stepf("Create VNet peering '%s'\n", name)
+	peering := network.VirtualNetworkPeering{
+		VirtualNetworkPeeringPropertiesFormat: &network.VirtualNetworkPeeringPropertiesFormat{
+			AllowVirtualNetworkAccess: to.BoolPtr(true),
+			AllowForwardedTraffic:     to.BoolPtr(true),
+			RemoteVirtualNetwork: &network.SubResource{
+				ID: remote.ID,
+			},
+		},
+	}
+	_, err := peeringClient.CreateOrUpdate(groupName, *local.Name, name, peering, nil)
+	onErrorFail(err, "CreateOrUpdate failed")
+
+	peering, err = peeringClient.Get(groupName, *local.Name, name)
+	onErrorFail(err, "Get failed")
+	recordCreated("peering", peeringClient.APIVersion, peering.ID, peering)
+	stepf("\tPeering state: %s\n", peering.PeeringState)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// namingConfig holds name templates per kind of resource, e.g. "{{prefix}}-{{tier}}-nic-{{region}}-{{seq}}".
+// Kinds are group, vnet, subnet, nic, pip, nsg, storage, vm, workspace and bastion. Kinds without a template
+// keep the sample's default names.
+//
+// Templates can use {{prefix}}, {{region}} and {{kind}}, and for subnets, NICs and public IPs {{seq}},
+// their 1-based number; subnets, NICs and NSGs also have {{tier}}, the tier of their subnet in the layout:
+// front-end, mid-tier or back-end by default.
+// Include {{region}} in the templates when deploying with -multi-region, so the names don't collide.
+type namingConfig struct {
+	Prefix    string            `json:"prefix"`
+	Templates map[string]string `json:"templates"`
+}
+
+// namingVars are the values of the placeholders of a name template.
+type namingVars map[string]string
+
+var (
+	namePlaceholder     = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+	invalidStorageChars = regexp.MustCompile(`[^a-z0-9]`)
+)
+
+// applyNaming resolves the names of the resources created by the main flow from the configured templates.
+func applyNaming() {
+	groupName = resourceName("group", groupName, westUS, nil)
+	if *existingGroup != "" {
+		groupName = *existingGroup
+	}
+	vNetName = resourceName("vnet", vNetName, westUS, nil)
+	layout = resolveLayout()
+	nicNameFrontEnd = layout[0].NIC
+	if len(layout) > 1 {
+		nicNameMidTier = layout[1].NIC
+	}
+	accountName = resourceName("storage", accountName, westUS, nil)
+	vmName = resourceName("vm", vmName, westUS, nil)
+	runState.ResourceGroup = groupName
+	if !*noTelemetry {
+		runState.CorrelationID = correlationID
+	}
+	runState.Started = runStarted.UTC().Format(time.RFC3339)
+}
+
+// resourceName resolves the template configured for kind, or returns defaultName if there is none.
+// An unknown placeholder is fatal, as the name would otherwise silently miss a part.
+func resourceName(kind, defaultName, region string, vars namingVars) string {
+	template, ok := config.Naming.Templates[kind]
+	if !ok {
+		return defaultName
+	}
+
+	values := namingVars{"prefix": config.Naming.Prefix, "region": region, "kind": kind}
+	for k, v := range vars {
+		values[k] = v
+	}
+	name := namePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		key := namePlaceholder.FindStringSubmatch(placeholder)[1]
+		value, ok := values[key]
+		if !ok {
+			fmt.Printf("Unknown placeholder %s in the %s name template\n", placeholder, kind)
+			os.Exit(1)
+		}
+		return value
+	})
+
+	if kind == "storage" {
+		// Storage account names may only contain lower-case letters and digits.
+		name = invalidStorageChars.ReplaceAllString(strings.ToLower(name), "")
+	}
+	return name
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+)
+
+// runCommandAPIVersion is a compute API version with RunCommand, which the SDK's compute API doesn't have.
+const runCommandAPIVersion = "2021-03-01"
+
+// netinfoScript dumps the guest's view of its network: addresses, routes and DNS resolvers. Older images
+// have systemd-resolve or only resolv.conf instead of resolvectl.
+var netinfoScript = []string{
+	"ip addr",
+	"ip route",
+	"resolvectl status 2>/dev/null || systemd-resolve --status 2>/dev/null || cat /etc/resolv.conf",
+}
+
+// runCommandResult is the result of a RunCommand, which the polled operation returns either directly or
+// nested in its properties.
+type runCommandResult struct {
+	Value      []runCommandStatus `json:"value"`
+	Properties struct {
+		Output struct {
+			Value []runCommandStatus `json:"value"`
+		} `json:"output"`
+	} `json:"properties"`
+}
+
+// runCommandStatus is the output of one stream of a RunCommand, e.g. ComponentStatus/StdOut/succeeded.
+type runCommandStatus struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// vmNetinfo prints the NICs of a VM as ARM sees them, then runs netinfoScript in the guest with RunCommand
+// and prints its output, so the two views can be compared.
+func vmNetinfo(args []string) {
+	name := vmName
+	switch len(args) {
+	case 0:
+	case 1:
+		name = args[0]
+	default:
+		fmt.Println("Usage: vm netinfo [name]")
+		os.Exit(1)
+	}
+
+	vm, err := vmClient.Get(groupName, name, "")
+	onErrorFail(err, "Get failed")
+	nics := []network.Interface{}
+	if vm.NetworkProfile != nil && vm.NetworkProfile.NetworkInterfaces != nil {
+		for _, ref := range *vm.NetworkProfile.NetworkInterfaces {
+			nic, err := interfacesClient.Get(groupName, lastSegment(ref.ID), "")
+			onErrorFail(err, "Get failed")
+			nics = append(nics, nic)
+		}
+	}
+	pips, err := listGroupPIPs(groupName)
+	onErrorFail(err, "List failed")
+	fmt.Printf("NICs of VM '%s' in ARM:\n", name)
+	printNICs(nics, publicIPAddresses(pips))
+
+	stepf("Run the network commands in VM '%s', which takes a minute\n", name)
+	var result runCommandResult
+	err = armRequest("POST", resourceID("Microsoft.Compute/virtualMachines", name)+"/runCommand", runCommandAPIVersion, nil,
+		map[string]interface{}{"commandId": "RunShellScript", "script": netinfoScript}, &result)
+	onErrorFail(err, "RunCommand failed")
+
+	statuses := result.Value
+	if len(statuses) == 0 {
+		statuses = result.Properties.Output.Value
+	}
+	fmt.Printf("\nNetwork state inside VM '%s':\n", name)
+	for _, s := range statuses {
+		if strings.Contains(s.Code, "StdErr") && strings.TrimSpace(s.Message) == "" {
+			continue
+		}
+		fmt.Println(strings.TrimSpace(s.Message))
+	}
+}
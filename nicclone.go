@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+)
+
+// nicClone creates a NIC with the configuration of another, e.g. to scale out identical appliance NICs. The
+// clone gets the source's DNS servers, NSG, IP forwarding, accelerated networking, tags and IP configurations,
+// with new dynamic private IPs and without public IPs or backend pools, in the source's subnet or in -subnet.
+func nicClone(args []string) {
+	fs := flag.NewFlagSet("nic clone", flag.ExitOnError)
+	subnet := fs.String("subnet", "", "name of a subnet of the source's VNet, or resource ID of a subnet, to place the clone into")
+	group := fs.String("group", groupName, "resource group to create the clone in")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fmt.Println("Usage: nic clone [-subnet name or ID] [-group name] <source> <dest>")
+		os.Exit(1)
+	}
+	source, dest := fs.Arg(0), fs.Arg(1)
+	nic, err := interfacesClient.Get(groupName, source, "")
+	onErrorFail(err, "Get failed")
+	clone := nicTemplate(nic)
+
+	if *subnet != "" {
+		subnetID := *subnet
+		if !strings.HasPrefix(subnetID, "/") {
+			primary := primaryIPConfiguration(nic)
+			if primary == nil || primary.InterfaceIPConfigurationPropertiesFormat == nil || primary.Subnet == nil {
+				onErrorFail(fmt.Errorf("NIC '%s' has no subnet", source), "Clone failed")
+			}
+			id := *primary.Subnet.ID
+			subnetID = id[:strings.LastIndex(id, "/")+1] + subnetID
+		}
+		target, err := getSubnet(subnetID)
+		onErrorFail(err, "Get subnet failed")
+		for i := range *clone.IPConfigurations {
+			(*clone.IPConfigurations)[i].Subnet = &network.Subnet{ID: target.ID}
+		}
+	}
+
+	fmt.Printf("Clone NIC '%s' to NIC '%s' in resource group '%s'\n", source, dest, *group)
+	url, err := withoutWaiting(func(cancel <-chan struct{}) error {
+		_, err := interfacesClient.CreateOrUpdate(*group, dest, clone, cancel)
+		return err
+	})
+	onErrorFail(err, "CreateOrUpdate failed")
+	if url != "" {
+		id := groupID(groupClient.SubscriptionID, *group).Child("Microsoft.Network/networkInterfaces", dest).String()
+		resourceCreated("nic", interfacesClient.APIVersion, &id, clone)
+		printAccepted("Creation", id, url)
+		return
+	}
+	clone, err = interfacesClient.Get(*group, dest, "")
+	onErrorFail(err, "Get failed")
+	resourceCreated("nic", interfacesClient.APIVersion, clone.ID, clone)
+	printIPConfigurations(clone)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// permissionsAPIVersion is the API version of the caller's permissions at a scope.
+const permissionsAPIVersion = "2015-07-01"
+
+// The actions ARM checks on a subnet and a public IP when a NIC references them. Creating the NIC needs
+// them at the subnet's and the public IP's scope, whichever resource group those are in.
+const (
+	subnetJoinAction   = "Microsoft.Network/virtualNetworks/subnets/join/action"
+	publicIPJoinAction = "Microsoft.Network/publicIPAddresses/join/action"
+)
+
+// nicCreate creates a NIC in -group whose subnet, and public IP with -public-ip, may be in other resource
+// groups, e.g. a NIC of an application's group in a subnet of a central networking group. ARM supports
+// this as long as they are in the NIC's subscription and location and the caller may join them, which is
+// checked first for a clear error rather than ARM's LinkedAuthorizationFailed.
+func nicCreate(args []string) {
+	fs := flag.NewFlagSet("nic create", flag.ExitOnError)
+	group := fs.String("group", groupName, "resource group to create the NIC in")
+	subnet := fs.String("subnet", "", "vnet/subnet of the NIC's resource group, or resource ID of a subnet in any resource group")
+	publicIP := fs.String("public-ip", "", "name of a public IP of the NIC's resource group, or resource ID of one in any resource group")
+	privateIP := fs.String("private-ip", "", "static private IP of the NIC, dynamic when empty")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *subnet == "" {
+		fmt.Println("Usage: nic create -subnet vnet/subnet or ID [-group name] [-public-ip name or ID] [-private-ip address] <name>")
+		os.Exit(1)
+	}
+	name := fs.Arg(0)
+	nicGroup := groupID(groupClient.SubscriptionID, *group)
+
+	subnetID, err := referencedID(nicGroup, "Microsoft.Network/virtualNetworks/subnets", *subnet)
+	onErrorFail(err, "Invalid -subnet")
+	target, err := getSubnet(subnetID.String())
+	onErrorFail(err, "Get subnet failed")
+	var vNet network.VirtualNetwork
+	err = armRequest("GET", subnetID.Parent().String(), vNetClient.APIVersion, nil, nil, &vNet)
+	onErrorFail(err, "Get VNet failed")
+	onErrorFail(checkPermission(subnetID, subnetJoinAction), "Permission check failed")
+	location := stringValue(vNet.Location)
+
+	configuration := network.InterfaceIPConfigurationPropertiesFormat{
+		Subnet:                    &network.Subnet{ID: target.ID},
+		PrivateIPAllocationMethod: network.Dynamic,
+	}
+	if *privateIP != "" {
+		onErrorFail(checkStaticIP(target, *privateIP), "Invalid -private-ip")
+		configuration.PrivateIPAllocationMethod = network.Static
+		configuration.PrivateIPAddress = to.StringPtr(*privateIP)
+	}
+	if *publicIP != "" {
+		pipID, err := referencedID(nicGroup, "Microsoft.Network/publicIPAddresses", *publicIP)
+		onErrorFail(err, "Invalid -public-ip")
+		pip, err := getPublicIP(pipID.String())
+		onErrorFail(err, "Get public IP failed")
+		if !sameLocation(stringValue(pip.Location), location) {
+			onErrorFail(fmt.Errorf("public IP '%s' is in %s, but VNet '%s' and so the NIC are in %s",
+				stringValue(pip.Name), stringValue(pip.Location), stringValue(vNet.Name), location), "Create failed")
+		}
+		if pip.PublicIPAddressPropertiesFormat != nil && pip.IPConfiguration != nil {
+			onErrorFail(fmt.Errorf("public IP '%s' is associated with %s", stringValue(pip.Name), stringValue(pip.IPConfiguration.ID)), "Create failed")
+		}
+		onErrorFail(checkPermission(pipID, publicIPJoinAction), "Permission check failed")
+		configuration.PublicIPAddress = &network.PublicIPAddress{ID: pip.ID}
+	}
+
+	rg, err := groupClient.Get(*group)
+	onErrorFail(err, "Get resource group failed")
+	if !sameLocation(stringValue(rg.Location), location) {
+		// Only the resources must share a location, a resource group's location is where its metadata is kept.
+		fmt.Printf("Note: resource group '%s' is in %s, the NIC is created in its VNet's location %s\n", *group, stringValue(rg.Location), location)
+	}
+
+	nic := network.Interface{
+		Location: to.StringPtr(location),
+		Tags:     resourceTags(),
+		InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+			IPConfigurations: &[]network.InterfaceIPConfiguration{{
+				Name:                                     to.StringPtr("ipconfig1"),
+				InterfaceIPConfigurationPropertiesFormat: &configuration,
+			}},
+		},
+	}
+	fmt.Printf("Create NIC '%s' in resource group '%s' with subnet '%s' of resource group '%s'\n",
+		name, *group, subnetID.NameOf("virtualNetworks")+"/"+subnetID.Name(), subnetID.ResourceGroup)
+	url, err := withoutWaiting(func(cancel <-chan struct{}) error {
+		_, err := interfacesClient.CreateOrUpdate(*group, name, nic, cancel)
+		return err
+	})
+	onErrorFail(err, "CreateOrUpdate failed")
+	if url != "" {
+		id := nicGroup.Child("Microsoft.Network/networkInterfaces", name).String()
+		resourceCreated("nic", interfacesClient.APIVersion, &id, nic)
+		printAccepted("Creation", id, url)
+		return
+	}
+	nic, err = interfacesClient.Get(*group, name, "")
+	onErrorFail(err, "Get failed")
+	resourceCreated("nic", interfacesClient.APIVersion, nic.ID, nic)
+	printIPConfigurations(nic)
+}
+
+// referencedID resolves a resource a NIC of the group refers to, given by resource ID or by name in the
+// NIC's resource group. The resource must be of resourceType and in the NIC's subscription, as ARM doesn't
+// let NICs refer to resources of other subscriptions.
+func referencedID(nicGroup armID, resourceType, nameOrID string) (armID, error) {
+	if !strings.HasPrefix(nameOrID, "/") {
+		return nicGroup.Child(resourceType, nameOrID), nil
+	}
+	r, err := parseID(nameOrID)
+	if err != nil {
+		return r, err
+	}
+	if !strings.EqualFold(r.Type(), resourceType) {
+		return r, fmt.Errorf("'%s' is not the resource ID of a %s", nameOrID, resourceType)
+	}
+	if !strings.EqualFold(r.Subscription, nicGroup.Subscription) {
+		return r, fmt.Errorf("'%s' is in subscription %s, a NIC can only refer to resources of its own subscription %s",
+			nameOrID, r.Subscription, nicGroup.Subscription)
+	}
+	return r, nil
+}
+
+// checkPermission returns an error unless the caller's role assignments at the resource's scope allow action.
+func checkPermission(id armID, action string) error {
+	var result struct {
+		Value []struct {
+			Actions    []string `json:"actions"`
+			NotActions []string `json:"notActions"`
+		} `json:"value"`
+	}
+	err := armRequest("GET", id.String()+"/providers/Microsoft.Authorization/permissions", permissionsAPIVersion, nil, nil, &result)
+	if err != nil {
+		return err
+	}
+	// Each entry is a role granted at or above the scope; one allowing the action is enough.
+	for _, p := range result.Value {
+		if matchesAny(p.Actions, action) && !matchesAny(p.NotActions, action) {
+			return nil
+		}
+	}
+	return fmt.Errorf("no role assignment allows %s on '%s' of resource group '%s', ask for the Network Contributor role there",
+		action, id.Name(), id.ResourceGroup)
+}
+
+// matchesAny reports whether one of the RBAC action patterns, e.g. "Microsoft.Network/*", matches action.
+// Actions are case-insensitive.
+func matchesAny(patterns []string, action string) bool {
+	for _, p := range patterns {
+		re := "(?i)^" + strings.Replace(regexp.QuoteMeta(p), `\*`, ".*", -1) + "$"
+		if ok, _ := regexp.MatchString(re, action); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sameLocation reports whether two locations are the same region, e.g. "West US" and "westus".
+func sameLocation(a, b string) bool {
+	return strings.EqualFold(strings.Replace(a, " ", "", -1), strings.Replace(b, " ", "", -1))
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/arm/compute"
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+)
+
+// nicDelete deletes a NIC of the resource group, detaching it from whatever uses it first, or with -prefix
+// or -tag every matching NIC. Matching NICs are deleted concurrently, except that those attached to a VM are
+// detached one after the other, as their VM can only be updated once at a time.
+func nicDelete(args []string) {
+	fs := flag.NewFlagSet("nic delete", flag.ExitOnError)
+	withVM := fs.Bool("delete-vm", false, "delete the NIC's VM instead of detaching the NIC from it")
+	prefix := fs.String("prefix", "", "delete every NIC whose name starts with this prefix")
+	tags := tagList{}
+	fs.Var(tags, "tag", "key=value tag of the NICs to delete; repeatable, all must match")
+	unattachedOnly := fs.Bool("unattached-only", false, "only delete matching NICs not attached to a VM")
+	fs.Parse(args)
+	bulk := *prefix != "" || len(tags) > 0
+	if bulk == (fs.NArg() == 1) || fs.NArg() > 1 {
+		fmt.Println("Usage: nic delete [-delete-vm] <name>")
+		fmt.Println("       nic delete [-prefix prefix] [-tag key=value]... [-unattached-only] [-delete-vm]")
+		os.Exit(1)
+	}
+	if !bulk {
+		deleteNIC(fs.Arg(0), *withVM)
+		return
+	}
+
+	list, err := listGroupNICs(groupName)
+	onErrorFail(err, "List failed")
+	unattached, attached := []string{}, []string{}
+	if list.Value != nil {
+		for _, nic := range *list.Value {
+			name := stringValue(nic.Name)
+			if !strings.HasPrefix(name, *prefix) || !hasTags(nic.Tags, tags) {
+				continue
+			}
+			switch {
+			case nic.InterfacePropertiesFormat == nil || nic.VirtualMachine == nil:
+				unattached = append(unattached, name)
+			case !*unattachedOnly:
+				attached = append(attached, name)
+			}
+		}
+	}
+	names := append(append([]string{}, unattached...), attached...)
+	if len(names) == 0 {
+		fmt.Println("No NIC matches")
+		return
+	}
+	fmt.Printf("Matching NICs: %s\n", strings.Join(names, ", "))
+	if !confirm(fmt.Sprintf("Delete these %d NICs?", len(names))) {
+		return
+	}
+
+	failures := map[string]error{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, name := range unattached {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			err := removeNIC(name, *withVM)
+			mu.Lock()
+			failures[name] = err
+			mu.Unlock()
+		}(name)
+	}
+	wg.Wait()
+	for _, name := range attached {
+		failures[name] = removeNIC(name, *withVM)
+	}
+
+	deleted := 0
+	for _, name := range names {
+		if err := failures[name]; err != nil {
+			fmt.Printf("Deleting NIC '%s' failed: %s\n", name, err)
+		} else {
+			deleted++
+		}
+	}
+	fmt.Printf("Deleted %d of %d NICs\n", deleted, len(names))
+	if deleted < len(names) {
+		os.Exit(1)
+	}
+}
+
+// hasTags reports whether tags has every key and value of want.
+func hasTags(tags *map[string]*string, want map[string]string) bool {
+	for k, v := range want {
+		if tags == nil || (*tags)[k] == nil || *(*tags)[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// deleteNIC deletes a NIC like removeNIC, failing the sample if that fails.
+func deleteNIC(nicName string, withVM bool) {
+	onErrorFail(removeNIC(nicName, withVM), "Delete NIC failed")
+}
+
+// removeNIC deletes a NIC once nothing references it any more. It leaves the load balancer backend pools,
+// inbound NAT rules and application gateway backend pools the NIC's IP configurations are in, and either
+// detaches the NIC from its VM or, with withVM, deletes the VM. Azure only detaches a NIC that isn't the
+// VM's primary one from a deallocated VM, so the VM is deallocated while it is detached, then started again.
+func removeNIC(nicName string, withVM bool) error {
+	stepf("Delete NIC '%s'\n", nicName)
+	nic, err := interfacesClient.Get(groupName, nicName, "")
+	if err != nil {
+		return err
+	}
+	if nic.InterfacePropertiesFormat != nil && nic.VirtualMachine != nil && nic.VirtualMachine.ID != nil {
+		if withVM {
+			err = deleteVMOf(nic)
+		} else {
+			err = detachFromVM(nic)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// Detaching the NIC from its VM changed it, so the pools are left from a fresh read.
+	_, err = patchNIC(groupName, nicName, func(nic *network.Interface) error {
+		if !leaveBackendPools(nic) {
+			return errNICUnchanged
+		}
+		stepf("\tRemove NIC '%s' from its load balancers and application gateways\n", nicName)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	id := resourceID("Microsoft.Network/networkInterfaces", nicName)
+	unlockFor(id)
+	url, err := withoutWaiting(func(cancel <-chan struct{}) error {
+		_, err := interfacesClient.Delete(groupName, nicName, cancel)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if url != "" {
+		printAccepted("Deletion", id, url)
+	}
+	resourceDeleted("Microsoft.Network/networkInterfaces", nicName)
+	return nil
+}
+
+// deleteVMOf deletes the VM the NIC is attached to.
+func deleteVMOf(nic network.Interface) error {
+	group, name := resourceGroupOf(nic.VirtualMachine.ID), lastSegment(nic.VirtualMachine.ID)
+	stepf("\tFirst, delete VM '%s'\n", name)
+	unlockFor(*nic.VirtualMachine.ID)
+	if _, err := vmClient.Delete(group, name, nil); err != nil {
+		return err
+	}
+	resourceDeleted("Microsoft.Compute/virtualMachines", name)
+	return nil
+}
+
+// detachFromVM removes the NIC from the network profile of its VM, which is deallocated meanwhile. The
+// VM's primary NIC can't be detached.
+func detachFromVM(nic network.Interface) (err error) {
+	group, name := resourceGroupOf(nic.VirtualMachine.ID), lastSegment(nic.VirtualMachine.ID)
+	vm, err := vmClient.Get(group, name, "")
+	if err != nil {
+		return err
+	}
+	kept := []compute.NetworkInterfaceReference{}
+	if vm.VirtualMachineProperties != nil && vm.NetworkProfile != nil && vm.NetworkProfile.NetworkInterfaces != nil {
+		for _, ref := range *vm.NetworkProfile.NetworkInterfaces {
+			if !strings.EqualFold(stringValue(ref.ID), stringValue(nic.ID)) {
+				kept = append(kept, ref)
+				continue
+			}
+			primary := ref.NetworkInterfaceReferenceProperties != nil && ref.Primary != nil && *ref.Primary
+			if primary || nic.Primary != nil && *nic.Primary {
+				return fmt.Errorf("NIC '%s' is the primary NIC of VM '%s', delete the VM along with it instead", stringValue(nic.Name), name)
+			}
+		}
+	}
+	if len(kept) == 0 {
+		return fmt.Errorf("NIC '%s' is the only NIC of VM '%s', delete the VM along with it instead", stringValue(nic.Name), name)
+	}
+
+	stepf("\tFirst, deallocate VM '%s' to detach NIC '%s' from it\n", name, stringValue(nic.Name))
+	if _, err = vmClient.Deallocate(group, name, nil); err != nil {
+		return err
+	}
+	// The VM is started again whether the update succeeds or not.
+	defer func() {
+		stepf("\tStart VM '%s' again\n", name)
+		if _, startErr := vmClient.Start(group, name, nil); startErr != nil {
+			if err != nil {
+				fmt.Printf("Starting VM '%s' again failed: %s\n", name, startErr)
+			} else {
+				err = startErr
+			}
+		}
+	}()
+	stepf("\tDetach NIC '%s' from VM '%s'\n", stringValue(nic.Name), name)
+	vm.NetworkProfile.NetworkInterfaces = &kept
+	// Extensions are child resources, which the VM's update mustn't carry.
+	vm.Resources = nil
+	_, err = vmClient.CreateOrUpdate(group, name, vm, nil)
+	return err
+}
+
+// leaveBackendPools removes the NIC's IP configurations from load balancer backend pools, inbound NAT rules
+// and application gateway backend pools, reporting whether any was in one.
+func leaveBackendPools(nic *network.Interface) bool {
+	if nic.InterfacePropertiesFormat == nil || nic.IPConfigurations == nil {
+		return false
+	}
+	changed := false
+	for i := range *nic.IPConfigurations {
+		p := (*nic.IPConfigurations)[i].InterfaceIPConfigurationPropertiesFormat
+		if p == nil {
+			continue
+		}
+		if p.LoadBalancerBackendAddressPools != nil && len(*p.LoadBalancerBackendAddressPools) > 0 {
+			p.LoadBalancerBackendAddressPools = &[]network.BackendAddressPool{}
+			changed = true
+		}
+		if p.LoadBalancerInboundNatRules != nil && len(*p.LoadBalancerInboundNatRules) > 0 {
+			p.LoadBalancerInboundNatRules = &[]network.InboundNatRule{}
+			changed = true
+		}
+		if p.ApplicationGatewayBackendAddressPools != nil && len(*p.ApplicationGatewayBackendAddressPools) > 0 {
+			p.ApplicationGatewayBackendAddressPools = &[]network.ApplicationGatewayBackendAddressPool{}
+			changed = true
+		}
+	}
+	return changed
+}
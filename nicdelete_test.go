@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// failVMUpdates is a transport answering the updates of VMs with 400 and counting the VMs started, and
+// passing the requests on to the fake.
+type failVMUpdates struct {
+	f      *fakeARM
+	mu     sync.Mutex
+	starts int
+}
+
+func (t *failVMUpdates) RoundTrip(r *http.Request) (*http.Response, error) {
+	if strings.Contains(r.URL.Path, "/virtualMachines/") {
+		switch {
+		case r.Method == http.MethodPut:
+			w := httptest.NewRecorder()
+			fakeError(w, http.StatusBadRequest, "InvalidParameter", "The VM can't be updated")
+			resp := w.Result()
+			resp.Request = r
+			return resp, nil
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/start"):
+			t.mu.Lock()
+			t.starts++
+			t.mu.Unlock()
+		}
+	}
+	return t.f.RoundTrip(r)
+}
+
+// seedVM adds a VM with the NICs of the given names to the fake's resource group, the first being the
+// primary one, and returns its ID.
+func seedVM(f *fakeARM, name string, nics ...string) string {
+	id := resourceID("Microsoft.Compute/virtualMachines", name)
+	refs := []interface{}{}
+	for i, nic := range nics {
+		refs = append(refs, map[string]interface{}{
+			"id":         resourceID("Microsoft.Network/networkInterfaces", nic),
+			"properties": map[string]interface{}{"primary": i == 0},
+		})
+	}
+	f.resources[strings.ToLower(id)] = map[string]interface{}{
+		"id": id, "name": name, "type": "Microsoft.Compute/virtualMachines", "location": westUS,
+		"properties": map[string]interface{}{"networkProfile": map[string]interface{}{"networkInterfaces": refs}},
+	}
+	return id
+}
+
+// TestDetachFromVMStartsVM checks that the VM deallocated to detach a NIC is started again when its
+// update fails.
+func TestDetachFromVMStartsVM(t *testing.T) {
+	f := newTestARM(t)
+	transport := &failVMUpdates{f: f}
+	createClients(offlineSubscriptionID, autorest.NullAuthorizer{}, newSenderWithTransport(transport))
+	vmID := seedVM(f, "vm", "nic-1", "nic-2")
+
+	nic := network.Interface{
+		ID:   to.StringPtr(resourceID("Microsoft.Network/networkInterfaces", "nic-2")),
+		Name: to.StringPtr("nic-2"),
+		InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+			VirtualMachine: &network.SubResource{ID: to.StringPtr(vmID)},
+		},
+	}
+	if err := detachFromVM(nic); err == nil {
+		t.Errorf("detaching with a failing VM update succeeded, want an error")
+	}
+	if transport.starts != 1 {
+		t.Errorf("the VM was started %d times, want once", transport.starts)
+	}
+}
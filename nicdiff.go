@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ignoredNICPaths are the properties nic diff leaves out: those identifying or describing a particular NIC
+// rather than its configuration, which always differ.
+var ignoredNICPaths = regexp.MustCompile(`^(id|name|etag|type)$|(^|\.)(etag|provisioningState|resourceGuid|macAddress)$|^properties\.ipConfigurations\[[^\]]*\]\.id$`)
+
+// nicDiff prints the configuration properties that differ between two NICs of the resource group, or
+// between a NIC and a JSON snapshot of one. It exits with status 1 if any differs, as diff does.
+func nicDiff(args []string) {
+	if len(args) != 2 {
+		fmt.Println("Usage: nic diff <name> <other name or snapshot.json>")
+		os.Exit(1)
+	}
+	before, after := map[string]string{}, map[string]string{}
+	flattenProperties("", nicProperties(args[0]), before)
+	flattenProperties("", nicProperties(args[1]), after)
+	for _, properties := range []map[string]string{before, after} {
+		for p := range properties {
+			if ignoredNICPaths.MatchString(p) {
+				delete(properties, p)
+			}
+		}
+	}
+
+	changes := diffProperties(before, after)
+	if len(changes) == 0 {
+		fmt.Printf("'%s' and '%s' have the same configuration\n", args[0], args[1])
+		return
+	}
+	fmt.Printf("--- %s\n+++ %s\n", args[0], args[1])
+	for _, c := range changes {
+		fmt.Printf("\t%s\n", c)
+	}
+	os.Exit(1)
+}
+
+// nicProperties returns the ARM JSON of the NIC of the resource group named arg, or of the snapshot file arg.
+func nicProperties(arg string) map[string]interface{} {
+	var b []byte
+	if _, err := os.Stat(arg); err == nil || strings.HasSuffix(arg, ".json") {
+		var err error
+		b, err = ioutil.ReadFile(arg)
+		onErrorFail(err, "ReadFile failed")
+	} else {
+		nic, err := interfacesClient.Get(groupName, arg, "")
+		onErrorFail(err, "Get failed")
+		b, err = json.Marshal(nic)
+		onErrorFail(err, "Marshal failed")
+	}
+	properties := map[string]interface{}{}
+	err := json.Unmarshal(b, &properties)
+	onErrorFail(err, fmt.Sprintf("Reading the NIC JSON of '%s' failed", arg))
+	return properties
+}
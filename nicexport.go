@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+)
+
+// nicExport prints the ARM JSON of a NIC, for nic import to restore it or nic diff to compare with it.
+func nicExport(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: nic export <name> > nic.json")
+		os.Exit(1)
+	}
+	nic, err := interfacesClient.Get(groupName, args[0], "")
+	onErrorFail(err, "Get failed")
+	b, err := json.MarshalIndent(nic, "", "  ")
+	onErrorFail(err, "MarshalIndent failed")
+	fmt.Println(string(b))
+}
+
+// nicImport creates or restores a NIC from the JSON written by nic export, in the resource group it was
+// exported from unless -group or -name say otherwise. Properties set by Azure, such as the MAC address and
+// the attached VM, are dropped, so a NIC attached to a VM keeps that attachment.
+func nicImport(args []string) {
+	fs := flag.NewFlagSet("nic import", flag.ExitOnError)
+	name := fs.String("name", "", "name of the NIC to create or restore, the exported one's by default")
+	group := fs.String("group", "", "resource group of the NIC, the exported one's by default")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Println("Usage: nic import [-name name] [-group name] <nic.json>")
+		os.Exit(1)
+	}
+	b, err := ioutil.ReadFile(fs.Arg(0))
+	onErrorFail(err, "ReadFile failed")
+	var nic network.Interface
+	err = json.Unmarshal(b, &nic)
+	onErrorFail(err, "Unmarshal failed")
+
+	if *name == "" {
+		*name = stringValue(nic.Name)
+	}
+	if *group == "" {
+		*group = resourceGroupOf(nic.ID)
+	}
+	if *group == "" {
+		*group = groupName
+	}
+	if *name == "" {
+		onErrorFail(fmt.Errorf("%s has no NIC name, pass -name", fs.Arg(0)), "Import failed")
+	}
+	clearReadOnly(&nic)
+
+	fmt.Printf("Import NIC '%s' into resource group '%s'\n", *name, *group)
+	_, err = interfacesClient.CreateOrUpdate(*group, *name, nic, nil)
+	onErrorFail(err, "CreateOrUpdate failed")
+	nic, err = interfacesClient.Get(*group, *name, "")
+	onErrorFail(err, "Get failed")
+	resourceCreated("nic", interfacesClient.APIVersion, nic.ID, nic)
+	printIPConfigurations(nic)
+}
+
+// clearReadOnly drops the properties of an exported NIC that Azure sets and rejects or ignores in a request.
+func clearReadOnly(nic *network.Interface) {
+	nic.ID, nic.Name, nic.Etag, nic.Type = nil, nil, nil, nil
+	p := nic.InterfacePropertiesFormat
+	if p == nil {
+		return
+	}
+	p.VirtualMachine, p.MacAddress, p.Primary, p.ResourceGUID, p.ProvisioningState = nil, nil, nil, nil, nil
+	if p.DNSSettings != nil {
+		p.DNSSettings.AppliedDNSServers, p.DNSSettings.InternalFqdn, p.DNSSettings.InternalDomainNameSuffix = nil, nil, nil
+	}
+	if p.IPConfigurations != nil {
+		for i := range *p.IPConfigurations {
+			c := &(*p.IPConfigurations)[i]
+			c.ID, c.Etag = nil, nil
+			if c.InterfaceIPConfigurationPropertiesFormat != nil {
+				c.ProvisioningState = nil
+			}
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/arm/compute"
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// nicRename gives a NIC a new name. Azure can't rename resources, so a NIC with the same configuration is
+// created under the new name and takes the old one's place in its VM, and once the old NIC is deleted the new
+// one gets its static private IPs, its public IPs and its backend pools. The VM is deallocated meanwhile, and
+// started again should the rename fail, which then prints the addresses of both NICs.
+func nicRename(args []string) {
+	if len(args) != 2 {
+		fmt.Println("Usage: nic rename <name> <new name>")
+		os.Exit(1)
+	}
+	oldName, newName := args[0], args[1]
+	old, err := interfacesClient.Get(groupName, oldName, "")
+	onErrorFail(err, "Get failed")
+	if existing, err := interfacesClient.Get(groupName, newName, ""); err == nil {
+		onErrorFail(fmt.Errorf("NIC '%s' already exists", *existing.Name), "Rename failed")
+	} else if !isNotFound(existing.Response) {
+		onErrorFail(err, "Get failed")
+	}
+
+	stepf("Create NIC '%s' with the configuration of NIC '%s'\n", newName, oldName)
+	_, err = interfacesClient.CreateOrUpdate(groupName, newName, nicTemplate(old), nil)
+	onErrorFail(err, "CreateOrUpdate failed")
+	renamed, err := interfacesClient.Get(groupName, newName, "")
+	onErrorFail(err, "Get failed")
+	resourceCreated("nic", interfacesClient.APIVersion, renamed.ID, renamed)
+	// Should the rename fail from here on, the addresses may be on either NIC.
+	onFailure(func() { printRenameAddresses(oldName, newName) })
+
+	var vmID *string
+	startedVM := func() {}
+	if old.InterfacePropertiesFormat != nil && old.VirtualMachine != nil {
+		vmID = old.VirtualMachine.ID
+		// The VM is started again however the rename ends.
+		startedVM = onFailure(func() {
+			fmt.Printf("Start VM '%s' again\n", lastSegment(vmID))
+			if _, err := vmClient.Start(resourceGroupOf(vmID), lastSegment(vmID), nil); err != nil {
+				fmt.Printf("Starting VM '%s' again failed: %s\n", lastSegment(vmID), err)
+			}
+		})
+		onErrorFail(swapVMNIC(*vmID, *old.ID, *renamed.ID), "Swapping the NICs of the VM failed")
+	}
+
+	stepf("Delete NIC '%s'\n", oldName)
+	unlockFor(*old.ID)
+	_, err = interfacesClient.Delete(groupName, oldName, nil)
+	onErrorFail(err, "Delete failed")
+	resourceDeleted("Microsoft.Network/networkInterfaces", oldName)
+
+	stepf("Move the addresses, public IPs and backend pools of NIC '%s' to NIC '%s'\n", oldName, newName)
+	withAddresses := inheritAttachments(renamed, old, true)
+	if _, err = interfacesClient.CreateOrUpdate(groupName, newName, withAddresses, nil); err != nil {
+		// Another resource may have taken a freed static address meanwhile.
+		fmt.Printf("Keeping the static private IPs of NIC '%s' failed, its addresses are dynamic: %s\n", oldName, err)
+		_, err = interfacesClient.CreateOrUpdate(groupName, newName, inheritAttachments(renamed, old, false), nil)
+		onErrorFail(err, "CreateOrUpdate failed")
+	}
+
+	if vmID != nil {
+		startedVM()
+		stepf("Start VM '%s' again\n", lastSegment(vmID))
+		_, err = vmClient.Start(resourceGroupOf(vmID), lastSegment(vmID), nil)
+		onErrorFail(err, "Start failed")
+	}
+	renamed, err = interfacesClient.Get(groupName, newName, "")
+	onErrorFail(err, "Get failed")
+	printIPConfigurations(renamed)
+}
+
+// printRenameAddresses prints the IP configurations of the NICs of a failed rename that still exist, to
+// show which one holds the addresses.
+func printRenameAddresses(oldName, newName string) {
+	for _, name := range []string{oldName, newName} {
+		if nic, err := interfacesClient.Get(groupName, name, ""); err == nil {
+			printIPConfigurations(nic)
+		} else if !isNotFound(nic.Response) {
+			fmt.Printf("Getting NIC '%s' failed: %s\n", name, err)
+		}
+	}
+}
+
+// nicTemplate returns a NIC with the configuration of nic: its location, tags, NSG, DNS servers, IP
+// forwarding, accelerated networking and IP configurations, with dynamic private IPs. Public IPs, backend
+// pools and the internal DNS name label are left out, as they can only belong to one NIC at a time.
+func nicTemplate(nic network.Interface) network.Interface {
+	tags := map[string]*string{}
+	if nic.Tags != nil {
+		for k, v := range *nic.Tags {
+			tags[k] = v
+		}
+	}
+	p := &network.InterfacePropertiesFormat{}
+	template := network.Interface{Location: nic.Location, Tags: &tags, InterfacePropertiesFormat: p}
+	if nic.InterfacePropertiesFormat == nil {
+		return template
+	}
+	p.EnableIPForwarding = nic.EnableIPForwarding
+	p.EnableAcceleratedNetworking = nic.EnableAcceleratedNetworking
+	if nic.NetworkSecurityGroup != nil {
+		p.NetworkSecurityGroup = &network.SecurityGroup{ID: nic.NetworkSecurityGroup.ID}
+	}
+	if nic.DNSSettings != nil && nic.DNSSettings.DNSServers != nil {
+		servers := append([]string{}, *nic.DNSSettings.DNSServers...)
+		p.DNSSettings = &network.InterfaceDNSSettings{DNSServers: &servers}
+	}
+	ipConfigs := []network.InterfaceIPConfiguration{}
+	if nic.IPConfigurations != nil {
+		for _, c := range *nic.IPConfigurations {
+			ipConfig := network.InterfaceIPConfiguration{
+				Name: c.Name,
+				InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+					PrivateIPAllocationMethod: network.Dynamic,
+				},
+			}
+			if c.InterfaceIPConfigurationPropertiesFormat != nil {
+				ipConfig.PrivateIPAddressVersion = c.PrivateIPAddressVersion
+				ipConfig.Primary = c.Primary
+				if c.Subnet != nil {
+					ipConfig.Subnet = &network.Subnet{ID: c.Subnet.ID}
+				}
+			}
+			ipConfigs = append(ipConfigs, ipConfig)
+		}
+	}
+	p.IPConfigurations = &ipConfigs
+	return template
+}
+
+// inheritAttachments returns nic given the public IPs, backend pools, inbound NAT rules and internal DNS
+// name label of old, and with withAddresses its static private IPs, matching IP configurations by name.
+func inheritAttachments(nic, old network.Interface, withAddresses bool) network.Interface {
+	if old.InterfacePropertiesFormat == nil || nic.InterfacePropertiesFormat == nil {
+		return nic
+	}
+	if old.DNSSettings != nil && old.DNSSettings.InternalDNSNameLabel != nil {
+		if nic.DNSSettings == nil {
+			nic.DNSSettings = &network.InterfaceDNSSettings{}
+		}
+		nic.DNSSettings.InternalDNSNameLabel = old.DNSSettings.InternalDNSNameLabel
+	}
+	if old.IPConfigurations == nil || nic.IPConfigurations == nil {
+		return nic
+	}
+	ipConfigs := append([]network.InterfaceIPConfiguration{}, *nic.IPConfigurations...)
+	for i, c := range ipConfigs {
+		if c.InterfaceIPConfigurationPropertiesFormat == nil {
+			continue
+		}
+		properties := *c.InterfaceIPConfigurationPropertiesFormat
+		for _, o := range *old.IPConfigurations {
+			p := o.InterfaceIPConfigurationPropertiesFormat
+			if p == nil || !strings.EqualFold(stringValue(o.Name), stringValue(c.Name)) {
+				continue
+			}
+			if withAddresses && p.PrivateIPAllocationMethod == network.Static {
+				properties.PrivateIPAllocationMethod = network.Static
+				properties.PrivateIPAddress = p.PrivateIPAddress
+			}
+			if p.PublicIPAddress != nil {
+				properties.PublicIPAddress = &network.PublicIPAddress{ID: p.PublicIPAddress.ID}
+			}
+			properties.LoadBalancerBackendAddressPools = p.LoadBalancerBackendAddressPools
+			properties.LoadBalancerInboundNatRules = p.LoadBalancerInboundNatRules
+			properties.ApplicationGatewayBackendAddressPools = p.ApplicationGatewayBackendAddressPools
+		}
+		ipConfigs[i].InterfaceIPConfigurationPropertiesFormat = &properties
+	}
+	properties := *nic.InterfacePropertiesFormat
+	properties.IPConfigurations = &ipConfigs
+	nic.InterfacePropertiesFormat = &properties
+	return nic
+}
+
+// swapVMNIC deallocates the VM vmID and replaces its NIC oldID with newID, keeping whether it is the primary one.
+func swapVMNIC(vmID, oldID, newID string) error {
+	group, name := resourceGroupOf(&vmID), lastSegment(&vmID)
+	vm, err := vmClient.Get(group, name, "")
+	if err != nil {
+		return err
+	}
+	if vm.VirtualMachineProperties == nil || vm.NetworkProfile == nil || vm.NetworkProfile.NetworkInterfaces == nil {
+		return fmt.Errorf("VM '%s' has no network profile", name)
+	}
+	refs := []compute.NetworkInterfaceReference{}
+	for _, ref := range *vm.NetworkProfile.NetworkInterfaces {
+		if strings.EqualFold(stringValue(ref.ID), oldID) {
+			ref.ID = to.StringPtr(newID)
+		}
+		refs = append(refs, ref)
+	}
+
+	stepf("Deallocate VM '%s' to swap its NICs\n", name)
+	if _, err = vmClient.Deallocate(group, name, nil); err != nil {
+		return err
+	}
+	stepf("Attach NIC '%s' to VM '%s' in place of NIC '%s'\n", lastSegment(&newID), name, lastSegment(&oldID))
+	vm.NetworkProfile.NetworkInterfaces = &refs
+	// Extensions are child resources, which the VM's update mustn't carry.
+	vm.Resources = nil
+	_, err = vmClient.CreateOrUpdate(group, name, vm, nil)
+	return err
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// TestRenameFailureStartsVM renames a NIC of a VM whose update fails, in a child process as the failure
+// exits, and checks that the VM is started again and the addresses of the NICs are printed.
+func TestRenameFailureStartsVM(t *testing.T) {
+	if os.Getenv("TEST_RENAME_FAILURE") != "" {
+		runFailingRename(t)
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRenameFailureStartsVM$")
+	cmd.Env = append(os.Environ(), "TEST_RENAME_FAILURE=1")
+	out, err := cmd.CombinedOutput()
+	if _, ok := err.(*exec.ExitError); !ok {
+		t.Fatalf("the failing rename exited with %v, want a failure:\n%s", err, out)
+	}
+	for _, want := range []string{"Swapping the NICs of the VM failed", "Start VM 'vm' again", "NIC 'nic-2'", "NIC 'renamed'"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("the output of the failing rename has no %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(string(out), "Starting VM 'vm' again failed") {
+		t.Errorf("starting the VM again failed:\n%s", out)
+	}
+}
+
+// runFailingRename is the child process of TestRenameFailureStartsVM.
+func runFailingRename(t *testing.T) {
+	f := newTestARM(t)
+	createClients(offlineSubscriptionID, autorest.NullAuthorizer{}, newSenderWithTransport(&failVMUpdates{f: f}))
+	createTestGroup(t)
+	if _, err := vNetClient.CreateOrUpdate(groupName, "vnet", testVNet(), nil); err != nil {
+		t.Fatalf("creating the VNet: %v", err)
+	}
+	for _, name := range []string{"nic-1", "nic-2"} {
+		if _, err := interfacesClient.CreateOrUpdate(groupName, name, testNIC(), nil); err != nil {
+			t.Fatalf("creating %s: %v", name, err)
+		}
+	}
+	vmID := seedVM(f, "vm", "nic-1", "nic-2")
+	nic := f.resources[strings.ToLower(resourceID("Microsoft.Network/networkInterfaces", "nic-2"))]
+	nic["properties"].(map[string]interface{})["virtualMachine"] = map[string]interface{}{"id": vmID}
+
+	runningCommand = true
+	nicRename([]string{"nic-2", "renamed"})
+	t.Fatalf("renaming with a failing VM update didn't fail")
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+)
+
+// nicList lists the NICs of the resource group, with -all-groups of the whole subscription grouped by
+// resource group, or with -scale-set those of a VM scale set's instances, as a table, or as CSV with one
+// row per IP configuration. Scale set NICs belong to the scale set rather than to the resource group, so
+// they are only listed with -scale-set. With -all-groups or a filter, a single Resource Graph query
+// finds the NICs, however many resource groups the subscription has.
+func nicList(args []string) {
+	fs := flag.NewFlagSet("nic list", flag.ExitOnError)
+	output := fs.String("output", "table", "output format: table or csv")
+	file := fs.String("file", "", "write the output to this file instead of stdout")
+	allGroups := fs.Bool("all-groups", false, "list the NICs of every resource group of the subscription")
+	scaleSet := fs.String("scale-set", "", "list the NICs of the instances of this VM scale set of the resource group")
+	instance := fs.String("instance", "", "with -scale-set, list only the NICs of the instance with this ID")
+	unattached := fs.Bool("unattached", false, "only list NICs attached to neither a VM nor a private endpoint")
+	ip := fs.String("ip", "", "only list the NIC with this private IP or holding the public IP with this address")
+	tags := tagList{}
+	fs.Var(tags, "tag", "only list NICs with this key=value tag; repeatable")
+	fs.BoolVar(wide, "wide", *wide, "show extra columns in the table")
+	fs.Parse(args)
+	filtered := *unattached || *ip != "" || len(tags) > 0
+
+	var nics []network.Interface
+	var pips network.PublicIPAddressListResult
+	switch {
+	case *instance != "" && *scaleSet == "", *allGroups && *scaleSet != "", filtered && *scaleSet != "":
+		fmt.Println("Usage: nic list [-all-groups] [-unattached] [-ip address] [-tag key=value]... [-output table|csv] [-file path] [-wide]")
+		fmt.Println("       nic list -scale-set name [-instance id] [-output table|csv] [-file path] [-wide]")
+		os.Exit(1)
+	case *scaleSet != "":
+		list, err := listScaleSetNICs(groupName, *scaleSet, *instance)
+		onErrorFail(err, "Listing the scale set's NICs failed")
+		pips, err = listGroupPIPs(groupName)
+		onErrorFail(err, "List failed")
+		nics = *list.Value
+	case *allGroups || filtered:
+		filter := nicFilter{unattached: *unattached, ip: *ip, tags: tags}
+		if !*allGroups {
+			filter.group = groupName
+		}
+		list, err := graphNICs(filter)
+		onErrorFail(err, "Querying Resource Graph failed")
+		pips, err = graphPIPs(filter.group)
+		onErrorFail(err, "Querying Resource Graph failed")
+		nics = *list.Value
+	default:
+		nics, pips = inventoryNICs()
+	}
+
+	var out io.Writer = os.Stdout
+	if *file != "" {
+		f, err := os.Create(*file)
+		onErrorFail(err, "Create failed")
+		defer f.Close()
+		out = f
+	}
+
+	switch *output {
+	case "table":
+		if out != os.Stdout {
+			fmt.Println("-file is only supported with -output csv")
+			os.Exit(1)
+		}
+		if *allGroups {
+			printNICsByGroup(nics, publicIPAddresses(pips))
+		} else {
+			printNICs(nics, publicIPAddresses(pips))
+		}
+	case "csv":
+		writeNICsCSV(out, nics, publicIPAddresses(pips))
+	default:
+		fmt.Printf("Unknown output format '%s'\n", *output)
+		os.Exit(1)
+	}
+}
+
+// writeNICsCSV writes one CSV row per IP configuration of each NIC. addresses maps the
+// lower-cased IDs of public IPs to their address.
+func writeNICsCSV(out io.Writer, nics []network.Interface, addresses map[string]string) {
+	w := csv.NewWriter(out)
+	w.Write([]string{
+		"nic", "nicId", "location", "macAddress", "ipForwarding", "virtualMachine", "provisioningState",
+		"ipConfiguration", "primary", "privateIPAddress", "privateIPAllocationMethod", "subnetId",
+		"publicIPAddressId", "publicIPAddress",
+	})
+	for _, nic := range nics {
+		if nic.InterfacePropertiesFormat == nil || nic.IPConfigurations == nil {
+			continue
+		}
+		forwarding := nic.EnableIPForwarding != nil && *nic.EnableIPForwarding
+		vm := ""
+		if nic.VirtualMachine != nil {
+			vm = stringValue(nic.VirtualMachine.ID)
+		}
+		for _, ipConfig := range *nic.IPConfigurations {
+			row := []string{
+				stringValue(nic.Name), stringValue(nic.ID), stringValue(nic.Location), stringValue(nic.MacAddress),
+				fmt.Sprint(forwarding), vm, stringValue(nic.ProvisioningState), stringValue(ipConfig.Name),
+			}
+			if p := ipConfig.InterfaceIPConfigurationPropertiesFormat; p != nil {
+				subnetID, pipID := "", ""
+				if p.Subnet != nil {
+					subnetID = stringValue(p.Subnet.ID)
+				}
+				if p.PublicIPAddress != nil {
+					pipID = stringValue(p.PublicIPAddress.ID)
+				}
+				row = append(row,
+					fmt.Sprint(p.Primary != nil && *p.Primary), stringValue(p.PrivateIPAddress),
+					string(p.PrivateIPAllocationMethod), subnetID, pipID, addresses[strings.ToLower(pipID)])
+			}
+			w.Write(row)
+		}
+	}
+	w.Flush()
+	onErrorFail(w.Error(), "Writing CSV failed")
+}
+
+// printNICsByGroup prints a table of NICs per resource group, in the order of the groups' names, each
+// headed by how many of its NICs are attached to a VM.
+func printNICsByGroup(nics []network.Interface, addresses map[string]string) {
+	byGroup := map[string][]network.Interface{}
+	names := map[string]string{}
+	for _, nic := range nics {
+		group := resourceGroupOf(nic.ID)
+		byGroup[strings.ToLower(group)] = append(byGroup[strings.ToLower(group)], nic)
+		names[strings.ToLower(group)] = group
+	}
+	keys := []string{}
+	for k := range byGroup {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if len(keys) == 0 {
+		fmt.Println("There are no NICs in the subscription")
+	}
+	for i, k := range keys {
+		attached := 0
+		for _, nic := range byGroup[k] {
+			if nic.InterfacePropertiesFormat != nil && nic.VirtualMachine != nil {
+				attached++
+			}
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("Resource group '%s': %d NICs, %d attached, %d unattached\n", names[k], len(byGroup[k]), attached, len(byGroup[k])-attached)
+		printNICs(byGroup[k], addresses)
+	}
+}
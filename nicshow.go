@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+)
+
+// nicShow prints a NIC of the resource group by name, or any NIC the credentials can read by resource ID,
+// e.g. one copied from another tool's output, in whichever subscription and resource group it is.
+func nicShow(args []string) {
+	fs := flag.NewFlagSet("nic show", flag.ExitOnError)
+	id := fs.String("id", "", "resource ID of the NIC, instead of its name")
+	asJSON := fs.Bool("json", false, "print the NIC's ARM JSON instead of a summary")
+	fs.Parse(args)
+	if (*id == "") == (fs.NArg() != 1) || fs.NArg() > 1 {
+		fmt.Println("Usage: nic show <name> | nic show -id /subscriptions/.../networkInterfaces/<name>")
+		os.Exit(1)
+	}
+
+	var nic network.Interface
+	var err error
+	if *id != "" {
+		nic, err = getNICByID(*id)
+	} else {
+		nic, err = interfacesClient.Get(groupName, fs.Arg(0), "")
+	}
+	onErrorFail(err, "Get failed")
+	if *asJSON {
+		b, err := json.MarshalIndent(nic, "", "  ")
+		onErrorFail(err, "MarshalIndent failed")
+		fmt.Println(string(b))
+		return
+	}
+	fmt.Printf("Resource group '%s', location %s\n", resourceGroupOf(nic.ID), stringValue(nic.Location))
+	printIPConfigurations(nic)
+}
+
+// getNICByID reads a NIC by resource ID, with a client of the ID's subscription. The NICs of VM scale set
+// instances have IDs of the form .../virtualMachineScaleSets/{set}/virtualMachines/{instance}/networkInterfaces/{nic}.
+func getNICByID(id string) (network.Interface, error) {
+	r, err := parseID(id)
+	if err != nil {
+		return network.Interface{}, err
+	}
+	client := interfacesClient
+	client.SubscriptionID = r.Subscription
+	switch strings.ToLower(r.Type()) {
+	case "microsoft.network/networkinterfaces":
+		return client.Get(r.ResourceGroup, r.Name(), "")
+	case "microsoft.compute/virtualmachinescalesets/virtualmachines/networkinterfaces":
+		return client.GetVirtualMachineScaleSetNetworkInterface(r.ResourceGroup, r.Names[0], r.Names[1], r.Name(), "")
+	}
+	return network.Interface{}, fmt.Errorf("'%s' is not the resource ID of a NIC", id)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// deploymentOutcome is the result of a deployment, sent to the configured notification targets when it ends.
+type deploymentOutcome struct {
+	Succeeded     bool              `json:"succeeded"`
+	ResourceGroup string            `json:"resourceGroup"`
+	Started       string            `json:"started"`
+	Duration      string            `json:"duration"`
+	ResourceIDs   []string          `json:"resourceIds"`
+	Resources     []outcomeResource `json:"resources"`
+	Error         string            `json:"error,omitempty"`
+}
+
+// outcomeResource is a resource created by the deployment, and how long it took to create.
+type outcomeResource struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	ID       string `json:"id"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// eventGridEvent is an event in the Event Grid schema.
+type eventGridEvent struct {
+	ID          string            `json:"id"`
+	EventType   string            `json:"eventType"`
+	Subject     string            `json:"subject"`
+	EventTime   string            `json:"eventTime"`
+	Data        deploymentOutcome `json:"data"`
+	DataVersion string            `json:"dataVersion"`
+}
+
+// deploying is set while the sample deploys its topology, until the outcome has been notified.
+var deploying bool
+
+// notifyDeployment reports the outcome of the deployment, with err nil on success. Failing to
+// notify is only a warning, the deployment itself is unaffected.
+func notifyDeployment(err error) {
+	if !deploying {
+		return
+	}
+	deploying = false
+
+	outcome := deploymentOutcome{
+		Succeeded:     err == nil,
+		ResourceGroup: groupName,
+		Started:       runStarted.UTC().Format(time.RFC3339),
+		Duration:      (time.Since(runStarted) / time.Second * time.Second).String(),
+		ResourceIDs:   []string{},
+		Resources:     []outcomeResource{},
+	}
+	for _, r := range runState.Resources {
+		outcome.ResourceIDs = append(outcome.ResourceIDs, r.ID)
+		outcome.Resources = append(outcome.Resources, outcomeResource{Type: r.Type, Name: r.Name, ID: r.ID, Duration: r.Duration})
+	}
+	if err != nil {
+		outcome.Error = err.Error()
+	}
+
+	if config.EventGrid != nil {
+		stepf("Publish deployment event to Event Grid\n")
+		if err := publishEvent(*config.EventGrid, outcome); err != nil {
+			fmt.Printf("\tPublishing the event failed: %s\n", err)
+		}
+	}
+	if *notifyURL != "" {
+		stepf("Post deployment outcome to '%s'\n", *notifyURL)
+		if err := postOutcome(*notifyURL, outcome); err != nil {
+			fmt.Printf("\tPosting the outcome failed: %s\n", err)
+		}
+	}
+	if *chatWebhook != "" {
+		stepf("Post deployment summary to the chat webhook\n")
+		if err := postChatMessage(*chatWebhook, outcome); err != nil {
+			fmt.Printf("\tPosting the summary failed: %s\n", err)
+		}
+	}
+}
+
+// postOutcome posts the outcome of a deployment as JSON to the endpoint given with -notify-url.
+func postOutcome(url string, outcome deploymentOutcome) error {
+	body, err := json.Marshal(outcome)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return postNotification(req)
+}
+
+// publishEvent publishes the outcome of a deployment to an Event Grid custom topic.
+func publishEvent(topic eventGridTopic, outcome deploymentOutcome) error {
+	eventType := "NetworkInterfaceSample.DeploymentSucceeded"
+	if !outcome.Succeeded {
+		eventType = "NetworkInterfaceSample.DeploymentFailed"
+	}
+	now := time.Now().UTC()
+	body, err := json.Marshal([]eventGridEvent{{
+		ID:          fmt.Sprintf("%s-%d", groupName, now.UnixNano()),
+		EventType:   eventType,
+		Subject:     "resourceGroups/" + groupName,
+		EventTime:   now.Format(time.RFC3339Nano),
+		Data:        outcome,
+		DataVersion: "1.0",
+	}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, topic.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("aeg-sas-key", topic.Key)
+	return postNotification(req)
+}
+
+// postNotification sends a notification request, failing on any status but 2xx.
+func postNotification(req *http.Request) error {
+	client := &http.Client{Transport: newTransport(), Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s responded %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// noWaitOperation is an operation started with -no-wait, which is no longer waited for once ARM has
+// accepted it.
+type noWaitOperation struct {
+	cancel chan struct{}
+	url    string
+}
+
+// noWaitOperations are the operations running with -no-wait by their cancel channel, which their
+// requests carry.
+var (
+	noWaitMu         sync.Mutex
+	noWaitOperations = map[<-chan struct{}]*noWaitOperation{}
+)
+
+// withoutWaiting runs op, a create or delete of an SDK client passed the cancel channel of its polling.
+// With -no-wait, it returns as soon as ARM has accepted the operation, with the URL to poll for its
+// status, rather than waiting for it to complete. It returns an empty URL if the operation completed
+// right away or -no-wait isn't set.
+func withoutWaiting(op func(cancel <-chan struct{}) error) (string, error) {
+	if !*noWait {
+		return "", op(nil)
+	}
+	o := &noWaitOperation{cancel: make(chan struct{})}
+	noWaitMu.Lock()
+	noWaitOperations[o.cancel] = o
+	noWaitMu.Unlock()
+	defer func() {
+		noWaitMu.Lock()
+		delete(noWaitOperations, o.cancel)
+		noWaitMu.Unlock()
+	}()
+
+	err := op(o.cancel)
+	noWaitMu.Lock()
+	defer noWaitMu.Unlock()
+	if o.url != "" {
+		// Closing the channel cancelled the polling, which is what ended op.
+		return o.url, nil
+	}
+	return "", err
+}
+
+// withNoWait decorates a sender to stop the polling of operations run by withoutWaiting once ARM answers
+// that it accepted them, recording the URL the polling would have used. The response is read before the
+// polling is cancelled, so that the SDK still gets it whole.
+func withNoWait(s autorest.Sender) autorest.Sender {
+	return autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+		resp, err := s.Do(r)
+		if err != nil || r.Cancel == nil {
+			return resp, err
+		}
+		noWaitMu.Lock()
+		defer noWaitMu.Unlock()
+		o := noWaitOperations[r.Cancel]
+		if o == nil || o.url != "" {
+			return resp, err
+		}
+		url := resp.Header.Get("Azure-AsyncOperation")
+		if url == "" && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusAccepted {
+			return resp, err
+		}
+		if url == "" {
+			url = resp.Header.Get("Location")
+		}
+		if url == "" {
+			url = r.URL.String()
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return resp, err
+		}
+		o.url = url
+		close(o.cancel)
+		return resp, nil
+	})
+}
+
+// printAccepted prints a resource whose operation ARM accepted with -no-wait, and where to follow it.
+func printAccepted(operation, id, url string) {
+	fmt.Printf("%s of %s accepted, not waiting for it to complete\n\tStatus: %s\n", operation, id, url)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// Levels at which -nsg associates network security groups.
+const (
+	nsgLevelSubnet = "subnet"
+	nsgLevelNIC    = "nic"
+	nsgLevelBoth   = "both"
+)
+
+// validateNSGLevel exits unless -nsg is empty or one of the NSG levels.
+func validateNSGLevel() {
+	switch *nsgLevel {
+	case "", nsgLevelSubnet, nsgLevelNIC, nsgLevelBoth:
+	default:
+		fmt.Printf("Unknown -nsg '%s', use subnet, nic or both\n", *nsgLevel)
+		os.Exit(1)
+	}
+}
+
+// subnetNSG creates the NSG of a subnet when its layout or -nsg associates NSGs with subnets, or returns nil.
+// The NSG admits the subnet's AllowInbound ports from the Internet on top of the default rules; by default
+// those are SSH and HTTP for the front-end subnet and none for the other tiers.
+func subnetNSG(location string, s subnetLayout) *network.SecurityGroup {
+	name, rules, ok := subnetNSGRules(location, s)
+	if !ok {
+		return nil
+	}
+	nsg := createNSG(location, name, rules)
+	return &nsg
+}
+
+// subnetNSGRules returns the name and rules of the NSG of a subnet, and whether the subnet gets one.
+func subnetNSGRules(location string, s subnetLayout) (string, []network.SecurityRule, bool) {
+	if !s.NSG && *nsgLevel != nsgLevelSubnet && *nsgLevel != nsgLevelBoth {
+		return "", nil, false
+	}
+	rules := []network.SecurityRule{}
+	for i, port := range s.AllowInbound {
+		if *jit && port == "22" {
+			// JIT opens SSH on request only.
+			continue
+		}
+		rules = append(rules, allowInternetRule("allow-"+port, port, int32(100+10*i)))
+	}
+	return resourceName("nsg", s.Name+"-nsg", location, namingVars{"tier": s.Tier}), rules, true
+}
+
+// nicNSG creates the NSG of the front-end NIC when -nsg associates NSGs with NICs, or returns nil.
+// It admits only SSH from the Internet, so with -nsg both HTTP is allowed by the subnet but dropped by the NIC.
+func nicNSG(location, nicName string) *network.SecurityGroup {
+	name, rules, ok := nicNSGRules(location, nicName)
+	if !ok {
+		return nil
+	}
+	nsg := createNSG(location, name, rules)
+	return &nsg
+}
+
+// nicNSGRules returns the name and rules of the NSG of the front-end NIC, and whether -nsg gives it one.
+func nicNSGRules(location, nicName string) (string, []network.SecurityRule, bool) {
+	if *nsgLevel != nsgLevelNIC && *nsgLevel != nsgLevelBoth {
+		return "", nil, false
+	}
+	rules := []network.SecurityRule{}
+	if !*jit {
+		rules = append(rules, allowInternetRule("allow-22", "22", 100))
+	}
+	return resourceName("nsg", nicName+"-nsg", location, namingVars{"tier": layout[0].Tier}), rules, true
+}
+
+// allowInternetRule is an inbound rule allowing TCP traffic from the Internet to a port.
+func allowInternetRule(name, port string, priority int32) network.SecurityRule {
+	return network.SecurityRule{
+		Name: to.StringPtr(name),
+		SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+			Protocol:                 network.TCP,
+			SourcePortRange:          to.StringPtr("*"),
+			DestinationPortRange:     to.StringPtr(port),
+			SourceAddressPrefix:      to.StringPtr("Internet"),
+			DestinationAddressPrefix: to.StringPtr("*"),
+			Access:                   network.Allow,
+			Priority:                 to.Int32Ptr(priority),
+			Direction:                network.Inbound,
+		},
+	}
+}
+
+// createNSG creates a network security group with the given rules on top of the default ones.
+func createNSG(location, name string, rules []network.SecurityRule) network.SecurityGroup {
+	stepf("\tCreate network security group '%s'\n", name)
+	nsg := network.SecurityGroup{
+		Location: to.StringPtr(location),
+		Tags:     resourceTags(),
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+			SecurityRules: &rules,
+		},
+	}
+	_, err := nsgClient.CreateOrUpdate(groupName, name, nsg, nil)
+	onErrorFail(err, "\tCreateOrUpdate failed")
+
+	nsg, err = nsgClient.Get(groupName, name, "")
+	onErrorFail(err, "\tGet failed")
+	recordCreated("nsg", nsgClient.APIVersion, nsg.ID, nsg)
+	return nsg
+}
+
+// nicEffectiveNSG prints the security rules applying to a NIC, grouped by the subnet and NIC NSGs they come from.
+func nicEffectiveNSG(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: nic effective-nsg <name>")
+		os.Exit(1)
+	}
+	nic, err := interfacesClient.Get(groupName, args[0], "")
+	onErrorFail(err, "Get failed")
+
+	// The SDK's ListEffectiveNetworkSecurityGroups drops the result of the long-running operation.
+	var result network.EffectiveNetworkSecurityGroupListResult
+	err = armRequest("POST", *nic.ID+"/effectiveNetworkSecurityGroups", interfacesClient.APIVersion, nil, nil, &result)
+	onErrorFail(err, "Listing the effective network security groups failed")
+	if result.Value == nil || len(*result.Value) == 0 {
+		fmt.Printf("No network security group applies to NIC '%s', all traffic is allowed\n", args[0])
+		return
+	}
+
+	for _, group := range *result.Value {
+		level, scope := "NIC", args[0]
+		if group.Association != nil && group.Association.Subnet != nil {
+			level, scope = "Subnet", lastSegment(group.Association.Subnet.ID)
+		}
+		fmt.Printf("\n%s '%s', NSG '%s':\n", level, scope, lastSegment(group.NetworkSecurityGroup.ID))
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "DIRECTION\tPRIORITY\tNAME\tACCESS\tPROTOCOL\tSOURCE\tDESTINATION\tPORTS")
+		if group.EffectiveSecurityRules != nil {
+			for _, r := range *group.EffectiveSecurityRules {
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Direction, to.Int32(r.Priority), to.String(r.Name),
+					r.Access, r.Protocol, to.String(r.SourceAddressPrefix), to.String(r.DestinationAddressPrefix),
+					to.String(r.DestinationPortRange))
+			}
+		}
+		w.Flush()
+	}
+	if len(*result.Value) > 1 {
+		fmt.Println("\nInbound traffic is evaluated against the subnet's NSG and then the NIC's, outbound traffic in the")
+		fmt.Println("reverse order; traffic passes only if both NSGs allow it.")
+	}
+}
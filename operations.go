@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+// stateOperation is a long-running operation ARM had accepted but not completed when the state file was
+// last written, e.g. because the run was killed or didn't wait for it with -no-wait.
+type stateOperation struct {
+	Method     string `json:"method"`
+	ResourceID string `json:"resourceId"`
+
+	// StatusURL is polled for the status, an Azure-AsyncOperation URL if Async is set, else a Location one.
+	StatusURL string `json:"statusUrl"`
+	Async     bool   `json:"async,omitempty"`
+	Started   string `json:"started"`
+}
+
+// withOperationTracking decorates a sender to record the long-running operations ARM accepts in the state
+// file until their polling sees them complete, so that a later run can resume polling them should this
+// one die. The body of a polling response is read and put back.
+func withOperationTracking(s autorest.Sender) autorest.Sender {
+	return autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+		resp, err := s.Do(r)
+		if err != nil || strings.Contains(r.URL.Path, "/oauth2/") {
+			return resp, err
+		}
+		if r.Method != http.MethodGet {
+			op := stateOperation{Method: r.Method, ResourceID: r.URL.Path, Started: time.Now().UTC().Format(time.RFC3339)}
+			if op.StatusURL = resp.Header.Get("Azure-AsyncOperation"); op.StatusURL != "" {
+				op.Async = true
+			} else if resp.StatusCode == http.StatusAccepted {
+				op.StatusURL = resp.Header.Get("Location")
+			}
+			if op.StatusURL != "" && resp.StatusCode < 300 {
+				updateOperations(func(ops []stateOperation) []stateOperation { return append(ops, op) })
+			}
+			return resp, err
+		}
+
+		body, readErr := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if readErr != nil {
+			return resp, err
+		}
+		updateOperations(func(ops []stateOperation) []stateOperation {
+			kept := []stateOperation{}
+			for _, op := range ops {
+				if !strings.EqualFold(op.StatusURL, r.URL.String()) || !operationDone(op, resp.StatusCode, body) {
+					kept = append(kept, op)
+				}
+			}
+			if len(kept) == len(ops) {
+				return nil
+			}
+			return kept
+		})
+		return resp, err
+	})
+}
+
+// operationDone reports whether a polling response says the operation is no longer running.
+func operationDone(op stateOperation, status int, body []byte) bool {
+	if !op.Async {
+		return status != http.StatusAccepted
+	}
+	var result struct {
+		Status string `json:"status"`
+	}
+	json.Unmarshal(body, &result)
+	return status >= 300 || result.Status == "Succeeded" || result.Status == "Failed" || result.Status == "Canceled"
+}
+
+// updateOperations replaces the in-flight operations of the state of the current run or, when a command
+// runs, of the state file written by the last run, if there is one, with what update returns from them.
+// The state file is left alone when update returns nil.
+func updateOperations(update func([]stateOperation) []stateOperation) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	if runningCommand {
+		if _, err := os.Stat(*statePath); err != nil {
+			return
+		}
+		runState = loadState()
+	}
+	if ops := update(runState.Operations); ops != nil {
+		runState.Operations = ops
+		writeState()
+	}
+}
+
+// resumeOperations polls the operations the state file records as in flight until they complete, so that
+// the run doesn't send its PUTs while ARM is still processing an earlier one. Each is removed from the
+// state file once done.
+func resumeOperations() {
+	if _, err := os.Stat(*statePath); err != nil {
+		return
+	}
+	state := loadState()
+	for len(state.Operations) > 0 {
+		op := state.Operations[0]
+		stepf("Resume polling %s %s, started %s\n", op.Method, op.ResourceID, op.Started)
+		if err := pollOperation(op); err != nil {
+			fmt.Printf("\t%s\n", err)
+		} else {
+			stepf("\tCompleted\n")
+		}
+		state.Operations = state.Operations[1:]
+		b, err := json.MarshalIndent(state, "", "  ")
+		onErrorFail(err, "MarshalIndent failed")
+		onErrorFail(ioutil.WriteFile(*statePath, b, 0644), "WriteFile failed")
+	}
+}
+
+// pollOperation polls an operation until it completes, as the SDK would have, and returns its error.
+func pollOperation(op stateOperation) error {
+	req, err := autorest.Prepare(&http.Request{}, autorest.WithMethod(op.Method), autorest.WithBaseURL(genericClient.BaseURI),
+		autorest.WithPath(op.ResourceID))
+	if err != nil {
+		return err
+	}
+	// The operation's first response is replayed to the poller, which takes it from there.
+	header := http.Header{}
+	if op.Async {
+		header.Set("Azure-AsyncOperation", op.StatusURL)
+	} else {
+		header.Set("Location", op.StatusURL)
+	}
+	accepted := &http.Response{
+		StatusCode: http.StatusAccepted,
+		Status:     "202 Accepted",
+		Header:     header,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}
+	replayed := false
+	replay := autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+		if !replayed {
+			replayed = true
+			return accepted, nil
+		}
+		return genericClient.Do(r)
+	})
+	resp, err := azure.DoPollForAsynchronous(genericClient.PollingDelay)(replay).Do(req)
+	if err != nil {
+		return err
+	}
+	return autorest.Respond(resp, azure.WithErrorUnlessStatusCode(http.StatusOK, http.StatusCreated, http.StatusNoContent), autorest.ByClosing())
+}
+
+// resume waits for the long-running operations recorded in the state file, e.g. those a killed run left
+// in flight, and removes them from it.
+func resume(args []string) {
+	fs := flag.NewFlagSet("resume", flag.ExitOnError)
+	fs.Parse(args)
+	if _, err := os.Stat(*statePath); err != nil || len(loadState().Operations) == 0 {
+		fmt.Printf("No operations in flight in '%s'\n", *statePath)
+		return
+	}
+	resumeOperations()
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+)
+
+// API group and version of the operator's custom resources.
+const (
+	operatorGroup   = "network.azure-samples.io"
+	operatorVersion = "v1alpha1"
+)
+
+// operatorTag marks the NICs and public IPs the operator manages, so that it deletes those whose custom
+// resource was deleted and leaves the other resources of the node resource group alone.
+const operatorTagKey, operatorTagValue = "managed-by", "nic-operator"
+
+// serviceAccountDir holds the token and CA certificate of a pod's service account.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubeClient calls the Kubernetes API with the pod's service account, or through kubectl proxy.
+type kubeClient struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// newKubeClient returns a client of the API server at apiURL, e.g. http://127.0.0.1:8001 for kubectl proxy,
+// or of the cluster the pod runs in when apiURL is empty.
+func newKubeClient(apiURL string) (*kubeClient, error) {
+	transport := newTransport()
+	if apiURL != "" {
+		return &kubeClient{baseURL: strings.TrimSuffix(apiURL, "/"), client: &http.Client{Transport: transport, Timeout: 30 * time.Second}}, nil
+	}
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a cluster, use -kube-api with kubectl proxy")
+	}
+	token, err := ioutil.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificate in %s/ca.crt", serviceAccountDir)
+	}
+	// The API server is reached directly, never through a proxy.
+	transport.Proxy = nil
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return &kubeClient{
+		baseURL: "https://" + host + ":" + port,
+		token:   strings.TrimSpace(string(token)),
+		client:  &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}, nil
+}
+
+// do sends a request with a JSON body, unless body is nil, and decodes the response into result, unless it is nil.
+func (k *kubeClient) do(method, path, contentType string, body, result interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, k.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if k.token != "" {
+		req.Header.Set("Authorization", "Bearer "+k.token)
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s responded %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// kubeMetadata is the part of a custom resource's metadata the operator uses.
+type kubeMetadata struct {
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace"`
+	Generation int64  `json:"generation"`
+}
+
+// azureNIC is an AzureNIC custom resource. The NIC is named after the resource's namespace and name unless
+// the spec names it, and its publicIp is the name of an AzurePublicIP of the same namespace.
+type azureNIC struct {
+	Metadata kubeMetadata `json:"metadata"`
+	Spec     nicSpec      `json:"spec"`
+}
+
+// azurePublicIP is an AzurePublicIP custom resource, named like an AzureNIC.
+type azurePublicIP struct {
+	Metadata kubeMetadata `json:"metadata"`
+	Spec     pipSpec      `json:"spec"`
+}
+
+// resourceStatus is the status the operator reports on its custom resources.
+type resourceStatus struct {
+	// State is Ready once the Azure resource matches the spec, and Error otherwise.
+	State              string `json:"state"`
+	Message            string `json:"message,omitempty"`
+	ID                 string `json:"id,omitempty"`
+	PrivateIP          string `json:"privateIp,omitempty"`
+	IPAddress          string `json:"ipAddress,omitempty"`
+	ObservedGeneration int64  `json:"observedGeneration"`
+}
+
+// operatorRun reconciles the NICs and public IPs of a resource group, typically a cluster's node resource
+// group, toward the AzureNIC and AzurePublicIP resources of the cluster every -interval, with the planning
+// and provisioning of apply. NICs and public IPs it created are deleted when their resource is.
+func operatorRun(args []string) {
+	fs := flag.NewFlagSet("operator run", flag.ExitOnError)
+	group := fs.String("resource-group", groupName, "resource group of the NICs and public IPs, e.g. the node resource group")
+	location := fs.String("location", westUS, "region of the NICs and public IPs")
+	namespace := fs.String("namespace", "", "namespace of the custom resources, all namespaces when empty")
+	interval := fs.Duration("interval", 30*time.Second, "resync interval")
+	apiURL := fs.String("kube-api", "", "URL of the Kubernetes API, e.g. of kubectl proxy, the pod's cluster when empty")
+	fs.Parse(args)
+	if fs.NArg() > 0 || *interval <= 0 {
+		fmt.Println("Usage: operator run [-resource-group name] [-location region] [-namespace ns] [-interval 30s] [-kube-api url]")
+		os.Exit(1)
+	}
+	kube, err := newKubeClient(*apiURL)
+	onErrorFail(err, "Connecting to Kubernetes failed")
+
+	fmt.Printf("Reconciling AzureNICs and AzurePublicIPs into resource group '%s' every %s\n", *group, *interval)
+	for {
+		if err := operatorPass(kube, *group, *location, *namespace); err != nil {
+			fmt.Printf("%s %s\n", timestamp(), err)
+		}
+		time.Sleep(*interval)
+	}
+}
+
+// operatorPass reconciles the Azure resources toward the custom resources once and reports their status.
+func operatorPass(kube *kubeClient, group, location, namespace string) error {
+	var pips struct {
+		Items []azurePublicIP `json:"items"`
+	}
+	var nics struct {
+		Items []azureNIC `json:"items"`
+	}
+	if err := kube.do("GET", crPath(namespace, "azurepublicips", ""), "", nil, &pips); err != nil {
+		return err
+	}
+	if err := kube.do("GET", crPath(namespace, "azurenics", ""), "", nil, &nics); err != nil {
+		return err
+	}
+
+	spec := topologySpec{ResourceGroup: group, Location: location}
+	// The statuses are keyed by kind, namespace and name of the custom resource, and azureKeys gives the
+	// key of the resource an Azure resource was planned for.
+	statuses := map[string]*resourceStatus{}
+	azureKeys := map[string]string{}
+	// keep has the Azure resources of custom resources in Error, which aren't in the spec but mustn't be pruned.
+	keep := map[string]bool{}
+	pipNames := map[string]string{}
+	for _, cr := range pips.Items {
+		p := cr.Spec
+		p.Name = operatorAzureName(cr.Metadata, p.Name)
+		key := operatorStatusKey("public IP", cr.Metadata)
+		status := &resourceStatus{State: "Ready", ObservedGeneration: cr.Metadata.Generation}
+		statuses[key] = status
+		switch network.IPAllocationMethod(p.Allocation) {
+		case "", network.Dynamic, network.Static:
+		default:
+			status.State, status.Message = "Error", "allocation must be Dynamic or Static"
+		}
+		if other, ok := azureKeys["public IP/"+strings.ToLower(p.Name)]; ok && status.State == "Ready" {
+			status.State, status.Message = "Error", fmt.Sprintf("public IP '%s' is already the one of %s", p.Name, other)
+		}
+		if status.State == "Error" {
+			keep["public IP/"+strings.ToLower(p.Name)] = true
+			continue
+		}
+		azureKeys["public IP/"+strings.ToLower(p.Name)] = key
+		p.Tags = mergeOperatorTag(p.Tags)
+		pipNames[cr.Metadata.Namespace+"/"+cr.Metadata.Name] = p.Name
+		spec.PublicIPs = append(spec.PublicIPs, p)
+	}
+	for _, cr := range nics.Items {
+		n := cr.Spec
+		n.Name = operatorAzureName(cr.Metadata, n.Name)
+		key := operatorStatusKey("NIC", cr.Metadata)
+		status := &resourceStatus{State: "Ready", ObservedGeneration: cr.Metadata.Generation}
+		statuses[key] = status
+		if !strings.HasPrefix(n.Subnet, "/subscriptions/") {
+			status.State, status.Message = "Error", "subnet must be the resource ID of a subnet"
+		} else if n.PublicIP != "" {
+			name, ok := pipNames[cr.Metadata.Namespace+"/"+n.PublicIP]
+			if !ok {
+				status.State, status.Message = "Error", fmt.Sprintf("no AzurePublicIP '%s' in namespace '%s'", n.PublicIP, cr.Metadata.Namespace)
+			}
+			n.PublicIP = name
+		}
+		if other, ok := azureKeys["NIC/"+strings.ToLower(n.Name)]; ok && status.State == "Ready" {
+			status.State, status.Message = "Error", fmt.Sprintf("NIC '%s' is already the one of %s", n.Name, other)
+		}
+		if status.State == "Error" {
+			keep["NIC/"+strings.ToLower(n.Name)] = true
+			continue
+		}
+		azureKeys["NIC/"+strings.ToLower(n.Name)] = key
+		n.Tags = mergeOperatorTag(n.Tags)
+		spec.NICs = append(spec.NICs, n)
+	}
+
+	actions, err := planSpec(spec, false)
+	if err != nil {
+		return fmt.Errorf("planning failed: %s", err)
+	}
+	prunes, err := operatorPrunes(spec, keep)
+	if err != nil {
+		return fmt.Errorf("planning failed: %s", err)
+	}
+	for _, a := range append(actions, prunes...) {
+		fmt.Printf("%s %s\n", timestamp(), a)
+		if err := a.apply(); err != nil {
+			fmt.Printf("%s Failed: %s\n", timestamp(), err)
+			if s := statuses[azureKeys[a.kind+"/"+strings.ToLower(a.name)]]; s != nil {
+				s.State, s.Message = "Error", err.Error()
+			}
+		}
+	}
+
+	for _, cr := range pips.Items {
+		status := statuses[operatorStatusKey("public IP", cr.Metadata)]
+		if status.State == "Ready" {
+			name := operatorAzureName(cr.Metadata, cr.Spec.Name)
+			if pip, err := addressClient.Get(group, name, ""); err == nil && pip.PublicIPAddressPropertiesFormat != nil {
+				status.ID, status.IPAddress = stringValue(pip.ID), stringValue(pip.IPAddress)
+			}
+		}
+		reportStatus(kube, cr.Metadata, "azurepublicips", status)
+	}
+	for _, cr := range nics.Items {
+		status := statuses[operatorStatusKey("NIC", cr.Metadata)]
+		if status.State == "Ready" {
+			name := operatorAzureName(cr.Metadata, cr.Spec.Name)
+			if nic, err := interfacesClient.Get(group, name, ""); err == nil {
+				status.ID = stringValue(nic.ID)
+				if ipConfig := primaryIPConfiguration(nic); ipConfig != nil && ipConfig.InterfaceIPConfigurationPropertiesFormat != nil {
+					status.PrivateIP = stringValue(ipConfig.PrivateIPAddress)
+				}
+			}
+		}
+		reportStatus(kube, cr.Metadata, "azurenics", status)
+	}
+	return nil
+}
+
+// operatorAzureName returns the name of a custom resource's Azure resource: the one its spec gives, or
+// its namespace and name, so that resources of the same name in two namespaces don't share one.
+func operatorAzureName(meta kubeMetadata, specName string) string {
+	if specName != "" {
+		return specName
+	}
+	return meta.Namespace + "-" + meta.Name
+}
+
+// operatorStatusKey returns the key of a custom resource's status in a pass.
+func operatorStatusKey(kind string, meta kubeMetadata) string {
+	return kind + "/" + meta.Namespace + "/" + meta.Name
+}
+
+// operatorPrunes returns the deletions of the NICs and public IPs tagged as the operator's that have no
+// custom resource anymore. Those in keep, of custom resources in Error, are left alone.
+func operatorPrunes(spec topologySpec, keep map[string]bool) ([]specAction, error) {
+	deletions, err := pruneActions(spec, spec.ResourceGroup)
+	if err != nil {
+		return nil, err
+	}
+	managed := map[string]bool{}
+	nics, err := listGroupNICs(spec.ResourceGroup)
+	if err != nil {
+		return nil, err
+	}
+	if nics.Value != nil {
+		for _, nic := range *nics.Value {
+			managed["NIC/"+stringValue(nic.Name)] = hasTags(nic.Tags, map[string]string{operatorTagKey: operatorTagValue})
+		}
+	}
+	pips, err := listGroupPIPs(spec.ResourceGroup)
+	if err != nil {
+		return nil, err
+	}
+	if pips.Value != nil {
+		for _, pip := range *pips.Value {
+			managed["public IP/"+stringValue(pip.Name)] = hasTags(pip.Tags, map[string]string{operatorTagKey: operatorTagValue})
+		}
+	}
+	prunes := []specAction{}
+	for _, a := range append(deletions[0], deletions[1]...) {
+		if managed[a.kind+"/"+a.name] && !keep[a.kind+"/"+strings.ToLower(a.name)] {
+			prunes = append(prunes, a)
+		}
+	}
+	return prunes, nil
+}
+
+// mergeOperatorTag adds the tag marking a resource as the operator's to tags.
+func mergeOperatorTag(tags map[string]string) map[string]string {
+	result := map[string]string{operatorTagKey: operatorTagValue}
+	for k, v := range tags {
+		result[k] = v
+	}
+	return result
+}
+
+// reportStatus sets the status of a custom resource, printing rather than failing on errors.
+func reportStatus(kube *kubeClient, meta kubeMetadata, plural string, status *resourceStatus) {
+	patch := map[string]interface{}{"status": status}
+	if err := kube.do("PATCH", crPath(meta.Namespace, plural, meta.Name)+"/status", "application/merge-patch+json", patch, nil); err != nil {
+		fmt.Printf("%s Reporting the status of %s '%s' failed: %s\n", timestamp(), plural, meta.Name, err)
+	}
+}
+
+// crPath returns the API path of the custom resources of a kind in a namespace, all namespaces when it is
+// empty, or of the one with the given name.
+func crPath(namespace, plural, name string) string {
+	path := "/apis/" + operatorGroup + "/" + operatorVersion
+	if namespace != "" {
+		path += "/namespaces/" + namespace
+	}
+	path += "/" + plural
+	if name != "" {
+		path += "/" + name
+	}
+	return path
+}
+
+// operatorCRDs prints the CustomResourceDefinitions of AzureNIC and AzurePublicIP, for kubectl apply -f -.
+func operatorCRDs(args []string) {
+	fmt.Print(strings.Replace(crdManifests, "GROUP", operatorGroup, -1))
+}
+
+// crdManifests are the CRDs of the operator's custom resources, with the API group as GROUP.
+const crdManifests = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: azurenics.GROUP
+spec:
+  group: GROUP
+  scope: Namespaced
+  names:
+    kind: AzureNIC
+    plural: azurenics
+    singular: azurenic
+  versions:
+  - name: v1alpha1
+    served: true
+    storage: true
+    subresources:
+      status: {}
+    additionalPrinterColumns:
+    - {name: State, type: string, jsonPath: .status.state}
+    - {name: Private IP, type: string, jsonPath: .status.privateIp}
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            required: [subnet]
+            properties:
+              name: {type: string}
+              subnet: {type: string, description: resource ID of the NIC's subnet}
+              privateIp: {type: string}
+              publicIp: {type: string, description: name of an AzurePublicIP of the namespace}
+              nsg: {type: string, description: name of an NSG of the resource group}
+              ipForwarding: {type: boolean}
+              tags: {type: object, additionalProperties: {type: string}}
+          status:
+            type: object
+            x-kubernetes-preserve-unknown-fields: true
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: azurepublicips.GROUP
+spec:
+  group: GROUP
+  scope: Namespaced
+  names:
+    kind: AzurePublicIP
+    plural: azurepublicips
+    singular: azurepublicip
+  versions:
+  - name: v1alpha1
+    served: true
+    storage: true
+    subresources:
+      status: {}
+    additionalPrinterColumns:
+    - {name: State, type: string, jsonPath: .status.state}
+    - {name: Address, type: string, jsonPath: .status.ipAddress}
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            properties:
+              name: {type: string}
+              allocation: {type: string, enum: [Dynamic, Static]}
+              tags: {type: object, additionalProperties: {type: string}}
+          status:
+            type: object
+            x-kubernetes-preserve-unknown-fields: true
+`
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// fakeKube serves lists of AzurePublicIPs and AzureNICs and records the statuses patched.
+type fakeKube struct {
+	pips, nics []interface{}
+	mu         sync.Mutex
+	statuses   map[string]resourceStatus
+}
+
+func (k *fakeKube) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	switch {
+	case r.Method == "GET" && r.URL.Path == crPath("", "azurepublicips", ""):
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": k.pips})
+	case r.Method == "GET" && r.URL.Path == crPath("", "azurenics", ""):
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": k.nics})
+	case r.Method == "PATCH" && strings.HasSuffix(r.URL.Path, "/status"):
+		var patch struct {
+			Status resourceStatus `json:"status"`
+		}
+		json.NewDecoder(r.Body).Decode(&patch)
+		k.statuses[r.URL.Path] = patch.Status
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// customResource returns a custom resource of the default namespace with a spec.
+func customResource(name string, spec map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"metadata": map[string]interface{}{"name": name, "namespace": "default"}, "spec": spec}
+}
+
+// TestOperatorPrunes checks that a pass deletes the operator's NIC whose custom resource was deleted, and
+// keeps those of an invalid custom resource, of a NIC whose AzurePublicIP is missing, and the untagged ones.
+func TestOperatorPrunes(t *testing.T) {
+	newTestARM(t)
+	createTestGroup(t)
+	if _, err := vNetClient.CreateOrUpdate(groupName, "vnet", testVNet(), nil); err != nil {
+		t.Fatalf("creating the VNet: %v", err)
+	}
+	subnetID := *(*testNIC().IPConfigurations)[0].Subnet.ID
+	tagged := to.StringMapPtr(map[string]string{operatorTagKey: operatorTagValue})
+	for _, name := range []string{"default-bad-subnet", "default-missing-pip", "default-deleted", "unmanaged"} {
+		nic := testNIC()
+		if name != "unmanaged" {
+			nic.Tags = tagged
+		}
+		if _, err := interfacesClient.CreateOrUpdate(groupName, name, nic, nil); err != nil {
+			t.Fatalf("creating %s: %v", name, err)
+		}
+	}
+	pip := network.PublicIPAddress{
+		Location: to.StringPtr(westUS),
+		Tags:     tagged,
+		PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+			PublicIPAllocationMethod: network.Static,
+		},
+	}
+	if _, err := addressClient.CreateOrUpdate(groupName, "default-bad-allocation", pip, nil); err != nil {
+		t.Fatalf("creating the public IP: %v", err)
+	}
+
+	kube := &fakeKube{
+		pips: []interface{}{customResource("bad-allocation", map[string]interface{}{"allocation": "Sometimes"})},
+		nics: []interface{}{
+			customResource("bad-subnet", map[string]interface{}{"subnet": "vnet/subnet"}),
+			customResource("missing-pip", map[string]interface{}{"subnet": subnetID, "publicIp": "missing"}),
+			customResource("good", map[string]interface{}{"subnet": subnetID}),
+		},
+		statuses: map[string]resourceStatus{},
+	}
+	srv := httptest.NewServer(kube)
+	defer srv.Close()
+	client, err := newKubeClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := operatorPass(client, groupName, westUS, ""); err != nil {
+		t.Fatalf("operator pass: %v", err)
+	}
+
+	for _, name := range []string{"default-bad-subnet", "default-missing-pip", "default-good", "unmanaged"} {
+		if _, err := interfacesClient.Get(groupName, name, ""); err != nil {
+			t.Errorf("getting NIC %s: %v, want it kept", name, err)
+		}
+	}
+	if _, err := addressClient.Get(groupName, "default-bad-allocation", ""); err != nil {
+		t.Errorf("getting the public IP of the invalid AzurePublicIP: %v, want it kept", err)
+	}
+	_, err = interfacesClient.Get(groupName, "default-deleted", "")
+	if de, ok := err.(autorest.DetailedError); !ok || de.StatusCode != http.StatusNotFound {
+		t.Errorf("getting the NIC of the deleted AzureNIC: err = %v, want a 404", err)
+	}
+
+	want := map[string]string{
+		crPath("default", "azurepublicips", "bad-allocation"): "Error",
+		crPath("default", "azurenics", "bad-subnet"):          "Error",
+		crPath("default", "azurenics", "missing-pip"):         "Error",
+		crPath("default", "azurenics", "good"):                "Ready",
+	}
+	for path, state := range want {
+		if got := kube.statuses[path+"/status"].State; got != state {
+			t.Errorf("state of %s = %q, want %s", path, got, state)
+		}
+	}
+}
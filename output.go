@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// Output levels, from -quiet to -vv.
+const (
+	quietLevel   = iota // errors and final outputs only
+	stepLevel           // every step of the sample, the default
+	requestLevel        // -v: also every ARM request
+	pollingLevel        // -vv: also the requests polling long-running operations
+)
+
+// outputLevel returns the output level selected by -quiet, -v and -vv.
+func outputLevel() int {
+	switch {
+	case *quiet:
+		return quietLevel
+	case *veryVerbose:
+		return pollingLevel
+	case *verbose:
+		return requestLevel
+	}
+	return stepLevel
+}
+
+// stepf prints the progress of a step of the sample, unless -quiet is set, or writes its event with
+// -progress jsonl.
+func stepf(format string, a ...interface{}) {
+	if progressEnabled() {
+		emitStep(format, a...)
+		return
+	}
+	if outputLevel() >= stepLevel {
+		fmt.Printf(format, a...)
+	}
+}
+
+// logRequests decorates a sender to print every request with its status and duration, and where to
+// follow the long-running operations they start, at -v, and the polling of those as well at -vv.
+func logRequests(s autorest.Sender) autorest.Sender {
+	return autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+		level := requestLevel
+		if isPollingRequest(r) {
+			level = pollingLevel
+		}
+		if outputLevel() < level {
+			return s.Do(r)
+		}
+
+		start := time.Now()
+		resp, err := s.Do(r)
+		elapsed := time.Since(start) / time.Millisecond * time.Millisecond
+		switch {
+		case err != nil:
+			fmt.Printf("\t\t%s %s: %s (%s)\n", r.Method, r.URL, err, elapsed)
+		case level == pollingLevel:
+			fmt.Printf("\t\tpoll %s %s: %s (%s)\n", r.Method, r.URL, resp.Status, elapsed)
+		default:
+			fmt.Printf("\t\t%s %s: %s (%s)\n", r.Method, r.URL, resp.Status, elapsed)
+		}
+		if err == nil && outputLevel() >= pollingLevel {
+			if id := resp.Header.Get("x-ms-request-id"); id != "" {
+				fmt.Printf("\t\t\tx-ms-request-id: %s\n", id)
+			}
+			if op := resp.Header.Get("Azure-AsyncOperation"); op != "" && level == pollingLevel {
+				fmt.Printf("\t\t\tAzure-AsyncOperation: %s\n", op)
+			}
+		}
+		if err == nil && level == requestLevel {
+			printOperationStarted(r, resp)
+		}
+		return resp, err
+	})
+}
+
+// printOperationStarted prints the resource and status URL of the long-running operation a response
+// says ARM started, if any, so that it can be inspected by hand when it hangs.
+func printOperationStarted(r *http.Request, resp *http.Response) {
+	if resp.StatusCode >= 300 {
+		return
+	}
+	header, url := "Azure-AsyncOperation", resp.Header.Get("Azure-AsyncOperation")
+	if url == "" && resp.StatusCode == http.StatusAccepted {
+		header, url = "Location", resp.Header.Get("Location")
+	}
+	if url == "" {
+		return
+	}
+	fmt.Printf("\t\t\tOperation on %s running, status (%s): %s\n", r.URL.Path, header, url)
+	fmt.Printf("\t\t\tCheck it with: az rest --method get --url '%s'\n", url)
+}
+
+// isPollingRequest reports whether r polls the status of a long-running operation.
+func isPollingRequest(r *http.Request) bool {
+	path := strings.ToLower(r.URL.Path)
+	return r.Method == http.MethodGet && (strings.Contains(path, "/operations/") ||
+		strings.Contains(path, "/operationresults/") || strings.Contains(path, "/operationstatuses/"))
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+)
+
+// deploymentOutputs is the content of the -outputs file, for automation consuming the deployment's results.
+type deploymentOutputs struct {
+	ResourceGroup string      `json:"resourceGroup"`
+	VM            string      `json:"vm"`
+	NICs          []nicOutput `json:"nics"`
+}
+
+// nicOutput holds the addresses assigned to a NIC. PublicIP, FQDN and SubnetID are those of its primary IP configuration.
+type nicOutput struct {
+	Name       string   `json:"name"`
+	ID         string   `json:"id"`
+	MACAddress string   `json:"macAddress"`
+	PrivateIPs []string `json:"privateIps"`
+	PublicIP   string   `json:"publicIp,omitempty"`
+	FQDN       string   `json:"fqdn,omitempty"`
+	SubnetID   string   `json:"subnetId"`
+}
+
+// writeOutputs writes the MAC address and the IPs of every NIC of the resource group to path as JSON.
+func writeOutputs(path string) {
+	stepf("Write outputs to '%s'\n", path)
+	nics, err := nicOutputs(groupName)
+	onErrorFail(err, "List failed")
+	outputs := deploymentOutputs{ResourceGroup: groupName, VM: vmName, NICs: nics}
+
+	b, err := json.MarshalIndent(outputs, "", "  ")
+	onErrorFail(err, "MarshalIndent failed")
+	err = ioutil.WriteFile(path, b, 0644)
+	onErrorFail(err, "WriteFile failed")
+}
+
+// nicOutputs returns the addresses of the NICs of a resource group.
+func nicOutputs(group string) ([]nicOutput, error) {
+	nics, err := listGroupNICs(group)
+	if err != nil {
+		return nil, err
+	}
+	pips, err := listGroupPIPs(group)
+	if err != nil {
+		return nil, err
+	}
+	fqdns := map[string]string{}
+	addresses := publicIPAddresses(pips)
+	if pips.Value != nil {
+		for _, pip := range *pips.Value {
+			if pip.ID != nil && pip.PublicIPAddressPropertiesFormat != nil && pip.DNSSettings != nil {
+				fqdns[strings.ToLower(*pip.ID)] = stringValue(pip.DNSSettings.Fqdn)
+			}
+		}
+	}
+
+	outputs := []nicOutput{}
+	if nics.Value != nil {
+		for _, nic := range *nics.Value {
+			o := newNICOutput(nic)
+			if c := primaryIPConfiguration(nic); c != nil && c.InterfaceIPConfigurationPropertiesFormat != nil && c.PublicIPAddress != nil && c.PublicIPAddress.ID != nil {
+				o.PublicIP = addresses[strings.ToLower(*c.PublicIPAddress.ID)]
+				o.FQDN = fqdns[strings.ToLower(*c.PublicIPAddress.ID)]
+			}
+			outputs = append(outputs, o)
+		}
+	}
+	return outputs, nil
+}
+
+// newNICOutput returns the name, MAC address, private IPs and subnet of a NIC, without its public IP.
+func newNICOutput(nic network.Interface) nicOutput {
+	o := nicOutput{Name: stringValue(nic.Name), ID: stringValue(nic.ID), MACAddress: stringValue(nic.MacAddress), PrivateIPs: []string{}}
+	if nic.InterfacePropertiesFormat != nil && nic.IPConfigurations != nil {
+		for _, c := range *nic.IPConfigurations {
+			if c.InterfaceIPConfigurationPropertiesFormat != nil {
+				o.PrivateIPs = append(o.PrivateIPs, stringValue(c.PrivateIPAddress))
+			}
+		}
+	}
+	if c := primaryIPConfiguration(nic); c != nil && c.InterfaceIPConfigurationPropertiesFormat != nil && c.Subnet != nil {
+		o.SubnetID = stringValue(c.Subnet.ID)
+	}
+	return o
+}
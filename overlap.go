@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+)
+
+// checkAddressSpaceOverlap warns about the VNets of the subscription whose address space overlaps with
+// prefixes, which rules out peering or routing between them later, and asks whether to deploy anyway.
+// The sample's own VNets, left by a previous run, don't count.
+func checkAddressSpaceOverlap(prefixes []string) {
+	stepf("Check the address space %s against the subscription's VNets\n", strings.Join(prefixes, ", "))
+	vNets, err := listAllVNets()
+	if err != nil {
+		fmt.Printf("Skip the address space overlap check, listing the VNets failed: %s\n", err)
+		return
+	}
+
+	overlaps := 0
+	for _, vNet := range vNets {
+		if isSampleVNet(vNet) || vNet.VirtualNetworkPropertiesFormat == nil || vNet.AddressSpace == nil || vNet.AddressSpace.AddressPrefixes == nil {
+			continue
+		}
+		for _, theirs := range *vNet.AddressSpace.AddressPrefixes {
+			_, other, err := net.ParseCIDR(theirs)
+			if err != nil {
+				continue
+			}
+			for _, ours := range prefixes {
+				_, n, _ := net.ParseCIDR(ours)
+				if !anyOverlaps([]*net.IPNet{other}, n) {
+					continue
+				}
+				overlaps++
+				fmt.Printf("Warning: %s overlaps with %s of VNet '%s' in resource group '%s'%s\n", ours, theirs,
+					stringValue(vNet.Name), resourceGroupOf(vNet.ID), reachability(vNet))
+			}
+		}
+	}
+	if overlaps == 0 {
+		return
+	}
+	fmt.Println("VNets with overlapping address spaces can't be peered, nor reached from each other through a gateway;")
+	fmt.Println("pick another range with -address-space to connect the sample's VNet to them.")
+	if !confirm("Deploy with the overlapping address space anyway?") {
+		os.Exit(exitCancelled)
+	}
+}
+
+// listAllVNets returns the VNets of the subscription, following the pages of the result.
+func listAllVNets() ([]network.VirtualNetwork, error) {
+	vNets := []network.VirtualNetwork{}
+	page, err := vNetClient.ListAll()
+	for {
+		if err != nil {
+			return nil, err
+		}
+		if page.Value != nil {
+			vNets = append(vNets, *page.Value...)
+		}
+		if page.NextLink == nil || *page.NextLink == "" {
+			return vNets, nil
+		}
+		page, err = vNetClient.ListAllNextResults(page)
+	}
+}
+
+// isSampleVNet reports whether vNet is one of the sample's, in its resource group and named after vNetName.
+func isSampleVNet(vNet network.VirtualNetwork) bool {
+	name := stringValue(vNet.Name)
+	return strings.EqualFold(resourceGroupOf(vNet.ID), groupName) && (name == vNetName || strings.HasPrefix(name, vNetName+"-"))
+}
+
+// reachability describes how traffic may already reach vNet from elsewhere, through peerings or a gateway,
+// which makes an overlap with it all the likelier to hurt.
+func reachability(vNet network.VirtualNetwork) string {
+	reasons := []string{}
+	if vNet.VirtualNetworkPeerings != nil && len(*vNet.VirtualNetworkPeerings) > 0 {
+		reasons = append(reasons, fmt.Sprintf("peered with %d VNets", len(*vNet.VirtualNetworkPeerings)))
+	}
+	if vNet.Subnets != nil {
+		for _, s := range *vNet.Subnets {
+			if stringValue(s.Name) == "GatewaySubnet" {
+				reasons = append(reasons, "with a gateway subnet")
+				break
+			}
+		}
+	}
+	if len(reasons) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(reasons, " and ")
+}
+
+// resourceGroupOf returns the resource group segment of a resource ID.
+func resourceGroupOf(id *string) string {
+	r, _ := parseID(stringValue(id))
+	return r.ResourceGroup
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"github.com/Azure/azure-sdk-for-go/arm/compute"
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/azure-sdk-for-go/arm/storage"
+)
+
+// ARM returns long lists a page at a time, with a NextLink to the next page. The functions below follow
+// the NextLinks and return every item as a single page, in the SDK's list result types.
+
+// listGroupNICs lists all NICs of a resource group.
+func listGroupNICs(group string) (network.InterfaceListResult, error) {
+	page, err := interfacesClient.List(group)
+	all := []network.Interface{}
+	for {
+		if err != nil {
+			return page, err
+		}
+		if page.Value != nil {
+			all = append(all, *page.Value...)
+		}
+		if page.NextLink == nil || *page.NextLink == "" {
+			page.Value = &all
+			return page, nil
+		}
+		page, err = interfacesClient.ListNextResults(page)
+	}
+}
+
+// listGroupPIPs lists all public IPs of a resource group.
+func listGroupPIPs(group string) (network.PublicIPAddressListResult, error) {
+	page, err := addressClient.List(group)
+	all := []network.PublicIPAddress{}
+	for {
+		if err != nil {
+			return page, err
+		}
+		if page.Value != nil {
+			all = append(all, *page.Value...)
+		}
+		if page.NextLink == nil || *page.NextLink == "" {
+			page.Value = &all
+			return page, nil
+		}
+		page, err = addressClient.ListNextResults(page)
+	}
+}
+
+// listGroupVNets lists all VNets of a resource group.
+func listGroupVNets(group string) (network.VirtualNetworkListResult, error) {
+	page, err := vNetClient.List(group)
+	all := []network.VirtualNetwork{}
+	for {
+		if err != nil {
+			return page, err
+		}
+		if page.Value != nil {
+			all = append(all, *page.Value...)
+		}
+		if page.NextLink == nil || *page.NextLink == "" {
+			page.Value = &all
+			return page, nil
+		}
+		page, err = vNetClient.ListNextResults(page)
+	}
+}
+
+// listGroupNSGs lists all network security groups of a resource group.
+func listGroupNSGs(group string) (network.SecurityGroupListResult, error) {
+	page, err := nsgClient.List(group)
+	all := []network.SecurityGroup{}
+	for {
+		if err != nil {
+			return page, err
+		}
+		if page.Value != nil {
+			all = append(all, *page.Value...)
+		}
+		if page.NextLink == nil || *page.NextLink == "" {
+			page.Value = &all
+			return page, nil
+		}
+		page, err = nsgClient.ListNextResults(page)
+	}
+}
+
+// listSubnets lists all subnets of a VNet.
+func listSubnets(group, vNet string) (network.SubnetListResult, error) {
+	page, err := subnetClient.List(group, vNet)
+	all := []network.Subnet{}
+	for {
+		if err != nil {
+			return page, err
+		}
+		if page.Value != nil {
+			all = append(all, *page.Value...)
+		}
+		if page.NextLink == nil || *page.NextLink == "" {
+			page.Value = &all
+			return page, nil
+		}
+		page, err = subnetClient.ListNextResults(page)
+	}
+}
+
+// listScaleSetNICs lists all NICs of a VM scale set's instances, or of the single instance given.
+func listScaleSetNICs(group, scaleSet, instance string) (network.InterfaceListResult, error) {
+	var page network.InterfaceListResult
+	var err error
+	if instance == "" {
+		page, err = interfacesClient.ListVirtualMachineScaleSetNetworkInterfaces(group, scaleSet)
+	} else {
+		page, err = interfacesClient.ListVirtualMachineScaleSetVMNetworkInterfaces(group, scaleSet, instance)
+	}
+	all := []network.Interface{}
+	for {
+		if err != nil {
+			return page, err
+		}
+		if page.Value != nil {
+			all = append(all, *page.Value...)
+		}
+		if page.NextLink == nil || *page.NextLink == "" {
+			page.Value = &all
+			return page, nil
+		}
+		if instance == "" {
+			page, err = interfacesClient.ListVirtualMachineScaleSetNetworkInterfacesNextResults(page)
+		} else {
+			page, err = interfacesClient.ListVirtualMachineScaleSetVMNetworkInterfacesNextResults(page)
+		}
+	}
+}
+
+// listGroupVMs lists all VMs of a resource group.
+func listGroupVMs(group string) (compute.VirtualMachineListResult, error) {
+	page, err := vmClient.List(group)
+	all := []compute.VirtualMachine{}
+	for {
+		if err != nil {
+			return page, err
+		}
+		if page.Value != nil {
+			all = append(all, *page.Value...)
+		}
+		if page.NextLink == nil || *page.NextLink == "" {
+			page.Value = &all
+			return page, nil
+		}
+		page, err = vmClient.ListNextResults(page)
+	}
+}
+
+// listGroupAccounts lists all storage accounts of a resource group. The storage API version of the SDK
+// returns them in a single page without a NextLink, so there is no further page to follow.
+func listGroupAccounts(group string) (storage.AccountListResult, error) {
+	page, err := accountClient.ListByResourceGroup(group)
+	if err != nil {
+		return page, err
+	}
+	if page.Value == nil {
+		page.Value = &[]storage.Account{}
+	}
+	return page, nil
+}
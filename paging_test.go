@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// failLaterPages is a transport answering the requests for a page after the first one with 400, and
+// passing the others on to the fake.
+type failLaterPages struct {
+	f *fakeARM
+}
+
+func (t failLaterPages) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.URL.Query().Get("$skiptoken") != "" {
+		w := httptest.NewRecorder()
+		fakeError(w, http.StatusBadRequest, "InvalidSkipToken", "The skip token is invalid")
+		resp := w.Result()
+		resp.Request = r
+		return resp, nil
+	}
+	return t.f.RoundTrip(r)
+}
+
+// seedNICs adds n NICs named nic-1 to nic-n to the fake's resource group.
+func seedNICs(f *fakeARM, n int) {
+	for i := 1; i <= n; i++ {
+		id := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/networkInterfaces/nic-%d",
+			offlineSubscriptionID, groupName, i)
+		f.resources[strings.ToLower(id)] = map[string]interface{}{
+			"id": id, "name": fmt.Sprintf("nic-%d", i), "type": "Microsoft.Network/networkInterfaces",
+			"location": westUS, "properties": map[string]interface{}{},
+		}
+	}
+}
+
+func TestListGroupNICsPages(t *testing.T) {
+	tests := []struct {
+		nics, pageSize int
+	}{
+		{nics: 0, pageSize: 2},
+		{nics: 1, pageSize: 0},
+		{nics: 2, pageSize: 2},
+		{nics: 5, pageSize: 2},
+		{nics: 7, pageSize: 1},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d NICs by %d", tt.nics, tt.pageSize), func(t *testing.T) {
+			f := newTestARM(t)
+			seedNICs(f, tt.nics)
+			f.pageSize = tt.pageSize
+
+			all, err := listGroupNICs(groupName)
+			if err != nil {
+				t.Fatalf("listGroupNICs: %v", err)
+			}
+			if all.Value == nil {
+				t.Fatalf("listGroupNICs returned a nil Value, want the %d NICs", tt.nics)
+			}
+			if len(*all.Value) != tt.nics {
+				t.Fatalf("listed %d NICs, want %d", len(*all.Value), tt.nics)
+			}
+			for i, nic := range *all.Value {
+				if want := fmt.Sprintf("nic-%d", i+1); to.String(nic.Name) != want {
+					t.Errorf("NIC %d = %q, want %q", i, to.String(nic.Name), want)
+				}
+			}
+		})
+	}
+}
+
+func TestListGroupNICsLaterPageFails(t *testing.T) {
+	f := newTestARM(t)
+	seedNICs(f, 5)
+	f.pageSize = 2
+	createClients(offlineSubscriptionID, autorest.NullAuthorizer{}, newSenderWithTransport(failLaterPages{f}))
+
+	_, err := listGroupNICs(groupName)
+	if de, ok := err.(autorest.DetailedError); !ok || de.StatusCode != http.StatusBadRequest {
+		t.Fatalf("listGroupNICs: err = %v, want the 400 of the second page", err)
+	}
+}
+
+func TestListGroupVMsPages(t *testing.T) {
+	f := newTestARM(t)
+	for i := 1; i <= 3; i++ {
+		id := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachines/vm-%d",
+			offlineSubscriptionID, groupName, i)
+		f.resources[strings.ToLower(id)] = map[string]interface{}{
+			"id": id, "name": fmt.Sprintf("vm-%d", i), "type": "Microsoft.Compute/virtualMachines",
+			"location": westUS, "properties": map[string]interface{}{},
+		}
+	}
+	f.pageSize = 2
+
+	all, err := listGroupVMs(groupName)
+	if err != nil {
+		t.Fatalf("listGroupVMs: %v", err)
+	}
+	if all.Value == nil || len(*all.Value) != 3 {
+		t.Fatalf("listGroupVMs returned %v, want the 3 VMs", all.Value)
+	}
+}
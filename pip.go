@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/azure-sdk-for-go/arm/resources/resources"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// pipSKUAPIVersion is a network API version with public IP SKUs and tiers, which the SDK's 2016-09-01 models
+// don't have, so public IPs with a tier are created as generic resources.
+const pipSKUAPIVersion = "2020-11-01"
+
+// validatePIPFlags exits unless -pip-allocation, -pip-idle-timeout and -pip-tier are valid and compatible.
+func validatePIPFlags() {
+	fail := func(format string, a ...interface{}) {
+		fmt.Printf(format+"\n", a...)
+		os.Exit(1)
+	}
+	switch network.IPAllocationMethod(*pipAllocation) {
+	case "", network.Dynamic, network.Static:
+	default:
+		fail("Unknown -pip-allocation '%s', use Dynamic or Static", *pipAllocation)
+	}
+	if *pipIdleTimeout != 0 && (*pipIdleTimeout < 4 || *pipIdleTimeout > 30) {
+		fail("-pip-idle-timeout must be between 4 and 30 minutes")
+	}
+	switch *pipTier {
+	case "", "Regional":
+	case "Global":
+		fail("Global public IPs can only be the frontend of a cross-region load balancer, not be attached to a NIC; use -pip-tier Regional")
+	default:
+		fail("Unknown -pip-tier '%s', use Regional or Global", *pipTier)
+	}
+	if *pipTier != "" && network.IPAllocationMethod(*pipAllocation) == network.Dynamic {
+		fail("-pip-tier creates Standard SKU public IPs, which only support -pip-allocation Static")
+	}
+}
+
+// samplePIPNames returns the names of the sample's two public IPs, the front-end NIC's first and final one.
+func samplePIPNames() (string, string) {
+	return resourceName("pip", "pip1", westUS, namingVars{"seq": "1"}), resourceName("pip", "pip2", westUS, namingVars{"seq": "2"})
+}
+
+// newPIPProperties returns the properties of the public IP pipName as chosen with the -pip-* flags.
+func newPIPProperties(pipName string) *network.PublicIPAddressPropertiesFormat {
+	properties := &network.PublicIPAddressPropertiesFormat{
+		PublicIPAllocationMethod: network.IPAllocationMethod(*pipAllocation),
+		DNSSettings: &network.PublicIPAddressDNSSettings{
+			DomainNameLabel: to.StringPtr(dnsLabel(pipName)),
+		},
+	}
+	if *pipTier != "" {
+		properties.PublicIPAllocationMethod = network.Static
+	}
+	if *pipIdleTimeout != 0 {
+		properties.IdleTimeoutInMinutes = to.Int32Ptr(int32(*pipIdleTimeout))
+	}
+	return properties
+}
+
+// createStandardPIP creates a Standard SKU public IP of the given tier, Regional or Global.
+func createStandardPIP(pipName, tier string, properties *network.PublicIPAddressPropertiesFormat) {
+	stepf("\tStandard SKU, %s tier\n", tier)
+	b, err := json.Marshal(properties)
+	onErrorFail(err, "Marshal failed")
+	body := map[string]interface{}{}
+	err = json.Unmarshal(b, &body)
+	onErrorFail(err, "Unmarshal failed")
+
+	client := genericClient
+	client.APIVersion = pipSKUAPIVersion
+	id := strings.TrimPrefix(resourceID("Microsoft.Network/publicIPAddresses", pipName), "/")
+	_, err = client.CreateOrUpdateByID(id, resources.GenericResource{
+		Location:   to.StringPtr(westUS),
+		Tags:       resourceTags(),
+		Sku:        &resources.Sku{Name: to.StringPtr("Standard"), Tier: to.StringPtr(tier)},
+		Properties: &body,
+	}, nil)
+	onErrorFail(err, "CreateOrUpdateByID failed")
+}
+
+// dnsLabel returns the DNS label of the public IP pipName, which makes it reachable as
+// {label}.{region}.cloudapp.azure.com.
+func dnsLabel(pipName string) string {
+	return fmt.Sprintf("azuresample-%s", strings.ToLower(pipName))
+}
+
+// checkDNSLabels fails before anything is deployed if the DNS label of one of the public IPs is taken in
+// location, unless it is taken by the public IP of that name from an earlier run into the same group.
+func checkDNSLabels(location string, pipNames ...string) {
+	stepf("Check the availability of the public IPs' DNS labels\n")
+	for _, name := range pipNames {
+		label := dnsLabel(name)
+		result, err := addressClient.CheckDNSNameAvailability(location, label)
+		onErrorFail(err, "CheckDNSNameAvailability failed")
+		if result.Available != nil && *result.Available {
+			continue
+		}
+		if pip, err := addressClient.Get(groupName, name, ""); err == nil && pip.DNSSettings != nil &&
+			pip.DNSSettings.DomainNameLabel != nil && *pip.DNSSettings.DomainNameLabel == label {
+			continue
+		}
+		onErrorFail(fmt.Errorf("DNS label '%s' of public IP '%s' is already taken in %s, choose another name with a naming template", label, name, location),
+			"Check DNS labels failed")
+	}
+}
+
+// existingPIP is the public IP of -public-ip-id, set by resolveExistingPIP.
+var existingPIP network.PublicIPAddress
+
+// resolveExistingPIP looks up the public IP id to attach to the front-end NIC, exiting unless it is in the
+// sample's region and not associated with another resource yet.
+func resolveExistingPIP(id string) {
+	pip, err := getPublicIP(id)
+	onErrorFail(err, "Get public IP failed")
+	if !strings.EqualFold(to.String(pip.Location), westUS) {
+		fmt.Printf("Public IP '%s' is in %s, but the sample deploys its NICs into %s\n", to.String(pip.Name), to.String(pip.Location), westUS)
+		os.Exit(1)
+	}
+	if pip.PublicIPAddressPropertiesFormat != nil && pip.IPConfiguration != nil && pip.IPConfiguration.ID != nil {
+		fmt.Printf("Public IP '%s' is already associated with %s\n", to.String(pip.Name), *pip.IPConfiguration.ID)
+		os.Exit(1)
+	}
+	stepf("Use the existing public IP '%s' of resource group '%s'\n", to.String(pip.Name), resourceGroupOf(pip.ID))
+	existingPIP = pip
+}
+
+// getPublicIP reads a public IP by resource ID, which may be in another resource group than the sample's.
+func getPublicIP(id string) (network.PublicIPAddress, error) {
+	group := resourceGroupOf(&id)
+	if group == "" {
+		return network.PublicIPAddress{}, fmt.Errorf("'%s' is not the resource ID of a public IP", id)
+	}
+	return addressClient.Get(group, lastSegment(&id), "")
+}
+
+// pipDelete deletes a public IP of the resource group. ARM refuses to delete a public IP still associated
+// with an IP configuration, so with -force the reference is first removed from the NIC holding it.
+func pipDelete(args []string) {
+	fs := flag.NewFlagSet("pip delete", flag.ExitOnError)
+	force := fs.Bool("force", false, "detach the public IP from its NIC first")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Println("Usage: pip delete [-force] <name>")
+		os.Exit(1)
+	}
+	name := fs.Arg(0)
+	pip, err := addressClient.Get(groupName, name, "")
+	onErrorFail(err, "Get failed")
+
+	if pip.PublicIPAddressPropertiesFormat != nil && pip.IPConfiguration != nil && pip.IPConfiguration.ID != nil {
+		ipConfigID := *pip.IPConfiguration.ID
+		if !*force {
+			fmt.Printf("Public IP '%s' is associated with %s, pass -force to detach it first\n", name, ipConfigID)
+			os.Exit(1)
+		}
+		detachPIP(ipConfigID)
+	}
+
+	fmt.Printf("Delete public IP '%s'\n", name)
+	unlockFor(resourceID("Microsoft.Network/publicIPAddresses", name))
+	_, err = addressClient.Delete(groupName, name, nil)
+	onErrorFail(err, "Delete failed")
+	resourceDeleted("Microsoft.Network/publicIPAddresses", name)
+}
+
+// detachPIP removes the public IP from the NIC IP configuration ipConfigID, waiting for the NIC's update.
+// Public IPs of load balancers and gateways have to be detached from those by hand.
+func detachPIP(ipConfigID string) {
+	id, err := parseID(ipConfigID)
+	if err != nil || !strings.EqualFold(id.Type(), "Microsoft.Network/networkInterfaces/ipConfigurations") {
+		onErrorFail(fmt.Errorf("it is associated with %s, which isn't a NIC", ipConfigID), "Detach public IP failed")
+	}
+	group, nicName, ipConfigName := id.ResourceGroup, id.NameOf("networkInterfaces"), id.Name()
+	fmt.Printf("Detach the public IP from IP configuration '%s' of NIC '%s'\n", ipConfigName, nicName)
+	_, err = patchNIC(group, nicName, func(nic *network.Interface) error {
+		if nic.InterfacePropertiesFormat != nil && nic.IPConfigurations != nil {
+			for i, c := range *nic.IPConfigurations {
+				if strings.EqualFold(stringValue(c.Name), ipConfigName) && c.InterfaceIPConfigurationPropertiesFormat != nil {
+					(*nic.IPConfigurations)[i].PublicIPAddress = nil
+				}
+			}
+		}
+		return nil
+	})
+	onErrorFail(err, "CreateOrUpdate failed")
+}
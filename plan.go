@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// whatIfAPIVersion is the first resources API version of What-If.
+const whatIfAPIVersion = "2019-07-01"
+
+// planIgnoredPaths are properties of the desired resources ARM never returns, which would otherwise always
+// show as changes.
+var planIgnoredPaths = map[string]bool{
+	"properties.osProfile.adminPassword": true,
+}
+
+// whatIfChange is a resource the deployment would create, delete, modify or leave alone.
+type whatIfChange struct {
+	ResourceID string                 `json:"resourceId"`
+	ChangeType string                 `json:"changeType"`
+	Delta      []whatIfPropertyChange `json:"delta"`
+}
+
+// whatIfPropertyChange is a property a deployment would change, with the changes of its members or
+// array elements as Children.
+type whatIfPropertyChange struct {
+	Path               string                 `json:"path"`
+	PropertyChangeType string                 `json:"propertyChangeType"`
+	Before             interface{}            `json:"before"`
+	After              interface{}            `json:"after"`
+	Children           []whatIfPropertyChange `json:"children"`
+}
+
+// whatIfSymbols prefix the resources and properties of a What-If result as in the Azure CLI.
+var whatIfSymbols = map[string]string{
+	"Create":   "+",
+	"Delete":   "-",
+	"Modify":   "~",
+	"Array":    "~",
+	"Deploy":   "!",
+	"NoChange": "=",
+	"NoEffect": "x",
+	"Ignore":   "*",
+}
+
+// whatIfChanges asks ARM what deploying the deployment into the resource group would change.
+func whatIfChanges(deployment interface{}) ([]whatIfChange, error) {
+	var result struct {
+		Status     string `json:"status"`
+		Properties struct {
+			Changes []whatIfChange `json:"changes"`
+		} `json:"properties"`
+		Error *struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	path := resourceID("Microsoft.Resources/deployments", templateDeploymentName) + "/whatIf"
+	if err := armRequest("POST", path, whatIfAPIVersion, nil, deployment, &result); err != nil {
+		return nil, err
+	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("%s: %s", result.Error.Code, result.Error.Message)
+	}
+	return result.Properties.Changes, nil
+}
+
+// printWhatIf prints the resources a deployment would change, with their property-level changes.
+func printWhatIf(changes []whatIfChange) {
+	for _, c := range changes {
+		r, _ := parseID(c.ResourceID)
+		fmt.Printf("%s %s %s\n", whatIfSymbols[c.ChangeType], r.Type(), r.Name())
+		printPropertyChanges(c.Delta, "\t")
+	}
+}
+
+// printPropertyChanges prints property changes of What-If, indenting the members of a changed property.
+func printPropertyChanges(changes []whatIfPropertyChange, indent string) {
+	for _, p := range changes {
+		switch {
+		case len(p.Children) > 0:
+			fmt.Printf("%s%s %s:\n", indent, whatIfSymbols[p.PropertyChangeType], p.Path)
+			printPropertyChanges(p.Children, indent+"\t")
+		case p.PropertyChangeType == "Create":
+			fmt.Printf("%s+ %s: %s\n", indent, p.Path, planValue(p.After))
+		case p.PropertyChangeType == "Delete":
+			fmt.Printf("%s- %s: %s\n", indent, p.Path, planValue(p.Before))
+		default:
+			fmt.Printf("%s%s %s: %s => %s\n", indent, whatIfSymbols[p.PropertyChangeType], p.Path, planValue(p.Before), planValue(p.After))
+		}
+	}
+}
+
+// planValue formats a property value of a plan.
+func planValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprint(v)
+}
+
+// plan prints what a sample run would create or change in the resource group, without changing anything.
+// With -engine template, ARM's What-If evaluates the run's template; with the SDK engine, each resource the
+// run would send is compared with the live one, property by property.
+func plan(args []string) {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	fs.Parse(args)
+	resolveTopology()
+	pip1Name, pip2Name := samplePIPNames()
+
+	existence, err := groupClient.CheckExistence(groupName)
+	if !isNotFound(existence) {
+		onErrorFail(err, "CheckExistence failed")
+	}
+	if *engine == engineTemplate && !isNotFound(existence) {
+		changes, err := whatIfChanges(topologyTemplate(westUS, pip1Name, pip2Name, templateResourceID).deployment())
+		onErrorFail(err, "What-If failed")
+		printWhatIf(changes)
+		return
+	}
+
+	liveID := func(resourceType string, names ...string) string {
+		return resourceID(resourceType, strings.Join(names, "/"))
+	}
+	for _, desired := range topologyTemplate(westUS, pip1Name, pip2Name, liveID).resources {
+		resourceType, name, apiVersion := desired["type"].(string), desired["name"].(string), desired["apiVersion"].(string)
+		live := map[string]interface{}{}
+		err := armRequest("GET", liveID(resourceType, name), apiVersion, nil, nil, &live)
+		if err != nil && (isNotFound(existence) || errorStatus(err) == http.StatusNotFound) {
+			fmt.Printf("+ %s %s\n", resourceType, name)
+			continue
+		}
+		onErrorFail(err, fmt.Sprintf("Get %s '%s' failed", resourceType, name))
+
+		body := map[string]interface{}{}
+		for k, v := range desired {
+			switch k {
+			case "type", "name", "apiVersion", "dependsOn":
+			default:
+				body[k] = v
+			}
+		}
+		changes := planChanges(body, live)
+		if len(changes) == 0 {
+			fmt.Printf("= %s %s\n", resourceType, name)
+			continue
+		}
+		fmt.Printf("~ %s %s\n", resourceType, name)
+		for _, c := range changes {
+			fmt.Printf("\t%s\n", c)
+		}
+	}
+}
+
+// planChanges describes the properties of desired that differ from live. Only the properties the run sets
+// are compared, as live also holds those ARM fills in; IDs and other values are compared case-insensitively
+// like ARM does.
+func planChanges(desired, live map[string]interface{}) []string {
+	want, have := map[string]string{}, map[string]string{}
+	flattenProperties("", desired, want)
+	flattenProperties("", live, have)
+	changes := []string{}
+	for p, w := range want {
+		h, ok := have[p]
+		switch {
+		case planIgnoredPaths[p]:
+		case !ok:
+			changes = append(changes, fmt.Sprintf("+ %s: %s", p, w))
+		case !strings.EqualFold(h, w):
+			changes = append(changes, fmt.Sprintf("~ %s: %s => %s", p, h, w))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
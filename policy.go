@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Azure/azure-sdk-for-go/arm/compute"
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/azure-sdk-for-go/arm/storage"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// policyInsightsAPIVersion is the API version of checkPolicyRestrictions.
+const policyInsightsAPIVersion = "2020-07-01"
+
+// plannedResource is a resource the sample is about to create, as its PUT would send it.
+type plannedResource struct {
+	Type       string
+	Name       string
+	APIVersion string
+	Model      interface{}
+}
+
+// policyRestrictions is the part of the answer of checkPolicyRestrictions the pre-check reports.
+type policyRestrictions struct {
+	FieldRestrictions []struct {
+		Field        string `json:"field"`
+		Restrictions []struct {
+			Result string        `json:"result"`
+			Values []string      `json:"values"`
+			Policy policyInfoRef `json:"policy"`
+		} `json:"restrictions"`
+	} `json:"fieldRestrictions"`
+	ContentEvaluationResult struct {
+		PolicyEvaluations []struct {
+			PolicyInfo       policyInfoRef `json:"policyInfo"`
+			EvaluationResult string        `json:"evaluationResult"`
+		} `json:"policyEvaluations"`
+	} `json:"contentEvaluationResult"`
+}
+
+// policyInfoRef identifies the policy assignment behind a restriction.
+type policyInfoRef struct {
+	PolicyDefinitionID string `json:"policyDefinitionId"`
+	PolicyAssignmentID string `json:"policyAssignmentId"`
+}
+
+// checkPolicies evaluates the resources the sample is about to create against the policies assigned to its
+// resource group with the policy insights API, and exits listing those a deny policy would refuse, rather
+// than failing on the VM after the network has been created. Policies of other effects, e.g. audit, don't
+// refuse resources and aren't reported.
+func checkPolicies() {
+	stepf("Check the resources against the assigned Azure policies\n")
+	scope := resourceID("", "")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	denied := 0
+	for _, r := range plannedResources() {
+		b, err := json.Marshal(r.Model)
+		onErrorFail(err, "Marshal failed")
+		content := map[string]interface{}{}
+		onErrorFail(json.Unmarshal(b, &content), "Unmarshal failed")
+		content["type"], content["name"] = r.Type, r.Name
+
+		body := map[string]interface{}{
+			"resourceDetails": map[string]interface{}{
+				"resourceContent": content,
+				"apiVersion":      r.APIVersion,
+				"scope":           scope,
+			},
+		}
+		// At the subscription's scope the check works before the resource group exists.
+		var result policyRestrictions
+		err = armRequest("POST", "/subscriptions/"+groupClient.SubscriptionID+"/providers/Microsoft.PolicyInsights/checkPolicyRestrictions",
+			policyInsightsAPIVersion, nil, body, &result)
+		onErrorFail(err, "Checking the policy restrictions failed")
+
+		for _, e := range result.ContentEvaluationResult.PolicyEvaluations {
+			if strings.EqualFold(e.EvaluationResult, "NonCompliant") {
+				if denied == 0 {
+					fmt.Fprintln(w, "TYPE\tNAME\tPOLICY ASSIGNMENT\tPOLICY DEFINITION")
+				}
+				denied++
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Type, r.Name, lastSegment(&e.PolicyInfo.PolicyAssignmentID), lastSegment(&e.PolicyInfo.PolicyDefinitionID))
+			}
+		}
+		for _, f := range result.FieldRestrictions {
+			for _, restriction := range f.Restrictions {
+				if strings.EqualFold(restriction.Result, "Deny") && len(restriction.Values) > 0 {
+					stepf("\t%s '%s': %s must be one of %s (%s)\n", r.Type, r.Name, f.Field, strings.Join(restriction.Values, ", "),
+						lastSegment(&restriction.Policy.PolicyAssignmentID))
+				}
+			}
+		}
+	}
+	if denied > 0 {
+		fmt.Printf("Azure Policy would deny %d of the sample's resources:\n", denied)
+		w.Flush()
+		os.Exit(1)
+	}
+}
+
+// plannedResources returns the principal resources the sample run creates, with the properties policies
+// typically look at: location, tags, SKUs, public IPs and the NSG of the front-end NIC.
+func plannedResources() []plannedResource {
+	planned := []plannedResource{}
+	tags := resourceTags()
+	if !useExistingNetwork() {
+		planned = append(planned, plannedResource{"Microsoft.Network/virtualNetworks", vNetName, vNetClient.APIVersion, network.VirtualNetwork{
+			Location: to.StringPtr(westUS),
+			Tags:     tags,
+			VirtualNetworkPropertiesFormat: &network.VirtualNetworkPropertiesFormat{
+				AddressSpace: &network.AddressSpace{AddressPrefixes: &addressSpace},
+			},
+		}})
+	}
+	pip1Name, pip2Name := samplePIPNames()
+	pipNames := []string{pip1Name}
+	if *existingPIPID == "" {
+		pipNames = append(pipNames, pip2Name)
+	}
+	for _, name := range pipNames {
+		planned = append(planned, plannedResource{"Microsoft.Network/publicIPAddresses", name, addressClient.APIVersion, network.PublicIPAddress{
+			Location:                        to.StringPtr(westUS),
+			Tags:                            tags,
+			PublicIPAddressPropertiesFormat: newPIPProperties(name),
+		}})
+	}
+	for i, s := range layout {
+		if len(s.Delegations) > 0 {
+			continue
+		}
+		subnetID := resourceID("Microsoft.Network/virtualNetworks/subnets", vNetName+"/"+s.Name)
+		if useExistingNetwork() {
+			subnetID = stringValue(existingSubnets[i].ID)
+		}
+		nic := network.Interface{
+			Location: to.StringPtr(westUS),
+			Tags:     tags,
+			InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+				IPConfigurations: &[]network.InterfaceIPConfiguration{{
+					Name: to.StringPtr(fmt.Sprintf("IPconfig%v", i+1)),
+					InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+						Subnet: &network.Subnet{ID: to.StringPtr(subnetID)},
+					},
+				}},
+			},
+		}
+		if s.NIC == nicNameFrontEnd {
+			nic.EnableIPForwarding = to.BoolPtr(true)
+			(*nic.IPConfigurations)[0].PublicIPAddress = &network.PublicIPAddress{ID: to.StringPtr(resourceID("Microsoft.Network/publicIPAddresses", pipNames[0]))}
+			if nsgName, _, ok := nicNSGRules(westUS, s.NIC); ok {
+				nic.NetworkSecurityGroup = &network.SecurityGroup{ID: to.StringPtr(resourceID("Microsoft.Network/networkSecurityGroups", nsgName))}
+			}
+		}
+		planned = append(planned, plannedResource{"Microsoft.Network/networkInterfaces", s.NIC, interfacesClient.APIVersion, nic})
+	}
+	planned = append(planned, plannedResource{"Microsoft.Storage/storageAccounts", accountName, accountClient.APIVersion, storage.AccountCreateParameters{
+		Sku:      &storage.Sku{Name: storage.StandardLRS},
+		Location: to.StringPtr(westUS),
+		Tags:     tags,
+	}})
+	planned = append(planned, plannedResource{"Microsoft.Compute/virtualMachines", vmName, vmClient.APIVersion, compute.VirtualMachine{
+		Location: to.StringPtr(westUS),
+		Tags:     tags,
+		VirtualMachineProperties: &compute.VirtualMachineProperties{
+			HardwareProfile: &compute.HardwareProfile{VMSize: compute.StandardD3V2},
+		},
+	}})
+	return planned
+}
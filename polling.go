@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// pollingConfig sets how often the status of long-running operations is polled, in place of the delay
+// ARM asks for with Retry-After.
+type pollingConfig struct {
+	// Interval is the delay before the first poll of an operation, e.g. "2s", in whole seconds.
+	Interval string `json:"interval"`
+
+	// Backoff multiplies the delay after each poll, 1 when 0, e.g. 1.5 to poll less and less often.
+	Backoff float64 `json:"backoff"`
+
+	// MaxInterval caps the delay between polls, e.g. "30s", unbounded when empty.
+	MaxInterval string `json:"maxInterval"`
+}
+
+// Parsed values of config.Polling, set by validatePolling.
+var (
+	pollInterval    time.Duration
+	pollMaxInterval time.Duration
+	pollBackoff     float64
+)
+
+// polls counts the polls of each long-running operation by its status URL, to back off from. Operations
+// are forgotten a pollForget after their last poll.
+var (
+	pollsMu sync.Mutex
+	polls   = map[string]*pollCount{}
+)
+
+// pollForget is how long the poll count of an operation that is no longer polled is kept.
+const pollForget = time.Hour
+
+// pollCount is the number of polls of an operation so far.
+type pollCount struct {
+	n    int
+	last time.Time
+}
+
+// validatePolling exits unless the polling configuration is valid, and parses it.
+func validatePolling() {
+	p := config.Polling
+	if p == nil {
+		return
+	}
+	fail := func(format string, a ...interface{}) {
+		fmt.Printf("Invalid polling configuration in %s: "+format+"\n", append([]interface{}{*configPath}, a...)...)
+		os.Exit(1)
+	}
+	var err error
+	if pollInterval, err = time.ParseDuration(p.Interval); err != nil || pollInterval < time.Second {
+		fail("interval '%s' must be a duration of at least 1s", p.Interval)
+	}
+	pollMaxInterval = time.Duration(math.MaxInt64)
+	if p.MaxInterval != "" {
+		if pollMaxInterval, err = time.ParseDuration(p.MaxInterval); err != nil || pollMaxInterval < pollInterval {
+			fail("maxInterval '%s' must be a duration of at least the interval", p.MaxInterval)
+		}
+	}
+	pollBackoff = p.Backoff
+	if pollBackoff == 0 {
+		pollBackoff = 1
+	}
+	if pollBackoff < 1 {
+		fail("backoff %g can't be less than 1", p.Backoff)
+	}
+}
+
+// withPollingInterval decorates a sender to replace the Retry-After of the responses of long-running
+// operations, which the SDK waits for before polling again, with the configured polling delays. Without
+// a polling configuration, ARM's Retry-After, or else the clients' default of a minute, is used.
+func withPollingInterval(s autorest.Sender) autorest.Sender {
+	return autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+		resp, err := s.Do(r)
+		if err != nil || config.Polling == nil || resp.StatusCode >= 300 {
+			return resp, err
+		}
+		url := r.URL.String()
+		if !isPollingRequest(r) {
+			// The first response of an operation tells where to poll.
+			if url = resp.Header.Get("Azure-AsyncOperation"); url == "" && resp.StatusCode == http.StatusAccepted {
+				url = resp.Header.Get("Location")
+			}
+			if url == "" {
+				return resp, err
+			}
+		}
+		delay := nextPollDelay(strings.ToLower(url))
+		resp.Header.Set("Retry-After", strconv.Itoa(int(delay/time.Second)))
+		return resp, err
+	})
+}
+
+// nextPollDelay returns the delay before polling the operation with the status URL again.
+func nextPollDelay(url string) time.Duration {
+	pollsMu.Lock()
+	defer pollsMu.Unlock()
+	now := time.Now()
+	for u, c := range polls {
+		if now.Sub(c.last) > pollForget {
+			delete(polls, u)
+		}
+	}
+	c := polls[url]
+	if c == nil {
+		c = &pollCount{}
+		polls[url] = c
+	}
+	delay := float64(pollInterval) * math.Pow(pollBackoff, float64(c.n))
+	c.n++
+	c.last = now
+	if delay > float64(pollMaxInterval) {
+		return pollMaxInterval
+	}
+	return time.Duration(delay)
+}
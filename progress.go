@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// progressJSONL is the -progress format writing an event per line to stdout, while the text output goes to stderr.
+const progressJSONL = "jsonl"
+
+// Kinds of progress events.
+const (
+	eventStepStarted        = "stepStarted"
+	eventStepDetail         = "stepDetail"
+	eventOperationAccepted  = "operationAccepted"
+	eventOperationPolling   = "operationPolling"
+	eventOperationSucceeded = "operationSucceeded"
+	eventOperationFailed    = "operationFailed"
+	eventRunSucceeded       = "runSucceeded"
+	eventRunFailed          = "runFailed"
+)
+
+// progressEvent is a line of the -progress jsonl stream, one lifecycle transition of the run.
+type progressEvent struct {
+	Time    string `json:"time"`
+	Event   string `json:"event"`
+	Message string `json:"message,omitempty"`
+
+	// Method, ResourceID and StatusURL identify the long-running operation of operation events.
+	Method     string `json:"method,omitempty"`
+	ResourceID string `json:"resourceId,omitempty"`
+	StatusURL  string `json:"statusUrl,omitempty"`
+
+	// Status is the status of a polled operation, and Error why the operation or the run failed.
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// progressOperations are the long-running operations being followed by their lower-cased status URL,
+// to tell which resource a poll is about. progressMu also serializes the writes of the events.
+var (
+	progressMu         sync.Mutex
+	progressOperations = map[string]stateOperation{}
+)
+
+// progressOut is the stream the events are written to, the original stdout.
+var progressOut io.Writer = os.Stdout
+
+// validateProgress exits unless -progress is empty or jsonl. With jsonl, everything else printed to stdout,
+// such as tables, prompts and errors, goes to stderr instead, so that stdout only has the events.
+func validateProgress() {
+	switch *progressFormat {
+	case "":
+	case progressJSONL:
+		progressOut = os.Stdout
+		os.Stdout = os.Stderr
+	default:
+		fmt.Printf("Unknown -progress '%s', use jsonl\n", *progressFormat)
+		os.Exit(1)
+	}
+}
+
+// progressEnabled reports whether -progress jsonl is set.
+func progressEnabled() bool {
+	return *progressFormat == progressJSONL
+}
+
+// emitProgress writes a progress event to progressOut, stamped with the current time, if -progress jsonl is set.
+func emitProgress(e progressEvent) {
+	if !progressEnabled() {
+		return
+	}
+	e.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	progressOut.Write(append(b, '\n'))
+}
+
+// emitStep writes the event of a step message printed with stepf. Indented messages are details of the
+// step started last.
+func emitStep(format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	event := eventStepStarted
+	if strings.HasPrefix(msg, "\t") || strings.HasPrefix(msg, " ") {
+		event = eventStepDetail
+	}
+	if msg = strings.TrimSpace(msg); msg != "" {
+		emitProgress(progressEvent{Event: event, Message: msg})
+	}
+}
+
+// withProgressEvents decorates a sender to write the events of the long-running operations ARM accepts,
+// polls and completes when -progress jsonl is set. The body of a polling response is read and put back.
+func withProgressEvents(s autorest.Sender) autorest.Sender {
+	return autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+		resp, err := s.Do(r)
+		if err != nil || !progressEnabled() || strings.Contains(r.URL.Path, "/oauth2/") {
+			return resp, err
+		}
+		if r.Method != http.MethodGet {
+			op := stateOperation{Method: r.Method, ResourceID: r.URL.Path}
+			if op.StatusURL = resp.Header.Get("Azure-AsyncOperation"); op.StatusURL != "" {
+				op.Async = true
+			} else if resp.StatusCode == http.StatusAccepted {
+				op.StatusURL = resp.Header.Get("Location")
+			}
+			if op.StatusURL != "" && resp.StatusCode < 300 {
+				progressMu.Lock()
+				progressOperations[strings.ToLower(op.StatusURL)] = op
+				progressMu.Unlock()
+				emitProgress(operationEvent(eventOperationAccepted, op))
+			}
+			return resp, err
+		}
+
+		progressMu.Lock()
+		op, ok := progressOperations[strings.ToLower(r.URL.String())]
+		progressMu.Unlock()
+		if !ok {
+			return resp, err
+		}
+		body, readErr := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if readErr != nil {
+			return resp, err
+		}
+		var result struct {
+			Status string `json:"status"`
+			Error  *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(body, &result)
+		e := operationEvent(eventOperationSucceeded, op)
+		if e.Status = result.Status; !op.Async {
+			e.Status = resp.Status
+		}
+		switch {
+		case !operationDone(op, resp.StatusCode, body):
+			e.Event = eventOperationPolling
+			emitProgress(e)
+			return resp, err
+		case resp.StatusCode >= 300 || result.Status == "Failed" || result.Status == "Canceled":
+			e.Event = eventOperationFailed
+			e.Error = e.Status
+			if result.Error != nil && result.Error.Message != "" {
+				e.Error = result.Error.Message
+			}
+		}
+		progressMu.Lock()
+		delete(progressOperations, strings.ToLower(r.URL.String()))
+		progressMu.Unlock()
+		emitProgress(e)
+		return resp, err
+	})
+}
+
+// operationEvent returns an event of a long-running operation.
+func operationEvent(event string, op stateOperation) progressEvent {
+	return progressEvent{Event: event, Method: op.Method, ResourceID: op.ResourceID, StatusURL: op.StatusURL}
+}
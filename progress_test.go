@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestProgressStdoutOnlyHasEvents checks that with -progress jsonl the events are the only lines written
+// to stdout, and the text output goes to stderr.
+func TestProgressStdoutOnlyHasEvents(t *testing.T) {
+	dir := t.TempDir()
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr, err := os.Create(filepath.Join(dir, "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedStdout, savedStderr, savedOut, savedFormat := os.Stdout, os.Stderr, progressOut, *progressFormat
+	t.Cleanup(func() {
+		os.Stdout, os.Stderr, progressOut, *progressFormat = savedStdout, savedStderr, savedOut, savedFormat
+		stdout.Close()
+		stderr.Close()
+	})
+	os.Stdout, os.Stderr = stdout, stderr
+	*progressFormat = progressJSONL
+
+	validateProgress()
+	stepf("Create VNet '%s'\n", "vnet")
+	stepf("\tSubnet '%s'\n", "front-end")
+	fmt.Println("NAME  PRIVATE IP")
+	emitProgress(progressEvent{Event: eventRunSucceeded})
+
+	out, _ := ioutil.ReadFile(stdout.Name())
+	events := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		var e progressEvent
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("stdout has a line that isn't an event: %q", line)
+		}
+		events = append(events, e.Event+" "+e.Message)
+	}
+	want := []string{eventStepStarted + " Create VNet 'vnet'", eventStepDetail + " Subnet 'front-end'", eventRunSucceeded + " "}
+	if strings.Join(events, "\n") != strings.Join(want, "\n") {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+	if text, _ := ioutil.ReadFile(stderr.Name()); !strings.Contains(string(text), "NAME  PRIVATE IP") {
+		t.Errorf("stderr = %q, want the text output", text)
+	}
+}
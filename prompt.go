@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// stdin is shared by all prompts, so that no input buffered by one is lost to the next.
+var stdin = bufio.NewReader(os.Stdin)
+
+// prompt asks for a line of input. It returns false at the end of the input.
+func prompt(text string) (string, bool) {
+	fmt.Printf("%s> ", text)
+	line, err := stdin.ReadString('\n')
+	if err == io.EOF && line == "" {
+		fmt.Println()
+		return "", false
+	}
+	return strings.TrimSpace(line), true
+}
+
+// confirm asks whether to go ahead with a destructive operation, unless -yes was given.
+// Anything but y or yes, including the end of the input, means no.
+func confirm(question string) bool {
+	if *yes {
+		return true
+	}
+	answer, _ := prompt(question + " [y/N]")
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// tokenBucket admits requests at a steady rate, letting up to a second's worth, at least one, through at
+// once after a quiet period.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a full bucket admitting rate requests per second, or every request when rate is 0.
+func newTokenBucket(rate float64) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: math.Max(rate, 1), last: time.Now()}
+}
+
+// reserve takes a token from the bucket and returns how long to wait before it is available.
+func (b *tokenBucket) reserve() time.Duration {
+	if b.rate == 0 {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if burst := math.Max(b.rate, 1); b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// validateRateLimits exits unless -reads-per-second and -writes-per-second are valid.
+func validateRateLimits() {
+	if *readsPerSecond < 0 || *writesPerSecond < 0 {
+		fmt.Println("-reads-per-second and -writes-per-second can't be negative, use 0 for no limit")
+		os.Exit(1)
+	}
+}
+
+// withRateLimit decorates a sender to send the requests to ARM of all clients at most at -reads-per-second
+// for GETs, polling included, and -writes-per-second for the other methods, so that bulk operations stay
+// below ARM's throttling limits of the subscription instead of being answered with 429. Token requests
+// aren't limited. Closing the request's Cancel channel stops waiting.
+func withRateLimit(s autorest.Sender) autorest.Sender {
+	reads, writes := newTokenBucket(*readsPerSecond), newTokenBucket(*writesPerSecond)
+	return autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+		if strings.Contains(r.URL.Path, "/oauth2/") {
+			return s.Do(r)
+		}
+		bucket := writes
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			bucket = reads
+		}
+		if wait := bucket.reserve(); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-r.Cancel:
+				return nil, fmt.Errorf("%s %s canceled while rate limited", r.Method, r.URL)
+			}
+		}
+		return s.Do(r)
+	})
+}
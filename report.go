@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// portalURL is the prefix of the Azure portal blade of a resource, followed by its resource ID.
+const portalURL = "https://portal.azure.com/#resource"
+
+// htmlReport is the template of the HTML report. Each resource name links to its blade in the Azure portal.
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"portal":   portalLink,
+	"settings": keySettingsList,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Deployment report - {{.Group}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+code { font-size: smaller; }
+</style>
+</head>
+<body>
+<h1>Deployment report</h1>
+<ul>
+<li>Resource group: <code>{{.Group}}</code></li>
+<li>Started: {{.Started}}</li>
+<li>Duration: {{.Duration}}</li>
+<li>Resources created: {{len .Resources}}</li>
+</ul>
+<table>
+<tr><th>Name</th><th>Type</th><th>Key settings</th><th>Time taken</th><th>ID</th></tr>
+{{range .Resources}}<tr>
+<td><a href="{{portal .ID}}">{{.Name}}</a></td>
+<td>{{.Type}}</td>
+<td>{{range settings .Outputs}}{{.}}<br>{{else}}-{{end}}</td>
+<td>{{if .Duration}}{{.Duration}}{{else}}-{{end}}</td>
+<td><code>{{.ID}}</code></td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// writeReport writes a summary of the resources created by this run, e.g. to attach to a PR or change record.
+// The report is written as HTML when path ends in .html or .htm, and as Markdown otherwise.
+func writeReport(path string) {
+	stepf("Write report to '%s'\n", path)
+	started := runStarted.UTC().Format(time.RFC3339)
+	duration := time.Since(runStarted) / time.Second * time.Second
+
+	var buf bytes.Buffer
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		err := htmlReport.Execute(&buf, map[string]interface{}{
+			"Group":     groupName,
+			"Started":   started,
+			"Duration":  duration,
+			"Resources": runState.Resources,
+		})
+		onErrorFail(err, "Execute failed")
+	default:
+		fmt.Fprintf(&buf, "# Deployment report\n\n")
+		fmt.Fprintf(&buf, "- Resource group: `%s`\n", groupName)
+		fmt.Fprintf(&buf, "- Started: %s\n", started)
+		fmt.Fprintf(&buf, "- Duration: %s\n", duration)
+		fmt.Fprintf(&buf, "- Resources created: %d\n\n", len(runState.Resources))
+
+		buf.WriteString("| Name | Type | Key settings | Time taken | ID |\n")
+		buf.WriteString("|------|------|--------------|------------|----|\n")
+		for _, r := range runState.Resources {
+			duration := r.Duration
+			if duration == "" {
+				duration = "-"
+			}
+			settings := strings.Join(keySettingsList(r.Outputs), "<br>")
+			if settings == "" {
+				settings = "-"
+			}
+			fmt.Fprintf(&buf, "| [%s](%s) | %s | %s | %s | `%s` |\n",
+				markdownCell(r.Name), portalLink(r.ID), markdownCell(r.Type), markdownCell(settings), duration, r.ID)
+		}
+	}
+
+	err := ioutil.WriteFile(path, buf.Bytes(), 0644)
+	onErrorFail(err, "WriteFile failed")
+}
+
+// portalLink returns the URL of the Azure portal blade of the resource with the given ID, normalized so that
+// IDs missing their leading slash or carrying a trailing one still link to the blade.
+func portalLink(id string) string {
+	if r, err := parseID(id); err == nil {
+		id = r.String()
+	}
+	return portalURL + id
+}
+
+// keySettingsList renders the outputs of a resource as key: value pairs, sorted by key.
+func keySettingsList(outputs map[string]string) []string {
+	keys := []string{}
+	for k := range outputs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	settings := []string{}
+	for _, k := range keys {
+		settings = append(settings, fmt.Sprintf("%s: %s", k, outputs[k]))
+	}
+	return settings
+}
+
+// markdownCell escapes the characters that would break a Markdown table cell.
+func markdownCell(s string) string {
+	return strings.Replace(strings.Replace(s, "|", `\|`, -1), "\n", " ", -1)
+}
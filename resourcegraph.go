@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+)
+
+// resourceGraphAPIVersion is the API version of Resource Graph queries.
+const resourceGraphAPIVersion = "2021-03-01"
+
+// resourceGraphPageSize is the number of rows Resource Graph returns per page at most.
+const resourceGraphPageSize = 1000
+
+// nicFilter selects NICs in a Resource Graph query.
+type nicFilter struct {
+	// group limits the query to a resource group, all of the subscription's when empty.
+	group string
+
+	// unattached selects NICs attached to neither a VM nor a private endpoint.
+	unattached bool
+
+	// ip selects the NIC with this private IP, or holding the public IP with this address.
+	ip string
+
+	// tags selects NICs with all of these tags, values compared case-insensitively.
+	tags map[string]string
+}
+
+// queryResourceGraph runs a Resource Graph query over the subscription and calls row with every row of
+// the result, following the skip tokens of longer results. A single query replaces listing each resource
+// group, and Resource Graph can filter on any property.
+func queryResourceGraph(query string, row func(json.RawMessage) error) error {
+	options := map[string]interface{}{"resultFormat": "objectArray", "$top": resourceGraphPageSize}
+	for {
+		body := map[string]interface{}{
+			"subscriptions": []string{groupClient.SubscriptionID},
+			"query":         query,
+			"options":       options,
+		}
+		var result struct {
+			Data      []json.RawMessage `json:"data"`
+			SkipToken string            `json:"$skipToken"`
+		}
+		err := armRequest("POST", "/providers/Microsoft.ResourceGraph/resources", resourceGraphAPIVersion, nil, body, &result)
+		if err != nil {
+			return err
+		}
+		for _, r := range result.Data {
+			if err := row(r); err != nil {
+				return err
+			}
+		}
+		if result.SkipToken == "" {
+			return nil
+		}
+		options["$skipToken"] = result.SkipToken
+	}
+}
+
+// graphNICs lists the NICs matching filter with Resource Graph.
+func graphNICs(filter nicFilter) (network.InterfaceListResult, error) {
+	query := "Resources | where type =~ 'microsoft.network/networkinterfaces'"
+	if filter.group != "" {
+		query += " | where resourceGroup =~ " + kqlString(filter.group)
+	}
+	if filter.unattached {
+		query += " | where isnull(properties.virtualMachine) and isnull(properties.privateEndpoint)"
+	}
+	if filter.ip != "" {
+		if net.ParseIP(filter.ip) == nil {
+			return network.InterfaceListResult{}, fmt.Errorf("'%s' is not an IP address", filter.ip)
+		}
+		// A NIC holds a public IP through one of its IP configurations, whose ID starts with the NIC's.
+		holders := "Resources | where type =~ 'microsoft.network/publicipaddresses' and properties.ipAddress == " + kqlString(filter.ip) +
+			" | project nicId = tolower(split(tostring(properties.ipConfiguration.id), '/ipConfigurations/')[0])"
+		query += fmt.Sprintf(" | where tostring(properties.ipConfigurations) contains %s or tolower(id) in (%s)",
+			kqlString(`"privateIPAddress":"`+filter.ip+`"`), holders)
+	}
+	keys := []string{}
+	for k := range filter.tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		query += fmt.Sprintf(" | where tags[%s] =~ %s", kqlString(k), kqlString(filter.tags[k]))
+	}
+	query += " | project id, name, type, location, tags, properties | order by id asc"
+
+	nics := []network.Interface{}
+	err := queryResourceGraph(query, func(row json.RawMessage) error {
+		var nic network.Interface
+		err := json.Unmarshal(row, &nic)
+		nics = append(nics, nic)
+		return err
+	})
+	return network.InterfaceListResult{Value: &nics}, err
+}
+
+// graphPIPs lists the public IPs of a resource group, or of the subscription when group is empty, with Resource Graph.
+func graphPIPs(group string) (network.PublicIPAddressListResult, error) {
+	query := "Resources | where type =~ 'microsoft.network/publicipaddresses'"
+	if group != "" {
+		query += " | where resourceGroup =~ " + kqlString(group)
+	}
+	query += " | project id, name, type, location, tags, properties"
+	pips := []network.PublicIPAddress{}
+	err := queryResourceGraph(query, func(row json.RawMessage) error {
+		var pip network.PublicIPAddress
+		err := json.Unmarshal(row, &pip)
+		pips = append(pips, pip)
+		return err
+	})
+	return network.PublicIPAddressListResult{Value: &pips}, err
+}
+
+// kqlString quotes s as a string literal of the Kusto query language.
+func kqlString(s string) string {
+	return `"` + strings.Replace(strings.Replace(s, `\`, `\\`, -1), `"`, `\"`, -1) + `"`
+}
+
+// orphans lists the NICs attached to nothing, the public IPs associated with nothing and the NSGs associated
+// with no subnet or NIC, which cost money or clutter without serving anything, with a single Resource Graph
+// query over the resource group or, with -all-groups, the subscription.
+func orphans(args []string) {
+	fs := flag.NewFlagSet("orphans", flag.ExitOnError)
+	allGroups := fs.Bool("all-groups", false, "look in every resource group of the subscription")
+	fs.Parse(args)
+
+	query := `Resources
+| where (type =~ 'microsoft.network/networkinterfaces' and isnull(properties.virtualMachine) and isnull(properties.privateEndpoint))
+	or (type =~ 'microsoft.network/publicipaddresses' and isnull(properties.ipConfiguration) and isnull(properties.natGateway))
+	or (type =~ 'microsoft.network/networksecuritygroups' and isnull(properties.networkInterfaces) and isnull(properties.subnets))`
+	if !*allGroups {
+		query += "\n| where resourceGroup =~ " + kqlString(groupName)
+	}
+	query += "\n| project id, type, location | order by type asc, id asc"
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	count := 0
+	err := queryResourceGraph(query, func(row json.RawMessage) error {
+		var r struct {
+			ID       string `json:"id"`
+			Type     string `json:"type"`
+			Location string `json:"location"`
+		}
+		if err := json.Unmarshal(row, &r); err != nil {
+			return err
+		}
+		if count == 0 {
+			fmt.Fprintln(w, "TYPE\tRESOURCE GROUP\tNAME\tLOCATION")
+		}
+		count++
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Type, resourceGroupOf(&r.ID), lastSegment(&r.ID), r.Location)
+		return nil
+	})
+	onErrorFail(err, "Querying Resource Graph failed")
+	if count == 0 {
+		fmt.Println("No orphaned NICs, public IPs or NSGs")
+		return
+	}
+	w.Flush()
+}
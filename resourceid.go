@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// armID is a parsed ARM resource ID, e.g.
+// /subscriptions/{sub}/resourceGroups/{group}/providers/Microsoft.Network/virtualNetworks/{vnet}/subnets/{subnet}
+// has the namespace Microsoft.Network, the types virtualNetworks and subnets, and the names {vnet} and
+// {subnet}. The IDs of subscriptions and resource groups have no namespace.
+type armID struct {
+	Subscription  string
+	ResourceGroup string
+	Namespace     string
+	Types         []string
+	Names         []string
+}
+
+// parseID parses a resource ID. Its keywords are case-insensitive like in ARM, and its case is kept.
+func parseID(id string) (armID, error) {
+	var r armID
+	invalid := fmt.Errorf("'%s' is not an ARM resource ID", id)
+	parts := strings.Split(strings.Trim(id, "/"), "/")
+	if len(parts) < 2 || !strings.EqualFold(parts[0], "subscriptions") || parts[1] == "" {
+		return r, invalid
+	}
+	r.Subscription, parts = parts[1], parts[2:]
+	if len(parts) >= 2 && strings.EqualFold(parts[0], "resourceGroups") {
+		if parts[1] == "" {
+			return r, invalid
+		}
+		r.ResourceGroup, parts = parts[1], parts[2:]
+	}
+	if len(parts) == 0 {
+		return r, nil
+	}
+	// The rest is providers/{namespace} followed by type/name pairs.
+	if len(parts) < 4 || len(parts)%2 != 0 || !strings.EqualFold(parts[0], "providers") {
+		return r, invalid
+	}
+	r.Namespace = parts[1]
+	for i := 2; i < len(parts); i += 2 {
+		if parts[i] == "" || parts[i+1] == "" {
+			return r, invalid
+		}
+		r.Types = append(r.Types, parts[i])
+		r.Names = append(r.Names, parts[i+1])
+	}
+	return r, nil
+}
+
+// groupID returns the ID of a resource group.
+func groupID(subscription, group string) armID {
+	return armID{Subscription: subscription, ResourceGroup: group}
+}
+
+// Child returns the ID of a resource nested in this one, e.g. groupID(sub, group).Child("Microsoft.Network/virtualNetworks",
+// "vnet1") or vNet.Child("subnets", "front-end"). As in ARM templates, a type of several segments takes a
+// name of as many: Child("Microsoft.Network/virtualNetworks/subnets", "vnet1/front-end").
+func (r armID) Child(resourceType, name string) armID {
+	types := strings.Split(resourceType, "/")
+	child := armID{Subscription: r.Subscription, ResourceGroup: r.ResourceGroup, Namespace: r.Namespace}
+	if child.Namespace == "" {
+		child.Namespace, types = types[0], types[1:]
+	}
+	child.Types = append(append([]string{}, r.Types...), types...)
+	child.Names = append(append([]string{}, r.Names...), strings.Split(name, "/")...)
+	return child
+}
+
+// Parent returns the ID of the resource this one is nested in, or of its resource group.
+func (r armID) Parent() armID {
+	parent := r
+	switch {
+	case len(r.Types) > 1:
+		parent.Types, parent.Names = r.Types[:len(r.Types)-1], r.Names[:len(r.Names)-1]
+	case len(r.Types) == 1:
+		parent.Namespace, parent.Types, parent.Names = "", nil, nil
+	default:
+		parent.ResourceGroup = ""
+	}
+	return parent
+}
+
+// Type returns the full resource type, e.g. Microsoft.Network/virtualNetworks/subnets.
+func (r armID) Type() string {
+	if r.Namespace == "" {
+		if r.ResourceGroup != "" {
+			return "Microsoft.Resources/resourceGroups"
+		}
+		return "Microsoft.Resources/subscriptions"
+	}
+	return r.Namespace + "/" + strings.Join(r.Types, "/")
+}
+
+// Name returns the resource's name.
+func (r armID) Name() string {
+	switch {
+	case len(r.Names) > 0:
+		return r.Names[len(r.Names)-1]
+	case r.ResourceGroup != "":
+		return r.ResourceGroup
+	}
+	return r.Subscription
+}
+
+// NameOf returns the name following a resource type of the ID, e.g. the VNet's of a subnet ID with
+// NameOf("virtualNetworks"), or "" if the ID has no such type.
+func (r armID) NameOf(resourceType string) string {
+	for i, t := range r.Types {
+		if strings.EqualFold(t, resourceType) {
+			return r.Names[i]
+		}
+	}
+	return ""
+}
+
+// String returns the resource ID.
+func (r armID) String() string {
+	s := "/subscriptions/" + r.Subscription
+	if r.ResourceGroup != "" {
+		s += "/resourceGroups/" + r.ResourceGroup
+	}
+	if r.Namespace != "" {
+		s += "/providers/" + r.Namespace
+		for i := 0; i < len(r.Types) && i < len(r.Names); i++ {
+			s += "/" + r.Types[i] + "/" + r.Names[i]
+		}
+	}
+	return s
+}
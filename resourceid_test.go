@@ -0,0 +1,125 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseIDRoundTrip(t *testing.T) {
+	tests := []string{
+		"/subscriptions/sub",
+		"/subscriptions/sub/resourceGroups/group",
+		"/subscriptions/sub/resourceGroups/group/providers/Microsoft.Network/virtualNetworks/vnet",
+		"/subscriptions/sub/resourceGroups/group/providers/Microsoft.Network/virtualNetworks/vnet/subnets/front-end",
+		"/subscriptions/sub/providers/Microsoft.Network/networkWatchers/watcher",
+	}
+	for _, id := range tests {
+		r, err := parseID(id)
+		if err != nil {
+			t.Errorf("parseID(%q): %v", id, err)
+			continue
+		}
+		if got := r.String(); got != id {
+			t.Errorf("parseID(%q).String() = %q", id, got)
+		}
+	}
+}
+
+func TestParseID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want armID
+	}{
+		{
+			id:   "/subscriptions/sub/resourceGroups/Group",
+			want: armID{Subscription: "sub", ResourceGroup: "Group"},
+		},
+		{
+			// The keywords are case-insensitive and the case of the names is kept.
+			id: "/SUBSCRIPTIONS/sub/resourcegroups/Group/PROVIDERS/Microsoft.Network/virtualNetworks/VNet/Subnets/Front",
+			want: armID{Subscription: "sub", ResourceGroup: "Group", Namespace: "Microsoft.Network",
+				Types: []string{"virtualNetworks", "Subnets"}, Names: []string{"VNet", "Front"}},
+		},
+		{
+			// A trailing slash is ignored.
+			id: "/subscriptions/sub/resourceGroups/group/providers/Microsoft.Network/networkInterfaces/nic/",
+			want: armID{Subscription: "sub", ResourceGroup: "group", Namespace: "Microsoft.Network",
+				Types: []string{"networkInterfaces"}, Names: []string{"nic"}},
+		},
+	}
+	for _, tt := range tests {
+		got, err := parseID(tt.id)
+		if err != nil {
+			t.Errorf("parseID(%q): %v", tt.id, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseID(%q) = %+v, want %+v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestParseIDMalformed(t *testing.T) {
+	tests := []string{
+		"",
+		"/",
+		"/subscriptions",
+		"/subscriptions//resourceGroups/group",
+		"/tenants/sub",
+		"/subscriptions/sub/resourceGroups/",
+		"/subscriptions/sub/resourceGroups/group/virtualNetworks/vnet",
+		"/subscriptions/sub/resourceGroups/group/providers/Microsoft.Network",
+		"/subscriptions/sub/resourceGroups/group/providers/Microsoft.Network/virtualNetworks",
+		"/subscriptions/sub/resourceGroups/group/providers/Microsoft.Network/virtualNetworks/vnet/subnets",
+		"/subscriptions/sub/resourceGroups/group/providers/Microsoft.Network/virtualNetworks//subnets/front-end",
+	}
+	for _, id := range tests {
+		if r, err := parseID(id); err == nil {
+			t.Errorf("parseID(%q) = %+v, want an error", id, r)
+		}
+	}
+}
+
+func TestChildAndParent(t *testing.T) {
+	group := groupID("sub", "group")
+	vNet := group.Child("Microsoft.Network/virtualNetworks", "vnet")
+	subnet := vNet.Child("subnets", "front-end")
+	tests := []struct {
+		name string
+		id   armID
+		want string
+		typ  string
+	}{
+		{"group", group, "/subscriptions/sub/resourceGroups/group", "Microsoft.Resources/resourceGroups"},
+		{"vnet", vNet, "/subscriptions/sub/resourceGroups/group/providers/Microsoft.Network/virtualNetworks/vnet",
+			"Microsoft.Network/virtualNetworks"},
+		{"subnet", subnet,
+			"/subscriptions/sub/resourceGroups/group/providers/Microsoft.Network/virtualNetworks/vnet/subnets/front-end",
+			"Microsoft.Network/virtualNetworks/subnets"},
+		{"nested type", group.Child("Microsoft.Network/virtualNetworks/subnets", "vnet/front-end"),
+			"/subscriptions/sub/resourceGroups/group/providers/Microsoft.Network/virtualNetworks/vnet/subnets/front-end",
+			"Microsoft.Network/virtualNetworks/subnets"},
+		{"subnet's parent", subnet.Parent(),
+			"/subscriptions/sub/resourceGroups/group/providers/Microsoft.Network/virtualNetworks/vnet",
+			"Microsoft.Network/virtualNetworks"},
+		{"vnet's parent", vNet.Parent(), "/subscriptions/sub/resourceGroups/group", "Microsoft.Resources/resourceGroups"},
+		{"group's parent", group.Parent(), "/subscriptions/sub", "Microsoft.Resources/subscriptions"},
+	}
+	for _, tt := range tests {
+		if got := tt.id.String(); got != tt.want {
+			t.Errorf("%s: String() = %q, want %q", tt.name, got, tt.want)
+		}
+		if got := tt.id.Type(); got != tt.typ {
+			t.Errorf("%s: Type() = %q, want %q", tt.name, got, tt.typ)
+		}
+	}
+
+	// Building a child doesn't change the IDs it was built from.
+	if vNet.String() != "/subscriptions/sub/resourceGroups/group/providers/Microsoft.Network/virtualNetworks/vnet" {
+		t.Errorf("building a subnet ID changed the VNet's to %q", vNet.String())
+	}
+	if subnet.Name() != "front-end" || subnet.NameOf("VIRTUALNETWORKS") != "vnet" || subnet.NameOf("routeTables") != "" {
+		t.Errorf("subnet: Name() = %q, NameOf(VIRTUALNETWORKS) = %q, NameOf(routeTables) = %q",
+			subnet.Name(), subnet.NameOf("VIRTUALNETWORKS"), subnet.NameOf("routeTables"))
+	}
+}
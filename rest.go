@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+// genericAPIVersions are the API versions of the resource types the sample manages through genericClient,
+// keyed by lower-cased type.
+var genericAPIVersions = map[string]string{
+	"microsoft.operationalinsights/workspaces":              "2020-08-01",
+	"microsoft.insights/metricalerts":                       "2018-03-01",
+	"microsoft.authorization/locks":                         "2016-09-01",
+	"microsoft.network/bastionhosts":                        "2020-11-01",
+	"microsoft.security/locations/jitnetworkaccesspolicies": jitAPIVersion,
+}
+
+// armRequest sends a request to an ARM path the SDK has no client for, e.g. the metrics of a resource,
+// authorized like the clients' requests. query may be nil; body, if not nil, is sent as JSON and the
+// response is unmarshalled into result. A response naming a long-running operation is polled until the
+// operation completes, and result is the operation's final response.
+func armRequest(method, path, apiVersion string, query map[string]interface{}, body, result interface{}) error {
+	parameters := map[string]interface{}{"api-version": apiVersion}
+	for k, v := range query {
+		parameters[k] = v
+	}
+	decorators := []autorest.PrepareDecorator{
+		autorest.WithMethod(method),
+		autorest.WithBaseURL(genericClient.BaseURI),
+		autorest.WithPath("/" + strings.TrimPrefix(path, "/")),
+		autorest.WithQueryParameters(parameters),
+	}
+	if body != nil {
+		decorators = append(decorators, autorest.AsJSON(), autorest.WithJSON(body))
+	}
+	req, err := autorest.Prepare(&http.Request{}, decorators...)
+	if err != nil {
+		return err
+	}
+
+	resp, err := autorest.SendWithSender(genericClient, req, pollIfAsync(genericClient.PollingDelay))
+	if err != nil {
+		return err
+	}
+	responders := []autorest.RespondDecorator{
+		genericClient.ByInspecting(),
+		azure.WithErrorUnlessStatusCode(http.StatusOK, http.StatusCreated, http.StatusAccepted, http.StatusNoContent),
+	}
+	if result != nil {
+		responders = append(responders, autorest.ByUnmarshallingJSON(result))
+	}
+	return autorest.Respond(resp, append(responders, autorest.ByClosing())...)
+}
+
+// pollIfAsync polls like azure.DoPollForAsynchronous, but only responses with an Azure-AsyncOperation or
+// Location header, so that actions answering 202 with their result, e.g. a JIT access request, aren't taken
+// for operations without a polling URI.
+func pollIfAsync(delay time.Duration) autorest.SendDecorator {
+	return func(s autorest.Sender) autorest.Sender {
+		return autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+			resp, err := s.Do(r)
+			if err != nil || (resp.Header.Get("Azure-AsyncOperation") == "" && resp.Header.Get("Location") == "") {
+				return resp, err
+			}
+			// Hand the response to the poller as if it had sent the request, and let it send the polls.
+			replayed := false
+			replay := autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+				if !replayed {
+					replayed = true
+					return resp, nil
+				}
+				return s.Do(r)
+			})
+			return azure.DoPollForAsynchronous(delay)(replay).Do(r)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// retryStatusCodes are the statuses a request is retried on: those autorest retries, and 429, which ARM
+// answers when the subscription's request quota is used up.
+var retryStatusCodes = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// validateRetryFlags exits unless -retry-attempts, -retry-min-delay and -retry-max-delay are valid.
+func validateRetryFlags() {
+	switch {
+	case *retryAttempts < 0:
+		fmt.Println("-retry-attempts can't be negative")
+		os.Exit(1)
+	case *retryMinDelay <= 0:
+		fmt.Println("-retry-min-delay must be positive")
+		os.Exit(1)
+	case *retryMaxDelay < *retryMinDelay:
+		fmt.Println("-retry-max-delay can't be shorter than -retry-min-delay")
+		os.Exit(1)
+	}
+}
+
+// withRetries decorates a sender to retry requests failing with one of retryStatusCodes up to -retry-attempts
+// times. The delay before a retry doubles from -retry-min-delay up to -retry-max-delay, unless the response
+// asks for a longer one with Retry-After, still capped at -retry-max-delay. It replaces the retries of the
+// autorest clients, whose delay doubles from 30 seconds without bound. Closing the request's Cancel channel
+// stops retrying.
+func withRetries(s autorest.Sender) autorest.Sender {
+	return autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+		var body []byte
+		if r.Body != nil {
+			b, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				return nil, err
+			}
+			body = b
+		}
+		delay := *retryMinDelay
+		for attempt := 0; ; attempt++ {
+			if body != nil {
+				r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			}
+			resp, err := s.Do(r)
+			if err != nil || attempt == *retryAttempts || !autorest.ResponseHasStatusCode(resp, retryStatusCodes...) {
+				return resp, err
+			}
+			wait := delay
+			if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && time.Duration(seconds)*time.Second > wait {
+				wait = time.Duration(seconds) * time.Second
+			}
+			if wait > *retryMaxDelay {
+				wait = *retryMaxDelay
+			}
+			stepf("\t\t%s %s: %s, retrying in %s\n", r.Method, r.URL, resp.Status, wait)
+			select {
+			case <-time.After(wait):
+			case <-r.Cancel:
+				return resp, err
+			}
+			autorest.Respond(resp, autorest.ByClosing())
+			if delay *= 2; delay > *retryMaxDelay {
+				delay = *retryMaxDelay
+			}
+		}
+	})
+}
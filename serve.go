@@ -0,0 +1,329 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// apiTokenVariable is the environment variable holding the bearer token of the API, unless -token-file gives one.
+const apiTokenVariable = "NIC_API_TOKEN"
+
+// serving is set while serve answers requests, so that a helper failing with onErrorFail fails the request
+// it serves instead of exiting the server.
+var serving bool
+
+// requestFailure is what onErrorFail panics with while serving, for authenticated to answer the request with.
+type requestFailure struct {
+	message string
+	err     error
+}
+
+// nicServer serves the NIC operations of the resource group over HTTP. Changes are made one at a time, as
+// deleting a NIC may deallocate its VM.
+type nicServer struct {
+	token string
+	mu    sync.Mutex
+}
+
+// serve exposes the NICs of the resource group as a JSON API authenticated with a bearer token:
+//
+//	GET    /nics                       list the NICs and their addresses
+//	POST   /nics                       create a NIC from a body like an apply spec's NIC
+//	GET    /nics/{name}                show a NIC
+//	DELETE /nics/{name}                delete a NIC, detaching it from its VM first
+//	PUT    /nics/{name}/public-ip      attach the public IP {"publicIp": "name or resource ID"}
+//	DELETE /nics/{name}/public-ip      detach the NIC's public IP
+func serve(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8080", "address to listen on")
+	tokenFile := fs.String("token-file", "", "file holding the bearer token clients must send, or else $"+apiTokenVariable)
+	certFile := fs.String("tls-cert", "", "certificate file, to serve HTTPS with -tls-key")
+	keyFile := fs.String("tls-key", "", "private key file of -tls-cert")
+	fs.Parse(args)
+	if fs.NArg() > 0 || (*certFile == "") != (*keyFile == "") {
+		fmt.Println("Usage: serve [-addr host:port] [-token-file path] [-tls-cert file -tls-key file]")
+		os.Exit(1)
+	}
+	token := os.Getenv(apiTokenVariable)
+	if *tokenFile != "" {
+		b, err := ioutil.ReadFile(*tokenFile)
+		onErrorFail(err, "Reading the token failed")
+		token = strings.TrimSpace(string(b))
+	}
+	if token == "" {
+		fmt.Printf("Set a bearer token with -token-file or $%s\n", apiTokenVariable)
+		os.Exit(1)
+	}
+
+	s := &nicServer{token: token}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/nics", s.authenticated(s.nics))
+	mux.HandleFunc("/nics/", s.authenticated(s.nic))
+	fmt.Printf("Serving the NICs of resource group '%s' on %s\n", groupName, *addr)
+	serving = true
+	var err error
+	if *certFile != "" {
+		err = http.ListenAndServeTLS(*addr, *certFile, *keyFile, mux)
+	} else {
+		err = http.ListenAndServe(*addr, mux)
+	}
+	fmt.Printf("Serving failed: %s\n", err)
+	os.Exit(exitCode(err))
+}
+
+// authenticated rejects requests without the server's bearer token and logs the others. A request whose
+// handler fails with onErrorFail, e.g. as the state file can't be written, is answered with the error.
+func (s *nicServer) authenticated(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if v := recover(); v != nil {
+				f, ok := v.(requestFailure)
+				if !ok {
+					panic(v)
+				}
+				status := http.StatusInternalServerError
+				if _, ok := f.err.(autorest.DetailedError); ok {
+					status = errorStatus(f.err)
+				}
+				writeJSONError(w, status, fmt.Errorf("%s: %s", f.message, f.err))
+			}
+		}()
+		header := r.Header.Get("Authorization")
+		given := strings.TrimPrefix(header, "Bearer ")
+		if given == header || subtle.ConstantTimeCompare([]byte(given), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, http.StatusUnauthorized, fmt.Errorf("missing or wrong bearer token"))
+			return
+		}
+		stepf("%s %s %s\n", timestamp(), r.Method, r.URL.Path)
+		h(w, r)
+	}
+}
+
+// nics lists and creates NICs.
+func (s *nicServer) nics(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		nics, err := nicOutputs(groupName)
+		if err != nil {
+			writeJSONError(w, errorStatus(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, nics)
+	case "POST":
+		var spec nicSpec
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		status, err := createSpecNIC(spec)
+		if err != nil {
+			writeJSONError(w, status, err)
+			return
+		}
+		s.writeNIC(w, http.StatusCreated, spec.Name)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s isn't allowed on /nics", r.Method))
+	}
+}
+
+// nic shows and deletes a NIC, and attaches and detaches its public IP.
+func (s *nicServer) nic(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/nics/"), "/")
+	name := parts[0]
+	switch {
+	case len(parts) == 1 && r.Method == "GET":
+		s.writeNIC(w, http.StatusOK, name)
+	case len(parts) == 1 && r.Method == "DELETE":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if err := removeNIC(name, false); err != nil {
+			writeJSONError(w, errorStatus(err), err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 2 && parts[1] == "public-ip" && (r.Method == "PUT" || r.Method == "DELETE"):
+		var body struct {
+			PublicIP string `json:"publicIp"`
+		}
+		if r.Method == "PUT" {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.PublicIP == "" {
+				writeJSONError(w, http.StatusBadRequest, fmt.Errorf(`the body must be {"publicIp": "name or resource ID"}`))
+				return
+			}
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if status, err := setNICPublicIP(name, body.PublicIP); err != nil {
+			writeJSONError(w, status, err)
+			return
+		}
+		s.writeNIC(w, http.StatusOK, name)
+	default:
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("no route for %s %s", r.Method, r.URL.Path))
+	}
+}
+
+// writeNIC responds with the addresses of a NIC.
+func (s *nicServer) writeNIC(w http.ResponseWriter, status int, name string) {
+	nics, err := nicOutputs(groupName)
+	if err != nil {
+		writeJSONError(w, errorStatus(err), err)
+		return
+	}
+	for _, nic := range nics {
+		if strings.EqualFold(nic.Name, name) {
+			writeJSON(w, status, nic)
+			return
+		}
+	}
+	writeJSONError(w, http.StatusNotFound, fmt.Errorf("no NIC '%s'", name))
+}
+
+// createSpecNIC creates a NIC as apply does, in the location of its subnet's VNet. Its subnet may be a
+// subnet of the sample's VNet, "vnet/subnet" of the resource group, or a resource ID. It returns the HTTP
+// status matching the error.
+func createSpecNIC(spec nicSpec) (int, error) {
+	if spec.Name == "" || spec.Subnet == "" {
+		return http.StatusBadRequest, fmt.Errorf("a NIC needs a name and a subnet")
+	}
+	subnetID := spec.Subnet
+	if !strings.HasPrefix(subnetID, "/subscriptions/") {
+		if !strings.Contains(subnetID, "/") {
+			subnetID = vNetName + "/" + subnetID
+		}
+		subnetID = resourceID("Microsoft.Network/virtualNetworks/subnets", subnetID)
+	}
+	subnet, err := parseID(subnetID)
+	if err != nil || !strings.EqualFold(subnet.Type(), "Microsoft.Network/virtualNetworks/subnets") {
+		return http.StatusBadRequest, fmt.Errorf("'%s' is not the resource ID of a subnet", spec.Subnet)
+	}
+	vNet, err := vNetClient.Get(subnet.ResourceGroup, subnet.NameOf("virtualNetworks"), "")
+	if err != nil {
+		return errorStatus(err), err
+	}
+	if _, err := getSubnet(subnetID); err != nil {
+		return errorStatus(err), err
+	}
+	if existing, err := interfacesClient.Get(groupName, spec.Name, ""); err == nil {
+		return http.StatusConflict, fmt.Errorf("NIC '%s' exists", stringValue(existing.Name))
+	} else if !isNotFound(existing.Response) {
+		return errorStatus(err), err
+	}
+
+	want := desiredNIC{subnetID: subnetID, privateIP: spec.PrivateIP, ipForwarding: spec.IPForwarding, tags: spec.Tags}
+	if spec.PublicIP != "" {
+		pip, status, err := findPublicIP(spec.PublicIP)
+		if err != nil {
+			return status, err
+		}
+		want.pipID = stringValue(pip.ID)
+	}
+	if spec.NSG != "" {
+		want.nsgID = resourceID("Microsoft.Network/networkSecurityGroups", spec.NSG)
+	}
+	nic := network.Interface{
+		Location: vNet.Location,
+		InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+			IPConfigurations: &[]network.InterfaceIPConfiguration{{
+				Name:                                     to.StringPtr("ipconfig1"),
+				InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{},
+			}},
+		},
+	}
+	want.applyTo(&nic)
+	stepf("Create NIC '%s'\n", spec.Name)
+	if _, err := interfacesClient.CreateOrUpdate(groupName, spec.Name, nic, nil); err != nil {
+		return errorStatus(err), err
+	}
+	if nic, err = interfacesClient.Get(groupName, spec.Name, ""); err == nil {
+		resourceCreated("nic", interfacesClient.APIVersion, nic.ID, nic)
+	}
+	return http.StatusCreated, nil
+}
+
+// setNICPublicIP attaches a public IP of the resource group, or given by resource ID, to the NIC's primary
+// IP configuration, or detaches its public IP when pipName is empty.
+func setNICPublicIP(nicName, pipName string) (int, error) {
+	var pipRef *network.PublicIPAddress
+	if pipName == "" {
+		stepf("Detach the public IP of NIC '%s'\n", nicName)
+	} else {
+		pip, status, err := findPublicIP(pipName)
+		if err != nil {
+			return status, err
+		}
+		stepf("Attach public IP '%s' to NIC '%s'\n", pipName, nicName)
+		pipRef = &network.PublicIPAddress{ID: pip.ID}
+	}
+	noIPConfiguration := fmt.Errorf("NIC '%s' has no IP configuration", nicName)
+	_, err := patchNIC(groupName, nicName, func(nic *network.Interface) error {
+		ipConfig := primaryIPConfiguration(*nic)
+		if ipConfig == nil || ipConfig.InterfaceIPConfigurationPropertiesFormat == nil {
+			return noIPConfiguration
+		}
+		ipConfig.PublicIPAddress = pipRef
+		return nil
+	})
+	switch {
+	case err == noIPConfiguration:
+		return http.StatusConflict, err
+	case err != nil:
+		return errorStatus(err), err
+	}
+	return http.StatusOK, nil
+}
+
+// findPublicIP reads a public IP of the resource group by name, or any public IP by resource ID.
+func findPublicIP(nameOrID string) (network.PublicIPAddress, int, error) {
+	var pip network.PublicIPAddress
+	var err error
+	if strings.HasPrefix(nameOrID, "/") {
+		pip, err = getPublicIP(nameOrID)
+	} else {
+		pip, err = addressClient.Get(groupName, nameOrID, "")
+	}
+	if err != nil {
+		if isNotFound(pip.Response) {
+			return pip, http.StatusBadRequest, fmt.Errorf("no public IP '%s'", nameOrID)
+		}
+		return pip, errorStatus(err), err
+	}
+	return pip, http.StatusOK, nil
+}
+
+// errorStatus returns the HTTP status ARM answered a failed request with, or 502 when it didn't answer or
+// refused the sample's own credentials with 401 or 403, which is no fault of the server's client.
+func errorStatus(err error) int {
+	if de, ok := err.(autorest.DetailedError); ok {
+		if code, ok := de.StatusCode.(int); ok && code >= 400 && code != http.StatusUnauthorized && code != http.StatusForbidden {
+			return code
+		}
+	}
+	return http.StatusBadGateway
+}
+
+// writeJSON responds with v as JSON.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeJSONError responds with {"error": "..."}.
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// newTestServer returns the handler of the NIC API, serving the test's fake with a VNet and a NIC named nic.
+func newTestServer(t *testing.T) (http.Handler, *fakeARM) {
+	t.Helper()
+	f := newTestARM(t)
+	createTestGroup(t)
+	if _, err := vNetClient.CreateOrUpdate(groupName, "vnet", testVNet(), nil); err != nil {
+		t.Fatalf("creating the VNet: %v", err)
+	}
+	if _, err := interfacesClient.CreateOrUpdate(groupName, "nic", testNIC(), nil); err != nil {
+		t.Fatalf("creating the NIC: %v", err)
+	}
+
+	serving = true
+	t.Cleanup(func() { serving = false })
+	s := &nicServer{token: "token"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/nics", s.authenticated(s.nics))
+	mux.HandleFunc("/nics/", s.authenticated(s.nic))
+	return mux, f
+}
+
+// serveTest sends a request with the server's token and returns the response's status and error, if any.
+func serveTest(h http.Handler, method, path, body string) (int, string) {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	var answer struct {
+		Error string `json:"error"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &answer)
+	return w.Code, answer.Error
+}
+
+// seedPublicIP adds a public IP to the fake and returns its ID.
+func seedPublicIP(f *fakeARM, group, name string) string {
+	id := groupID(offlineSubscriptionID, group).Child("Microsoft.Network/publicIPAddresses", name).String()
+	f.resources[strings.ToLower(id)] = map[string]interface{}{
+		"id": id, "name": name, "type": "Microsoft.Network/publicIPAddresses", "location": westUS,
+		"properties": map[string]interface{}{"publicIPAllocationMethod": "Static", "ipAddress": "203.0.113.10"},
+	}
+	return id
+}
+
+func TestServeAttachPublicIP(t *testing.T) {
+	h, f := newTestServer(t)
+	local := seedPublicIP(f, groupName, "pip")
+	other := seedPublicIP(f, "other-group", "pip")
+
+	tests := []struct {
+		publicIP string
+		status   int
+		want     string
+	}{
+		{publicIP: "pip", status: http.StatusOK, want: local},
+		{publicIP: other, status: http.StatusOK, want: other},
+		{publicIP: "missing", status: http.StatusBadRequest, want: other},
+		{publicIP: groupID(offlineSubscriptionID, "other-group").Child("Microsoft.Network/publicIPAddresses", "missing").String(),
+			status: http.StatusBadRequest, want: other},
+	}
+	for _, tt := range tests {
+		status, msg := serveTest(h, "PUT", "/nics/nic/public-ip", `{"publicIp": "`+tt.publicIP+`"}`)
+		if status != tt.status {
+			t.Errorf("attaching %q: status %d (%s), want %d", tt.publicIP, status, msg, tt.status)
+		}
+		nic, err := interfacesClient.Get(groupName, "nic", "")
+		if err != nil {
+			t.Fatalf("getting the NIC: %v", err)
+		}
+		pip := primaryIPConfiguration(nic).PublicIPAddress
+		if pip == nil || !strings.EqualFold(to.String(pip.ID), tt.want) {
+			t.Errorf("after attaching %q the NIC's public IP is %+v, want %s", tt.publicIP, pip, tt.want)
+		}
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	h, _ := newTestServer(t)
+
+	if status, msg := serveTest(h, "GET", "/nics/missing", ""); status != http.StatusNotFound {
+		t.Errorf("GET of a missing NIC: status %d (%s), want 404", status, msg)
+	}
+	if status, msg := serveTest(h, "DELETE", "/nics/missing", ""); status != http.StatusNotFound {
+		t.Errorf("DELETE of a missing NIC: status %d (%s), want 404", status, msg)
+	}
+
+	// The state file can't be read, which fails recording the operation of the NIC's creation.
+	runningCommand = true
+	statePathSet := *statePath
+	*statePath = t.TempDir()
+	status, msg := serveTest(h, "POST", "/nics", `{"name": "new-nic", "subnet": "vnet/subnet"}`)
+	if status != http.StatusInternalServerError || !strings.Contains(msg, "ReadFile failed") {
+		t.Errorf("POST failing to read the state: status %d (%s), want 500 and the failure", status, msg)
+	}
+
+	// The server goes on answering once the state file can be read again.
+	*statePath = statePathSet
+	if status, msg := serveTest(h, "GET", "/nics", ""); status != http.StatusOK {
+		t.Errorf("GET after a failed request: status %d (%s), want 200", status, msg)
+	}
+}
+
+func TestServeAuthentication(t *testing.T) {
+	h, _ := newTestServer(t)
+
+	for _, header := range []string{"", "token", "Bearer", "Bearer other", "bearer token", "Basic token"} {
+		r := httptest.NewRequest("GET", "/nics", nil)
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: status %d, want 401", header, w.Code)
+		}
+	}
+	if status, msg := serveTest(h, "GET", "/nics", ""); status != http.StatusOK {
+		t.Errorf("GET with the token: status %d (%s), want 200", status, msg)
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{autorest.DetailedError{StatusCode: http.StatusNotFound}, http.StatusNotFound},
+		{autorest.DetailedError{StatusCode: http.StatusConflict}, http.StatusConflict},
+		{autorest.DetailedError{StatusCode: http.StatusUnauthorized}, http.StatusBadGateway},
+		{autorest.DetailedError{StatusCode: http.StatusForbidden}, http.StatusBadGateway},
+		{autorest.DetailedError{}, http.StatusBadGateway},
+		{fmt.Errorf("connection refused"), http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		if got := errorStatus(tt.err); got != tt.want {
+			t.Errorf("errorStatus(%#v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/arm/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// adminUsername is the administrator account of the VMs.
+const adminUsername = "notadmin"
+
+// linuxConfiguration returns the Linux configuration authorizing the -ssh-key public key instead of the
+// password, or nil without -ssh-key.
+func linuxConfiguration() *compute.LinuxConfiguration {
+	if *sshKeyPath == "" {
+		return nil
+	}
+	key, err := ioutil.ReadFile(*sshKeyPath)
+	onErrorFail(err, "Reading -ssh-key failed")
+	return &compute.LinuxConfiguration{
+		DisablePasswordAuthentication: to.BoolPtr(true),
+		SSH: &compute.SSHConfiguration{
+			PublicKeys: &[]compute.SSHPublicKey{
+				{
+					Path:    to.StringPtr(fmt.Sprintf("/home/%s/.ssh/authorized_keys", adminUsername)),
+					KeyData: to.StringPtr(strings.TrimSpace(string(key))),
+				},
+			},
+		},
+	}
+}
+
+// sshHost returns the name to SSH to the VM at through the public IP pipID: the -dns-zone hostname if one
+// was registered, or else the public IP's FQDN, or else its address.
+func sshHost(pipID string) string {
+	if *dnsZone != "" {
+		recordName := *dnsRecordName
+		if recordName == "" {
+			recordName = vmName
+		}
+		return recordName + "." + *dnsZone
+	}
+	pip, err := getPublicIP(pipID)
+	onErrorFail(err, "Get failed")
+	if pip.DNSSettings != nil && pip.DNSSettings.Fqdn != nil {
+		return *pip.DNSSettings.Fqdn
+	}
+	return to.String(pip.IPAddress)
+}
+
+// printSSHCommand prints the command to SSH to the VM through the public IP pipID, and copies it to the
+// clipboard with -copy-ssh.
+func printSSHCommand(pipID string) {
+	command := fmt.Sprintf("ssh %s@%s", adminUsername, sshHost(pipID))
+	if *sshKeyPath != "" {
+		command = fmt.Sprintf("ssh -i %s %s@%s", strings.TrimSuffix(*sshKeyPath, ".pub"), adminUsername, sshHost(pipID))
+	}
+	fmt.Printf("Connect to VM '%s' with: %s\n", vmName, command)
+	if *copySSH {
+		if err := copyToClipboard(command); err != nil {
+			fmt.Printf("Copying to the clipboard failed: %s\n", err)
+		} else {
+			stepf("\tCopied to the clipboard\n")
+		}
+	}
+}
+
+// copyToClipboard puts text on the clipboard with the platform's clipboard tool.
+func copyToClipboard(text string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("pbcopy")
+	case "windows":
+		cmd = exec.Command("clip")
+	default:
+		for _, tool := range [][]string{{"wl-copy"}, {"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}} {
+			if _, err := exec.LookPath(tool[0]); err == nil {
+				cmd = exec.Command(tool[0], tool[1:]...)
+				break
+			}
+		}
+		if cmd == nil {
+			return fmt.Errorf("none of wl-copy, xclip or xsel is installed")
+		}
+	}
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
+
+// waitForSSH probes TCP port 22 of the public IP pipID until the VM's SSH server answers with its banner or
+// timeout passes, and reports which happened. A VM that doesn't answer isn't a failure of the deployment, as
+// NSGs or the caller's network may block SSH on purpose.
+func waitForSSH(pipID string, timeout time.Duration) {
+	pip, err := getPublicIP(pipID)
+	onErrorFail(err, "Get failed")
+	if pip.IPAddress == nil {
+		fmt.Printf("Public IP '%s' has no address, can't check whether SSH is reachable\n", to.String(pip.Name))
+		return
+	}
+	address := net.JoinHostPort(*pip.IPAddress, "22")
+	stepf("Wait up to %s for SSH on %s\n", timeout, address)
+	start := time.Now()
+	for {
+		banner, err := sshBanner(address)
+		if err == nil {
+			fmt.Printf("VM '%s' is reachable over SSH after %s: %s\n", vmName, time.Since(start)/time.Second*time.Second, banner)
+			return
+		}
+		if time.Since(start) >= timeout {
+			fmt.Printf("VM '%s' isn't reachable over SSH on %s after %s: %s\n", vmName, address, timeout, err)
+			return
+		}
+		stepf("\tNot yet: %s\n", err)
+		time.Sleep(10 * time.Second)
+	}
+}
+
+// sshBanner connects to address and returns the identification line the SSH server sends first.
+func sshBanner(address string) (string, error) {
+	conn, err := net.DialTimeout("tcp", address, 5*time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "SSH-") {
+		return "", fmt.Errorf("port 22 answered %q, not an SSH server", line)
+	}
+	return line, nil
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/arm/compute"
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/azure-sdk-for-go/arm/resources/resources"
+	"github.com/Azure/azure-sdk-for-go/arm/storage"
+)
+
+// sampleState is what a run of the sample recorded about the resources it created,
+// in the order they were created.
+type sampleState struct {
+	ResourceGroup string `json:"resourceGroup"`
+
+	// CorrelationID is the x-ms-correlation-request-id the run sent its requests with, and Started when it started.
+	CorrelationID string          `json:"correlationId,omitempty"`
+	Started       string          `json:"started,omitempty"`
+	Resources     []stateResource `json:"resources"`
+
+	// Operations are the long-running operations ARM accepted and the run hadn't seen complete yet.
+	Operations []stateOperation `json:"operations,omitempty"`
+}
+
+// stateResource is a single resource in the state file. Body holds its configuration
+// once the whole topology has been deployed.
+type stateResource struct {
+	Type     string                 `json:"type"`
+	Name     string                 `json:"name"`
+	ID       string                 `json:"id"`
+	Duration string                 `json:"duration,omitempty"`
+	Outputs  map[string]string      `json:"outputs,omitempty"`
+	Body     map[string]interface{} `json:"body,omitempty"`
+}
+
+var (
+	// runState is the state of the current run, written to the state file after every change.
+	// Its resource group is set once the names have been resolved.
+	runState sampleState
+
+	// runStarted is when the run started, and lastRecorded when the last resource was recorded.
+	runStarted   = time.Now()
+	lastRecorded = runStarted
+
+	// stateMu serializes the updates of resources deleted concurrently.
+	stateMu sync.Mutex
+)
+
+// recordCreated adds a resource to the state file as soon as it has been created.
+func recordCreated(kind, apiVersion string, id *string, model interface{}) {
+	r := newDeployedResource(kind, apiVersion, id, model)
+	// Resources are created one after the other, so the time since the last one was recorded is the time it took.
+	now := time.Now()
+	entry := stateResource{
+		Type:     r.Type,
+		Name:     r.Name,
+		ID:       r.ID,
+		Duration: (now.Sub(lastRecorded) / time.Second * time.Second).String(),
+		Outputs:  resourceOutputs(model),
+	}
+	lastRecorded = now
+	if i := runState.find(r.ID); i >= 0 {
+		runState.Resources[i] = entry
+	} else {
+		runState.Resources = append(runState.Resources, entry)
+	}
+	writeState()
+}
+
+// recordDeleted removes a resource from the state file.
+func recordDeleted(resourceType, name string) {
+	for i, r := range runState.Resources {
+		if strings.EqualFold(r.Type, resourceType) && strings.EqualFold(r.Name, name) {
+			runState.Resources = append(runState.Resources[:i], runState.Resources[i+1:]...)
+			break
+		}
+	}
+	writeState()
+}
+
+// resourceCreated adds a created resource to the state of the current run or, when a command created it,
+// to the state file written by the last run, if there is one.
+func resourceCreated(kind, apiVersion string, id *string, model interface{}) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	if runningCommand {
+		if _, err := os.Stat(*statePath); err != nil {
+			return
+		}
+		runState = loadState()
+	}
+	recordCreated(kind, apiVersion, id, model)
+}
+
+// resourceDeleted removes a deleted resource from the state of the current run or, when a command deleted
+// it, from the state file written by the last run.
+func resourceDeleted(resourceType, name string) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	if runningCommand {
+		forgetResource(resourceType, name)
+	} else {
+		recordDeleted(resourceType, name)
+	}
+}
+
+// resourceMoved replaces the ID of a resource moved by a command in the state file written by the last run,
+// if there is one and it records the resource.
+func resourceMoved(oldID, newID string) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	if _, err := os.Stat(*statePath); err != nil {
+		return
+	}
+	runState = loadState()
+	if i := runState.find(oldID); i >= 0 {
+		runState.Resources[i].ID = newID
+		writeState()
+	}
+}
+
+// forgetResource removes a resource deleted by a command from the state file written by the last run, if there is one.
+func forgetResource(resourceType, name string) {
+	if _, err := os.Stat(*statePath); err != nil {
+		return
+	}
+	runState = loadState()
+	recordDeleted(resourceType, name)
+}
+
+// find returns the index of the resource with the given ID, or -1.
+func (s sampleState) find(id string) int {
+	for i, r := range s.Resources {
+		if strings.EqualFold(r.ID, id) {
+			return i
+		}
+	}
+	return -1
+}
+
+// writeState writes the state of the current run to the state file.
+func writeState() {
+	b, err := json.MarshalIndent(runState, "", "  ")
+	onErrorFail(err, "MarshalIndent failed")
+	err = ioutil.WriteFile(*statePath, b, 0644)
+	onErrorFail(err, "WriteFile failed")
+}
+
+// saveState records the current configuration and outputs of the deployed resources in the state file.
+func saveState() {
+	stepf("Save state to '%s'\n", *statePath)
+	for _, r := range collectDeployedResources() {
+		i := runState.find(r.ID)
+		if i < 0 {
+			runState.Resources = append(runState.Resources, stateResource{Type: r.Type, Name: r.Name, ID: r.ID})
+			i = len(runState.Resources) - 1
+		}
+		runState.Resources[i].Outputs = resourceOutputs(r.Model)
+		runState.Resources[i].Body = r.Body
+	}
+	writeState()
+}
+
+// resourceOutputs returns the values of a resource that are only known once ARM has created it.
+func resourceOutputs(model interface{}) map[string]string {
+	outputs := map[string]string{}
+	set := func(key string, value *string) {
+		if value != nil && *value != "" {
+			outputs[key] = *value
+		}
+	}
+
+	switch m := model.(type) {
+	case resources.ResourceGroup:
+		set("location", m.Location)
+	case network.VirtualNetwork:
+		if m.AddressSpace != nil && m.AddressSpace.AddressPrefixes != nil {
+			outputs["addressPrefixes"] = strings.Join(*m.AddressSpace.AddressPrefixes, ",")
+		}
+	case network.Subnet:
+		if m.SubnetPropertiesFormat != nil {
+			set("addressPrefix", m.AddressPrefix)
+		}
+	case network.PublicIPAddress:
+		if m.PublicIPAddressPropertiesFormat != nil {
+			set("ipAddress", m.IPAddress)
+			if m.DNSSettings != nil {
+				set("fqdn", m.DNSSettings.Fqdn)
+			}
+		}
+	case network.Interface:
+		if m.InterfacePropertiesFormat != nil {
+			set("macAddress", m.MacAddress)
+			if m.IPConfigurations != nil && len(*m.IPConfigurations) > 0 {
+				ipConfig := (*m.IPConfigurations)[0]
+				if ipConfig.InterfaceIPConfigurationPropertiesFormat != nil {
+					set("privateIPAddress", ipConfig.PrivateIPAddress)
+					if ipConfig.PublicIPAddress != nil {
+						set("publicIPAddressID", ipConfig.PublicIPAddress.ID)
+					}
+				}
+			}
+		}
+	case storage.Account:
+		if m.AccountProperties != nil && m.PrimaryEndpoints != nil {
+			set("blobEndpoint", m.PrimaryEndpoints.Blob)
+		}
+	case compute.VirtualMachine:
+		if m.VirtualMachineProperties != nil && m.HardwareProfile != nil {
+			outputs["vmSize"] = string(m.HardwareProfile.VMSize)
+		}
+	}
+	return outputs
+}
+
+// loadState reads the state file written by the last run.
+func loadState() sampleState {
+	var state sampleState
+	b, err := ioutil.ReadFile(*statePath)
+	onErrorFail(err, "ReadFile failed")
+	err = json.Unmarshal(b, &state)
+	onErrorFail(err, "Unmarshal failed")
+	return state
+}
+
+// stateDiff reports property-level drift between the state file and the live resources, sorted by resource
+// ID. Live resources the state doesn't record are only reported if they are of a type and name the sample
+// creates. It exits with status 1 if anything drifted, as diff does.
+func stateDiff(args []string) {
+	recorded := loadState()
+	live := map[string]deployedResource{}
+	for _, r := range collectDeployedResources() {
+		live[strings.ToLower(r.ID)] = r
+	}
+
+	reports := map[string][]string{}
+	for _, r := range recorded.Resources {
+		current, ok := live[strings.ToLower(r.ID)]
+		delete(live, strings.ToLower(r.ID))
+		if r.Body == nil {
+			// The resource group and subnets are covered by their container's configuration.
+			continue
+		}
+		if !ok {
+			reports[r.ID] = []string{fmt.Sprintf("'%s' (%s) has been deleted", r.Name, r.Type)}
+			continue
+		}
+
+		before, after := map[string]string{}, map[string]string{}
+		flattenProperties("", r.Body, before)
+		flattenProperties("", current.Body, after)
+		changes := diffProperties(before, after)
+		if len(changes) > 0 {
+			report := []string{fmt.Sprintf("Drift in '%s' (%s)", r.Name, r.Type)}
+			for _, c := range changes {
+				report = append(report, "\t"+c)
+			}
+			reports[r.ID] = report
+		}
+	}
+	names := sampleResourceNames()
+	for _, r := range live {
+		if names[strings.ToLower(r.Type+"/"+r.Name)] {
+			reports[r.ID] = []string{fmt.Sprintf("'%s' (%s) is not in the state file", r.Name, r.Type)}
+		}
+	}
+
+	if len(reports) == 0 {
+		fmt.Println("No drift detected")
+		return
+	}
+	ids := []string{}
+	for id := range reports {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return strings.ToLower(ids[i]) < strings.ToLower(ids[j]) })
+	for _, id := range ids {
+		for _, line := range reports[id] {
+			fmt.Println(line)
+		}
+	}
+	os.Exit(1)
+}
+
+// sampleResourceNames returns the types and names, as "type/name" in lower case, of the resources a run of
+// the sample creates in its resource group with its naming in the default region, whatever its flags.
+func sampleResourceNames() map[string]bool {
+	names := map[string]bool{}
+	add := func(resourceType, name string) {
+		names[strings.ToLower(resourceType+"/"+name)] = true
+	}
+	add("Microsoft.Network/virtualNetworks", vNetName)
+	for _, s := range layout {
+		add("Microsoft.Network/networkInterfaces", s.NIC)
+		add("Microsoft.Network/networkSecurityGroups", resourceName("nsg", s.Name+"-nsg", westUS, namingVars{"tier": s.Tier}))
+	}
+	if len(layout) > 0 {
+		add("Microsoft.Network/networkSecurityGroups", resourceName("nsg", layout[0].NIC+"-nsg", westUS, namingVars{"tier": layout[0].Tier}))
+	}
+	pip1Name, pip2Name := samplePIPNames()
+	add("Microsoft.Network/publicIPAddresses", pip1Name)
+	add("Microsoft.Network/publicIPAddresses", pip2Name)
+	add("Microsoft.Storage/storageAccounts", accountName)
+	add("Microsoft.Compute/virtualMachines", vmName)
+	return names
+}
+
+// flattenProperties flattens a JSON value into path/value pairs. Array elements that
+// have a name, such as subnets and ipconfigs, are keyed by name rather than index.
+func flattenProperties(path string, v interface{}, out map[string]string) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			flattenProperties(p, child, out)
+		}
+	case []interface{}:
+		for i, item := range t {
+			key := fmt.Sprint(i)
+			if m, ok := item.(map[string]interface{}); ok {
+				if name, ok := m["name"].(string); ok {
+					key = name
+				}
+			}
+			flattenProperties(fmt.Sprintf("%s[%s]", path, key), item, out)
+		}
+	default:
+		b, _ := json.Marshal(t)
+		out[path] = string(b)
+	}
+}
+
+// diffProperties describes every path whose value differs between before and after.
+func diffProperties(before, after map[string]string) []string {
+	changes := []string{}
+	for p, b := range before {
+		a, ok := after[p]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("%s: %s -> <removed>", p, b))
+		case a != b:
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", p, b, a))
+		}
+	}
+	for p, a := range after {
+		if _, ok := before[p]; !ok {
+			changes = append(changes, fmt.Sprintf("%s: <unset> -> %s", p, a))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
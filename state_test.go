@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// TestStateDiff runs state diff in a child process, as drift exits with status 1, and checks that the drift is
+// reported by resource ID and that only the resources of the sample's names are reported as unrecorded.
+func TestStateDiff(t *testing.T) {
+	if os.Getenv("TEST_STATE_DIFF") != "" {
+		runStateDiff(t)
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestStateDiff$")
+	cmd.Env = append(os.Environ(), "TEST_STATE_DIFF=1")
+	out, err := cmd.Output()
+	if e, ok := err.(*exec.ExitError); !ok || e.ExitCode() != 1 {
+		t.Fatalf("state diff exited with %v, want status 1:\n%s", err, out)
+	}
+	lines := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if !strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, "PASS") {
+			lines = append(lines, line)
+		}
+	}
+	want := []string{
+		"'nic1' (Microsoft.Network/networkInterfaces) is not in the state file",
+		"'pip1' (Microsoft.Network/publicIPAddresses) has been deleted",
+		"Drift in 'vNet' (Microsoft.Network/virtualNetworks)",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("state diff reported\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// runStateDiff is the child process of TestStateDiff. The state records the VNet with another address space
+// and a public IP that doesn't exist, and the group has a NIC of the sample and others that aren't.
+func runStateDiff(t *testing.T) {
+	newTestARM(t)
+	createTestGroup(t)
+	layout = defaultLayout
+	if _, err := vNetClient.CreateOrUpdate(groupName, vNetName, testVNet(), nil); err != nil {
+		t.Fatalf("creating the VNet: %v", err)
+	}
+	if _, err := vNetClient.CreateOrUpdate(groupName, "other-vnet", testVNet(), nil); err != nil {
+		t.Fatalf("creating the other VNet: %v", err)
+	}
+	for _, name := range []string{"nic1", "unrelated-nic"} {
+		if _, err := interfacesClient.CreateOrUpdate(groupName, name, testNIC(), nil); err != nil {
+			t.Fatalf("creating %s: %v", name, err)
+		}
+	}
+
+	for _, r := range collectDeployedResources() {
+		if r.Name == vNetName {
+			r.Body["properties"].(map[string]interface{})["addressSpace"] = map[string]interface{}{"addressPrefixes": []interface{}{"10.1.0.0/16"}}
+			runState.Resources = append(runState.Resources, stateResource{Type: r.Type, Name: r.Name, ID: r.ID, Body: r.Body})
+		}
+	}
+	runState.Resources = append(runState.Resources, stateResource{
+		Type: "Microsoft.Network/publicIPAddresses", Name: "pip1",
+		ID: resourceID("Microsoft.Network/publicIPAddresses", "pip1"), Body: map[string]interface{}{"location": westUS},
+	})
+	writeState()
+	stateDiff(nil)
+	t.Fatalf("state diff didn't exit")
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+)
+
+// azureReservedAddresses is how many addresses Azure reserves at the start of every subnet: the network
+// address, the default gateway and two for Azure DNS. It also reserves the last, broadcast address.
+const azureReservedAddresses = 4
+
+// checkStaticIP returns an error unless address may be statically assigned in subnet: it must be an IPv4
+// address inside the subnet, not one of those Azure reserves, and free according to ARM's
+// CheckIPAddressAvailability. The error for an address in use names its holder and free alternatives.
+func checkStaticIP(subnet network.Subnet, address string) error {
+	ip := net.ParseIP(address).To4()
+	if ip == nil {
+		return fmt.Errorf("'%s' is not an IPv4 address", address)
+	}
+	if subnet.SubnetPropertiesFormat == nil || subnet.AddressPrefix == nil {
+		return fmt.Errorf("subnet '%s' has no address prefix", stringValue(subnet.Name))
+	}
+	_, n, err := net.ParseCIDR(*subnet.AddressPrefix)
+	if err != nil {
+		return err
+	}
+	if !n.Contains(ip) {
+		return fmt.Errorf("address %s is outside subnet '%s' (%s)", address, stringValue(subnet.Name), *subnet.AddressPrefix)
+	}
+	ones, bits := n.Mask.Size()
+	offset := binary.BigEndian.Uint32(ip) - binary.BigEndian.Uint32(n.IP.To4())
+	if offset < azureReservedAddresses || offset == 1<<uint(bits-ones)-1 {
+		return fmt.Errorf("address %s is reserved by Azure in subnet '%s', the first usable one is %s",
+			address, stringValue(subnet.Name), addressAt(n, azureReservedAddresses))
+	}
+
+	id, err := parseID(stringValue(subnet.ID))
+	if err != nil {
+		return fmt.Errorf("subnet '%s' has no resource ID", stringValue(subnet.Name))
+	}
+	availability, err := vNetClient.CheckIPAddressAvailability(id.ResourceGroup, id.NameOf("virtualNetworks"), address)
+	if err != nil {
+		return err
+	}
+	if availability.Available != nil && *availability.Available {
+		return nil
+	}
+	holder, err := ipHolder(subnet, address)
+	if err != nil {
+		return err
+	}
+	if holder == "" {
+		holder = "a resource outside the subnet's IP configurations"
+	}
+	return fmt.Errorf("address %s in use by %s%s", address, holder, suggestions(availability))
+}
+
+// suggestions returns the free addresses ARM proposes instead of an unavailable one, as a sentence to append to an error.
+func suggestions(availability network.IPAddressAvailabilityResult) string {
+	if availability.AvailableIPAddresses == nil || len(*availability.AvailableIPAddresses) == 0 {
+		return ""
+	}
+	return ", free addresses are " + strings.Join(*availability.AvailableIPAddresses, ", ")
+}
+
+// vnetCheckIP reports whether addresses of the sample's VNet, or of the one named with -vnet, are free,
+// suggesting free ones instead of those that aren't.
+func vnetCheckIP(args []string) {
+	fs := flag.NewFlagSet("vnet check-ip", flag.ExitOnError)
+	name := fs.String("vnet", vNetName, "name of the VNet in the resource group")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fmt.Println("Usage: vnet check-ip [-vnet name] <ip>...")
+		os.Exit(1)
+	}
+
+	taken := false
+	for _, address := range fs.Args() {
+		if net.ParseIP(address).To4() == nil {
+			onErrorFail(fmt.Errorf("'%s' is not an IPv4 address", address), "Check IP failed")
+		}
+		availability, err := vNetClient.CheckIPAddressAvailability(groupName, *name, address)
+		onErrorFail(err, "CheckIPAddressAvailability failed")
+		if availability.Available != nil && *availability.Available {
+			fmt.Printf("%s is free\n", address)
+			continue
+		}
+		taken = true
+		fmt.Printf("%s is not available", address)
+		if availability.AvailableIPAddresses != nil && len(*availability.AvailableIPAddresses) > 0 {
+			fmt.Printf(", try %s", strings.Join(*availability.AvailableIPAddresses, ", "))
+		}
+		fmt.Println()
+	}
+	if taken {
+		os.Exit(1)
+	}
+}
+
+// ipHolder returns the ID of the resource, usually a NIC, whose IP configuration in subnet has the private
+// address, or "" if none has. The subnet only lists the IDs of its IP configurations, so each is read.
+func ipHolder(subnet network.Subnet, address string) (string, error) {
+	if subnet.IPConfigurations == nil {
+		return "", nil
+	}
+	for _, c := range *subnet.IPConfigurations {
+		if c.ID == nil {
+			continue
+		}
+		if c.IPConfigurationPropertiesFormat == nil || c.PrivateIPAddress == nil {
+			var ipConfig network.IPConfiguration
+			if err := armRequest("GET", *c.ID, interfacesClient.APIVersion, nil, nil, &ipConfig); err != nil {
+				return "", err
+			}
+			c = ipConfig
+		}
+		if c.IPConfigurationPropertiesFormat != nil && stringValue(c.PrivateIPAddress) == address {
+			// The IP configuration is a child resource, e.g. .../networkInterfaces/nic1/ipConfigurations/IPconfig1.
+			id, err := parseID(*c.ID)
+			if err != nil {
+				return "", err
+			}
+			return id.Parent().String(), nil
+		}
+	}
+	return "", nil
+}
+
+// addressAt returns the IPv4 address offset addresses into the network n.
+func addressAt(n *net.IPNet, offset uint32) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, binary.BigEndian.Uint32(n.IP.To4())+offset)
+	return ip
+}
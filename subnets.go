@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/azure-sdk-for-go/arm/resources/resources"
+)
+
+// subnetAPIVersion is the first network API version of subnet delegations, which the SDK's 2016-09-01
+// models don't have, nor service endpoints, so such subnets are created as generic resources.
+const subnetAPIVersion = "2018-08-01"
+
+// subnetLayout is a subnet of the sample's VNet and the NIC placed into it.
+type subnetLayout struct {
+	Name string `json:"name"`
+
+	// AddressPrefix is the subnet's prefix. Subnets without one are given a /Size, a /24 when Size is
+	// zero, by the planner, around the prefixes of the other subnets.
+	AddressPrefix string `json:"addressPrefix"`
+	Size          int    `json:"size"`
+
+	// NIC is the name of the NIC placed into the subnet, nic{seq} when empty. The first subnet's NIC is
+	// the VM's primary NIC.
+	NIC string `json:"nic"`
+
+	// PrivateIP statically assigns this address to the NIC, whose private IP is allocated dynamically when empty.
+	PrivateIP string `json:"privateIp"`
+
+	// Tier is the value of the {{tier}} placeholder, the subnet's name in lower case when empty.
+	Tier string `json:"tier"`
+
+	// NSG associates a network security group with the subnet, as -nsg subnet does for every subnet.
+	// AllowInbound are the TCP ports the NSG opens to the Internet.
+	NSG          bool     `json:"nsg"`
+	AllowInbound []string `json:"allowInbound"`
+
+	// Delegations are the services the subnet is delegated to, e.g. "Microsoft.Web/serverFarms".
+	// No NIC is placed into a delegated subnet.
+	Delegations []string `json:"delegations"`
+
+	// ServiceEndpoints are the services reachable from the subnet over the Azure backbone, e.g. "Microsoft.Storage".
+	ServiceEndpoints []string `json:"serviceEndpoints"`
+}
+
+// defaultLayout is the front-end, mid-tier and back-end layout used when the configuration file has no subnets.
+var defaultLayout = []subnetLayout{
+	{Name: "Front-end", AddressPrefix: "172.16.1.0/24", NIC: "nic1", Tier: "front-end", AllowInbound: []string{"22", "80"}},
+	{Name: "Mid-tier", AddressPrefix: "172.16.2.0/24", NIC: "nic2", Tier: "mid-tier"},
+	{Name: "Back-end", AddressPrefix: "172.16.3.0/24", NIC: "nic3", Tier: "back-end"},
+}
+
+// layout is the subnets of the sample's VNet, with their names resolved by applyNaming.
+var layout []subnetLayout
+
+// resolveLayout returns the configured subnets, or the default ones, with their subnet and NIC names
+// resolved from the naming templates and the delegations of SubnetDelegations merged in.
+func resolveLayout() []subnetLayout {
+	subnets := config.Subnets
+	if len(subnets) == 0 {
+		subnets = defaultLayout
+	}
+	resolved := []subnetLayout{}
+	nicNames := map[string]bool{}
+	for i, s := range subnets {
+		if s.Name == "" {
+			fmt.Printf("Subnet %d in %s needs a name\n", i+1, *configPath)
+			os.Exit(1)
+		}
+		if s.Tier == "" {
+			s.Tier = strings.ToLower(s.Name)
+		}
+		if s.NIC == "" {
+			s.NIC = fmt.Sprintf("nic%d", i+1)
+		}
+		vars := namingVars{"tier": s.Tier, "seq": fmt.Sprint(i + 1)}
+		s.Name = resourceName("subnet", s.Name, westUS, vars)
+		s.NIC = resourceName("nic", s.NIC, westUS, vars)
+		if nicNames[s.NIC] {
+			fmt.Printf("NIC name '%s' is used by more than one subnet\n", s.NIC)
+			os.Exit(1)
+		}
+		nicNames[s.NIC] = true
+		s.Delegations = append(append([]string{}, s.Delegations...), config.SubnetDelegations[s.Name]...)
+		resolved = append(resolved, s)
+	}
+	return resolved
+}
+
+// createGenericSubnet creates a subnet with delegations or service endpoints, associated with nsg unless it is nil.
+func createGenericSubnet(vNetName string, s subnetLayout, nsg *network.SecurityGroup) {
+	properties := map[string]interface{}{
+		"addressPrefix": s.AddressPrefix,
+	}
+	if len(s.Delegations) > 0 {
+		stepf("\t\tDelegate subnet '%s' to %s\n", s.Name, strings.Join(s.Delegations, ", "))
+		delegations := []interface{}{}
+		for i, service := range s.Delegations {
+			delegations = append(delegations, map[string]interface{}{
+				"name":       fmt.Sprintf("delegation%d", i),
+				"properties": map[string]interface{}{"serviceName": service},
+			})
+		}
+		properties["delegations"] = delegations
+	}
+	if len(s.ServiceEndpoints) > 0 {
+		stepf("\t\tEnable service endpoints for %s\n", strings.Join(s.ServiceEndpoints, ", "))
+		endpoints := []interface{}{}
+		for _, service := range s.ServiceEndpoints {
+			endpoints = append(endpoints, map[string]interface{}{"service": service})
+		}
+		properties["serviceEndpoints"] = endpoints
+	}
+	if nsg != nil {
+		properties["networkSecurityGroup"] = map[string]interface{}{"id": *nsg.ID}
+	}
+
+	client := genericClient
+	client.APIVersion = subnetAPIVersion
+	id := strings.TrimPrefix(resourceID("Microsoft.Network/virtualNetworks/subnets", vNetName+"/"+s.Name), "/")
+	_, err := client.CreateOrUpdateByID(id, resources.GenericResource{Properties: &properties}, nil)
+	onErrorFail(err, "\tCreateOrUpdateByID failed")
+}
+
+// hasNIC reports whether a NIC of the given name is among nics.
+func hasNIC(nics []network.Interface, name string) bool {
+	for _, nic := range nics {
+		if nic.Name != nil && *nic.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// tagsAPIVersion is a network API version with the UpdateTags PATCH, which the SDK's 2016-09-01 clients lack.
+const tagsAPIVersion = "2018-08-01"
+
+// tagList collects repeated key=value flags.
+type tagList map[string]string
+
+func (t tagList) String() string {
+	pairs := []string{}
+	for k, v := range t {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (t tagList) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("tag '%s' isn't of the form key=value", value)
+	}
+	t[kv[0]] = kv[1]
+	return nil
+}
+
+// sampleTags returns the tags of the configuration file merged with -tag.
+func sampleTags() map[string]string {
+	tags := map[string]string{}
+	for k, v := range config.Tags {
+		tags[k] = v
+	}
+	for k, v := range tagFlags {
+		tags[k] = v
+	}
+	return tags
+}
+
+// resourceTags returns the tags to stamp on a resource, or nil if there are none.
+func resourceTags() *map[string]*string {
+	tags := sampleTags()
+	if len(tags) == 0 {
+		return nil
+	}
+	result := map[string]*string{}
+	for k, v := range tags {
+		value := v
+		result[k] = &value
+	}
+	return &result
+}
+
+// validateTags exits unless every required tag has a non-empty value. Tag keys are case-insensitive in Azure.
+func validateTags() {
+	given := map[string]bool{}
+	for k, v := range sampleTags() {
+		if v != "" {
+			given[strings.ToLower(k)] = true
+		}
+	}
+	missing := []string{}
+	for _, k := range config.RequiredTags {
+		if !given[strings.ToLower(k)] {
+			missing = append(missing, k)
+		}
+	}
+	if len(missing) > 0 {
+		fmt.Printf("Missing required tags: %s. Set them in the tags of %s or with -tag key=value\n", strings.Join(missing, ", "), *configPath)
+		os.Exit(1)
+	}
+}
+
+// updateTags replaces the tags of a network resource with a PATCH, which unlike a PUT of the whole resource
+// leaves its other properties alone and doesn't reprovision it.
+func updateTags(id string, tags *map[string]*string) error {
+	if tags == nil {
+		tags = &map[string]*string{}
+	}
+	return armRequest("PATCH", id, tagsAPIVersion, nil, map[string]interface{}{"tags": tags}, nil)
+}
+
+// nicTag sets tags of a NIC with key=value and removes them with key-, printing the NIC's tags afterwards.
+func nicTag(args []string) {
+	if len(args) < 2 {
+		fmt.Println("Usage: nic tag <name> key=value... key-...")
+		os.Exit(1)
+	}
+	nic, err := interfacesClient.Get(groupName, args[0], "")
+	onErrorFail(err, "Get failed")
+	tags := map[string]*string{}
+	if nic.Tags != nil {
+		for k, v := range *nic.Tags {
+			tags[k] = v
+		}
+	}
+	for _, a := range args[1:] {
+		kv := strings.SplitN(a, "=", 2)
+		remove := len(kv) == 1 && strings.HasSuffix(a, "-")
+		key := kv[0]
+		if remove {
+			key = strings.TrimSuffix(key, "-")
+		}
+		if !remove && len(kv) != 2 || key == "" {
+			fmt.Printf("Tag '%s' isn't of the form key=value or key-\n", a)
+			os.Exit(1)
+		}
+		// Tag keys are case-insensitive, so a key set in another case replaces the existing tag.
+		for k := range tags {
+			if strings.EqualFold(k, key) {
+				delete(tags, k)
+			}
+		}
+		if !remove {
+			value := kv[1]
+			tags[key] = &value
+		}
+	}
+
+	stepf("Update the tags of NIC '%s'\n", args[0])
+	onErrorFail(updateTags(*nic.ID, &tags), "UpdateTags failed")
+	pairs := tagList{}
+	for k, v := range tags {
+		pairs[k] = stringValue(v)
+	}
+	if len(pairs) == 0 {
+		fmt.Printf("NIC '%s' has no tags\n", args[0])
+	} else {
+		fmt.Printf("NIC '%s' tags: %s\n", args[0], pairs)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/arm/dns"
+)
+
+// deletionOrder ranks resource types so that dependents are deleted before what they depend on.
+var deletionOrder = map[string]int{
+	"microsoft.authorization/locks":                            -1,
+	"microsoft.insights/metricalerts":                          0,
+	"microsoft.network/dnszones/a":                             0,
+	"microsoft.network/bastionhosts":                           0,
+	"microsoft.security/locations/jitnetworkaccesspolicies":    0,
+	"microsoft.compute/virtualmachines":                        0,
+	"microsoft.network/networkinterfaces":                      1,
+	"microsoft.network/publicipaddresses":                      2,
+	"microsoft.network/virtualnetworks/virtualnetworkpeerings": 3,
+	"microsoft.network/virtualnetworks/subnets":                3,
+	"microsoft.network/virtualnetworks":                        4,
+	"microsoft.network/networksecuritygroups":                  5,
+	"microsoft.storage/storageaccounts":                        5,
+	"microsoft.operationalinsights/workspaces":                 5,
+	"microsoft.network/dnszones":                               5,
+	"microsoft.resources/resourcegroups":                       6,
+}
+
+// byDeletionOrder sorts resources by deletionOrder.
+type byDeletionOrder []stateResource
+
+func (s byDeletionOrder) Len() int      { return len(s) }
+func (s byDeletionOrder) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byDeletionOrder) Less(i, j int) bool {
+	return deletionOrder[strings.ToLower(s[i].Type)] < deletionOrder[strings.ToLower(s[j].Type)]
+}
+
+// rollingBack is set while rollback runs, so a failure during the rollback doesn't start another one.
+var rollingBack bool
+
+// rollback deletes the resources created by this run, dependents first, leaving anything
+// that already existed before the run untouched. A failing command rolls nothing back: the state it
+// updates is the last run's, whose resources the command didn't create.
+func rollback() {
+	if rollingBack || runningCommand || len(runState.Resources) == 0 {
+		return
+	}
+	rollingBack = true
+	if circuit.isOpen() {
+		fmt.Printf("ARM keeps failing, so the resources are left in place, they are recorded in '%s'\n", *statePath)
+		return
+	}
+	if !confirm("Roll back the resources created in this run?") {
+		fmt.Printf("Leaving the resources in place, they are recorded in '%s'\n", *statePath)
+		return
+	}
+	stepf("Rolling back the resources created in this run\n")
+
+	for _, r := range runState.Resources {
+		if strings.EqualFold(r.Type, resourceTypes["group"]) {
+			// The whole group is ours, so deleting it takes everything else with it but what lives elsewhere.
+			deleteResources(append(outsideGroup(runState.Resources), r))
+			return
+		}
+	}
+	deleteResources(runState.Resources)
+}
+
+// deleteSampleResources deletes the resources created by this run one by one, preserving the
+// resource group and anything else in it.
+func deleteSampleResources() {
+	stepf("Deleting the sample's resources, keeping resource group '%s'\n", groupName)
+	created := []stateResource{}
+	for _, r := range runState.Resources {
+		if !strings.EqualFold(r.Type, resourceTypes["group"]) {
+			created = append(created, r)
+		}
+	}
+	deleteResources(created)
+}
+
+// outsideGroup returns the resources that live outside the sample's resource group, e.g. a DNS record in
+// a zone of another group, which deleting the group leaves behind.
+func outsideGroup(created []stateResource) []stateResource {
+	prefix := strings.ToLower(resourceID("", "") + "/")
+	outside := []stateResource{}
+	for _, r := range created {
+		if !strings.EqualFold(r.Type, resourceTypes["group"]) && !strings.HasPrefix(strings.ToLower(r.ID), prefix) {
+			outside = append(outside, r)
+		}
+	}
+	return outside
+}
+
+// deleteResources deletes the given resources in dependency order and removes them from the state file.
+// Resources of the same rank of deletionOrder, e.g. the VMs, then the NICs, don't depend on each other and
+// are deleted concurrently, but for children of the same parent, e.g. the subnets of a VNet, which ARM
+// changes one at a time. Each result is reported as it comes in, and failures don't stop the remaining
+// deletions.
+func deleteResources(created []stateResource) {
+	ordered := make([]stateResource, len(created))
+	copy(ordered, created)
+	// Reverse the creation order first, so that resources of the same type go newest first.
+	for i, j := 0, len(ordered)-1; i < j; i, j = i+1, j-1 {
+		ordered[i], ordered[j] = ordered[j], ordered[i]
+	}
+	sort.Stable(byDeletionOrder(ordered))
+
+	deleted := 0
+	for start := 0; start < len(ordered); {
+		end := start + 1
+		for end < len(ordered) && !byDeletionOrder(ordered).Less(start, end) {
+			end++
+		}
+		deleted += deleteWave(ordered[start:end])
+		start = end
+	}
+	if len(ordered) > 1 {
+		stepf("\tDeleted %d of %d resources\n", deleted, len(ordered))
+	}
+}
+
+// deleteWave deletes resources that don't depend on each other concurrently, those of the same parent
+// one after the other, removes the deleted ones from the state file and returns how many were deleted.
+func deleteWave(wave []stateResource) int {
+	for _, r := range wave {
+		if !strings.EqualFold(r.Type, lockType) {
+			unlockFor(r.ID)
+		}
+	}
+	// Resources are queued by their parent, or by their own ID if they are top-level.
+	queues := map[string][]stateResource{}
+	keys := []string{}
+	for _, r := range wave {
+		key := strings.ToLower(r.ID)
+		if id, err := parseID(r.ID); err == nil && strings.Count(r.Type, "/") > 1 {
+			key = strings.ToLower(id.Parent().String())
+		}
+		if _, ok := queues[key]; !ok {
+			keys = append(keys, key)
+		}
+		queues[key] = append(queues[key], r)
+	}
+
+	deleted := 0
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		wg.Add(1)
+		go func(queue []stateResource) {
+			defer wg.Done()
+			for _, r := range queue {
+				stepf("\tDelete %s '%s'\n", r.Type, r.Name)
+				start := time.Now()
+				err := deleteResource(r)
+				elapsed := time.Since(start) / time.Second * time.Second
+
+				mu.Lock()
+				if err != nil {
+					fmt.Printf("\tDeleting %s '%s' failed after %s: %s\n", r.Type, r.Name, elapsed, err)
+				} else {
+					stepf("\tDeleted %s '%s' in %s\n", r.Type, r.Name, elapsed)
+					deleted++
+					stateMu.Lock()
+					if strings.EqualFold(r.Type, resourceTypes["group"]) {
+						runState.Resources = nil
+						writeState()
+					} else {
+						recordDeleted(r.Type, r.Name)
+					}
+					stateMu.Unlock()
+				}
+				mu.Unlock()
+			}
+		}(queues[key])
+	}
+	wg.Wait()
+	return deleted
+}
+
+// deleteResource deletes a single resource recorded in the state file. Locks on it must have been
+// removed with unlockFor.
+func deleteResource(r stateResource) error {
+	var err error
+	switch strings.ToLower(r.Type) {
+	case "microsoft.compute/virtualmachines":
+		_, err = vmClient.Delete(groupName, r.Name, nil)
+	case "microsoft.network/networkinterfaces":
+		_, err = interfacesClient.Delete(groupName, r.Name, nil)
+	case "microsoft.network/publicipaddresses":
+		_, err = addressClient.Delete(groupName, r.Name, nil)
+	case "microsoft.network/virtualnetworks/subnets":
+		id, _ := parseID(r.ID)
+		_, err = subnetClient.Delete(groupName, id.NameOf("virtualNetworks"), r.Name, nil)
+	case "microsoft.network/virtualnetworks/virtualnetworkpeerings":
+		id, _ := parseID(r.ID)
+		_, err = peeringClient.Delete(groupName, id.NameOf("virtualNetworks"), r.Name, nil)
+	case "microsoft.network/virtualnetworks":
+		_, err = vNetClient.Delete(groupName, r.Name, nil)
+	case "microsoft.network/networksecuritygroups":
+		_, err = nsgClient.Delete(groupName, r.Name, nil)
+	case "microsoft.network/dnszones/a":
+		// Record IDs end in .../dnszones/{zoneName}/A/{recordName}, and the zone may be in another group.
+		id, _ := parseID(r.ID)
+		_, err = recordSetClient.Delete(id.ResourceGroup, id.NameOf("dnszones"), r.Name, dns.A, "")
+	case "microsoft.network/dnszones":
+		_, err = zoneClient.Delete(groupName, r.Name, "", nil)
+	case "microsoft.storage/storageaccounts":
+		_, err = accountClient.Delete(groupName, r.Name)
+	case "microsoft.operationalinsights/workspaces", "microsoft.insights/metricalerts", "microsoft.authorization/locks",
+		"microsoft.network/bastionhosts", "microsoft.security/locations/jitnetworkaccesspolicies":
+		client := genericClient
+		client.APIVersion = genericAPIVersions[strings.ToLower(r.Type)]
+		_, err = client.DeleteByID(strings.TrimPrefix(r.ID, "/"), nil)
+	case "microsoft.resources/resourcegroups":
+		_, err = groupClient.Delete(r.Name, nil)
+	default:
+		err = fmt.Errorf("don't know how to delete resources of type %s", r.Type)
+	}
+	return err
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// TestFailedCommandDeletesNothing runs a command failing after it updated the state file of the last run,
+// in a child process as the failure exits, and checks that none of the last run's resources were deleted.
+func TestFailedCommandDeletesNothing(t *testing.T) {
+	if os.Getenv("TEST_FAILED_COMMAND_STORE") != "" {
+		runFailingCommand(t)
+		return
+	}
+
+	f := newTestARM(t)
+	store := filepath.Join(t.TempDir(), "sample-offline.json")
+	f.path = store
+	createTestGroup(t)
+	if _, err := vNetClient.CreateOrUpdate(groupName, "vnet", testVNet(), nil); err != nil {
+		t.Fatalf("creating the VNet: %v", err)
+	}
+	groupID := "/subscriptions/" + offlineSubscriptionID + "/resourceGroups/" + groupName
+	runState = sampleState{ResourceGroup: groupName, Resources: []stateResource{
+		{Type: resourceTypes["group"], Name: groupName, ID: groupID},
+		{Type: "Microsoft.Network/virtualNetworks", Name: "vnet", ID: groupID + "/providers/Microsoft.Network/virtualNetworks/vnet"},
+	}}
+	writeState()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestFailedCommandDeletesNothing$")
+	cmd.Env = append(os.Environ(), "TEST_FAILED_COMMAND_STORE="+store, "TEST_FAILED_COMMAND_STATE="+*statePath)
+	out, err := cmd.CombinedOutput()
+	if _, ok := err.(*exec.ExitError); !ok {
+		t.Fatalf("the failing command exited with %v, want a failure:\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "Get failed") {
+		t.Fatalf("the command didn't fail getting the NIC:\n%s", out)
+	}
+
+	after := newFakeARM(store)
+	for _, id := range []string{groupID, groupID + "/providers/Microsoft.Network/virtualNetworks/vnet"} {
+		if after.resources[strings.ToLower(id)] == nil {
+			t.Errorf("%s was deleted by the failing command:\n%s", id, out)
+		}
+	}
+}
+
+// runFailingCommand is the child process of TestFailedCommandDeletesNothing. It starts a long-running
+// operation, which loads the last run's state, then shows a NIC that doesn't exist, with -yes set so
+// that a rollback wouldn't ask before deleting.
+func runFailingCommand(t *testing.T) {
+	*offline = true
+	*offlineStore = os.Getenv("TEST_FAILED_COMMAND_STORE")
+	*statePath = os.Getenv("TEST_FAILED_COMMAND_STATE")
+	*yes = true
+	groupName = "test-group"
+	createClients(offlineSubscriptionID, autorest.NullAuthorizer{}, newSender())
+
+	runningCommand = true
+	if _, err := vNetClient.CreateOrUpdate(groupName, "other-vnet", testVNet(), nil); err != nil {
+		t.Fatalf("creating another VNet: %v", err)
+	}
+	if len(runState.Resources) == 0 {
+		t.Fatalf("the operation didn't load the state of the last run")
+	}
+	nicShow([]string{"missing"})
+	t.Fatalf("showing a missing NIC didn't fail")
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Azure/azure-sdk-for-go/arm/compute"
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/azure-sdk-for-go/arm/resources/resources"
+	"github.com/Azure/azure-sdk-for-go/arm/storage"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// Engines creating the sample's topology with -engine.
+const (
+	engineSDK      = "sdk"
+	engineTemplate = "template"
+)
+
+// templateDeploymentName is the name of the ARM deployment of -engine template in the resource group.
+const templateDeploymentName = "network-interface-sample"
+
+// validateEngine exits unless -engine is one of the engines and the template engine is given only
+// options it can declare.
+func validateEngine() {
+	switch *engine {
+	case engineSDK:
+		if *whatIf {
+			fmt.Println("-what-if previews template deployments, use it with -engine template or see the plan command")
+			os.Exit(1)
+		}
+		return
+	case engineTemplate:
+	default:
+		fmt.Printf("Unknown -engine '%s', use sdk or template\n", *engine)
+		os.Exit(1)
+	}
+	unsupported := ""
+	switch {
+	case *bastion:
+		unsupported = "-bastion"
+	case *jit:
+		unsupported = "-jit"
+	case *multiRegion:
+		unsupported = "-multi-region"
+	case *pipTier != "":
+		unsupported = "-pip-tier"
+	}
+	for _, s := range layout {
+		if len(s.Delegations) > 0 || len(s.ServiceEndpoints) > 0 {
+			unsupported = "subnets with delegations or service endpoints"
+		}
+	}
+	if unsupported != "" {
+		fmt.Printf("-engine template doesn't support %s, use -engine sdk\n", unsupported)
+		os.Exit(1)
+	}
+}
+
+// deployTemplate creates the VNet, NSGs, public IPs, NICs, storage account and VM the SDK engine creates one
+// call at a time with a single ARM deployment of a template assembled from the same SDK models, and returns
+// the NICs and the front-end NIC's public IP. ARM orders the resources by their dependsOn and creates
+// independent ones in parallel. With -what-if, the changes the deployment makes are shown for confirmation first.
+func deployTemplate(location, pip1Name, pip2Name string) ([]network.Interface, network.PublicIPAddress) {
+	t := topologyTemplate(location, pip1Name, pip2Name, templateResourceID)
+	deployment := t.deployment()
+	stepf("Validate the template of %d resources\n", len(t.resources))
+	validation, err := deploymentsClient.Validate(groupName, templateDeploymentName, deployment)
+	onErrorFail(err, "Validate failed")
+	if validation.Error != nil {
+		onErrorFail(fmt.Errorf("%s: %s", stringValue(validation.Error.Code), stringValue(validation.Error.Message)), "Validate failed")
+	}
+	if *whatIf {
+		changes, err := whatIfChanges(deployment)
+		onErrorFail(err, "What-If failed")
+		printWhatIf(changes)
+		if !confirm("Deploy these changes?") {
+			fmt.Println("Nothing deployed")
+			os.Exit(exitCancelled)
+		}
+	}
+	stepf("Deploy the template as deployment '%s'\n", templateDeploymentName)
+	_, err = deploymentsClient.CreateOrUpdate(groupName, templateDeploymentName, deployment, nil)
+	onErrorFail(err, "CreateOrUpdate failed")
+
+	// Record the deployed resources as the SDK engine does, for the state file, outputs and reports.
+	for _, name := range t.nsgNames {
+		nsg, err := nsgClient.Get(groupName, name, "")
+		onErrorFail(err, "Get failed")
+		recordCreated("nsg", nsgClient.APIVersion, nsg.ID, nsg)
+	}
+	if !useExistingNetwork() {
+		vNet, err := vNetClient.Get(groupName, vNetName, "")
+		onErrorFail(err, "Get failed")
+		recordCreated("vnet", vNetClient.APIVersion, vNet.ID, vNet)
+		for _, s := range layout {
+			subnet, err := subnetClient.Get(groupName, vNetName, s.Name, "")
+			onErrorFail(err, "Get failed")
+			recordCreated("subnet", subnetClient.APIVersion, subnet.ID, subnet)
+		}
+	}
+	pip2 := existingPIP
+	for _, name := range t.pipNames {
+		pip, err := addressClient.Get(groupName, name, "")
+		onErrorFail(err, "Get failed")
+		recordCreated("pip", addressClient.APIVersion, pip.ID, pip)
+		if name == pip2Name {
+			pip2 = pip
+		}
+	}
+	nics := []network.Interface{}
+	for _, s := range layout {
+		nic, err := interfacesClient.Get(groupName, s.NIC, "")
+		onErrorFail(err, "Get failed")
+		recordCreated("nic", interfacesClient.APIVersion, nic.ID, nic)
+		nics = append(nics, nic)
+	}
+	account, err := accountClient.GetProperties(groupName, accountName)
+	onErrorFail(err, "GetProperties failed")
+	recordCreated("storage", accountClient.APIVersion, account.ID, account)
+	vm, err := vmClient.Get(groupName, vmName, "")
+	onErrorFail(err, "Get failed")
+	recordCreated("vm", vmClient.APIVersion, vm.ID, vm)
+	return nics, pip2
+}
+
+// topologyTemplate assembles the sample's topology from the SDK models the SDK engine sends, with the
+// resources referring to each other by the IDs idOf returns, template expressions for a deployment. The
+// front-end NIC is declared with its final public IP, the second one, instead of being updated with it
+// once the VM exists.
+func topologyTemplate(location, pip1Name, pip2Name string, idOf func(resourceType string, names ...string) string) *armTemplate {
+	t := &armTemplate{}
+	tags := resourceTags()
+
+	addNSG := func(name string, rules []network.SecurityRule) string {
+		t.add("Microsoft.Network/networkSecurityGroups", nsgClient.APIVersion, name, network.SecurityGroup{
+			Location:                      to.StringPtr(location),
+			Tags:                          tags,
+			SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{SecurityRules: &rules},
+		})
+		t.nsgNames = append(t.nsgNames, name)
+		return idOf("Microsoft.Network/networkSecurityGroups", name)
+	}
+
+	subnetIDs := []string{}
+	if useExistingNetwork() {
+		for _, s := range existingSubnets {
+			subnetIDs = append(subnetIDs, stringValue(s.ID))
+		}
+	} else {
+		subnets := []network.Subnet{}
+		dependsOn := []string{}
+		for _, s := range layout {
+			subnet := network.Subnet{
+				Name:                   to.StringPtr(s.Name),
+				SubnetPropertiesFormat: &network.SubnetPropertiesFormat{AddressPrefix: to.StringPtr(s.AddressPrefix)},
+			}
+			if name, rules, ok := subnetNSGRules(location, s); ok {
+				id := addNSG(name, rules)
+				subnet.NetworkSecurityGroup = &network.SecurityGroup{ID: to.StringPtr(id)}
+				dependsOn = append(dependsOn, id)
+			}
+			subnets = append(subnets, subnet)
+			subnetIDs = append(subnetIDs, idOf("Microsoft.Network/virtualNetworks/subnets", vNetName, s.Name))
+		}
+		t.add("Microsoft.Network/virtualNetworks", vNetClient.APIVersion, vNetName, network.VirtualNetwork{
+			Location: to.StringPtr(location),
+			Tags:     tags,
+			VirtualNetworkPropertiesFormat: &network.VirtualNetworkPropertiesFormat{
+				AddressSpace: &network.AddressSpace{AddressPrefixes: &addressSpace},
+				DhcpOptions:  dhcpOptions(config.DNSServers),
+				Subnets:      &subnets,
+			},
+		}, dependsOn...)
+	}
+
+	t.pipNames = []string{pip1Name}
+	frontEndPIP := stringValue(existingPIP.ID)
+	if *existingPIPID == "" {
+		t.pipNames = append(t.pipNames, pip2Name)
+		frontEndPIP = idOf("Microsoft.Network/publicIPAddresses", pip2Name)
+	}
+	for _, name := range t.pipNames {
+		t.add("Microsoft.Network/publicIPAddresses", addressClient.APIVersion, name, network.PublicIPAddress{
+			Location:                        to.StringPtr(location),
+			Tags:                            tags,
+			PublicIPAddressPropertiesFormat: newPIPProperties(name),
+		})
+	}
+
+	nirs := []compute.NetworkInterfaceReference{}
+	vmDependsOn := []string{idOf("Microsoft.Storage/storageAccounts", accountName)}
+	for i, s := range layout {
+		configuration := network.InterfaceIPConfigurationPropertiesFormat{
+			Subnet:                    &network.Subnet{ID: to.StringPtr(subnetIDs[i])},
+			PrivateIPAllocationMethod: network.Dynamic,
+		}
+		if s.PrivateIP != "" {
+			configuration.PrivateIPAllocationMethod = network.Static
+			configuration.PrivateIPAddress = to.StringPtr(s.PrivateIP)
+		}
+		nic := network.Interface{
+			Location: to.StringPtr(location),
+			Tags:     tags,
+			InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+				IPConfigurations: &[]network.InterfaceIPConfiguration{{
+					Name:                                     to.StringPtr(fmt.Sprintf("IPconfig%v", i+1)),
+					InterfaceIPConfigurationPropertiesFormat: &configuration,
+				}},
+			},
+		}
+		dependsOn := []string{}
+		if !useExistingNetwork() {
+			dependsOn = append(dependsOn, idOf("Microsoft.Network/virtualNetworks", vNetName))
+		}
+		if s.NIC == nicNameFrontEnd {
+			nic.EnableIPForwarding = to.BoolPtr(true)
+			configuration.Primary = to.BoolPtr(true)
+			configuration.PublicIPAddress = &network.PublicIPAddress{ID: to.StringPtr(frontEndPIP)}
+			if *existingPIPID == "" {
+				dependsOn = append(dependsOn, frontEndPIP)
+			}
+			if name, rules, ok := nicNSGRules(location, s.NIC); ok {
+				id := addNSG(name, rules)
+				nic.NetworkSecurityGroup = &network.SecurityGroup{ID: to.StringPtr(id)}
+				dependsOn = append(dependsOn, id)
+			}
+		}
+		t.add("Microsoft.Network/networkInterfaces", interfacesClient.APIVersion, s.NIC, nic, dependsOn...)
+
+		id := idOf("Microsoft.Network/networkInterfaces", s.NIC)
+		nirs = append(nirs, compute.NetworkInterfaceReference{
+			ID:                                  to.StringPtr(id),
+			NetworkInterfaceReferenceProperties: &compute.NetworkInterfaceReferenceProperties{Primary: to.BoolPtr(s.NIC == nicNameFrontEnd)},
+		})
+		vmDependsOn = append(vmDependsOn, id)
+	}
+
+	t.add("Microsoft.Storage/storageAccounts", accountClient.APIVersion, accountName, storage.AccountCreateParameters{
+		Sku:                               &storage.Sku{Name: storage.StandardLRS},
+		Location:                          to.StringPtr(location),
+		Tags:                              tags,
+		AccountPropertiesCreateParameters: &storage.AccountPropertiesCreateParameters{},
+	})
+	t.add("Microsoft.Compute/virtualMachines", vmClient.APIVersion, vmName, vmModel(location, vmName, accountName, nirs), vmDependsOn...)
+	return t
+}
+
+// armTemplate collects the resources of an ARM template, and the names of the NSGs and public IPs of the topology.
+type armTemplate struct {
+	resources []map[string]interface{}
+	nsgNames  []string
+	pipNames  []string
+}
+
+// deployment returns an incremental deployment of the template.
+func (t *armTemplate) deployment() resources.Deployment {
+	template := map[string]interface{}{
+		"$schema":        "https://schema.management.azure.com/schemas/2015-01-01/deploymentTemplate.json#",
+		"contentVersion": "1.0.0.0",
+		"resources":      t.resources,
+	}
+	return resources.Deployment{Properties: &resources.DeploymentProperties{Template: &template, Mode: resources.Incremental}}
+}
+
+// add declares a resource with the body of an SDK model, created after the resources of dependsOn.
+func (t *armTemplate) add(resourceType, apiVersion, name string, model interface{}, dependsOn ...string) {
+	b, err := json.Marshal(model)
+	onErrorFail(err, "Marshal failed")
+	r := map[string]interface{}{}
+	onErrorFail(json.Unmarshal(b, &r), "Unmarshal failed")
+	r["type"], r["apiVersion"], r["name"] = resourceType, apiVersion, name
+	if len(dependsOn) > 0 {
+		r["dependsOn"] = dependsOn
+	}
+	t.resources = append(t.resources, r)
+}
+
+// templateResourceID returns the template expression of the ID of a resource of the deployment's resource
+// group, with one name per segment of its type, e.g. a VNet's and a subnet's for a subnet.
+func templateResourceID(resourceType string, names ...string) string {
+	id := fmt.Sprintf("[resourceId('%s'", resourceType)
+	for _, n := range names {
+		id += fmt.Sprintf(", '%s'", n)
+	}
+	return id + ")]"
+}
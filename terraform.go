@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/arm/compute"
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/azure-sdk-for-go/arm/storage"
+)
+
+// tfBlock is a Terraform block, e.g. a resource or one of its nested blocks.
+type tfBlock struct {
+	Type   string
+	Labels []string
+	Attrs  [][2]string
+	Blocks []tfBlock
+}
+
+var tfInvalidName = regexp.MustCompile(`[^a-z0-9_-]`)
+
+// attr appends an attribute whose value is already a Terraform expression.
+func (b *tfBlock) attr(name, expr string) {
+	b.Attrs = append(b.Attrs, [2]string{name, expr})
+}
+
+// write writes the block in the layout produced by `terraform fmt`.
+func (b tfBlock) write(buf *bytes.Buffer, depth int) {
+	indent := strings.Repeat("  ", depth)
+	buf.WriteString(indent + b.Type)
+	for _, l := range b.Labels {
+		buf.WriteString(" " + strconv.Quote(l))
+	}
+	buf.WriteString(" {\n")
+
+	width := 0
+	for _, a := range b.Attrs {
+		if len(a[0]) > width {
+			width = len(a[0])
+		}
+	}
+	for _, a := range b.Attrs {
+		fmt.Fprintf(buf, "%s  %-*s = %s\n", indent, width, a[0], a[1])
+	}
+	for _, nested := range b.Blocks {
+		buf.WriteString("\n")
+		nested.write(buf, depth+1)
+	}
+	buf.WriteString(indent + "}\n")
+}
+
+// tfName turns an Azure resource name into a valid Terraform resource name.
+func tfName(name string) string {
+	n := tfInvalidName.ReplaceAllString(strings.ToLower(name), "_")
+	if n == "" || (n[0] >= '0' && n[0] <= '9') || n[0] == '-' {
+		n = "_" + n
+	}
+	return n
+}
+
+// tfList renders a list of string literals.
+func tfList(values []string) string {
+	quoted := []string{}
+	for _, v := range values {
+		quoted = append(quoted, strconv.Quote(v))
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// exportTerraform writes Terraform import blocks and skeleton resource definitions for the created resources,
+// so they can be adopted into a Terraform state with `terraform apply`.
+func exportTerraform(path string) {
+	stepf("Export Terraform import blocks to '%s'\n", path)
+	deployed := recordedResources(runState)
+
+	group, err := groupClient.Get(groupName)
+	onErrorFail(err, "Get failed")
+
+	// Addresses of everything that can be referenced from another resource, keyed by lower-cased resource ID.
+	references := map[string]string{}
+	rgAddress := "azurerm_resource_group." + tfName(groupName)
+	if *existingGroup != "" {
+		// The group isn't the sample's to manage, so it is only read.
+		rgAddress = "data." + rgAddress
+	}
+	references[strings.ToLower(*group.ID)] = rgAddress
+
+	imports := []tfBlock{}
+	resources := []tfBlock{}
+	add := func(address, id string, resource tfBlock) {
+		imports = append(imports, tfBlock{Type: "import", Attrs: [][2]string{
+			{"to", address},
+			{"id", strconv.Quote(id)},
+		}})
+		resources = append(resources, resource)
+	}
+
+	if *existingGroup != "" {
+		rg := tfBlock{Type: "data", Labels: []string{"azurerm_resource_group", tfName(groupName)}}
+		rg.attr("name", strconv.Quote(groupName))
+		resources = append(resources, rg)
+	} else {
+		rg := tfBlock{Type: "resource", Labels: []string{"azurerm_resource_group", tfName(groupName)}}
+		rg.attr("name", strconv.Quote(groupName))
+		rg.attr("location", strconv.Quote(*group.Location))
+		add(rgAddress, *group.ID, rg)
+	}
+
+	for _, r := range deployed {
+		switch m := r.Model.(type) {
+		case network.VirtualNetwork:
+			references[strings.ToLower(r.ID)] = "azurerm_virtual_network." + tfName(r.Name)
+			if m.Subnets != nil {
+				for _, s := range *m.Subnets {
+					references[strings.ToLower(*s.ID)] = "azurerm_subnet." + tfName(r.Name+"_"+*s.Name)
+				}
+			}
+		case network.SecurityGroup:
+			references[strings.ToLower(r.ID)] = "azurerm_network_security_group." + tfName(r.Name)
+		case network.PublicIPAddress:
+			references[strings.ToLower(r.ID)] = "azurerm_public_ip." + tfName(r.Name)
+		case network.Interface:
+			references[strings.ToLower(r.ID)] = "azurerm_network_interface." + tfName(r.Name)
+		case storage.Account:
+			references[strings.ToLower(r.ID)] = "azurerm_storage_account." + tfName(r.Name)
+		}
+	}
+	ref := func(id *string) string {
+		if id == nil {
+			return "null"
+		}
+		if address, ok := references[strings.ToLower(*id)]; ok {
+			return address + ".id"
+		}
+		return strconv.Quote(*id)
+	}
+
+	passwords := false
+	for _, r := range deployed {
+		b := tfBlock{Type: "resource"}
+		children, childIDs := []tfBlock{}, []string{}
+		b.attr("name", strconv.Quote(r.Name))
+		b.attr("resource_group_name", rgAddress+".name")
+
+		switch m := r.Model.(type) {
+		case storage.Account:
+			b.Labels = []string{"azurerm_storage_account", tfName(r.Name)}
+			b.attr("location", strconv.Quote(*m.Location))
+			if m.Sku != nil {
+				sku := strings.SplitN(string(m.Sku.Name), "_", 2)
+				b.attr("account_tier", strconv.Quote(sku[0]))
+				if len(sku) == 2 {
+					b.attr("account_replication_type", strconv.Quote(sku[1]))
+				}
+			}
+
+		case network.VirtualNetwork:
+			b.Labels = []string{"azurerm_virtual_network", tfName(r.Name)}
+			b.attr("location", strconv.Quote(*m.Location))
+			if m.AddressSpace != nil && m.AddressSpace.AddressPrefixes != nil {
+				b.attr("address_space", tfList(*m.AddressSpace.AddressPrefixes))
+			}
+			if m.Subnets != nil {
+				for _, s := range *m.Subnets {
+					// Subnets are named after their VNet too, as VNets in several regions have the same subnets.
+					subnet := tfBlock{Type: "resource", Labels: []string{"azurerm_subnet", tfName(r.Name + "_" + *s.Name)}}
+					subnet.attr("name", strconv.Quote(*s.Name))
+					subnet.attr("resource_group_name", rgAddress+".name")
+					subnet.attr("virtual_network_name", references[strings.ToLower(r.ID)]+".name")
+					if s.AddressPrefix != nil {
+						subnet.attr("address_prefixes", tfList([]string{*s.AddressPrefix}))
+					}
+					children = append(children, subnet)
+					childIDs = append(childIDs, *s.ID)
+					if s.SubnetPropertiesFormat != nil && s.NetworkSecurityGroup != nil {
+						association := tfBlock{Type: "resource", Labels: []string{"azurerm_subnet_network_security_group_association", tfName(r.Name + "_" + *s.Name)}}
+						association.attr("subnet_id", ref(s.ID))
+						association.attr("network_security_group_id", ref(s.NetworkSecurityGroup.ID))
+						children = append(children, association)
+						childIDs = append(childIDs, *s.ID)
+					}
+				}
+			}
+			if m.VirtualNetworkPeerings != nil {
+				for _, p := range *m.VirtualNetworkPeerings {
+					peering := tfBlock{Type: "resource", Labels: []string{"azurerm_virtual_network_peering", tfName(r.Name + "_" + *p.Name)}}
+					peering.attr("name", strconv.Quote(*p.Name))
+					peering.attr("resource_group_name", rgAddress+".name")
+					peering.attr("virtual_network_name", references[strings.ToLower(r.ID)]+".name")
+					if p.RemoteVirtualNetwork != nil {
+						peering.attr("remote_virtual_network_id", ref(p.RemoteVirtualNetwork.ID))
+					}
+					if p.AllowVirtualNetworkAccess != nil {
+						peering.attr("allow_virtual_network_access", strconv.FormatBool(*p.AllowVirtualNetworkAccess))
+					}
+					if p.AllowForwardedTraffic != nil {
+						peering.attr("allow_forwarded_traffic", strconv.FormatBool(*p.AllowForwardedTraffic))
+					}
+					children = append(children, peering)
+					childIDs = append(childIDs, *p.ID)
+				}
+			}
+
+		case network.SecurityGroup:
+			b.Labels = []string{"azurerm_network_security_group", tfName(r.Name)}
+			b.attr("location", strconv.Quote(*m.Location))
+			if m.SecurityRules != nil {
+				for _, rule := range *m.SecurityRules {
+					p := rule.SecurityRulePropertiesFormat
+					if p == nil {
+						continue
+					}
+					sr := tfBlock{Type: "security_rule"}
+					sr.attr("name", strconv.Quote(stringValue(rule.Name)))
+					if p.Priority != nil {
+						sr.attr("priority", strconv.Itoa(int(*p.Priority)))
+					}
+					sr.attr("direction", strconv.Quote(string(p.Direction)))
+					sr.attr("access", strconv.Quote(string(p.Access)))
+					sr.attr("protocol", strconv.Quote(string(p.Protocol)))
+					sr.attr("source_port_range", strconv.Quote(stringValue(p.SourcePortRange)))
+					sr.attr("destination_port_range", strconv.Quote(stringValue(p.DestinationPortRange)))
+					sr.attr("source_address_prefix", strconv.Quote(stringValue(p.SourceAddressPrefix)))
+					sr.attr("destination_address_prefix", strconv.Quote(stringValue(p.DestinationAddressPrefix)))
+					b.Blocks = append(b.Blocks, sr)
+				}
+			}
+
+		case network.PublicIPAddress:
+			b.Labels = []string{"azurerm_public_ip", tfName(r.Name)}
+			b.attr("location", strconv.Quote(*m.Location))
+			b.attr("allocation_method", strconv.Quote(string(m.PublicIPAllocationMethod)))
+			if m.DNSSettings != nil && m.DNSSettings.DomainNameLabel != nil {
+				b.attr("domain_name_label", strconv.Quote(*m.DNSSettings.DomainNameLabel))
+			}
+
+		case network.Interface:
+			b.Labels = []string{"azurerm_network_interface", tfName(r.Name)}
+			b.attr("location", strconv.Quote(*m.Location))
+			if m.EnableIPForwarding != nil {
+				b.attr("enable_ip_forwarding", strconv.FormatBool(*m.EnableIPForwarding))
+			}
+			if m.IPConfigurations != nil {
+				for _, ipConfig := range *m.IPConfigurations {
+					ic := tfBlock{Type: "ip_configuration"}
+					ic.attr("name", strconv.Quote(*ipConfig.Name))
+					if ipConfig.Subnet != nil {
+						ic.attr("subnet_id", ref(ipConfig.Subnet.ID))
+					}
+					ic.attr("private_ip_address_allocation", strconv.Quote(string(ipConfig.PrivateIPAllocationMethod)))
+					if ipConfig.PrivateIPAllocationMethod == network.Static && ipConfig.PrivateIPAddress != nil {
+						ic.attr("private_ip_address", strconv.Quote(*ipConfig.PrivateIPAddress))
+					}
+					if ipConfig.PublicIPAddress != nil {
+						ic.attr("public_ip_address_id", ref(ipConfig.PublicIPAddress.ID))
+					}
+					if ipConfig.Primary != nil {
+						ic.attr("primary", strconv.FormatBool(*ipConfig.Primary))
+					}
+					b.Blocks = append(b.Blocks, ic)
+				}
+			}
+			if m.NetworkSecurityGroup != nil {
+				association := tfBlock{Type: "resource", Labels: []string{"azurerm_network_interface_security_group_association", tfName(r.Name)}}
+				association.attr("network_interface_id", references[strings.ToLower(r.ID)]+".id")
+				association.attr("network_security_group_id", ref(m.NetworkSecurityGroup.ID))
+				children = append(children, association)
+				childIDs = append(childIDs, r.ID+"|"+stringValue(m.NetworkSecurityGroup.ID))
+			}
+
+		case compute.VirtualMachine:
+			b.Labels = []string{"azurerm_virtual_machine", tfName(r.Name)}
+			b.attr("location", strconv.Quote(*m.Location))
+			if m.HardwareProfile != nil {
+				b.attr("vm_size", strconv.Quote(string(m.HardwareProfile.VMSize)))
+			}
+			if m.NetworkProfile != nil && m.NetworkProfile.NetworkInterfaces != nil {
+				ids := []string{}
+				for _, nir := range *m.NetworkProfile.NetworkInterfaces {
+					ids = append(ids, ref(nir.ID))
+					if nir.NetworkInterfaceReferenceProperties != nil && nir.Primary != nil && *nir.Primary {
+						b.attr("primary_network_interface_id", ref(nir.ID))
+					}
+				}
+				b.attr("network_interface_ids", "["+strings.Join(ids, ", ")+"]")
+			}
+			if sp := m.StorageProfile; sp != nil {
+				if image := sp.ImageReference; image != nil {
+					ir := tfBlock{Type: "storage_image_reference"}
+					ir.attr("publisher", strconv.Quote(*image.Publisher))
+					ir.attr("offer", strconv.Quote(*image.Offer))
+					ir.attr("sku", strconv.Quote(*image.Sku))
+					ir.attr("version", strconv.Quote(*image.Version))
+					b.Blocks = append(b.Blocks, ir)
+				}
+				if disk := sp.OsDisk; disk != nil {
+					od := tfBlock{Type: "storage_os_disk"}
+					od.attr("name", strconv.Quote(*disk.Name))
+					if disk.Vhd != nil && disk.Vhd.URI != nil {
+						od.attr("vhd_uri", strconv.Quote(*disk.Vhd.URI))
+					}
+					od.attr("create_option", strconv.Quote(string(disk.CreateOption)))
+					b.Blocks = append(b.Blocks, od)
+				}
+			}
+			if op := m.OsProfile; op != nil {
+				// The password is only set when the VM allows password authentication, as without -ssh-key.
+				passwordless := op.LinuxConfiguration != nil && op.LinuxConfiguration.DisablePasswordAuthentication != nil &&
+					*op.LinuxConfiguration.DisablePasswordAuthentication
+				profile := tfBlock{Type: "os_profile"}
+				profile.attr("computer_name", strconv.Quote(*op.ComputerName))
+				profile.attr("admin_username", strconv.Quote(*op.AdminUsername))
+				if !passwordless {
+					profile.attr("admin_password", "var.admin_password")
+					passwords = true
+				}
+				b.Blocks = append(b.Blocks, profile)
+				linux := tfBlock{Type: "os_profile_linux_config"}
+				linux.attr("disable_password_authentication", strconv.FormatBool(passwordless))
+				if op.LinuxConfiguration != nil && op.LinuxConfiguration.SSH != nil && op.LinuxConfiguration.SSH.PublicKeys != nil {
+					for _, key := range *op.LinuxConfiguration.SSH.PublicKeys {
+						keys := tfBlock{Type: "ssh_keys"}
+						keys.attr("path", strconv.Quote(stringValue(key.Path)))
+						keys.attr("key_data", strconv.Quote(stringValue(key.KeyData)))
+						linux.Blocks = append(linux.Blocks, keys)
+					}
+				}
+				b.Blocks = append(b.Blocks, linux)
+			}
+
+		default:
+			continue
+		}
+		add(b.Labels[0]+"."+b.Labels[1], r.ID, b)
+		for i, child := range children {
+			add(child.Labels[0]+"."+child.Labels[1], childIDs[i], child)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# Generated from the resources created by network-go-manage-network-interface.\n")
+	buf.WriteString("# The resource definitions are skeletons: run `terraform plan` and fill in any reported differences.\n")
+	if passwords {
+		buf.WriteString("\nvariable \"admin_password\" {\n  type      = string\n  sensitive = true\n}\n")
+	}
+	for _, b := range imports {
+		buf.WriteString("\n")
+		b.write(&buf, 0)
+	}
+	for _, b := range resources {
+		buf.WriteString("\n")
+		b.write(&buf, 0)
+	}
+
+	err = ioutil.WriteFile(path, buf.Bytes(), 0644)
+	onErrorFail(err, "WriteFile failed")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/arm/compute"
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// TestExportTerraform exports an existing group with an NSG on a subnet and a NIC, and a VM authorizing an
+// SSH key instead of the password.
+func TestExportTerraform(t *testing.T) {
+	newTestARM(t)
+	createTestGroup(t)
+	savedGroup, savedKey := *existingGroup, *sshKeyPath
+	t.Cleanup(func() { *existingGroup, *sshKeyPath = savedGroup, savedKey })
+	*existingGroup = groupName
+	*sshKeyPath = filepath.Join(t.TempDir(), "id_rsa.pub")
+	if err := ioutil.WriteFile(*sshKeyPath, []byte("ssh-rsa AAAA test\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	nsgID := resourceID("Microsoft.Network/networkSecurityGroups", "nsg")
+	if _, err := nsgClient.CreateOrUpdate(groupName, "nsg", network.SecurityGroup{
+		Location: to.StringPtr(westUS),
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+			SecurityRules: &[]network.SecurityRule{{
+				Name: to.StringPtr("ssh"),
+				SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+					Protocol: network.TCP, SourcePortRange: to.StringPtr("*"), DestinationPortRange: to.StringPtr("22"),
+					SourceAddressPrefix: to.StringPtr("*"), DestinationAddressPrefix: to.StringPtr("*"),
+					Access: network.Allow, Priority: to.Int32Ptr(100), Direction: network.Inbound,
+				},
+			}},
+		},
+	}, nil); err != nil {
+		t.Fatalf("creating the NSG: %v", err)
+	}
+	vNet := testVNet()
+	(*vNet.Subnets)[0].NetworkSecurityGroup = &network.SecurityGroup{ID: to.StringPtr(nsgID)}
+	if _, err := vNetClient.CreateOrUpdate(groupName, "vnet", vNet, nil); err != nil {
+		t.Fatalf("creating the VNet: %v", err)
+	}
+	nic := testNIC()
+	nic.NetworkSecurityGroup = &network.SecurityGroup{ID: to.StringPtr(nsgID)}
+	if _, err := interfacesClient.CreateOrUpdate(groupName, "nic", nic, nil); err != nil {
+		t.Fatalf("creating the NIC: %v", err)
+	}
+	nicID := resourceID("Microsoft.Network/networkInterfaces", "nic")
+	if _, err := vmClient.CreateOrUpdate(groupName, "vm", compute.VirtualMachine{
+		Location: to.StringPtr(westUS),
+		VirtualMachineProperties: &compute.VirtualMachineProperties{
+			OsProfile: &compute.OSProfile{
+				ComputerName: to.StringPtr("vm"), AdminUsername: to.StringPtr(adminUsername),
+				LinuxConfiguration: linuxConfiguration(),
+			},
+			NetworkProfile: &compute.NetworkProfile{NetworkInterfaces: &[]compute.NetworkInterfaceReference{{ID: to.StringPtr(nicID)}}},
+		},
+	}, nil); err != nil {
+		t.Fatalf("creating the VM: %v", err)
+	}
+	for _, r := range []stateResource{
+		{Type: "Microsoft.Network/networkSecurityGroups", Name: "nsg"},
+		{Type: "Microsoft.Network/virtualNetworks", Name: "vnet"},
+		{Type: "Microsoft.Network/networkInterfaces", Name: "nic"},
+		{Type: "Microsoft.Compute/virtualMachines", Name: "vm"},
+	} {
+		r.ID = resourceID(r.Type, r.Name)
+		runState.Resources = append(runState.Resources, r)
+	}
+
+	path := filepath.Join(t.TempDir(), "import.tf")
+	exportTerraform(path)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tf := string(b)
+	for _, want := range []string{
+		`data "azurerm_resource_group" "test-group"`,
+		`resource "azurerm_network_security_group" "nsg"`,
+		`resource "azurerm_subnet" "vnet_subnet"`,
+		`resource "azurerm_subnet_network_security_group_association" "vnet_subnet"`,
+		`resource "azurerm_network_interface_security_group_association" "nic"`,
+		`id = "` + nicID + `|` + nsgID + `"`,
+		`disable_password_authentication = true`,
+		`key_data = "ssh-rsa AAAA test"`,
+	} {
+		if !strings.Contains(tf, want) {
+			t.Errorf("the export has no %s:\n%s", want, tf)
+		}
+	}
+	for _, unwanted := range []string{`resource "azurerm_resource_group"`, "admin_password"} {
+		if strings.Contains(tf, unwanted) {
+			t.Errorf("the export has %s:\n%s", unwanted, tf)
+		}
+	}
+}
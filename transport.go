@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// sampleUserAgent identifies the sample in the User-Agent header of its requests.
+const sampleUserAgent = "network-go-manage-network-interface"
+
+// userAgent appends the sample's identification, version and commit, unless -no-telemetry is set, and
+// -user-agent-suffix to a client's User-Agent.
+func userAgent(base string) string {
+	ua := base
+	if !*noTelemetry {
+		ua += " " + sampleUserAgent + "/" + version + " (" + commit + ")"
+	}
+	if *userAgentSuffix != "" {
+		ua += " " + *userAgentSuffix
+	}
+	return ua
+}
+
+// correlationID is sent to ARM with every request of the run, which files the run's operations in the
+// Activity Log under it. It is recorded in the state file for the history command.
+var correlationID = newCorrelationID()
+
+// newSender returns the HTTP sender shared by the clients and the token refreshes, sending the requests
+// to ARM, or to the fake ARM backend with -offline.
+func newSender() autorest.Sender {
+	if *offline {
+		return newSenderWithTransport(newFakeARM(*offlineStore))
+	}
+	return newSenderWithTransport(newTransport())
+}
+
+// newSenderWithTransport returns a sender sending its requests with transport. Its requests are retried
+// as -retry-attempts says, rate limited, printed at -v and, if they change a resource, recorded in the
+// audit log. Repeated failures open the circuit breaker, operations run with -no-wait stop being polled
+// once accepted, and the others are polled as the configuration says, recorded in the state file while
+// in flight and reported to -progress.
+func newSenderWithTransport(transport http.RoundTripper) autorest.Sender {
+	validateRetryFlags()
+	validateRateLimits()
+	validateCircuitBreaker()
+	validatePolling()
+	jar, _ := cookiejar.New(nil)
+	return withNoWait(withProgressEvents(withOperationTracking(withPollingInterval(withCorrelationID(withCircuitBreaker(withRetries(withRateLimit(logRequests(auditMutations(&http.Client{
+		Jar:       jar,
+		Transport: transport,
+	}))))))))))
+}
+
+// withCorrelationID decorates a sender to send the run's correlation ID with every request to ARM, unless
+// -no-telemetry is set.
+func withCorrelationID(s autorest.Sender) autorest.Sender {
+	return autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+		if !*noTelemetry && !strings.Contains(r.URL.Path, "/oauth2/") && r.Header.Get("x-ms-correlation-request-id") == "" {
+			if r.Header == nil {
+				r.Header = http.Header{}
+			}
+			r.Header.Set("x-ms-correlation-request-id", correlationID)
+		}
+		return s.Do(r)
+	})
+}
+
+// newCorrelationID returns a random version 4 UUID.
+func newCorrelationID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// newTransport returns an HTTP transport sending requests through the proxy given with -proxy,
+// or else the one from HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+func newTransport() *http.Transport {
+	proxy := http.ProxyFromEnvironment
+	if *proxyURL != "" {
+		u, err := url.Parse(*proxyURL)
+		onErrorFail(err, "Parsing -proxy failed")
+		proxy = http.ProxyURL(u)
+	}
+
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
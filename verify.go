@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+)
+
+// networkWatcherAPIVersion is the version of the Network Watcher API, which the SDK has no client for.
+const networkWatcherAPIVersion = "2020-11-01"
+
+// verifyCommand checks the connectivity between the tiers, exiting with status 1 if it isn't as expected.
+func verifyCommand(args []string) {
+	if !verifyTiers(args) {
+		os.Exit(1)
+	}
+}
+
+// verifyTiers checks with Network Watcher that each tier of the layout reaches the next one's private IP on
+// the -ports ports as -expect says, evaluating the NSG rules with IP flow verify and the routes, including
+// user-defined ones, with next hop. It reports whether all checks agreed.
+func verifyTiers(args []string) bool {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	ports := fs.String("ports", "22,80", "comma-separated TCP ports to check between the tiers")
+	expect := fs.String("expect", "Allow", "expected verdict of the NSGs: Allow or Deny")
+	fs.Parse(args)
+	if !strings.EqualFold(*expect, "Allow") && !strings.EqualFold(*expect, "Deny") {
+		fmt.Println("Usage: verify [-ports 22,80] [-expect Allow|Deny]")
+		os.Exit(1)
+	}
+
+	watcher := networkWatcher(westUS)
+	stepf("Verify connectivity between the tiers with Network Watcher '%s'\n", lastSegment(&watcher))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FROM\tTO\tPORT\tNSG VERDICT\tRULE\tNEXT HOP\tRESULT")
+	failed := false
+	for i := 1; i < len(layout); i++ {
+		source, target, ok := tierNICs(layout[i-1], layout[i])
+		if !ok {
+			continue
+		}
+		fromIP := *(*source.IPConfigurations)[0].PrivateIPAddress
+		toIP := *(*target.IPConfigurations)[0].PrivateIPAddress
+		hop := nextHop(watcher, source, fromIP, toIP)
+		for _, port := range strings.Split(*ports, ",") {
+			port = strings.TrimSpace(port)
+			access, rule := ipFlowVerify(watcher, target, fromIP, toIP, port)
+			result := "ok"
+			if !strings.EqualFold(access, *expect) || hop == "None" {
+				result = "UNEXPECTED"
+				failed = true
+			}
+			fmt.Fprintf(w, "%s (%s)\t%s (%s)\t%s\t%s\t%s\t%s\t%s\n", *source.Name, fromIP, *target.Name, toIP, port, access, rule, hop, result)
+		}
+	}
+	w.Flush()
+	if failed {
+		fmt.Printf("Connectivity between the tiers isn't as expected (%s)\n", *expect)
+	}
+	return !failed
+}
+
+// tierNICs returns the NICs of two subnets of the layout, or false if one of them has none or isn't attached to a VM.
+func tierNICs(source, target subnetLayout) (network.Interface, network.Interface, bool) {
+	nics := []network.Interface{}
+	for _, s := range []subnetLayout{source, target} {
+		nic, err := interfacesClient.Get(groupName, s.NIC, "")
+		if err != nil || nic.VirtualMachine == nil {
+			stepf("\tSkip '%s' to '%s', NIC '%s' isn't attached to a VM\n", source.Name, target.Name, s.NIC)
+			return network.Interface{}, network.Interface{}, false
+		}
+		nics = append(nics, nic)
+	}
+	return nics[0], nics[1], true
+}
+
+// networkWatcher returns the ID of the subscription's Network Watcher in location, which Azure creates in
+// NetworkWatcherRG when the first VNet of the region is.
+func networkWatcher(location string) string {
+	var watchers struct {
+		Value []struct {
+			ID       string `json:"id"`
+			Location string `json:"location"`
+		} `json:"value"`
+	}
+	err := armRequest("GET", fmt.Sprintf("subscriptions/%s/providers/Microsoft.Network/networkWatchers", genericClient.SubscriptionID),
+		networkWatcherAPIVersion, nil, nil, &watchers)
+	onErrorFail(err, "Listing the Network Watchers failed")
+	for _, w := range watchers.Value {
+		if strings.EqualFold(w.Location, location) {
+			return w.ID
+		}
+	}
+	onErrorFail(fmt.Errorf("the subscription has no Network Watcher in %s", location), "Verify failed")
+	return ""
+}
+
+// ipFlowVerify returns whether the NSGs of nic let TCP traffic from fromIP in to toIP:port, and the deciding rule.
+func ipFlowVerify(watcher string, nic network.Interface, fromIP, toIP, port string) (access, rule string) {
+	var result struct {
+		Access   string `json:"access"`
+		RuleName string `json:"ruleName"`
+	}
+	err := armRequest("POST", watcher+"/ipFlowVerify", networkWatcherAPIVersion, nil, map[string]interface{}{
+		"targetResourceId":    *nic.VirtualMachine.ID,
+		"targetNicResourceId": *nic.ID,
+		"direction":           "Inbound",
+		"protocol":            "TCP",
+		"localIPAddress":      toIP,
+		"localPort":           port,
+		"remoteIPAddress":     fromIP,
+		"remotePort":          "*",
+	}, &result)
+	onErrorFail(err, "IP flow verify failed")
+	return result.Access, lastSegment(&result.RuleName)
+}
+
+// nextHop returns the type of the next hop of traffic leaving nic from fromIP to toIP, e.g. VnetLocal, or
+// VirtualAppliance when a user-defined route sends it through an appliance.
+func nextHop(watcher string, nic network.Interface, fromIP, toIP string) string {
+	var result struct {
+		NextHopType string `json:"nextHopType"`
+	}
+	err := armRequest("POST", watcher+"/nextHop", networkWatcherAPIVersion, nil, map[string]interface{}{
+		"targetResourceId":     *nic.VirtualMachine.ID,
+		"targetNicResourceId":  *nic.ID,
+		"sourceIPAddress":      fromIP,
+		"destinationIPAddress": toIP,
+	}, &result)
+	onErrorFail(err, "Next hop failed")
+	return result.NextHopType
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/Azure/azure-sdk-for-go/arm/network"
+	"github.com/Azure/go-autorest/autorest"
+)
+
+// Build metadata, set with e.g.
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+func init() {
+	commands = append(commands, command{"version", "print the version of the sample and the SDKs it was built with", printVersion, true})
+}
+
+// printVersion prints the build metadata of the sample and the versions of the SDKs it uses.
+func printVersion(args []string) {
+	fmt.Printf("%s %s\n", sampleUserAgent, version)
+	fmt.Printf("  commit:             %s\n", commit)
+	fmt.Printf("  built:              %s\n", buildDate)
+	fmt.Printf("  go:                 %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Printf("  azure-sdk-for-go:   %s\n", network.Version())
+	fmt.Printf("  go-autorest:        %s\n", autorest.Version())
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is a significant line of a YAML document: its indentation, its content without the indentation
+// and comment, and its 1-based number for errors.
+type yamlLine struct {
+	indent  int
+	content string
+	number  int
+}
+
+// yamlPlain is a plain scalar that reads as a number or a boolean. It is decoded as such, unless it goes
+// into a string, which gets its text as written: a tag "costcenter: 1234" or a name "001".
+type yamlPlain struct {
+	text  string
+	value interface{}
+}
+
+// unmarshalYAML decodes the block-style subset of YAML that topology specs use into v, through JSON: nested
+// mappings and sequences, flow sequences of scalars such as [a, b], single-line plain and quoted scalars,
+// and comments. JSON, which is YAML too, is decoded as is. Anything else, such as flow mappings, nested flow
+// sequences, multi-line scalars, anchors, tags and several documents, is an error rather than misread.
+func unmarshalYAML(data []byte, v interface{}) error {
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "{") {
+		return json.Unmarshal(data, v)
+	}
+	lines := []yamlLine{}
+	for i, raw := range strings.Split(string(data), "\n") {
+		raw = strings.TrimRight(stripYAMLComment(raw), " \t\r")
+		content := strings.TrimLeft(raw, " ")
+		if content == "" {
+			continue
+		}
+		if content == "---" || content == "..." {
+			if len(lines) > 0 {
+				return fmt.Errorf("line %d: several documents aren't supported", i+1)
+			}
+			continue
+		}
+		if strings.HasPrefix(content, "\t") {
+			return fmt.Errorf("line %d: YAML is indented with spaces, not tabs", i+1)
+		}
+		lines = append(lines, yamlLine{indent: len(raw) - len(content), content: content, number: i + 1})
+	}
+	if len(lines) == 0 {
+		return json.Unmarshal([]byte("null"), v)
+	}
+	value, next, err := parseYAMLBlock(lines, 0)
+	if err != nil {
+		return err
+	}
+	if next < len(lines) {
+		return yamlIndentationError(lines[next])
+	}
+	b, err := json.Marshal(resolveYAML(value, reflect.TypeOf(v)))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// resolveYAML replaces the plain scalars of a parsed value with their text where the type t they are decoded
+// into is a string, and with their number or boolean elsewhere.
+func resolveYAML(value interface{}, t reflect.Type) interface{} {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch value := value.(type) {
+	case yamlPlain:
+		if t != nil && t.Kind() == reflect.String {
+			return value.text
+		}
+		return value.value
+	case []interface{}:
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		}
+		for i, item := range value {
+			value[i] = resolveYAML(item, elem)
+		}
+	case map[string]interface{}:
+		for key, item := range value {
+			var elem reflect.Type
+			if t != nil && t.Kind() == reflect.Map {
+				elem = t.Elem()
+			} else if t != nil && t.Kind() == reflect.Struct {
+				elem = jsonFieldType(t, key)
+			}
+			value[key] = resolveYAML(item, elem)
+		}
+	}
+	return value
+}
+
+// jsonFieldType returns the type of the field of struct type t that encoding/json decodes key into, or nil.
+func jsonFieldType(t reflect.Type, key string) reflect.Type {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if strings.EqualFold(name, key) {
+			return field.Type
+		}
+	}
+	return nil
+}
+
+// parseYAMLBlock parses the mapping or sequence starting at lines[i], returning it and the index of the
+// first line after it.
+func parseYAMLBlock(lines []yamlLine, i int) (interface{}, int, error) {
+	indent := lines[i].indent
+	if isYAMLItem(lines[i].content) {
+		items := []interface{}{}
+		for i < len(lines) && lines[i].indent == indent && isYAMLItem(lines[i].content) {
+			rest := strings.TrimLeft(strings.TrimPrefix(lines[i].content, "-"), " ")
+			var item interface{}
+			var err error
+			switch {
+			case rest == "":
+				// The item is the block indented below the dash.
+				if i+1 < len(lines) && lines[i+1].indent > indent {
+					item, i, err = parseYAMLBlock(lines, i+1)
+				} else {
+					i++
+				}
+			case yamlKey(rest) != "" && !strings.ContainsAny(rest[:1], "{["):
+				// "- key: value" starts a mapping indented as far as its first key.
+				keyIndent := indent + len(lines[i].content) - len(rest)
+				lines[i] = yamlLine{indent: keyIndent, content: rest, number: lines[i].number}
+				item, i, err = parseYAMLBlock(lines, i)
+			default:
+				item, err = parseYAMLScalar(rest, lines[i].number)
+				if i++; err == nil && i < len(lines) && lines[i].indent > indent {
+					err = yamlIndentationError(lines[i])
+				}
+			}
+			if err != nil {
+				return nil, i, err
+			}
+			items = append(items, item)
+		}
+		return items, i, nil
+	}
+
+	mapping := map[string]interface{}{}
+	for i < len(lines) && lines[i].indent == indent && !isYAMLItem(lines[i].content) {
+		line := lines[i]
+		key := yamlKey(line.content)
+		switch {
+		case line.content == "?" || strings.HasPrefix(line.content, "? "):
+			return nil, i, fmt.Errorf("line %d: complex keys aren't supported", line.number)
+		case key == "":
+			return nil, i, fmt.Errorf("line %d: expected 'key: value'", line.number)
+		case strings.ContainsAny(key[:1], "{["):
+			return nil, i, fmt.Errorf("line %d: flow mappings aren't supported", line.number)
+		case strings.ContainsAny(key[:1], "&*!"):
+			return nil, i, fmt.Errorf("line %d: anchors, aliases and tags aren't supported", line.number)
+		}
+		if _, ok := mapping[key]; ok {
+			return nil, i, fmt.Errorf("line %d: duplicate key '%s'", line.number, key)
+		}
+		rest := strings.TrimSpace(line.content[len(key)+1:])
+		i++
+		switch {
+		case rest != "":
+			value, err := parseYAMLScalar(rest, line.number)
+			if err != nil {
+				return nil, i, err
+			}
+			if i < len(lines) && lines[i].indent > indent {
+				return nil, i, yamlIndentationError(lines[i])
+			}
+			mapping[unquoteYAMLKey(key)] = value
+		case i < len(lines) && (lines[i].indent > indent || lines[i].indent == indent && isYAMLItem(lines[i].content)):
+			// A sequence may be indented as far as its key.
+			value, next, err := parseYAMLBlock(lines, i)
+			if err != nil {
+				return nil, next, err
+			}
+			mapping[unquoteYAMLKey(key)] = value
+			i = next
+		default:
+			mapping[unquoteYAMLKey(key)] = nil
+		}
+	}
+	return mapping, i, nil
+}
+
+// yamlIndentationError returns the error of a line indented further than the line before it, which is a
+// continuation of its multi-line scalar unless the line before it starts a block.
+func yamlIndentationError(line yamlLine) error {
+	return fmt.Errorf("line %d: unexpected indentation, multi-line scalars aren't supported", line.number)
+}
+
+// isYAMLItem reports whether content is an item of a block sequence.
+func isYAMLItem(content string) bool {
+	return content == "-" || strings.HasPrefix(content, "- ")
+}
+
+// yamlKey returns the key of a "key: value" or "key:" line, or "" if content isn't one.
+func yamlKey(content string) string {
+	if strings.HasPrefix(content, "\"") || strings.HasPrefix(content, "'") {
+		end := strings.Index(content[1:], content[:1])
+		if end < 0 || !strings.HasPrefix(content[end+2:], ":") {
+			return ""
+		}
+		return content[:end+2]
+	}
+	for i := 0; i < len(content); i++ {
+		if content[i] == ':' && (i+1 == len(content) || content[i+1] == ' ') {
+			return content[:i]
+		}
+	}
+	return ""
+}
+
+// unquoteYAMLKey removes the quotes around a quoted key.
+func unquoteYAMLKey(key string) string {
+	if len(key) >= 2 && (key[0] == '"' || key[0] == '\'') {
+		return key[1 : len(key)-1]
+	}
+	return key
+}
+
+// parseYAMLScalar parses a plain, quoted or flow sequence value. Plain values are booleans, null, numbers
+// or else strings.
+func parseYAMLScalar(s string, number int) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("line %d: unterminated flow sequence", number)
+		}
+		parts, err := splitYAMLFlow(strings.TrimSpace(s[1:len(s)-1]), number)
+		if err != nil {
+			return nil, err
+		}
+		items := []interface{}{}
+		for _, part := range parts {
+			if yamlKey(part) != "" && !strings.ContainsAny(part[:1], "\"'") {
+				return nil, fmt.Errorf("line %d: flow mappings aren't supported", number)
+			}
+			item, err := parseYAMLScalar(part, number)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case strings.HasPrefix(s, "\""):
+		unquoted, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid quoted string %s", number, s)
+		}
+		return unquoted, nil
+	case strings.HasPrefix(s, "'"):
+		if closingYAMLQuote(s, 0) != len(s)-1 {
+			return nil, fmt.Errorf("line %d: invalid quoted string %s", number, s)
+		}
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	case strings.HasPrefix(s, "{"), strings.HasPrefix(s, "}"), strings.HasPrefix(s, "]"):
+		return nil, fmt.Errorf("line %d: flow mappings aren't supported", number)
+	case strings.HasPrefix(s, "&"), strings.HasPrefix(s, "*"), strings.HasPrefix(s, "!"):
+		return nil, fmt.Errorf("line %d: anchors, aliases and tags aren't supported", number)
+	case strings.HasPrefix(s, "|"), strings.HasPrefix(s, ">"):
+		return nil, fmt.Errorf("line %d: multi-line scalars aren't supported", number)
+	}
+	switch s {
+	case "true", "True":
+		return yamlPlain{s, true}, nil
+	case "false", "False":
+		return yamlPlain{s, false}, nil
+	case "null", "~":
+		return nil, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return yamlPlain{s, n}, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return yamlPlain{s, f}, nil
+	}
+	return s, nil
+}
+
+// splitYAMLFlow splits the inside of a flow sequence at its commas, leaving those in quoted items alone.
+// Nested flow sequences and flow mappings aren't supported.
+func splitYAMLFlow(inner string, number int) ([]string, error) {
+	parts := []string{}
+	if inner == "" {
+		return parts, nil
+	}
+	start := 0
+	for i := 0; i < len(inner); i++ {
+		switch c := inner[i]; c {
+		case '"', '\'':
+			if strings.TrimSpace(inner[start:i]) != "" {
+				// A quote within a plain item, e.g. [it's], is part of it.
+				continue
+			}
+			end := closingYAMLQuote(inner, i)
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated quoted string in flow sequence", number)
+			}
+			i = end
+		case '[', ']', '{', '}':
+			return nil, fmt.Errorf("line %d: nested flow sequences and flow mappings aren't supported", number)
+		case ',':
+			parts = append(parts, strings.TrimSpace(inner[start:i]))
+			start = i + 1
+		}
+	}
+	return append(parts, strings.TrimSpace(inner[start:])), nil
+}
+
+// closingYAMLQuote returns the index of the quote closing the string quoted at s[start], or -1 if it isn't
+// closed. Double-quoted strings escape with a backslash, single-quoted ones by doubling the quote.
+func closingYAMLQuote(s string, start int) int {
+	quote := s[start]
+	for i := start + 1; i < len(s); i++ {
+		switch {
+		case quote == '"' && s[i] == '\\':
+			i++
+		case s[i] != quote:
+		case quote == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		default:
+			return i
+		}
+	}
+	return -1
+}
+
+// stripYAMLComment removes a # comment from a line, leaving # inside quotes, escaped quotes included, and
+// within words alone. A line with an unterminated quote is left whole for the parsing to reject.
+func stripYAMLComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" \t[,:", line[i-1]) >= 0):
+			if i = closingYAMLQuote(line, i); i < 0 {
+				return line
+			}
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshalYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string // the same document as JSON
+	}{
+		{"empty", "", `null`},
+		{"comments only", "# nothing\n---\n", `null`},
+		{"JSON", `{"a": [1, "b"]}`, `{"a": [1, "b"]}`},
+		{"scalars", `
+string: text with spaces
+int: 42
+float: 1.5
+yes: true
+no: False
+none: ~
+empty:
+`, `{"string": "text with spaces", "int": 42, "float": 1.5, "yes": true, "no": false, "none": null, "empty": null}`},
+		{"quoted scalars", `
+double: "a \"quoted\" # not a comment"
+single: 'it''s # not a comment'
+number: "42"
+"quoted key": x
+`, `{"double": "a \"quoted\" # not a comment", "single": "it's # not a comment", "number": "42", "quoted key": "x"}`},
+		{"comments", `
+# a topology
+vnet: front # trailing comment
+quoted: "value" # after a quoted value
+single: 'value'	# after a tab
+url: http://example.com/#anchor
+`, `{"vnet": "front", "quoted": "value", "single": "value", "url": "http://example.com/#anchor"}`},
+		{"nested mappings", `
+vnet:
+  name: front
+  subnet:
+    prefix: 10.0.0.0/24
+`, `{"vnet": {"name": "front", "subnet": {"prefix": "10.0.0.0/24"}}}`},
+		{"sequences", `
+nics:
+  - nic1
+  - name: nic2
+    subnet: back
+  -
+    name: nic3
+list:
+- indented as far as its key
+`, `{"nics": ["nic1", {"name": "nic2", "subnet": "back"}, {"name": "nic3"}], "list": ["indented as far as its key"]}`},
+		{"flow sequences", `
+empty: []
+prefixes: [10.0.0.0/16, 10.1.0.0/16]
+quoted: ["a, b", 'c, d', it's]
+`, `{"empty": [], "prefixes": ["10.0.0.0/16", "10.1.0.0/16"], "quoted": ["a, b", "c, d", "it's"]}`},
+		{"document start", "---\na: 1\n", `{"a": 1}`},
+	}
+	for _, tt := range tests {
+		var got, want interface{}
+		if err := unmarshalYAML([]byte(tt.yaml), &got); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+			t.Fatalf("%s: bad test JSON: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %#v, want %#v", tt.name, got, want)
+		}
+	}
+}
+
+func TestUnmarshalYAMLUnsupported(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string // in the error
+	}{
+		{"flow mapping", "vnet: {name: front}", "flow mappings"},
+		{"flow mapping item", "- {name: front}", "flow mappings"},
+		{"nested flow sequence", "a: [[1, 2], [3]]", "nested flow"},
+		{"flow mapping in sequence", "a: [{b: 1}]", "nested flow"},
+		{"single-pair flow mapping", "a: [b: 1]", "flow mappings"},
+		{"unterminated flow sequence", "a: [1, 2", "unterminated"},
+		{"literal scalar", "a: |\n  line 1\n  line 2", "multi-line"},
+		{"folded scalar", "a: >-\n  line 1", "multi-line"},
+		{"plain continuation", "a: line 1\n  line 2", "multi-line"},
+		{"item continuation", "- line 1\n  line 2", "multi-line"},
+		{"nested continuation", "a:\n  b: line 1\n    line 2\nc: 1", "multi-line"},
+		{"unterminated quote", `a: "line 1`, "invalid quoted"},
+		{"text after a quoted value", `a: "value" trailing`, "invalid quoted"},
+		{"text after a single-quoted value", `a: 'value' trailing`, "invalid quoted"},
+		{"anchor", "a: &default\n  b: 1", "anchors"},
+		{"alias", "a: *default", "aliases"},
+		{"anchored item", "- &first a", "anchors"},
+		{"anchored key", "&a key: 1", "anchors"},
+		{"merge key", "a:\n  <<: *default", "aliases"},
+		{"tag", "a: !!str 1", "tags"},
+		{"complex key", "? a\n: b", "complex keys"},
+		{"several documents", "a: 1\n---\nb: 2", "several documents"},
+		{"duplicate key", "a: 1\na: 2", "duplicate key"},
+		{"tab", "a:\n\tb: 1", "tabs"},
+	}
+	for _, tt := range tests {
+		var got interface{}
+		err := unmarshalYAML([]byte(tt.yaml), &got)
+		if err == nil {
+			t.Errorf("%s: got %#v, want an error", tt.name, got)
+		} else if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %q, want one about %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// TestUnmarshalYAMLTopology decodes a spec whose plain scalars read as numbers and booleans, keeping their
+// text in the string fields and their value in the others.
+func TestUnmarshalYAMLTopology(t *testing.T) {
+	var spec topologySpec
+	err := unmarshalYAML([]byte(`
+resourceGroup: 2024
+vnets:
+  - name: 001
+    addressSpace: [10.0.0.0/16]
+    subnets:
+      - name: true
+        addressPrefix: 10.0.0.0/24
+publicIps:
+  - name: 1.50
+    tags:
+      costcenter: 1234
+      enabled: yes
+nics:
+  - name: nic
+    subnet: 001/true
+    ipForwarding: true
+`), &spec)
+	if err != nil {
+		t.Fatalf("unmarshalYAML: %v", err)
+	}
+	want := topologySpec{
+		ResourceGroup: "2024",
+		VNets: []vnetSpec{{
+			Name: "001", AddressSpace: []string{"10.0.0.0/16"},
+			Subnets: []subnetSpec{{Name: "true", AddressPrefix: "10.0.0.0/24"}},
+		}},
+		PublicIPs: []pipSpec{{Name: "1.50", Tags: map[string]string{"costcenter": "1234", "enabled": "yes"}}},
+		NICs:      []nicSpec{{Name: "nic", Subnet: "001/true", IPForwarding: true}},
+	}
+	if !reflect.DeepEqual(spec, want) {
+		t.Errorf("got %+v, want %+v", spec, want)
+	}
+
+	if err := unmarshalYAML([]byte("nics:\n  - name: nic\n    ipForwarding: 1\n"), &spec); err == nil {
+		t.Errorf("decoding a number into a boolean succeeded, want an error")
+	}
+}